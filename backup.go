@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/hooks"
+)
+
+// runBackup copies the database to path, or into the rotated backups
+// directory when no path is given. It is safe while the TUI is running.
+func runBackup(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: apollo backup [path]")
+		return 2
+	}
+
+	cfg, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	var dest string
+	if len(args) == 0 {
+		dest, err = db.BackupInto(database, config.BackupDir(), cfg.Backups.Keep)
+	} else {
+		dest = config.ExpandHome(args[0])
+		if info, statErr := os.Stat(dest); statErr == nil && info.IsDir() {
+			dest = filepath.Join(dest, "apollo-backup.db")
+		}
+		err = db.Backup(database, dest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	fmt.Printf("backed up %s to %s\n", config.DBPath(), dest)
+	return 0
+}
+
+// runRestore swaps a backup in for the database. The backup is checked
+// first, and the database it replaces is kept beside it.
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	force := fs.Bool("force", false, "restore even if an apollo process seems to be running")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apollo restore [-force] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if !*force && hooks.Running(config.SocketPath()) {
+		fmt.Fprintln(os.Stderr, "restore: apollo is running; quit it first")
+		return 1
+	}
+
+	src := config.ExpandHome(fs.Arg(0))
+	version, err := db.CheckBackup(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	saved, err := db.Restore(src, config.DBPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	if saved != "" {
+		fmt.Printf("previous database saved to %s\n", saved)
+	}
+	fmt.Printf("restored %s (schema v%d) to %s\n", src, version, config.DBPath())
+	return 0
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/db"
+)
+
+// openDatabase loads the config and opens the database for a subcommand.
+func openDatabase() (config.Config, *sql.DB, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return cfg, nil, fmt.Errorf("config: %w", err)
+	}
+	if err := os.MkdirAll(config.ApolloDir(), 0755); err != nil {
+		return cfg, nil, err
+	}
+	database, err := db.Open(config.DBPath())
+	if err != nil {
+		return cfg, nil, fmt.Errorf("db: %w", err)
+	}
+	return cfg, database, nil
+}
+
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	days := fs.Int("days", 0, "retire reviewed and ignored commits untouched for this many days (default: retention.days)")
+	purge := fs.Bool("purge", false, "keep only the hash and status of retired commits (default: retention.purge)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gc: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	if *days == 0 {
+		*days = cfg.Retention.Days
+	}
+	if !*purge {
+		*purge = cfg.Retention.Purge
+	}
+
+	if *days > 0 {
+		n, err := db.ArchiveCommits(database, time.Now().AddDate(0, 0, -*days), *purge)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gc: %v\n", err)
+			return 1
+		}
+		verb := "archived"
+		if *purge {
+			verb = "purged"
+		}
+		fmt.Printf("%s %d commits untouched for %d days\n", verb, n, *days)
+	}
+
+	before, after, err := db.Compact(database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gc: compact: %v\n", err)
+		return 1
+	}
+	fmt.Printf("compacted %s: %s -> %s\n", config.DBPath(), formatSize(before), formatSize(after))
+	return 0
+}
+
+func runArchive(args []string) int {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	repo := fs.String("repo", "", "only show commits from this repo path")
+	limit := fs.Int("n", 50, "show at most this many commits")
+	verbose := fs.Bool("v", false, "show bodies, notes, approvers, labels and files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apollo archive [-repo path] [-n limit] [-v] [query]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	_, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archive: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	var repoIDs []int64
+	if *repo != "" {
+		abs, err := filepath.Abs(config.ExpandHome(*repo))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "archive: %v\n", err)
+			return 1
+		}
+		r, err := db.GetRepoByPath(database, abs)
+		if err != nil || r == nil {
+			fmt.Fprintf(os.Stderr, "archive: %s is not tracked\n", *repo)
+			return 1
+		}
+		repoIDs = []int64{r.ID}
+	}
+
+	commits, err := db.ListArchived(database, repoIDs, strings.Join(fs.Args(), " "), *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archive: %v\n", err)
+		return 1
+	}
+	for _, c := range commits {
+		fmt.Printf("%s  %-10s  %-10s  %s  %-16s  %s\n", c.Hash[:min(7, len(c.Hash))], c.Status,
+			c.RepoName, c.CommittedAt.Format("2006-01-02"), c.Author, c.Subject)
+		if !*verbose {
+			continue
+		}
+		if c.Body != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(strings.TrimSpace(c.Body), "\n", "\n    "))
+		}
+		if c.Note != "" {
+			fmt.Printf("    note: %s\n", c.Note)
+		}
+		if len(c.Approvers) > 0 {
+			fmt.Printf("    approved by: %s\n", strings.Join(c.Approvers, ", "))
+		}
+		if len(c.Labels) > 0 {
+			names := make([]string, len(c.Labels))
+			for i, l := range c.Labels {
+				names[i] = l.Name
+			}
+			fmt.Printf("    labels: %s\n", strings.Join(names, ", "))
+		}
+		if len(c.Files) > 0 {
+			fmt.Printf("    files: %s\n", strings.Join(c.Files, ", "))
+		}
+		fmt.Printf("    archived %s\n", c.ArchivedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return 0
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
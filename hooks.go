@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/hooks"
+)
+
+const hooksUsage = `usage:
+  apollo hooks install <repo>...
+  apollo hooks uninstall <repo>...
+  apollo hooks status <repo>...`
+
+func runHooks(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, hooksUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "install":
+		bin, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hooks: %v\n", err)
+			return 1
+		}
+		return eachRepo(args[1:], func(path string) error {
+			if err := hooks.Install(path, bin); err != nil {
+				return err
+			}
+			fmt.Printf("installed hooks in %s\n", path)
+			return nil
+		})
+	case "uninstall":
+		return eachRepo(args[1:], func(path string) error {
+			if err := hooks.Uninstall(path); err != nil {
+				return err
+			}
+			fmt.Printf("removed hooks from %s\n", path)
+			return nil
+		})
+	case "status":
+		return eachRepo(args[1:], func(path string) error {
+			state := "not installed"
+			if hooks.Installed(path) {
+				state = "installed"
+			}
+			fmt.Printf("%s: %s\n", path, state)
+			return nil
+		})
+	case "notify":
+		return runHookNotify(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, hooksUsage)
+		return 2
+	}
+}
+
+func eachRepo(paths []string, fn func(string) error) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, hooksUsage)
+		return 2
+	}
+	code := 0
+	for _, p := range paths {
+		abs, err := filepath.Abs(config.ExpandHome(p))
+		if err == nil {
+			err = fn(abs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hooks: %s: %v\n", p, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// runHookNotify is invoked by the installed hook scripts. It never fails the
+// git operation: without a listening Apollo the next start catches up.
+func runHookNotify(args []string) int {
+	if len(args) == 0 {
+		return 0
+	}
+	repo, err := hooks.RepoRoot()
+	if err != nil {
+		return 0
+	}
+	n, ok, err := hooks.Parse(repo, args[0], args[1:], os.Stdin)
+	if err != nil || !ok {
+		return 0
+	}
+	// One set of hooks serves every profile: each running Apollo ignores
+	// repos it doesn't track.
+	profiles, err := config.ListProfiles()
+	if err != nil {
+		profiles = []string{config.Profile()}
+	}
+	for _, name := range profiles {
+		if err := hooks.Send(config.ProfileSocketPath(name), n); err != nil && !errors.Is(err, hooks.ErrNoListener) {
+			fmt.Fprintf(os.Stderr, "apollo: notify %s: %v\n", name, err)
+		}
+	}
+	return 0
+}
@@ -6,14 +6,81 @@ import (
 	"strconv"
 	"strings"
 
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/pelletier/go-toml/v2"
 )
 
+type ScanRoot struct {
+	Path     string   `toml:"path"`
+	MaxDepth int      `toml:"max_depth"`
+	Ignore   []string `toml:"ignore"`
+}
+
+// LabelRule labels new commits automatically. Every condition given must
+// match: Subject, Author and Branch are regular expressions, Paths are globs
+// tried against each file the commit touched.
+type LabelRule struct {
+	Name    string   `toml:"name"`
+	Label   string   `toml:"label"`
+	Color   string   `toml:"color"`
+	Subject string   `toml:"subject"`
+	Author  string   `toml:"author"`
+	Branch  string   `toml:"branch"`
+	Paths   []string `toml:"paths"`
+}
+
+// Retention retires reviewed and ignored commits nobody has touched for
+// Days days, archiving them or, with Purge, dropping everything but their
+// hash and status. Zero Days keeps everything. IntervalHours is how often
+// Apollo runs it in the background.
+type Retention struct {
+	Days          int  `toml:"days"`
+	Purge         bool `toml:"purge"`
+	IntervalHours int  `toml:"interval_hours"`
+}
+
+// Notifications controls the desktop notification sent for each new commit.
+// Off silences them; Prefix, e.g. "[work]", starts every title so
+// notifications from different profiles can be told apart.
+type Notifications struct {
+	Off    bool   `toml:"off"`
+	Prefix string `toml:"prefix"`
+}
+
+// Backups keeps Keep rotated copies of the database in BackupDir, taking a
+// new one every IntervalHours while Apollo runs. Zero Keep turns them off.
+type Backups struct {
+	Keep          int `toml:"keep"`
+	IntervalHours int `toml:"interval_hours"`
+}
+
 type Config struct {
-	RepoPath   string   `toml:"repo_path"`
-	RepoPaths  []string `toml:"repo_paths"`
-	SeedDepth  int      `toml:"seed_depth"`
-	DebounceMs int      `toml:"debounce_ms"`
+	RepoPath       string     `toml:"repo_path"`
+	RepoPaths      []string   `toml:"repo_paths"`
+	SeedDepth      int        `toml:"seed_depth"`
+	DebounceMs     int        `toml:"debounce_ms"`
+	MaxLatencyMs   int        `toml:"max_latency_ms"`
+	PollPaths      []string   `toml:"poll_paths"`
+	PollIntervalMs int        `toml:"poll_interval_ms"`
+	ScanRoots      []ScanRoot `toml:"scan_roots"`
+	PausedPaths    []string   `toml:"paused_paths"`
+	// ExcludedPaths are repos removed from Apollo that discovery leaves
+	// alone, though they are under a scan root.
+	ExcludedPaths []string `toml:"excluded_paths"`
+	// ShareReview makes a review apply to every repo holding the same
+	// commit, e.g. a fork and its upstream.
+	ShareReview   bool          `toml:"share_review"`
+	LabelRules    []LabelRule   `toml:"label_rules"`
+	Retention     Retention     `toml:"retention"`
+	Backups       Backups       `toml:"backups"`
+	Notifications Notifications `toml:"notifications"`
+	// Reviewer is recorded against every review decision. Load fills it
+	// from git's user.name and user.email when it isn't set; with neither,
+	// the board refuses decisions that would count as approvals.
+	Reviewer string `toml:"reviewer"`
+	// RequiredApprovals maps repo paths to how many distinct reviewers must
+	// approve a commit there. Repos not listed need one.
+	RequiredApprovals map[string]int `toml:"required_approvals"`
 }
 
 func (c Config) ResolvedPaths() []string {
@@ -39,23 +106,89 @@ func (c Config) ResolvedPaths() []string {
 	return result
 }
 
+func (c Config) ResolvedScanRoots() []ScanRoot {
+	var result []ScanRoot
+	for _, r := range c.ScanRoots {
+		p := ExpandHome(strings.TrimSpace(r.Path))
+		if p == "" {
+			continue
+		}
+		r.Path = filepath.Clean(p)
+		result = append(result, r)
+	}
+	return result
+}
+
+func (c Config) ShouldPoll(path string) bool {
+	for _, p := range c.PollPaths {
+		if ExpandHome(strings.TrimSpace(p)) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) IsPaused(path string) bool {
+	for _, p := range c.PausedPaths {
+		if ExpandHome(strings.TrimSpace(p)) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) IsExcluded(path string) bool {
+	for _, p := range c.ExcludedPaths {
+		if ExpandHome(strings.TrimSpace(p)) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) ApprovalsFor(path string) int {
+	for p, n := range c.RequiredApprovals {
+		if ExpandHome(strings.TrimSpace(p)) == path {
+			return max(n, 1)
+		}
+	}
+	return 1
+}
+
 func ApolloDir() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".apollo")
+	return ProfileDir(profile)
 }
 
 func ConfigPath() string {
 	return filepath.Join(ApolloDir(), "config.toml")
 }
 
+func SocketPath() string {
+	return ProfileSocketPath(profile)
+}
+
+// ProfileSocketPath is where an Apollo running under the named profile
+// listens for hook notifications.
+func ProfileSocketPath(name string) string {
+	return filepath.Join(ProfileDir(name), "apollo.sock")
+}
+
 func DBPath() string {
 	return filepath.Join(ApolloDir(), "apollo.db")
 }
 
+func BackupDir() string {
+	return filepath.Join(ApolloDir(), "backups")
+}
+
 func Defaults() Config {
 	return Config{
-		SeedDepth:  50,
-		DebounceMs: 300,
+		SeedDepth:      50,
+		DebounceMs:     300,
+		MaxLatencyMs:   2000,
+		PollIntervalMs: 2000,
+		Retention:      Retention{IntervalHours: 24},
+		Backups:        Backups{Keep: 7, IntervalHours: 24},
 	}
 }
 
@@ -75,9 +208,30 @@ func Load() (Config, error) {
 
 	applyEnvOverrides(&cfg)
 	cfg.RepoPath = ExpandHome(cfg.RepoPath)
+	if cfg.Reviewer = strings.TrimSpace(cfg.Reviewer); cfg.Reviewer == "" {
+		cfg.Reviewer = GitUser()
+	}
 	return cfg, nil
 }
 
+// GitUser returns the global git identity as "Name <email>", or whichever
+// half of it is set, or "" when git has none.
+func GitUser() string {
+	c, err := gitconfig.LoadConfig(gitconfig.GlobalScope)
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(c.User.Name)
+	email := strings.TrimSpace(c.User.Email)
+	switch {
+	case name != "" && email != "":
+		return name + " <" + email + ">"
+	case email != "":
+		return "<" + email + ">"
+	}
+	return name
+}
+
 func Save(cfg Config) error {
 	if err := os.MkdirAll(ApolloDir(), 0755); err != nil {
 		return err
@@ -89,6 +243,43 @@ func Save(cfg Config) error {
 	return os.WriteFile(ConfigPath(), data, 0600)
 }
 
+// Update applies fn to the config as stored on disk, without env overrides or
+// command-line repos, and saves it. Runtime edits go through here so they
+// persist without capturing transient settings.
+func Update(fn func(*Config)) error {
+	cfg := Defaults()
+	data, err := os.ReadFile(ConfigPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := toml.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+	}
+	fn(&cfg)
+	return Save(cfg)
+}
+
+func AddPath(paths []string, path string) []string {
+	for _, p := range paths {
+		if ExpandHome(strings.TrimSpace(p)) == path {
+			return paths
+		}
+	}
+	return append(paths, path)
+}
+
+func RemovePath(paths []string, path string) []string {
+	var result []string
+	for _, p := range paths {
+		if ExpandHome(strings.TrimSpace(p)) != path {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("APOLLO_REPO_PATH"); v != "" {
 		cfg.RepoPath = v
@@ -96,6 +287,9 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("APOLLO_REPO_PATHS"); v != "" {
 		cfg.RepoPaths = strings.Split(v, ",")
 	}
+	if v := os.Getenv("APOLLO_REVIEWER"); v != "" {
+		cfg.Reviewer = v
+	}
 	if v := os.Getenv("APOLLO_SEED_DEPTH"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.SeedDepth = n
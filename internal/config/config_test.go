@@ -14,6 +14,12 @@ func TestDefaults(t *testing.T) {
 	if cfg.DebounceMs != 300 {
 		t.Errorf("DebounceMs = %d, want 300", cfg.DebounceMs)
 	}
+	if cfg.MaxLatencyMs != 2000 {
+		t.Errorf("MaxLatencyMs = %d, want 2000", cfg.MaxLatencyMs)
+	}
+	if cfg.PollIntervalMs != 2000 {
+		t.Errorf("PollIntervalMs = %d, want 2000", cfg.PollIntervalMs)
+	}
 }
 
 func TestLoadMissingFile(t *testing.T) {
@@ -156,3 +162,162 @@ func TestEnvOverrideRepoPaths(t *testing.T) {
 		t.Errorf("RepoPaths = %v", cfg.RepoPaths)
 	}
 }
+
+func TestShouldPoll(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	cfg := Config{PollPaths: []string{"/mnt/nfs/repo", "~/share"}}
+	if !cfg.ShouldPoll("/mnt/nfs/repo") {
+		t.Error("expected /mnt/nfs/repo to poll")
+	}
+	if !cfg.ShouldPoll(filepath.Join(home, "share")) {
+		t.Error("expected ~/share to poll")
+	}
+	if cfg.ShouldPoll("/local/repo") {
+		t.Error("/local/repo should not poll")
+	}
+}
+
+func TestLoadScanRoots(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	data := `
+[[scan_roots]]
+path = "~/code"
+max_depth = 2
+ignore = ["node_modules"]
+`
+	os.MkdirAll(ApolloDir(), 0755)
+	if err := os.WriteFile(ConfigPath(), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := cfg.ResolvedScanRoots()
+	if len(roots) != 1 {
+		t.Fatalf("roots = %+v", roots)
+	}
+	if roots[0].Path != filepath.Join(tmp, "code") || roots[0].MaxDepth != 2 || roots[0].Ignore[0] != "node_modules" {
+		t.Errorf("root = %+v", roots[0])
+	}
+}
+
+func TestUpdateIgnoresEnv(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("APOLLO_SEED_DEPTH", "7")
+
+	if err := Save(Config{SeedDepth: 20, RepoPaths: []string{"/code/a"}}); err != nil {
+		t.Fatal(err)
+	}
+	err := Update(func(c *Config) {
+		c.RepoPaths = AddPath(c.RepoPaths, "/code/b")
+		c.RepoPaths = AddPath(c.RepoPaths, "/code/a")
+		c.PausedPaths = AddPath(c.PausedPaths, "/code/b")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("APOLLO_SEED_DEPTH", "")
+	got, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SeedDepth != 20 {
+		t.Errorf("SeedDepth = %d, env override should not be persisted", got.SeedDepth)
+	}
+	if len(got.RepoPaths) != 2 || got.RepoPaths[1] != "/code/b" {
+		t.Errorf("RepoPaths = %v", got.RepoPaths)
+	}
+	if !got.IsPaused("/code/b") || got.IsPaused("/code/a") {
+		t.Errorf("PausedPaths = %v", got.PausedPaths)
+	}
+
+	if paths := RemovePath(got.RepoPaths, "/code/a"); len(paths) != 1 || paths[0] != "/code/b" {
+		t.Errorf("RemovePath = %v", paths)
+	}
+}
+
+func TestReviewerDefaultsToGitUser(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, ".config"))
+	gitconfig := "[user]\n\tname = Ada Lovelace\n\temail = ada@example.com\n"
+	if err := os.WriteFile(filepath.Join(tmp, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Reviewer != "Ada Lovelace <ada@example.com>" {
+		t.Errorf("Reviewer = %q", cfg.Reviewer)
+	}
+
+	if err := Save(Config{Reviewer: "ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ = Load(); cfg.Reviewer != "ada" {
+		t.Errorf("configured Reviewer = %q, want ada", cfg.Reviewer)
+	}
+}
+
+func TestApprovalsFor(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	cfg := Config{RequiredApprovals: map[string]int{"~/payments": 2, "/code/zero": 0}}
+	if n := cfg.ApprovalsFor(filepath.Join(home, "payments")); n != 2 {
+		t.Errorf("payments = %d, want 2", n)
+	}
+	if n := cfg.ApprovalsFor("/code/zero"); n != 1 {
+		t.Errorf("zero = %d, want at least 1", n)
+	}
+	if n := cfg.ApprovalsFor("/code/other"); n != 1 {
+		t.Errorf("unlisted = %d, want 1", n)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Cleanup(func() { SetProfile(DefaultProfile) })
+
+	if err := Save(Config{SeedDepth: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(tmp, ".apollo", "profiles", "work"); ApolloDir() != want || filepath.Dir(DBPath()) != want {
+		t.Errorf("ApolloDir = %q, DBPath = %q, want under %q", ApolloDir(), DBPath(), want)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SeedDepth != 50 {
+		t.Errorf("work SeedDepth = %d, should not see the default profile's config", cfg.SeedDepth)
+	}
+	if err := Save(Config{SeedDepth: 20, Notifications: Notifications{Prefix: "[work]"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetProfile(""); err != nil || Profile() != DefaultProfile {
+		t.Fatalf("empty profile = %q, %v", Profile(), err)
+	}
+	if cfg, _ = Load(); cfg.SeedDepth != 10 || cfg.Notifications.Prefix != "" {
+		t.Errorf("default profile = %+v", cfg)
+	}
+
+	if err := SetProfile("../escape"); err == nil || Profile() != DefaultProfile {
+		t.Errorf("bad name accepted, profile = %q", Profile())
+	}
+	profiles, err := ListProfiles()
+	if err != nil || len(profiles) != 2 || profiles[0] != DefaultProfile || profiles[1] != "work" {
+		t.Errorf("profiles = %v, %v", profiles, err)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DefaultProfile is the profile used when none is chosen. It lives directly
+// in ~/.apollo, where Apollo kept everything before profiles existed; named
+// profiles each get a directory of their own under ~/.apollo/profiles.
+const DefaultProfile = "default"
+
+// profile is the active profile, set once at startup and again whenever the
+// user switches. Everything under ApolloDir follows it.
+var profile = DefaultProfile
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SetProfile makes name the active profile. An empty name is the default.
+func SetProfile(name string) error {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if err := ValidProfile(name); err != nil {
+		return err
+	}
+	profile = name
+	return nil
+}
+
+// ValidProfile reports whether name can be used as a directory for a
+// profile.
+func ValidProfile(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Profile returns the active profile's name.
+func Profile() string {
+	return profile
+}
+
+// ProfileDir is where the named profile keeps its config, database, backups
+// and hook socket.
+func ProfileDir(name string) string {
+	home, _ := os.UserHomeDir()
+	root := filepath.Join(home, ".apollo")
+	if name == DefaultProfile || name == "" {
+		return root
+	}
+	return filepath.Join(root, "profiles", name)
+}
+
+// ListProfiles returns the default profile followed by every named profile
+// that has been used, sorted.
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(ProfileDir(DefaultProfile), "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && profileName.MatchString(e.Name()) && e.Name() != DefaultProfile {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...), nil
+}
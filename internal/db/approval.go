@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrNoReviewer rejects a decision that would count as an approval when
+// there is nobody to attribute it to.
+var ErrNoReviewer = errors.New("no reviewer to record the decision against")
+
+// Approval is one reviewer's sign-off on a commit. A commit counts as
+// reviewed once its repo's RequiredApprovals distinct reviewers have
+// approved it.
+type Approval struct {
+	Reviewer   string    `json:"reviewer"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// approvalDelta is what one decision did to a commit's approvals, and the
+// tally it left.
+type approvalDelta struct {
+	approved  []Approval
+	withdrawn []Approval
+	count     int
+	required  int
+}
+
+func (d approvalDelta) empty() bool {
+	return len(d.approved) == 0 && len(d.withdrawn) == 0
+}
+
+// SetRequiredApprovals sets how many reviewers must approve the repo's
+// commits. It applies to decisions from now on; commits already reviewed
+// stay reviewed.
+func SetRequiredApprovals(db *sql.DB, repoID int64, n int) error {
+	_, err := db.Exec(`UPDATE repositories SET required_approvals = ? WHERE id = ?`, max(n, 1), repoID)
+	return err
+}
+
+// ListApprovals returns who has approved a commit, earliest first.
+func ListApprovals(db *sql.DB, repoID int64, hash string) ([]Approval, error) {
+	return approvals(db, repoID, hash)
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func approvals(db querier, repoID int64, hash string) ([]Approval, error) {
+	rows, err := db.Query(
+		`SELECT reviewer, approved_at FROM approvals WHERE repo_id = ? AND commit_hash = ?
+		 ORDER BY approved_at, reviewer`, repoID, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Approval
+	for rows.Next() {
+		var a Approval
+		if err := rows.Scan(&a.Reviewer, &a.ApprovedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// decide applies by's decision to a commit's approvals and works out the
+// status that follows. Decisions other than reviewed and unreviewed leave
+// the approvals alone.
+func decide(tx *sql.Tx, repoID int64, hash string, cur reviewState, status, by string, now time.Time) (reviewState, approvalDelta, error) {
+	if !approves(status) {
+		return reviewState{status: status, by: by}, approvalDelta{}, nil
+	}
+
+	given, err := approvals(tx, repoID, hash)
+	if err != nil {
+		return reviewState{}, approvalDelta{}, err
+	}
+	delta := approvalChange(given, status, by, now)
+	if err := applyApprovals(tx, repoID, hash, delta); err != nil {
+		return reviewState{}, delta, err
+	}
+	if err := tally(tx, repoID, hash, &delta); err != nil {
+		return reviewState{}, delta, err
+	}
+	return settle(cur, status, by, now, delta), delta, nil
+}
+
+// approves reports whether status is a decision that goes through approvals.
+func approves(status string) bool {
+	return status == "reviewed" || status == "unreviewed"
+}
+
+// approvalChange works out what by's decision does to the approvals given.
+// Marking a commit reviewed adds by's approval. Marking it unreviewed
+// withdraws by's approval, or every approval when by hadn't given one, so
+// anyone can still send a commit back for review.
+func approvalChange(given []Approval, status, by string, now time.Time) approvalDelta {
+	var delta approvalDelta
+	i := slices.IndexFunc(given, func(a Approval) bool { return a.Reviewer == by })
+	switch {
+	case status == "reviewed" && i < 0:
+		delta.approved = []Approval{{Reviewer: by, ApprovedAt: now}}
+	case status == "unreviewed" && i >= 0:
+		delta.withdrawn = []Approval{given[i]}
+	case status == "unreviewed":
+		delta.withdrawn = given
+	}
+	return delta
+}
+
+func applyApprovals(tx *sql.Tx, repoID int64, hash string, delta approvalDelta) error {
+	for _, a := range delta.withdrawn {
+		_, err := tx.Exec(`DELETE FROM approvals WHERE repo_id = ? AND commit_hash = ? AND reviewer = ?`,
+			repoID, hash, a.Reviewer)
+		if err != nil {
+			return err
+		}
+	}
+	for _, a := range delta.approved {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO approvals (repo_id, commit_hash, reviewer, approved_at) VALUES (?, ?, ?, ?)`,
+			repoID, hash, a.Reviewer, a.ApprovedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle returns the status by's decision and the commit's tallied
+// approvals give it. A commit that reaches its quota becomes reviewed by by
+// at now. One already reviewed keeps its original review until somebody
+// sends it back: approving it again doesn't re-count it, so reviews from
+// before approvals, and ones made before the quota was raised, stay
+// reviewed.
+func settle(cur reviewState, status, by string, now time.Time, delta approvalDelta) reviewState {
+	switch {
+	case cur.status == "reviewed" && status == "reviewed":
+		return cur
+	case delta.count < delta.required:
+		return reviewState{status: "unreviewed"}
+	case cur.status == "reviewed":
+		return cur
+	}
+	return reviewState{status: "reviewed", reviewedAt: &now, by: by}
+}
+
+// adopt returns the status a review brought from elsewhere, by an import or
+// from another repo, leaves once its approvals are tallied here. It stands
+// as it was only if they meet this repo's quota, or if it brought none at
+// all: such a review predates approvals, or nobody signed it, and stays
+// reviewed as the migration to approvals left those.
+func adopt(theirs reviewState, brought int, now time.Time, delta approvalDelta) reviewState {
+	switch {
+	case !approves(theirs.status), theirs.status == "reviewed" && brought == 0:
+		return theirs
+	case delta.count < delta.required:
+		return reviewState{status: "unreviewed"}
+	case theirs.status == "reviewed":
+		return theirs
+	}
+	return reviewState{status: "reviewed", reviewedAt: &now, by: theirs.by}
+}
+
+func tally(tx *sql.Tx, repoID int64, hash string, delta *approvalDelta) error {
+	return tx.QueryRow(
+		`SELECT (SELECT COUNT(*) FROM approvals WHERE repo_id = ?1 AND commit_hash = ?2),
+		        (SELECT required_approvals FROM repositories WHERE id = ?1)`, repoID, hash,
+	).Scan(&delta.count, &delta.required)
+}
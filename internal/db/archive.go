@@ -0,0 +1,183 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ArchivedCommit is a commit retired from the board by retention, with the
+// review it had when it was archived.
+type ArchivedCommit struct {
+	CommitRow
+	Files      []string
+	ArchivedAt time.Time
+}
+
+// ArchiveCommits retires reviewed and ignored commits with no activity since
+// before: neither detected nor touched by any event after it. Archived
+// commits keep their details, review and approvers in archived_commits;
+// with purge only the hash and status are kept, and their events are
+// deleted too. Either way the hash stays known, so re-ingesting it does not
+// bring it back as unreviewed. It returns how many commits were retired.
+func ArchiveCommits(db *sql.DB, before time.Time, purge bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`CREATE TEMP TABLE IF NOT EXISTS gc_commits (id INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO gc_commits (id)
+		 SELECT c.id FROM commits c
+		 JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+		 WHERE r.status IN ('reviewed', 'ignored')
+		   AND MAX(COALESCE(c.detected_at, ''), COALESCE((
+		         SELECT MAX(e.created_at) FROM events e
+		         WHERE e.repo_id = c.repo_id AND e.commit_hash = c.hash), '')) < ?`,
+		before.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	details := `c.author, c.subject, c.body, c.branch, c.files, r.note,
+		COALESCE((SELECT group_concat(l.name, char(10)) FROM commit_labels cl
+		          JOIN labels l ON l.id = cl.label_id
+		          WHERE cl.repo_id = c.repo_id AND cl.commit_hash = c.hash), ''),
+		r.reviewed_by, COALESCE(` + approversColumn + `, '')`
+	if purge {
+		details = `'', '', '', '', '', '', '', '', ''`
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		`INSERT OR REPLACE INTO archived_commits
+		 (repo_id, hash, author, subject, body, branch, files, note, labels, reviewed_by, approvers,
+		  committed_at, detected_at, status, reviewed_at, purged)
+		 SELECT c.repo_id, c.hash, %s, c.committed_at, c.detected_at, r.status, r.reviewed_at, ?
+		 FROM commits c
+		 JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+		 WHERE c.id IN (SELECT id FROM gc_commits)`, details), purge)
+	if err != nil {
+		return 0, err
+	}
+
+	retired := `(SELECT repo_id, hash FROM commits WHERE id IN (SELECT id FROM gc_commits))`
+	stmts := []string{
+		`DELETE FROM commit_labels WHERE (repo_id, commit_hash) IN ` + retired,
+		`DELETE FROM approvals WHERE (repo_id, commit_hash) IN ` + retired,
+		`DELETE FROM review_state WHERE (repo_id, commit_hash) IN ` + retired,
+	}
+	if purge {
+		stmts = append(stmts, `DELETE FROM events WHERE (repo_id, commit_hash) IN `+retired)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM commits WHERE id IN (SELECT id FROM gc_commits)`)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.Exec(`DELETE FROM gc_commits`); err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// Compact merges the search index, rebuilds the database file to reclaim the
+// space freed by archiving and truncates the write-ahead log. It returns the
+// database size in bytes before and after.
+func Compact(db *sql.DB) (before, after int64, err error) {
+	if before, err = dbSize(db); err != nil {
+		return 0, 0, err
+	}
+	stmts := []string{
+		`INSERT INTO commit_search (commit_search) VALUES ('optimize')`,
+		`VACUUM`,
+		`PRAGMA wal_checkpoint(TRUNCATE)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return 0, 0, err
+		}
+	}
+	after, err = dbSize(db)
+	return before, after, err
+}
+
+func dbSize(db *sql.DB) (int64, error) {
+	var size int64
+	err := db.QueryRow(`SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`).Scan(&size)
+	return size, err
+}
+
+// ListArchived returns archived commits, newest first, from repoIDs or from
+// every repo when repoIDs is empty. A non-empty query keeps commits whose
+// hash starts with it or whose subject, author or note contains it. Purged
+// commits have nothing left to show and are skipped.
+func ListArchived(db *sql.DB, repoIDs []int64, query string, limit int) ([]ArchivedCommit, error) {
+	where := []string{`a.purged = 0`}
+	var args []any
+	if len(repoIDs) > 0 {
+		placeholders := make([]string, len(repoIDs))
+		for i, id := range repoIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		where = append(where, fmt.Sprintf(`a.repo_id IN (%s)`, strings.Join(placeholders, ",")))
+	}
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + query + "%"
+		where = append(where, `(a.hash LIKE ? OR a.subject LIKE ? OR a.author LIKE ? OR a.note LIKE ?)`)
+		args = append(args, query+"%", like, like, like)
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT a.hash, a.repo_id, COALESCE(rp.name, ''), a.author, a.subject, a.body, a.branch,
+		        a.committed_at, a.detected_at, a.status, a.reviewed_at, a.reviewed_by, a.note,
+		        a.labels, a.approvers, a.files, a.archived_at
+		 FROM archived_commits a
+		 LEFT JOIN repositories rp ON rp.id = a.repo_id
+		 WHERE %s
+		 ORDER BY a.committed_at DESC
+		 LIMIT ?`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ArchivedCommit
+	for rows.Next() {
+		var a ArchivedCommit
+		var labels, approvers, files string
+		if err := rows.Scan(&a.Hash, &a.RepoID, &a.RepoName, &a.Author, &a.Subject, &a.Body, &a.Branch,
+			&a.CommittedAt, &a.DetectedAt, &a.Status, &a.ReviewedAt, &a.ReviewedBy, &a.Note,
+			&labels, &approvers, &files, &a.ArchivedAt); err != nil {
+			return nil, err
+		}
+		a.Approvers = splitLines(approvers)
+		for _, name := range splitLines(labels) {
+			a.Labels = append(a.Labels, Label{Name: name})
+		}
+		a.Files = splitLines(files)
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scheduled backups are named apollo-<timestamp>.db so they sort by age.
+const (
+	backupPrefix = "apollo-"
+	backupExt    = ".db"
+	backupStamp  = "20060102T150405"
+)
+
+// Backup writes a consistent copy of db to dest. VACUUM INTO reads a
+// snapshot, so this is safe while another process keeps writing. dest must
+// not exist yet; the copy only appears there once it is complete.
+func Backup(db *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// CheckBackup verifies that the file at path is an intact Apollo database
+// from a schema this build can open, without migrating it. It returns the
+// file's schema version.
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	raw, err := sql.Open("sqlite", "file:"+path+"?_time_format=sqlite")
+	if err != nil {
+		return 0, err
+	}
+	defer raw.Close()
+
+	var result string
+	if err := raw.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil {
+		return 0, fmt.Errorf("%s is not a readable database: %w", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s is damaged: %s", path, result)
+	}
+
+	var tables int
+	err = raw.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('commits', 'review_state')`).Scan(&tables)
+	if err != nil {
+		return 0, err
+	}
+	if tables != 2 {
+		return 0, fmt.Errorf("%s is not an apollo database", path)
+	}
+
+	version, err := SchemaVersion(raw)
+	if err != nil {
+		return 0, err
+	}
+	if version > LatestVersion() {
+		return 0, fmt.Errorf("%s has schema v%d, newer than this build supports (v%d)", path, version, LatestVersion())
+	}
+	return version, nil
+}
+
+// Restore replaces the database at dest with the backup at src once
+// CheckBackup accepts it. The database being replaced is first copied next
+// to dest and that copy's path returned, "" if there was nothing to keep.
+// Nothing may have dest open while it runs; an older backup is migrated the
+// next time dest is opened.
+func Restore(src, dest string) (string, error) {
+	if _, err := CheckBackup(src); err != nil {
+		return "", err
+	}
+
+	saved := ""
+	if _, err := os.Stat(dest); err == nil {
+		saved = fmt.Sprintf("%s.pre-restore-%s.bak", dest, time.Now().Format(backupStamp))
+		cur, err := sql.Open("sqlite", "file:"+dest)
+		if err != nil {
+			return "", err
+		}
+		err = Backup(cur, saved)
+		cur.Close()
+		if err != nil {
+			return "", fmt.Errorf("save current database: %w", err)
+		}
+	}
+
+	tmp := dest + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return saved, err
+	}
+	// A write-ahead log left beside dest belongs to the old database and
+	// would be replayed over the restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return saved, err
+		}
+	}
+	return saved, os.Rename(tmp, dest)
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ListBackups returns the scheduled backups in dir, oldest first.
+func ListBackups(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupExt))
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, p := range paths {
+		if _, ok := backupTime(p); ok {
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func backupTime(path string) (time.Time, bool) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), backupPrefix), backupExt)
+	t, err := time.ParseInLocation(backupStamp, stamp, time.Local)
+	return t, err == nil
+}
+
+// BackupInto writes a new timestamped backup into dir, then deletes all but
+// the keep newest. It returns the new backup's path.
+func BackupInto(db *sql.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, backupPrefix+time.Now().Format(backupStamp)+backupExt)
+	if err := Backup(db, dest); err != nil {
+		return "", err
+	}
+	return dest, rotateBackups(dir, keep)
+}
+
+// ScheduledBackup runs BackupInto unless the newest backup in dir is younger
+// than every. It returns "" when no backup was due.
+func ScheduledBackup(db *sql.DB, dir string, every time.Duration, keep int) (string, error) {
+	existing, err := ListBackups(dir)
+	if err != nil {
+		return "", err
+	}
+	if n := len(existing); n > 0 {
+		if last, _ := backupTime(existing[n-1]); time.Since(last) < every {
+			return "", nil
+		}
+	}
+	return BackupInto(db, dir, keep)
+}
+
+func rotateBackups(dir string, keep int) error {
+	existing, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for len(existing) > max(keep, 1) {
+		if err := os.Remove(existing[0]); err != nil {
+			return err
+		}
+		existing = existing[1:]
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -19,7 +20,34 @@ type CommitRow struct {
 	DetectedAt  time.Time
 	Status      string
 	ReviewedAt  *time.Time
-	Note        string
+	ReviewedBy  string
+	// Approvers have approved the commit, earliest first; it is reviewed
+	// once there are RequiredApprovals of them.
+	Approvers         []string
+	RequiredApprovals int
+	Note              string
+	Labels            []Label
+	// Cursor is set by QueryCommits: passed as CommitQuery.After it resumes
+	// the listing right after this commit.
+	Cursor string
+}
+
+// approversColumn selects a commit's approvers, newline-separated, or NULL
+// when it has none.
+const approversColumn = `(SELECT group_concat(reviewer, char(10)) FROM (
+	SELECT a.reviewer FROM approvals a WHERE a.repo_id = c.repo_id AND a.commit_hash = c.hash
+	ORDER BY a.approved_at, a.reviewer))`
+
+// scanApprovers fills in c's approvers from approversColumn.
+func (c *CommitRow) scanApprovers(list sql.NullString) {
+	if list.Valid {
+		c.Approvers = strings.Split(list.String, "\n")
+	}
+}
+
+// Approved reports whether c has enough approvals to count as reviewed.
+func (c CommitRow) Approved() bool {
+	return len(c.Approvers) >= c.RequiredApprovals
 }
 
 type ReviewFilter string
@@ -31,103 +59,219 @@ const (
 	FilterIgnored    ReviewFilter = "ignored"
 )
 
-func InsertCommit(db *sql.DB, repoID int64, hash, author, subject, body, branch string, committedAt time.Time) error {
-	_, err := db.Exec(
-		`INSERT OR IGNORE INTO commits (hash, repo_id, author, subject, body, branch, committed_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		hash, repoID, author, subject, body, branch, committedAt,
-	)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec(
-		`INSERT OR IGNORE INTO review_state (commit_hash) VALUES (?)`, hash,
-	)
+// InsertCommit stores a single newly seen commit as unreviewed. Commits
+// already stored or archived are left as they are.
+func InsertCommit(db *sql.DB, repoID int64, hash, author, subject, body, branch string, committedAt time.Time, files []string) error {
+	_, err := IngestCommits(db, repoID, []NewCommit{{
+		Hash: hash, Author: author, Subject: subject, Body: body, Branch: branch,
+		CommittedAt: committedAt, Files: files,
+	}}, "")
 	return err
 }
 
-func UpdateReviewStatus(db *sql.DB, hash, status, note string) error {
-	var reviewedAt *time.Time
-	if status == "reviewed" {
-		now := time.Now()
-		reviewedAt = &now
+// KnownHashes reports which of hashes are already stored or archived for
+// repoID.
+func KnownHashes(db *sql.DB, repoID int64, hashes []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	if len(hashes) == 0 {
+		return known, nil
 	}
-	_, err := db.Exec(
-		`UPDATE review_state SET status = ?, reviewed_at = ?, note = ? WHERE commit_hash = ?`,
-		status, reviewedAt, note, hash,
-	)
-	return err
-}
-
-func ListCommits(db *sql.DB, repoID int64, filter ReviewFilter) ([]CommitRow, error) {
-	query := `SELECT c.hash, c.repo_id, rp.name, c.author, c.subject, c.body, c.branch,
-	                 c.committed_at, c.detected_at,
-	                 r.status, r.reviewed_at, r.note
-	          FROM commits c
-	          JOIN review_state r ON r.commit_hash = c.hash
-	          JOIN repositories rp ON rp.id = c.repo_id
-	          WHERE c.repo_id = ?`
 
-	if filter != FilterAll {
-		query += ` AND r.status = '` + string(filter) + `'`
+	placeholders := make([]string, len(hashes))
+	args := make([]any, len(hashes)+1)
+	args[0] = repoID
+	for i, h := range hashes {
+		placeholders[i] = fmt.Sprintf("?%d", i+2)
+		args[i+1] = h
 	}
-	query += ` ORDER BY c.committed_at DESC`
 
-	rows, err := db.Query(query, repoID)
+	in := strings.Join(placeholders, ",")
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT hash FROM commits WHERE repo_id = ?1 AND hash IN (%s)
+		 UNION SELECT hash FROM archived_commits WHERE repo_id = ?1 AND hash IN (%s)`, in, in), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	return scanCommitRows(rows)
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		known[h] = true
+	}
+	return known, rows.Err()
 }
 
-func ListAllCommits(db *sql.DB, repoIDs []int64, filter ReviewFilter) ([]CommitRow, error) {
+// UpdateReviewStatus records reviewer by's decision and note on a commit in
+// one repo, with an event for each one that actually changes. Marking it
+// reviewed is an approval; the commit only becomes reviewed once the repo's
+// required approvals are in. Marking it reviewed or unreviewed needs a
+// reviewer: without one it fails with ErrNoReviewer.
+func UpdateReviewStatus(db *sql.DB, repoID int64, hash, status, note, by string) error {
+	return updateReview(db, []int64{repoID}, hash, status, note, by)
+}
+
+// UpdateSharedReviewStatus sets status and note on hash in every repo that
+// contains it, for setups where forks or mirrors share one review.
+func UpdateSharedReviewStatus(db *sql.DB, hash, status, note, by string) error {
+	repoIDs, err := reposWithCommit(db, hash)
+	if err != nil {
+		return err
+	}
 	if len(repoIDs) == 0 {
-		return nil, nil
+		return errCommitNotFound
+	}
+	return updateReview(db, repoIDs, hash, status, note, by)
+}
+
+func updateReview(db *sql.DB, repoIDs []int64, hash, status, note, by string) error {
+	if by == "" && approves(status) {
+		return ErrNoReviewer
 	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	placeholders := make([]string, len(repoIDs))
-	args := make([]any, len(repoIDs))
-	for i, id := range repoIDs {
-		placeholders[i] = "?"
-		args[i] = id
+	now := time.Now()
+	for _, repoID := range repoIDs {
+		cur, err := currentReview(tx, repoID, hash)
+		if err != nil {
+			return err
+		}
+		next, delta, err := decide(tx, repoID, hash, cur, status, by, now)
+		if err != nil {
+			return err
+		}
+		if err := setStatus(tx, repoID, hash, cur, next, delta, by, 0); err != nil {
+			return err
+		}
+		if err := setNote(tx, repoID, hash, cur, note, 0); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
-	query := fmt.Sprintf(`SELECT c.hash, c.repo_id, rp.name, c.author, c.subject, c.body, c.branch,
-	                 c.committed_at, c.detected_at,
-	                 r.status, r.reviewed_at, r.note
-	          FROM commits c
-	          JOIN review_state r ON r.commit_hash = c.hash
-	          JOIN repositories rp ON rp.id = c.repo_id
-	          WHERE c.repo_id IN (%s)`, strings.Join(placeholders, ","))
+// UpdateNote sets the note on a commit in one repo. A note is no decision:
+// the status and approvals stay as they are.
+func UpdateNote(db *sql.DB, repoID int64, hash, note string) error {
+	return updateNote(db, []int64{repoID}, hash, note)
+}
 
-	if filter != FilterAll {
-		query += ` AND r.status = '` + string(filter) + `'`
+// UpdateSharedNote sets the note on hash in every repo that contains it.
+func UpdateSharedNote(db *sql.DB, hash, note string) error {
+	repoIDs, err := reposWithCommit(db, hash)
+	if err != nil {
+		return err
 	}
-	query += ` ORDER BY c.committed_at DESC`
+	if len(repoIDs) == 0 {
+		return errCommitNotFound
+	}
+	return updateNote(db, repoIDs, hash, note)
+}
 
-	rows, err := db.Query(query, args...)
+func updateNote(db *sql.DB, repoIDs []int64, hash, note string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	return scanCommitRows(rows)
+	for _, repoID := range repoIDs {
+		cur, err := currentReview(tx, repoID, hash)
+		if err != nil {
+			return err
+		}
+		if err := setNote(tx, repoID, hash, cur, note, 0); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func scanCommitRows(rows *sql.Rows) ([]CommitRow, error) {
-	var result []CommitRow
+func reposWithCommit(db *sql.DB, hash string) ([]int64, error) {
+	rows, err := db.Query(`SELECT repo_id FROM commits WHERE hash = ? ORDER BY repo_id`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
 	for rows.Next() {
-		var c CommitRow
-		if err := rows.Scan(&c.Hash, &c.RepoID, &c.RepoName, &c.Author, &c.Subject, &c.Body, &c.Branch,
-			&c.CommittedAt, &c.DetectedAt, &c.Status, &c.ReviewedAt, &c.Note); err != nil {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		result = append(result, c)
+		ids = append(ids, id)
 	}
-	return result, rows.Err()
+	return ids, rows.Err()
+}
+
+// InheritSharedReview gives newly detected commits in repoID the review
+// another repo already recorded for the same hash. Commits that have been
+// touched in repoID are left alone. It returns how many were updated.
+func InheritSharedReview(db *sql.DB, repoID int64, hashes []string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, hash := range hashes {
+		cur, err := currentReview(tx, repoID, hash)
+		if err != nil {
+			return 0, err
+		}
+		if cur.status != "unreviewed" || cur.note != "" {
+			continue
+		}
+
+		var fromRepo int64
+		var from reviewState
+		err = tx.QueryRow(
+			`SELECT repo_id, status, note, reviewed_at, reviewed_by FROM review_state
+			 WHERE commit_hash = ? AND repo_id != ? AND (status != 'unreviewed' OR note != '')
+			 ORDER BY reviewed_at IS NULL, reviewed_at DESC, repo_id LIMIT 1`, hash, repoID,
+		).Scan(&fromRepo, &from.status, &from.note, &from.reviewedAt, &from.by)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		given, err := approvals(tx, fromRepo, hash)
+		if err != nil {
+			return 0, err
+		}
+		delta := approvalDelta{approved: given}
+		if err := applyApprovals(tx, repoID, hash, delta); err != nil {
+			return 0, err
+		}
+		if err := tally(tx, repoID, hash, &delta); err != nil {
+			return 0, err
+		}
+		next := adopt(from, len(given), time.Now(), delta)
+		if err := setStatus(tx, repoID, hash, cur, next, delta, from.by, 0); err != nil {
+			return 0, err
+		}
+		if err := setNote(tx, repoID, hash, cur, from.note, 0); err != nil {
+			return 0, err
+		}
+		err = recordEvent(tx, repoID, EventRuleApplied, hash, RuleDecision{
+			Rule: "share_review", Action: "inherit", Value: fmt.Sprintf("repo %d", fromRepo),
+		})
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
 }
 
 type Stats struct {
@@ -160,7 +304,7 @@ func queryStats(db *sql.DB, where string, args ...any) (Stats, error) {
 	var s Stats
 	query := fmt.Sprintf(
 		`SELECT r.status, COUNT(*)
-		 FROM commits c JOIN review_state r ON r.commit_hash = c.hash
+		 FROM commits c JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
 		 %s
 		 GROUP BY r.status`, where,
 	)
@@ -176,15 +320,67 @@ func queryStats(db *sql.DB, where string, args ...any) (Stats, error) {
 		if err := rows.Scan(&status, &count); err != nil {
 			return s, err
 		}
-		s.Total += count
-		switch status {
-		case "unreviewed":
-			s.Unreviewed = count
-		case "reviewed":
-			s.Reviewed = count
-		case "ignored":
-			s.Ignored = count
-		}
+		s.add(status, count)
 	}
 	return s, rows.Err()
 }
+
+func (s *Stats) add(status string, count int) {
+	s.Total += count
+	switch status {
+	case "unreviewed":
+		s.Unreviewed += count
+	case "reviewed":
+		s.Reviewed += count
+	case "ignored":
+		s.Ignored += count
+	}
+}
+
+// ReviewerStats counts the current decisions one reviewer is on record for.
+// Decisions made before reviewers were tracked have an empty Reviewer.
+type ReviewerStats struct {
+	Reviewer string
+	Reviewed int
+	Ignored  int
+}
+
+// GetReviewerStats breaks the approvals and ignored commits of repoIDs down
+// by who made the call, busiest reviewer first.
+func GetReviewerStats(db *sql.DB, repoIDs []int64) ([]ReviewerStats, error) {
+	if len(repoIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(repoIDs))
+	args := make([]any, len(repoIDs))
+	for i, id := range repoIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	// A reviewer's approvals count whether or not the commit has reached
+	// its quota yet.
+	in := strings.Join(placeholders, ",")
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT reviewer, SUM(kind = 'reviewed'), SUM(kind = 'ignored')
+		 FROM (SELECT reviewer, 'reviewed' AS kind FROM approvals WHERE repo_id IN (%s)
+		       UNION ALL
+		       SELECT reviewed_by, status FROM review_state WHERE repo_id IN (%s) AND status = 'ignored')
+		 GROUP BY reviewer
+		 ORDER BY COUNT(*) DESC, reviewer`, in, in), append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ReviewerStats
+	for rows.Next() {
+		var s ReviewerStats
+		if err := rows.Scan(&s.Reviewer, &s.Reviewed, &s.Ignored); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
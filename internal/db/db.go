@@ -26,11 +26,9 @@ func Open(path string) (*sql.DB, error) {
 		}
 	}
 
-	for _, ddl := range migrations {
-		if _, err := db.Exec(ddl); err != nil {
-			db.Close()
-			return nil, err
-		}
+	if err := migrate(db, path, migrations); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
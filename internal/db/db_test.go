@@ -2,7 +2,12 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -63,6 +68,32 @@ func TestUpsertRepo(t *testing.T) {
 	}
 }
 
+func TestUpsertRepoAfterOtherInserts(t *testing.T) {
+	h := testDB(t)
+	a := h.mustRepoAt("a", "/tmp/a")
+	b := h.mustRepoAt("b", "/tmp/b")
+
+	// Rows in other tables move the connection's last insert rowid on.
+	for i := range 5 {
+		CreateLabel(h.db, fmt.Sprintf("label-%d", i), "")
+	}
+	SetRepoIdentity(h.db, a, []string{"r1", "r2", "r3"}, nil)
+	InsertEvent(h.db, 0, EventRefDeleted, "", "")
+
+	for _, want := range []struct {
+		path string
+		id   int64
+	}{{"/tmp/a", a}, {"/tmp/b", b}, {"/tmp/a", a}} {
+		id, err := UpsertRepo(h.db, "renamed", want.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want.id {
+			t.Errorf("upsert %s = %d, want %d", want.path, id, want.id)
+		}
+	}
+}
+
 func TestGetRepoByPath(t *testing.T) {
 	h := testDB(t)
 	h.mustRepo()
@@ -92,14 +123,14 @@ func TestInsertAndListCommits(t *testing.T) {
 	repoID := h.mustRepo()
 
 	now := time.Now().Truncate(time.Second)
-	if err := InsertCommit(h.db, repoID, "abc123", "alice", "feat: add foo", "", "main", now); err != nil {
+	if err := InsertCommit(h.db, repoID, "abc123", "alice", "feat: add foo", "", "main", now, nil); err != nil {
 		t.Fatal(err)
 	}
-	if err := InsertCommit(h.db, repoID, "def456", "bob", "fix: bar", "body text", "main", now.Add(time.Minute)); err != nil {
+	if err := InsertCommit(h.db, repoID, "def456", "bob", "fix: bar", "body text", "main", now.Add(time.Minute), nil); err != nil {
 		t.Fatal(err)
 	}
 
-	commits, err := ListCommits(h.db, repoID, FilterAll)
+	commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -122,10 +153,10 @@ func TestInsertCommitDuplicate(t *testing.T) {
 	repoID := h.mustRepo()
 	now := time.Now()
 
-	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now); err != nil {
+	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now, nil); err != nil {
 		t.Fatal(err)
 	}
-	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now); err != nil {
+	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now, nil); err != nil {
 		t.Fatal("duplicate insert should not error")
 	}
 }
@@ -135,15 +166,15 @@ func TestUpdateReviewStatus(t *testing.T) {
 	repoID := h.mustRepo()
 	now := time.Now()
 
-	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now); err != nil {
+	if err := InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", now, nil); err != nil {
 		t.Fatal(err)
 	}
 
-	if err := UpdateReviewStatus(h.db, "abc123", "reviewed", "looks good"); err != nil {
+	if err := UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "looks good", "tester"); err != nil {
 		t.Fatal(err)
 	}
 
-	commits, err := ListCommits(h.db, repoID, FilterReviewed)
+	commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}, Status: FilterReviewed})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,12 +191,12 @@ func TestFilterCommits(t *testing.T) {
 	repoID := h.mustRepo()
 	now := time.Now()
 
-	InsertCommit(h.db, repoID, "a", "alice", "msg1", "", "main", now)
-	InsertCommit(h.db, repoID, "b", "bob", "msg2", "", "main", now.Add(time.Minute))
-	InsertCommit(h.db, repoID, "c", "carol", "msg3", "", "main", now.Add(2*time.Minute))
+	InsertCommit(h.db, repoID, "a", "alice", "msg1", "", "main", now, nil)
+	InsertCommit(h.db, repoID, "b", "bob", "msg2", "", "main", now.Add(time.Minute), nil)
+	InsertCommit(h.db, repoID, "c", "carol", "msg3", "", "main", now.Add(2*time.Minute), nil)
 
-	UpdateReviewStatus(h.db, "b", "reviewed", "")
-	UpdateReviewStatus(h.db, "c", "ignored", "")
+	UpdateReviewStatus(h.db, repoID, "b", "reviewed", "", "tester")
+	UpdateReviewStatus(h.db, repoID, "c", "ignored", "", "")
 
 	tests := []struct {
 		filter ReviewFilter
@@ -177,7 +208,7 @@ func TestFilterCommits(t *testing.T) {
 		{FilterIgnored, 1},
 	}
 	for _, tt := range tests {
-		commits, err := ListCommits(h.db, repoID, tt.filter)
+		commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}, Status: tt.filter})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -192,10 +223,10 @@ func TestGetStats(t *testing.T) {
 	repoID := h.mustRepo()
 	now := time.Now()
 
-	InsertCommit(h.db, repoID, "a", "alice", "msg1", "", "main", now)
-	InsertCommit(h.db, repoID, "b", "bob", "msg2", "", "main", now.Add(time.Minute))
-	InsertCommit(h.db, repoID, "c", "carol", "msg3", "", "main", now.Add(2*time.Minute))
-	UpdateReviewStatus(h.db, "b", "reviewed", "")
+	InsertCommit(h.db, repoID, "a", "alice", "msg1", "", "main", now, nil)
+	InsertCommit(h.db, repoID, "b", "bob", "msg2", "", "main", now.Add(time.Minute), nil)
+	InsertCommit(h.db, repoID, "c", "carol", "msg3", "", "main", now.Add(2*time.Minute), nil)
+	UpdateReviewStatus(h.db, repoID, "b", "reviewed", "", "tester")
 
 	stats, err := GetStats(h.db, repoID)
 	if err != nil {
@@ -228,11 +259,11 @@ func TestTimeRoundTrip(t *testing.T) {
 	repoID := h.mustRepo()
 
 	want := time.Date(2025, 6, 15, 10, 30, 45, 0, time.UTC)
-	if err := InsertCommit(h.db, repoID, "timetest", "alice", "msg", "", "main", want); err != nil {
+	if err := InsertCommit(h.db, repoID, "timetest", "alice", "msg", "", "main", want, nil); err != nil {
 		t.Fatal(err)
 	}
 
-	commits, err := ListCommits(h.db, repoID, FilterAll)
+	commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -253,21 +284,124 @@ func TestOpenBadPath(t *testing.T) {
 
 func TestInsertEvent(t *testing.T) {
 	h := testDB(t)
-	if err := InsertEvent(h.db, "commit_detected", "abc123", `{"branch":"main"}`); err != nil {
+	if err := InsertEvent(h.db, 0, "commit_detected", "abc123", `{"branch":"main"}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func eventTypes(t *testing.T, h *testHelper, repoID int64, hash string) []string {
+	t.Helper()
+	events, err := ListEvents(h.db, repoID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func TestReviewAuditTrail(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", time.Now(), nil)
+	InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", time.Now(), nil)
+
+	if err := UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "first", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "second", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "second", "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := eventTypes(t, h, repoID, "abc123")
+	want := []string{EventDetected, EventStatusChanged, EventNoteEdited, EventNoteEdited}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+
+	events, _ := ListEvents(h.db, repoID, "abc123")
+	var sc StatusChange
+	json.Unmarshal([]byte(events[1].Payload), &sc)
+	if sc.From != "unreviewed" || sc.To != "reviewed" {
+		t.Errorf("status payload = %+v", sc)
+	}
+	var ne NoteEdit
+	json.Unmarshal([]byte(events[3].Payload), &ne)
+	if ne.From != "first" || ne.To != "second" {
+		t.Errorf("note payload = %+v", ne)
+	}
+}
+
+func TestUndoEvent(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "abc123", "unreviewed", "keep me", "tester")
+	UpdateReviewStatus(h.db, repoID, "abc123", "ignored", "changed", "")
+
+	events, _ := ListEvents(h.db, repoID, "abc123")
+	// detected, note "" -> "keep me", status -> ignored, note -> "changed"
+	if len(events) != 4 {
+		t.Fatalf("events = %d, want 4", len(events))
+	}
+	if err := UndoEvent(h.db, events[0].ID, ""); !errors.Is(err, ErrNotUndoable) {
+		t.Errorf("undo detection err = %v", err)
+	}
+	if err := UndoEvent(h.db, events[2].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := UndoEvent(h.db, events[3].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := UndoEvent(h.db, events[3].ID, ""); !errors.Is(err, ErrAlreadyUndone) {
+		t.Errorf("second undo err = %v", err)
+	}
+
+	commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	if commits[0].Status != "unreviewed" || commits[0].Note != "keep me" {
+		t.Errorf("after undo = %q %q", commits[0].Status, commits[0].Note)
+	}
+
+	events, _ = ListEvents(h.db, repoID, "abc123")
+	undone := UndoneEvents(events)
+	if len(events) != 6 || !undone[events[2].ID] || !undone[events[3].ID] || undone[events[1].ID] {
+		t.Errorf("undone = %v over %d events", undone, len(events))
+	}
+}
+
+func TestUndoRestoresReviewedAt(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "abc123", "alice", "msg", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "tester")
+	before, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	UpdateReviewStatus(h.db, repoID, "abc123", "unreviewed", "", "tester")
+
+	events, _ := ListEvents(h.db, repoID, "abc123")
+	if err := UndoEvent(h.db, events[len(events)-1].ID, ""); err != nil {
 		t.Fatal(err)
 	}
+	after, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	if after[0].Status != "reviewed" || after[0].ReviewedAt == nil || !after[0].ReviewedAt.Equal(*before[0].ReviewedAt) {
+		t.Errorf("reviewed_at = %v, want %v", after[0].ReviewedAt, before[0].ReviewedAt)
+	}
 }
 
-func TestListAllCommits(t *testing.T) {
+func TestQueryCommitsAcrossRepos(t *testing.T) {
 	h := testDB(t)
 	repoA := h.mustRepoAt("alpha", "/tmp/alpha")
 	repoB := h.mustRepoAt("beta", "/tmp/beta")
 	now := time.Now()
 
-	InsertCommit(h.db, repoA, "a1", "alice", "alpha commit", "", "main", now)
-	InsertCommit(h.db, repoB, "b1", "bob", "beta commit", "", "main", now.Add(time.Minute))
+	InsertCommit(h.db, repoA, "a1", "alice", "alpha commit", "", "main", now, nil)
+	InsertCommit(h.db, repoB, "b1", "bob", "beta commit", "", "main", now.Add(time.Minute), nil)
 
-	commits, err := ListAllCommits(h.db, []int64{repoA, repoB}, FilterAll)
+	commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoA, repoB}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -282,10 +416,9 @@ func TestListAllCommits(t *testing.T) {
 	}
 }
 
-func TestListAllCommitsEmpty(t *testing.T) {
+func TestQueryCommitsEmpty(t *testing.T) {
 	h := testDB(t)
-	_ = h
-	commits, err := ListAllCommits(h.db, nil, FilterAll)
+	commits, err := QueryCommits(h.db, CommitQuery{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -300,10 +433,10 @@ func TestGetAggregateStats(t *testing.T) {
 	repoB := h.mustRepoAt("beta", "/tmp/beta")
 	now := time.Now()
 
-	InsertCommit(h.db, repoA, "a1", "alice", "msg", "", "main", now)
-	InsertCommit(h.db, repoA, "a2", "alice", "msg", "", "main", now.Add(time.Minute))
-	InsertCommit(h.db, repoB, "b1", "bob", "msg", "", "main", now.Add(2*time.Minute))
-	UpdateReviewStatus(h.db, "a2", "reviewed", "")
+	InsertCommit(h.db, repoA, "a1", "alice", "msg", "", "main", now, nil)
+	InsertCommit(h.db, repoA, "a2", "alice", "msg", "", "main", now.Add(time.Minute), nil)
+	InsertCommit(h.db, repoB, "b1", "bob", "msg", "", "main", now.Add(2*time.Minute), nil)
+	UpdateReviewStatus(h.db, repoA, "a2", "reviewed", "", "tester")
 
 	stats, err := GetAggregateStats(h.db, []int64{repoA, repoB})
 	if err != nil {
@@ -327,3 +460,1273 @@ func TestListActiveRepos(t *testing.T) {
 		t.Fatalf("len = %d, want 2", len(repos))
 	}
 }
+
+func TestKnownHashes(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	now := time.Now()
+
+	InsertCommit(h.db, repoID, "a", "alice", "msg", "", "main", now, nil)
+	InsertCommit(h.db, repoID, "b", "bob", "msg", "", "main", now, nil)
+
+	known, err := KnownHashes(h.db, repoID, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !known["a"] || !known["b"] || known["c"] {
+		t.Errorf("known = %v", known)
+	}
+}
+
+func TestSetRepoActive(t *testing.T) {
+	h := testDB(t)
+	id := h.mustRepoAt("alpha", "/tmp/alpha")
+	h.mustRepoAt("beta", "/tmp/beta")
+
+	if err := SetRepoActive(h.db, id, false); err != nil {
+		t.Fatal(err)
+	}
+	repos, err := ListActiveRepos(h.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Name != "beta" {
+		t.Fatalf("active = %+v, want only beta", repos)
+	}
+
+	h.mustRepoAt("alpha", "/tmp/alpha")
+	repos, _ = ListActiveRepos(h.db)
+	if len(repos) != 1 {
+		t.Errorf("upsert should not reactivate, active = %d", len(repos))
+	}
+
+	SetRepoActive(h.db, id, true)
+	repos, _ = ListActiveRepos(h.db)
+	if len(repos) != 2 {
+		t.Errorf("active = %d, want 2", len(repos))
+	}
+}
+
+func TestDeleteRepo(t *testing.T) {
+	h := testDB(t)
+	keep := h.mustRepoAt("keep", "/tmp/keep")
+	purge := h.mustRepoAt("purge", "/tmp/purge")
+	now := time.Now()
+	InsertCommit(h.db, keep, "k1", "alice", "msg", "", "main", now, nil)
+	InsertCommit(h.db, purge, "p1", "bob", "msg", "", "main", now, nil)
+	InsertEvent(h.db, purge, EventRefDeleted, "p1", "")
+
+	if err := DeleteRepo(h.db, keep, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRepo(h.db, purge, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := GetRepoByPath(h.db, "/tmp/keep"); r == nil || r.Active {
+		t.Error("kept repo should remain as inactive")
+	}
+	if r, _ := GetRepoByPath(h.db, "/tmp/purge"); r != nil {
+		t.Error("purged repo row should be gone")
+	}
+	if known, _ := KnownHashes(h.db, keep, []string{"k1"}); !known["k1"] {
+		t.Error("kept repo's commits should remain")
+	}
+	if known, _ := KnownHashes(h.db, purge, []string{"p1"}); known["p1"] {
+		t.Error("purged repo's commits should be gone")
+	}
+	var events int
+	h.db.QueryRow(`SELECT COUNT(*) FROM events WHERE commit_hash = 'p1'`).Scan(&events)
+	if events != 0 {
+		t.Errorf("events for purged commit = %d, want 0", events)
+	}
+}
+
+func TestSameCommitInTwoRepos(t *testing.T) {
+	h := testDB(t)
+	fork := h.mustRepoAt("fork", "/tmp/fork")
+	upstream := h.mustRepoAt("upstream", "/tmp/upstream")
+	now := time.Now()
+
+	if err := InsertCommit(h.db, fork, "abc123", "alice", "msg", "", "main", now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertCommit(h.db, upstream, "abc123", "alice", "msg", "", "main", now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReviewStatus(h.db, fork, "abc123", "reviewed", "fork only", "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	forkStats, _ := GetStats(h.db, fork)
+	upStats, _ := GetStats(h.db, upstream)
+	if forkStats.Reviewed != 1 || upStats.Unreviewed != 1 {
+		t.Errorf("fork = %+v, upstream = %+v", forkStats, upStats)
+	}
+	all, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{fork, upstream}})
+	if len(all) != 2 {
+		t.Fatalf("commits = %d, want one per repo", len(all))
+	}
+	if types := eventTypes(t, h, upstream, "abc123"); len(types) != 1 {
+		t.Errorf("upstream events = %v, want detection only", types)
+	}
+}
+
+func TestSharedReview(t *testing.T) {
+	h := testDB(t)
+	fork := h.mustRepoAt("fork", "/tmp/fork")
+	upstream := h.mustRepoAt("upstream", "/tmp/upstream")
+	mirror := h.mustRepoAt("mirror", "/tmp/mirror")
+	now := time.Now()
+
+	InsertCommit(h.db, fork, "abc123", "alice", "msg", "", "main", now, nil)
+	InsertCommit(h.db, upstream, "abc123", "alice", "msg", "", "main", now, nil)
+	if err := UpdateSharedReviewStatus(h.db, "abc123", "reviewed", "lgtm", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{fork, upstream} {
+		commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{id}, Status: FilterReviewed})
+		if len(commits) != 1 || commits[0].Note != "lgtm" {
+			t.Errorf("repo %d = %+v", id, commits)
+		}
+	}
+
+	InsertCommit(h.db, mirror, "abc123", "alice", "msg", "", "main", now, nil)
+	InsertCommit(h.db, mirror, "def456", "bob", "msg", "", "main", now, nil)
+	n, err := InheritSharedReview(h.db, mirror, []string{"abc123", "def456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("inherited = %d, want 1", n)
+	}
+	commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{mirror}, Status: FilterReviewed})
+	if len(commits) != 1 || commits[0].Hash != "abc123" || commits[0].Note != "lgtm" || commits[0].ReviewedAt == nil {
+		t.Errorf("mirror reviewed = %+v", commits)
+	}
+	got := eventTypes(t, h, mirror, "abc123")
+	want := []string{EventDetected, EventStatusChanged, EventNoteEdited, EventRuleApplied}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	if n, _ := InheritSharedReview(h.db, mirror, []string{"abc123"}); n != 0 {
+		t.Error("a commit with its own review should not inherit again")
+	}
+}
+
+func TestSearchCommits(t *testing.T) {
+	h := testDB(t)
+	alpha := h.mustRepoAt("alpha", "/tmp/alpha")
+	beta := h.mustRepoAt("beta", "/tmp/beta")
+	now := time.Now()
+
+	InsertCommit(h.db, alpha, "a1", "alice", "Fix watcher leak", "", "main", now, []string{"internal/watcher/watcher.go"})
+	InsertCommit(h.db, alpha, "a2", "bob", "Tidy docs", "mentions the watcher once", "main", now, nil)
+	InsertCommit(h.db, alpha, "a3", "carol", "Bump deps", "", "main", now, []string{"go.mod"})
+	InsertCommit(h.db, beta, "b1", "dave", "Watcher rewrite", "", "main", now, nil)
+	UpdateReviewStatus(h.db, alpha, "a3", "reviewed", "check the lockfile", "tester")
+
+	results, err := SearchCommits(h.db, []int64{alpha}, "watch", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Hash != "a1" || results[1].Hash != "a2" {
+		t.Fatalf("results = %+v, want subject match ranked above body match", results)
+	}
+	if results[0].SubjectMatch != "Fix "+MatchStart+"watcher"+MatchEnd+" leak" {
+		t.Errorf("subject = %q", results[0].SubjectMatch)
+	}
+	if !strings.Contains(results[1].Snippet, MatchStart+"watcher"+MatchEnd) {
+		t.Errorf("snippet = %q", results[1].Snippet)
+	}
+
+	for query, want := range map[string]string{
+		"lockfile":   "a3",
+		"go.mod":     "a3",
+		"carol":      "a3",
+		"fix leak":   "a1",
+		`"unclosed`:  "",
+		"watcher.go": "a1",
+	} {
+		results, err := SearchCommits(h.db, []int64{alpha}, query, 10)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		got := ""
+		if len(results) > 0 {
+			got = results[0].Hash
+		}
+		if got != want {
+			t.Errorf("%q: top = %q, want %q", query, got, want)
+		}
+	}
+
+	UpdateReviewStatus(h.db, alpha, "a3", "reviewed", "", "tester")
+	if results, _ := SearchCommits(h.db, []int64{alpha}, "lockfile", 10); len(results) != 0 {
+		t.Error("cleared note should leave the index")
+	}
+	DeleteRepo(h.db, alpha, true)
+	if results, _ := SearchCommits(h.db, []int64{alpha, beta}, "watcher", 10); len(results) != 1 || results[0].Hash != "b1" {
+		t.Errorf("after purge = %+v", results)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "a", "alice", "msg", "", "main", time.Now(), nil)
+	InsertCommit(h.db, repoID, "b", "bob", "msg", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "b", "reviewed", "", "tester")
+
+	security, err := CreateLabel(h.db, "security", "#ef5350")
+	if err != nil {
+		t.Fatal(err)
+	}
+	perf, _ := CreateLabel(h.db, "perf", "")
+	if again, _ := CreateLabel(h.db, "Security", ""); again != security {
+		t.Errorf("names should be case-insensitive, got id %d want %d", again, security)
+	}
+
+	if err := AddLabel(h.db, repoID, "a", security); err != nil {
+		t.Fatal(err)
+	}
+	AddLabel(h.db, repoID, "a", security)
+	AddLabel(h.db, repoID, "b", security)
+	AddLabel(h.db, repoID, "a", perf)
+	if err := AddLabel(h.db, repoID, "missing", perf); err == nil {
+		t.Error("labeling an unknown commit should fail")
+	}
+
+	commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	for _, c := range commits {
+		if c.Hash == "a" && (len(c.Labels) != 2 || c.Labels[0].Name != "perf" || c.Labels[1].Color != "#ef5350") {
+			t.Errorf("labels on a = %+v", c.Labels)
+		}
+	}
+
+	stats, err := GetLabelStats(h.db, []int64{repoID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[1].Name != "security" || stats[1].Total != 2 || stats[1].Unreviewed != 1 || stats[0].Total != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	RemoveLabel(h.db, repoID, "a", security)
+	events, _ := ListEvents(h.db, repoID, "a")
+	if got := eventTypes(t, h, repoID, "a"); strings.Join(got, ",") != "detected,label_added,label_added,label_removed" {
+		t.Fatalf("events = %v", got)
+	}
+	if err := UndoEvent(h.db, events[len(events)-1].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	commits, _ = QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}, Status: FilterUnreviewed})
+	if len(commits[0].Labels) != 2 {
+		t.Errorf("undo should put the label back, got %+v", commits[0].Labels)
+	}
+
+	if err := DeleteLabel(h.db, security); err != nil {
+		t.Fatal(err)
+	}
+	commits, _ = QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}, Status: FilterUnreviewed})
+	if len(commits[0].Labels) != 1 || commits[0].Labels[0].ID != perf {
+		t.Errorf("after delete = %+v", commits[0].Labels)
+	}
+}
+
+func TestApplyRuleLabel(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "a", "alice", "msg", "", "main", time.Now(), nil)
+
+	added, err := ApplyRuleLabel(h.db, repoID, "a", "cve", "security", "#ef5350")
+	if err != nil || !added {
+		t.Fatalf("added = %v, %v", added, err)
+	}
+	if added, _ := ApplyRuleLabel(h.db, repoID, "a", "cve", "security", ""); added {
+		t.Error("applying twice should be a no-op")
+	}
+
+	events, _ := ListEvents(h.db, repoID, "a")
+	var d RuleDecision
+	json.Unmarshal([]byte(events[len(events)-1].Payload), &d)
+	if len(events) != 2 || events[1].Type != EventRuleApplied || d.Rule != "cve" || d.Value != "security" {
+		t.Errorf("events = %+v, decision = %+v", events, d)
+	}
+	labels, _ := ListLabels(h.db)
+	if len(labels) != 1 || labels[0].Color != "#ef5350" {
+		t.Errorf("labels = %+v", labels)
+	}
+}
+
+func TestArchiveCommits(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	now := time.Now()
+	for _, hash := range []string{"old-reviewed", "old-ignored", "old-open", "fresh"} {
+		if err := InsertCommit(h.db, repoID, hash, "alice", "subject "+hash, "body", "main", now, []string{"a.go"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	UpdateReviewStatus(h.db, repoID, "old-reviewed", "reviewed", "looked fine", "tester")
+	UpdateReviewStatus(h.db, repoID, "old-reviewed", "reviewed", "looked fine", "alice")
+	UpdateReviewStatus(h.db, repoID, "old-ignored", "ignored", "", "")
+	UpdateReviewStatus(h.db, repoID, "fresh", "reviewed", "", "tester")
+	id, _ := CreateLabel(h.db, "keep", "")
+	AddLabel(h.db, repoID, "old-reviewed", id)
+
+	// Age everything but "fresh" past the cutoff.
+	cutoff := now.Add(-24 * time.Hour)
+	old := cutoff.Add(-time.Hour).UTC().Format("2006-01-02 15:04:05")
+	h.db.Exec(`UPDATE commits SET detected_at = ? WHERE hash != 'fresh'`, old)
+	h.db.Exec(`UPDATE events SET created_at = ? WHERE commit_hash != 'fresh'`, old)
+
+	n, err := ArchiveCommits(h.db, cutoff, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("archived = %d, want 2", n)
+	}
+	left, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	if len(left) != 2 {
+		t.Errorf("board keeps %d commits, want old-open and fresh", len(left))
+	}
+	if found, _ := SearchCommits(h.db, []int64{repoID}, "old-reviewed", 10); len(found) != 0 {
+		t.Errorf("archived commit still searchable: %+v", found)
+	}
+
+	archived, err := ListArchived(h.db, nil, "fine", 10)
+	if err != nil || len(archived) != 1 {
+		t.Fatalf("archived = %+v, %v", archived, err)
+	}
+	a := archived[0]
+	if a.Hash != "old-reviewed" || a.Status != "reviewed" || a.Body != "body" || len(a.Labels) != 1 || a.Labels[0].Name != "keep" || a.Files[0] != "a.go" {
+		t.Errorf("archived commit = %+v", a)
+	}
+	if strings.Join(a.Approvers, ",") != "tester,alice" || a.ReviewedBy != "tester" {
+		t.Errorf("archived approvals = %v by %q, want tester,alice", a.Approvers, a.ReviewedBy)
+	}
+
+	// Seeing the commits again must not put them back on the board.
+	for _, hash := range []string{"old-reviewed", "old-ignored"} {
+		if err := InsertCommit(h.db, repoID, hash, "alice", "again", "", "main", now, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if left, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}}); len(left) != 2 {
+		t.Errorf("re-ingest resurrected archived commits: %d on board", len(left))
+	}
+	known, _ := KnownHashes(h.db, repoID, []string{"old-reviewed", "fresh", "new"})
+	if !known["old-reviewed"] || !known["fresh"] || known["new"] {
+		t.Errorf("known = %v", known)
+	}
+
+	before, after, err := Compact(h.db)
+	if err != nil || before <= 0 || after <= 0 {
+		t.Errorf("compact = %d, %d, %v", before, after, err)
+	}
+}
+
+func TestPurgeCommits(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "gone", "alice", "secret subject", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "gone", "reviewed", "note", "tester")
+
+	n, err := ArchiveCommits(h.db, time.Now().Add(time.Hour), true)
+	if err != nil || n != 1 {
+		t.Fatalf("purged = %d, %v", n, err)
+	}
+	if events, _ := ListEvents(h.db, repoID, "gone"); len(events) != 0 {
+		t.Errorf("purge left %d events", len(events))
+	}
+	if archived, _ := ListArchived(h.db, nil, "", 10); len(archived) != 0 {
+		t.Errorf("purged commits listed: %+v", archived)
+	}
+	var subject string
+	h.db.QueryRow(`SELECT subject FROM archived_commits WHERE hash = 'gone'`).Scan(&subject)
+	if subject != "" {
+		t.Errorf("purge kept subject %q", subject)
+	}
+
+	InsertCommit(h.db, repoID, "gone", "alice", "secret subject", "", "main", time.Now(), nil)
+	if left, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}}); len(left) != 0 {
+		t.Error("re-ingest resurrected a purged commit")
+	}
+}
+
+func TestIngestCommitsIsAtomic(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	batch := []NewCommit{
+		{Hash: "one", Author: "alice", Subject: "one", CommittedAt: time.Now()},
+		{Hash: "bad", Author: "alice", Subject: "bad", CommittedAt: time.Now()},
+	}
+	_, err := h.db.Exec(`CREATE TRIGGER fail_bad BEFORE INSERT ON commits WHEN new.hash = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'boom'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := IngestCommits(h.db, repoID, batch, "bad"); err == nil {
+		t.Fatal("expected error")
+	}
+	if commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}}); len(commits) != 0 {
+		t.Errorf("failed batch left %d commits", len(commits))
+	}
+	repo, _ := GetRepoByPath(h.db, "/tmp/test")
+	if repo.LastCommitHash != "" {
+		t.Errorf("failed batch moved the cursor to %q", repo.LastCommitHash)
+	}
+
+	h.db.Exec(`DROP TRIGGER fail_bad`)
+	added, err := IngestCommits(h.db, repoID, append(batch, batch[0]), "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 2 {
+		t.Errorf("added = %v, want one and bad once each", added)
+	}
+	if again, _ := IngestCommits(h.db, repoID, batch, ""); len(again) != 0 {
+		t.Errorf("re-ingest added %v", again)
+	}
+	repo, _ = GetRepoByPath(h.db, "/tmp/test")
+	if repo.LastCommitHash != "bad" {
+		t.Errorf("cursor = %q", repo.LastCommitHash)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "fine", "alice", "fine", "", "main", time.Now(), nil)
+	InsertCommit(h.db, repoID, "unindexed", "alice", "needle", "", "main", time.Now(), nil)
+
+	// Damage of the kind a crash between statements, or a build without
+	// foreign keys, could leave behind.
+	h.db.Exec("PRAGMA foreign_keys=OFF")
+	stmts := []string{
+		`INSERT INTO commits (repo_id, hash, author, subject, committed_at) VALUES (1, 'no-review', 'bob', 'x', '2024-01-01')`,
+		`INSERT INTO review_state (repo_id, commit_hash) VALUES (1, 'no-commit')`,
+		`DELETE FROM commit_search WHERE rowid = (SELECT id FROM commits WHERE hash = 'unindexed')`,
+		`UPDATE repositories SET last_commit_hash = 'never-stored'`,
+	}
+	for _, stmt := range stmts {
+		if _, err := h.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.db.Exec("PRAGMA foreign_keys=ON")
+
+	r, err := Repair(h.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Repairs{ReviewRows: 1, Orphans: 1, SearchRows: 1, LostCursors: 1}
+	if r != want {
+		t.Errorf("repairs = %+v, want %+v", r, want)
+	}
+	if commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}, Status: FilterUnreviewed}); len(commits) != 3 {
+		t.Errorf("unreviewed = %d, want 3", len(commits))
+	}
+	if found, _ := SearchCommits(h.db, []int64{repoID}, "needle", 10); len(found) != 1 {
+		t.Errorf("search after repair = %+v", found)
+	}
+
+	if r, _ := Repair(h.db); r.Total() != 0 {
+		t.Errorf("second repair = %+v", r)
+	}
+}
+
+// benchCommits returns n commits shaped like a seeded history.
+func benchCommits(n int) []NewCommit {
+	commits := make([]NewCommit, n)
+	now := time.Now()
+	for i := range commits {
+		commits[i] = NewCommit{
+			Hash:        fmt.Sprintf("%040x", i),
+			Author:      "alice",
+			Subject:     fmt.Sprintf("change %d", i),
+			Body:        "details about the change",
+			Branch:      "main",
+			CommittedAt: now.Add(-time.Duration(i) * time.Minute),
+			Files:       []string{"internal/db/commit.go", "README.md"},
+		}
+	}
+	return commits
+}
+
+func BenchmarkIngestCommits10k(b *testing.B) {
+	commits := benchCommits(10000)
+	for i := 0; b.Loop(); i++ {
+		db, err := Open(filepath.Join(b.TempDir(), fmt.Sprintf("bench%d.db", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		repoID, _ := UpsertRepo(db, "bench", "/tmp/bench")
+		if _, err := IngestCommits(db, repoID, commits, commits[0].Hash); err != nil {
+			b.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+// BenchmarkInsertCommit10k is the per-commit baseline IngestCommits replaced.
+func BenchmarkInsertCommit10k(b *testing.B) {
+	commits := benchCommits(10000)
+	for i := 0; b.Loop(); i++ {
+		db, err := Open(filepath.Join(b.TempDir(), fmt.Sprintf("bench%d.db", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		repoID, _ := UpsertRepo(db, "bench", "/tmp/bench")
+		for _, c := range commits {
+			if err := InsertCommit(db, repoID, c.Hash, c.Author, c.Subject, c.Body, c.Branch, c.CommittedAt, c.Files); err != nil {
+				b.Fatal(err)
+			}
+		}
+		db.Close()
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "apollo.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoID, _ := UpsertRepo(db, "test", "/tmp/test")
+	InsertCommit(db, repoID, "kept", "alice", "kept", "", "main", time.Now(), nil)
+	UpdateReviewStatus(db, repoID, "kept", "reviewed", "evidence", "tester")
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := Backup(db, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(db, backup); err == nil {
+		t.Error("backup should refuse to overwrite")
+	}
+	if v, err := CheckBackup(backup); err != nil || v != LatestVersion() {
+		t.Fatalf("check = %d, %v", v, err)
+	}
+
+	InsertCommit(db, repoID, "later", "alice", "later", "", "main", time.Now(), nil)
+	db.Close()
+
+	saved, err := Restore(backup, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(saved); err != nil {
+		t.Errorf("pre-restore copy: %v", err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	commits, _ := QueryCommits(db, CommitQuery{RepoIDs: []int64{repoID}})
+	if len(commits) != 1 || commits[0].Note != "evidence" {
+		t.Errorf("restored commits = %+v", commits)
+	}
+	if events, _ := ListEvents(db, repoID, "kept"); len(events) < 2 {
+		t.Errorf("restored history = %+v", events)
+	}
+}
+
+func TestCheckBackupRejects(t *testing.T) {
+	dir := t.TempDir()
+
+	junk := filepath.Join(dir, "junk.db")
+	os.WriteFile(junk, []byte("not a database"), 0600)
+	if _, err := CheckBackup(junk); err == nil {
+		t.Error("accepted a non-database file")
+	}
+
+	other := filepath.Join(dir, "other.db")
+	raw, _ := sql.Open("sqlite", "file:"+other)
+	raw.Exec(`CREATE TABLE notes (body TEXT)`)
+	raw.Close()
+	if _, err := CheckBackup(other); err == nil || !strings.Contains(err.Error(), "not an apollo database") {
+		t.Errorf("err = %v", err)
+	}
+
+	future := filepath.Join(dir, "future.db")
+	db, _ := Open(future)
+	db.Exec(`INSERT INTO schema_version (version, name) VALUES (?, 'future')`, LatestVersion()+1)
+	db.Close()
+	if _, err := CheckBackup(future); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := Restore(future, filepath.Join(dir, "apollo.db")); err == nil {
+		t.Error("restored a backup from a newer schema")
+	}
+}
+
+func TestScheduledBackupRotates(t *testing.T) {
+	h := testDB(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	// Backups older than the interval, as a previous run would have left.
+	os.MkdirAll(dir, 0700)
+	for i := 1; i <= 3; i++ {
+		stamp := time.Now().Add(-time.Duration(i) * 48 * time.Hour).Format(backupStamp)
+		os.WriteFile(filepath.Join(dir, backupPrefix+stamp+backupExt), nil, 0600)
+	}
+	os.WriteFile(filepath.Join(dir, "apollo-manual.db"), nil, 0600)
+
+	path, err := ScheduledBackup(h.db, dir, 24*time.Hour, 2)
+	if err != nil || path == "" {
+		t.Fatalf("backup = %q, %v", path, err)
+	}
+	backups, _ := ListBackups(dir)
+	if len(backups) != 2 || backups[1] != path {
+		t.Errorf("backups = %v, want the newest two", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apollo-manual.db")); err != nil {
+		t.Error("rotation removed a file it didn't write")
+	}
+
+	if path, err := ScheduledBackup(h.db, dir, 24*time.Hour, 2); err != nil || path != "" {
+		t.Errorf("second backup = %q, %v; none should be due", path, err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := testDB(t)
+	repoID := src.mustRepo()
+	when := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	InsertCommit(src.db, repoID, "aaa", "alice", "first", "body", "main", when, []string{"a.go"})
+	InsertCommit(src.db, repoID, "bbb", "bob", "second", "", "main", when.AddDate(0, 1, 0), nil)
+	UpdateReviewStatus(src.db, repoID, "aaa", "ignored", "", "")
+	UpdateReviewStatus(src.db, repoID, "aaa", "reviewed", "audited", "tester")
+	id, _ := CreateLabel(src.db, "security", "#ef5350")
+	AddLabel(src.db, repoID, "aaa", id)
+	events, _ := ListEvents(src.db, repoID, "aaa")
+	if err := UndoEvent(src.db, events[len(events)-1].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	AddLabel(src.db, repoID, "aaa", id)
+
+	data, err := ExportData(src.db, ExportFilter{Status: FilterReviewed, Until: when.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(data)
+	var decoded Export
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(decoded.Repositories[0].Commits); n != 1 {
+		t.Fatalf("exported %d commits, want only the reviewed one before the cutoff", n)
+	}
+
+	dst := testDB(t)
+	// Row ids differ on the other machine.
+	dst.mustRepoAt("other", "/elsewhere")
+	CreateLabel(dst.db, "unrelated", "")
+	res, err := ImportData(dst.db, decoded, ImportOptions{Source: "export.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Added != 1 || res.Repos != 1 {
+		t.Errorf("result = %+v", res)
+	}
+
+	repo, _ := GetRepoByPath(dst.db, "/tmp/test")
+	commits, _ := QueryCommits(dst.db, CommitQuery{RepoIDs: []int64{repo.ID}})
+	if len(commits) != 1 {
+		t.Fatalf("imported commits = %+v", commits)
+	}
+	c := commits[0]
+	if c.Status != "reviewed" || c.Note != "audited" || c.Body != "body" || len(c.Labels) != 1 || c.Labels[0].Color != "#ef5350" {
+		t.Errorf("imported commit = %+v", c)
+	}
+	if found, _ := SearchCommits(dst.db, []int64{repo.ID}, "a.go", 10); len(found) != 1 {
+		t.Error("imported commit should be searchable by file")
+	}
+
+	history, _ := ListEvents(dst.db, repo.ID, "aaa")
+	if len(history) != len(events)+3 {
+		t.Fatalf("history = %d events, want the %d exported plus undo, re-label and import", len(history), len(events))
+	}
+	undone := UndoneEvents(history)
+	var label LabelChange
+	json.Unmarshal([]byte(history[len(history)-2].Payload), &label)
+	if len(undone) != 1 || label.LabelID != c.Labels[0].ID {
+		t.Errorf("event references not remapped: undone %v, label %+v", undone, label)
+	}
+	var rule RuleDecision
+	json.Unmarshal([]byte(history[len(history)-1].Payload), &rule)
+	if rule.Rule != "import" || rule.Value != "export.json" {
+		t.Errorf("last event = %+v", rule)
+	}
+
+	if res, _ := ImportData(dst.db, decoded, ImportOptions{}); res.Unchanged != 1 || res.Added != 0 {
+		t.Errorf("re-import = %+v", res)
+	}
+}
+
+func TestImportMergePolicies(t *testing.T) {
+	incoming := Export{Format: 1, Repositories: []ExportedRepo{{Path: "/tmp/test", Commits: []ExportedCommit{
+		{Hash: "untouched", Status: "reviewed", Note: "theirs"},
+		{Hash: "mine", Status: "ignored", Note: "theirs", Labels: []string{"imported"}},
+	}}}}
+
+	for _, tt := range []struct {
+		policy    MergePolicy
+		untouched string
+		mine      string
+		labels    int
+	}{
+		{MergeFill, "reviewed", "reviewed", 1},
+		{MergeOurs, "unreviewed", "reviewed", 0},
+		{MergeTheirs, "reviewed", "ignored", 1},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			h := testDB(t)
+			repoID := h.mustRepo()
+			InsertCommit(h.db, repoID, "untouched", "alice", "one", "", "main", time.Now(), nil)
+			InsertCommit(h.db, repoID, "mine", "alice", "two", "", "main", time.Now(), nil)
+			UpdateReviewStatus(h.db, repoID, "mine", "reviewed", "ours", "tester")
+
+			if _, err := ImportData(h.db, incoming, ImportOptions{Policy: tt.policy}); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]CommitRow)
+			commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+			for _, c := range commits {
+				got[c.Hash] = c
+			}
+			if got["untouched"].Status != tt.untouched || got["mine"].Status != tt.mine || len(got["mine"].Labels) != tt.labels {
+				t.Errorf("untouched %s, mine %s with %d labels", got["untouched"].Status, got["mine"].Status, len(got["mine"].Labels))
+			}
+		})
+	}
+
+	h := testDB(t)
+	if _, err := ImportData(h.db, incoming, ImportOptions{Policy: "newest"}); err == nil {
+		t.Error("unknown policy accepted")
+	}
+	res, err := ImportData(h.db, incoming, ImportOptions{DryRun: true})
+	if err != nil || res.Added != 2 {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+	if repos, _ := ListRepos(h.db); len(repos) != 0 {
+		t.Error("dry run wrote to the database")
+	}
+}
+
+func TestImportRequiredApprovals(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	SetRequiredApprovals(h.db, repoID, 2)
+	InsertCommit(h.db, repoID, "sent-back", "alice", "one", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "sent-back", "reviewed", "", "alice")
+	UpdateReviewStatus(h.db, repoID, "sent-back", "reviewed", "", "bob")
+
+	at := time.Now().Add(-time.Hour)
+	incoming := Export{Format: 1, Repositories: []ExportedRepo{{Path: "/tmp/test", Commits: []ExportedCommit{
+		{Hash: "short", Status: "reviewed", ReviewedBy: "carol", ReviewedAt: &at},
+		{Hash: "enough", Status: "reviewed", ReviewedBy: "carol", ReviewedAt: &at, Approvals: []Approval{
+			{Reviewer: "carol", ApprovedAt: at}, {Reviewer: "dave", ApprovedAt: at},
+		}},
+		{Hash: "sent-back", Status: "unreviewed"},
+		{Hash: "unsigned", Status: "reviewed", ReviewedAt: &at},
+		{Hash: "nameless", Status: "reviewed", ReviewedBy: "carol", ReviewedAt: &at, Approvals: []Approval{
+			{Reviewer: "carol", ApprovedAt: at}, {Reviewer: "", ApprovedAt: at},
+		}},
+	}}}}
+	if _, err := ImportData(h.db, incoming, ImportOptions{Policy: MergeTheirs}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]CommitRow)
+	commits, _ := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+	for _, c := range commits {
+		got[c.Hash] = c
+	}
+	if c := got["short"]; c.Status != "unreviewed" || c.ReviewedBy != "" || strings.Join(c.Approvers, ",") != "carol" {
+		t.Errorf("one of two approvals imported as %+v", c)
+	}
+	if c := got["enough"]; c.Status != "reviewed" || c.ReviewedBy != "carol" || len(c.Approvers) != 2 {
+		t.Errorf("two of two approvals imported as %+v", c)
+	}
+	if c := got["sent-back"]; c.Status != "unreviewed" || len(c.Approvers) != 0 {
+		t.Errorf("imported unreviewed left %+v", c)
+	}
+	// A review nobody signed brings no approval, and stays reviewed as
+	// migrated ones do.
+	if c := got["unsigned"]; c.Status != "reviewed" || len(c.Approvers) != 0 {
+		t.Errorf("unsigned review imported as %+v", c)
+	}
+	if c := got["nameless"]; c.Status != "unreviewed" || strings.Join(c.Approvers, ",") != "carol" {
+		t.Errorf("approval without a reviewer imported as %+v", c)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "aaa", "alice", "subject, with comma", "", "main", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), nil)
+	UpdateReviewStatus(h.db, repoID, "aaa", "reviewed", "multi\nline", "tester")
+	a, _ := CreateLabel(h.db, "a", "")
+	b, _ := CreateLabel(h.db, "b", "")
+	AddLabel(h.db, repoID, "aaa", a)
+	AddLabel(h.db, repoID, "aaa", b)
+
+	data, err := ExportData(h.db, ExportFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := WriteCSV(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadCSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := back.Repositories[0].Commits[0]
+	if back.Repositories[0].Path != "/tmp/test" || c.Subject != "subject, with comma" || c.Note != "multi\nline" ||
+		c.Status != "reviewed" || c.ReviewedAt == nil || len(c.Labels) != 2 || !c.CommittedAt.Equal(data.Repositories[0].Commits[0].CommittedAt) {
+		t.Errorf("csv round trip = %+v", c)
+	}
+
+	if _, err := ReadCSV(strings.NewReader("hash,status\nabc,reviewed\n")); err == nil {
+		t.Error("csv without repo_path accepted")
+	}
+	sheet := "repo_path,hash,status,note\n/tmp/test,bbb,ignored,from a spreadsheet\n"
+	trimmed, err := ReadCSV(strings.NewReader(sheet))
+	if err != nil || trimmed.Repositories[0].Commits[0].Status != "ignored" {
+		t.Errorf("trimmed csv = %+v, %v", trimmed, err)
+	}
+}
+
+func TestRebindRepo(t *testing.T) {
+	h := testDB(t)
+	oldID := h.mustRepoAt("apollo", "/code/apollo")
+	now := time.Now()
+	InsertCommit(h.db, oldID, "aaa", "alice", "root", "", "main", now, nil)
+	InsertCommit(h.db, oldID, "bbb", "alice", "second", "", "main", now, nil)
+	UpdateReviewStatus(h.db, oldID, "aaa", "reviewed", "looked fine", "tester")
+	if err := SetRepoIdentity(h.db, oldID, []string{"aaa"}, []string{"git@example.com:apollo"}); err != nil {
+		t.Fatal(err)
+	}
+	forkID := h.mustRepoAt("fork", "/code/fork")
+	SetRepoIdentity(h.db, forkID, []string{"aaa"}, []string{"git@example.com:someone/apollo"})
+
+	// The moved checkout has been opened once and seen one commit more.
+	newID := h.mustRepoAt("apollo", "/work/apollo")
+	InsertCommit(h.db, newID, "aaa", "alice", "root", "", "main", now, nil)
+	InsertCommit(h.db, newID, "bbb", "alice", "second", "", "main", now, nil)
+	InsertCommit(h.db, newID, "ccc", "alice", "third", "", "main", now, nil)
+	UpdateReviewStatus(h.db, newID, "ccc", "ignored", "", "")
+	UpdateLastCommitHash(h.db, newID, "ccc")
+	SetRepoIdentity(h.db, newID, []string{"aaa"}, []string{"git@example.com:apollo"})
+
+	found, err := FindReposByIdentity(h.db, newID, []string{"aaa"}, []string{"git@example.com:apollo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != oldID {
+		t.Fatalf("candidates = %+v, want only the old row", found)
+	}
+
+	if err := RebindRepo(h.db, oldID, "/work/apollo", "apollo"); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := GetRepoByPath(h.db, "/work/apollo")
+	if err != nil || repo == nil || repo.ID != oldID {
+		t.Fatalf("repo at new path = %+v, %v", repo, err)
+	}
+	if repo.LastCommitHash != "ccc" {
+		t.Errorf("cursor = %q, want ccc", repo.LastCommitHash)
+	}
+	if gone, _ := GetRepoByPath(h.db, "/code/apollo"); gone != nil {
+		t.Error("old path still has a row")
+	}
+
+	commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{oldID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]string)
+	for _, c := range commits {
+		status[c.Hash] = c.Status
+	}
+	want := map[string]string{"aaa": "reviewed", "bbb": "unreviewed", "ccc": "ignored"}
+	if fmt.Sprint(status) != fmt.Sprint(want) {
+		t.Errorf("statuses = %v, want %v", status, want)
+	}
+	if types := eventTypes(t, h, oldID, "ccc"); len(types) == 0 {
+		t.Error("moved commit lost its events")
+	}
+	var left int
+	h.db.QueryRow(`SELECT COUNT(*) FROM commits WHERE repo_id = ?`, newID).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d commits left on the dropped row", left)
+	}
+	if ok, _ := HasRepoIdentity(h.db, oldID); !ok {
+		t.Error("identity not carried over")
+	}
+	var relocated int
+	h.db.QueryRow(`SELECT COUNT(*) FROM events WHERE repo_id = ? AND type = ?`, oldID, EventRepoRelocated).Scan(&relocated)
+	if relocated != 1 {
+		t.Errorf("relocation events = %d, want 1", relocated)
+	}
+}
+
+func TestReviewedBy(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	now := time.Now()
+	for _, hash := range []string{"aaa", "bbb", "ccc"} {
+		InsertCommit(h.db, repoID, hash, "dev", "subject "+hash, "", "main", now, nil)
+	}
+
+	UpdateReviewStatus(h.db, repoID, "aaa", "reviewed", "", "alice")
+	UpdateReviewStatus(h.db, repoID, "bbb", "reviewed", "", "alice")
+	UpdateReviewStatus(h.db, repoID, "ccc", "ignored", "", "bob")
+	UpdateReviewStatus(h.db, repoID, "aaa", "ignored", "", "bob")
+
+	by := func(hash string) string {
+		commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range commits {
+			if c.Hash == hash {
+				return c.ReviewedBy
+			}
+		}
+		return "?"
+	}
+	if got := by("aaa"); got != "bob" {
+		t.Errorf("aaa reviewed by %q, want bob", got)
+	}
+
+	events, _ := ListEvents(h.db, repoID, "aaa")
+	last := events[len(events)-1]
+	var p StatusChange
+	json.Unmarshal([]byte(last.Payload), &p)
+	if p.By != "bob" || p.FromBy != "alice" {
+		t.Errorf("status event = %+v", p)
+	}
+	if err := UndoEvent(h.db, last.ID, "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if got := by("aaa"); got != "alice" {
+		t.Errorf("after undo aaa reviewed by %q, want alice back", got)
+	}
+
+	stats, err := GetReviewerStats(h.db, []int64{repoID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ReviewerStats{{"alice", 2, 0}, {"bob", 0, 1}}
+	if fmt.Sprint(stats) != fmt.Sprint(want) {
+		t.Errorf("reviewer stats = %v, want %v", stats, want)
+	}
+}
+
+func TestQueryCommits(t *testing.T) {
+	h := testDB(t)
+	alpha := h.mustRepoAt("alpha", "/tmp/alpha")
+	beta := h.mustRepoAt("beta", "/tmp/beta")
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	add := func(repoID int64, hash, author, subject, branch string, day int, files ...string) {
+		t.Helper()
+		if err := InsertCommit(h.db, repoID, hash, author, subject, "", branch, base.AddDate(0, 0, day), files); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(alpha, "a1", "Alice Smith", "parser: handle tabs", "main", 0, "internal/parser/lex.go")
+	add(alpha, "a2", "bob", "docs: 100% coverage", "docs", 1, "README.md")
+	add(alpha, "a3", "alice smith", "db: add index", "main", 2, "internal/db/schema.go", "internal/dbx/old.go")
+	add(beta, "b1", "carol", "parser: fix crash", "main", 3, "internal/parser/parse.go")
+	UpdateReviewStatus(h.db, alpha, "a3", "reviewed", "", "bob")
+	security, _ := CreateLabel(h.db, "security", "")
+	AddLabel(h.db, beta, "b1", security)
+
+	hashes := func(q CommitQuery) string {
+		t.Helper()
+		commits, err := QueryCommits(h.db, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, c := range commits {
+			out = append(out, c.Hash)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name string
+		q    CommitQuery
+		want string
+	}{
+		{"all", CommitQuery{}, "b1,a3,a2,a1"},
+		{"repo", CommitQuery{RepoIDs: []int64{alpha}}, "a3,a2,a1"},
+		{"status", CommitQuery{Status: FilterReviewed}, "a3"},
+		{"author ignores case", CommitQuery{Author: "ALICE"}, "a3,a1"},
+		{"author is not a pattern", CommitQuery{Author: "%"}, ""},
+		{"branch", CommitQuery{Branch: "docs"}, "a2"},
+		{"since and until", CommitQuery{Since: base.AddDate(0, 0, 1), Until: base.AddDate(0, 0, 3)}, "a3,a2"},
+		{"label", CommitQuery{Label: security}, "b1"},
+		{"path directory", CommitQuery{Path: "internal/db/"}, "a3"},
+		{"path file", CommitQuery{Path: "README.md"}, "a2"},
+		{"text", CommitQuery{Text: "parser"}, "b1,a1"},
+		{"combined", CommitQuery{RepoIDs: []int64{alpha}, Text: "parser", Branch: "main"}, "a1"},
+		{"ascending", CommitQuery{Asc: true}, "a1,a2,a3,b1"},
+		{"by author", CommitQuery{Sort: SortAuthor, Asc: true}, "a1,a3,a2,b1"},
+	}
+	for _, tt := range tests {
+		if got := hashes(tt.q); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Paging through with the last cursor visits every commit once.
+	var pages []string
+	q := CommitQuery{Limit: 3}
+	for {
+		commits, err := QueryCommits(h.db, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page []string
+		for _, c := range commits {
+			page = append(page, c.Hash)
+		}
+		pages = append(pages, strings.Join(page, ","))
+		if len(commits) < q.Limit {
+			break
+		}
+		q.After = commits[len(commits)-1].Cursor
+	}
+	if got := strings.Join(pages, "|"); got != "b1,a3,a2|a1" {
+		t.Errorf("pages = %q", got)
+	}
+
+	if _, err := QueryCommits(h.db, CommitQuery{After: "garbage"}); !errors.Is(err, ErrBadCursor) {
+		t.Errorf("bad cursor err = %v", err)
+	}
+	commits, _ := QueryCommits(h.db, CommitQuery{Limit: 1})
+	if _, err := QueryCommits(h.db, CommitQuery{Sort: SortAuthor, After: commits[0].Cursor}); !errors.Is(err, ErrBadCursor) {
+		t.Errorf("cursor from another ordering err = %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	h := testDB(t)
+	alpha := h.mustRepoAt("alpha", "/tmp/alpha")
+	beta := h.mustRepoAt("beta", "/tmp/beta")
+	now := time.Now()
+	for i, hash := range []string{"a1", "a2", "a3", "a4"} {
+		InsertCommit(h.db, alpha, hash, "dev", "alpha "+hash, "", "main", now.Add(time.Duration(i)*time.Minute), nil)
+	}
+	InsertCommit(h.db, beta, "b1", "dev", "beta b1", "", "main", now, nil)
+
+	// Detected 1, 2 and 40 days ago; a1 and a2 reviewed after 1h and 10h.
+	detected := map[string]time.Duration{"a1": 48 * time.Hour, "a2": 24 * time.Hour, "a3": 40 * 24 * time.Hour, "a4": 3 * time.Hour, "b1": 36 * time.Hour}
+	for hash, ago := range detected {
+		h.db.Exec(`UPDATE commits SET detected_at = ? WHERE hash = ?`, now.Add(-ago).UTC(), hash)
+	}
+	for hash, wait := range map[string]time.Duration{"a1": time.Hour, "a2": 10 * time.Hour} {
+		UpdateReviewStatus(h.db, alpha, hash, "reviewed", "", "tester")
+		h.db.Exec(`UPDATE review_state SET reviewed_at = ? WHERE commit_hash = ?`, now.Add(-detected[hash]+wait), hash)
+	}
+
+	if err := SnapshotStats(h.db, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := SnapshotStats(h.db, now); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := GetMetrics(h.db, nil, now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.TimeToReview.Count != 2 || m.TimeToReview.P50 != time.Hour || m.TimeToReview.P90 != 10*time.Hour {
+		t.Errorf("time to review = %+v", m.TimeToReview)
+	}
+	if len(m.ReviewsPerDay) != 8 {
+		t.Errorf("reviews per day covers %d days, want 8", len(m.ReviewsPerDay))
+	}
+	reviews := 0
+	for _, d := range m.ReviewsPerDay {
+		reviews += d.Count
+	}
+	if reviews != 2 {
+		t.Errorf("reviews per day sum to %d, want 2", reviews)
+	}
+
+	var backlog []int
+	for _, b := range m.Backlog {
+		backlog = append(backlog, b.Count)
+	}
+	if fmt.Sprint(backlog) != "[1 1 0 1]" {
+		t.Errorf("backlog = %v, want [1 1 0 1]", backlog)
+	}
+	if len(m.Oldest) != 2 || m.Oldest[0].Hash != "a3" || m.Oldest[0].Unreviewed != 2 || m.Oldest[1].Hash != "b1" {
+		t.Errorf("oldest = %+v", m.Oldest)
+	}
+	if len(m.Snapshots) != 1 || m.Snapshots[0].Total != 5 || m.Snapshots[0].Unreviewed != 3 || m.Snapshots[0].Reviewed != 2 {
+		t.Errorf("snapshots = %+v", m.Snapshots)
+	}
+
+	m, _ = GetMetrics(h.db, []int64{beta}, now.AddDate(0, 0, -7), now)
+	if m.TimeToReview.Count != 0 || len(m.Oldest) != 1 || m.Snapshots[0].Total != 1 {
+		t.Errorf("beta only: %+v", m)
+	}
+}
+
+func TestReviewedBeforeApprovalsStaysReviewed(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	InsertCommit(h.db, repoID, "abc123", "dev", "msg", "", "main", time.Now(), nil)
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "alice")
+	// As migration 9 left reviews nobody signed: reviewed, no approvals.
+	if _, err := h.db.Exec(`DELETE FROM approvals`); err != nil {
+		t.Fatal(err)
+	}
+	SetRequiredApprovals(h.db, repoID, 2)
+	get := func() CommitRow {
+		t.Helper()
+		commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+		if err != nil || len(commits) != 1 {
+			t.Fatalf("commits = %v, %v", commits, err)
+		}
+		return commits[0]
+	}
+
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "bob")
+	c := get()
+	if c.Status != "reviewed" || c.ReviewedBy != "alice" || fmt.Sprint(c.Approvers) != "[bob]" {
+		t.Errorf("after a second reviewer approves = %s by %q %v", c.Status, c.ReviewedBy, c.Approvers)
+	}
+	UpdateReviewStatus(h.db, repoID, "abc123", "unreviewed", "", "bob")
+	if c = get(); c.Status != "unreviewed" || len(c.Approvers) != 0 {
+		t.Errorf("after sending it back = %s %v", c.Status, c.Approvers)
+	}
+}
+
+func TestRequiredApprovals(t *testing.T) {
+	h := testDB(t)
+	repoID := h.mustRepo()
+	if err := SetRequiredApprovals(h.db, repoID, 2); err != nil {
+		t.Fatal(err)
+	}
+	InsertCommit(h.db, repoID, "abc123", "dev", "msg", "", "main", time.Now(), nil)
+	get := func() CommitRow {
+		t.Helper()
+		commits, err := QueryCommits(h.db, CommitQuery{RepoIDs: []int64{repoID}})
+		if err != nil || len(commits) != 1 {
+			t.Fatalf("commits = %v, %v", commits, err)
+		}
+		return commits[0]
+	}
+	lastEvent := func() Event {
+		t.Helper()
+		events, _ := ListEvents(h.db, repoID, "abc123")
+		return events[len(events)-1]
+	}
+
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "alice")
+	c := get()
+	if c.Status != "unreviewed" || fmt.Sprint(c.Approvers) != "[alice]" || c.RequiredApprovals != 2 || c.Approved() {
+		t.Fatalf("after one approval = %s %v of %d", c.Status, c.Approvers, c.RequiredApprovals)
+	}
+	var p StatusChange
+	json.Unmarshal([]byte(lastEvent().Payload), &p)
+	if p.From != "unreviewed" || p.To != "unreviewed" || len(p.Approved) != 1 || p.Approvals != 1 || p.Required != 2 {
+		t.Errorf("approval event = %+v", p)
+	}
+
+	// Approving twice is one approval.
+	before := len(eventTypes(t, h, repoID, "abc123"))
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "alice")
+	if n := len(eventTypes(t, h, repoID, "abc123")); n != before {
+		t.Errorf("repeat approval recorded %d events", n-before)
+	}
+
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "bob")
+	if c = get(); c.Status != "reviewed" || c.ReviewedBy != "bob" || len(c.Approvers) != 2 {
+		t.Fatalf("after two approvals = %s by %q %v", c.Status, c.ReviewedBy, c.Approvers)
+	}
+
+	// Undoing bob's approval takes it back off the quota.
+	bobs := lastEvent()
+	if err := UndoEvent(h.db, bobs.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if c = get(); c.Status != "unreviewed" || fmt.Sprint(c.Approvers) != "[alice]" {
+		t.Errorf("after undo = %s %v", c.Status, c.Approvers)
+	}
+	if err := UndoEvent(h.db, lastEvent().ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if c = get(); c.Status != "reviewed" || len(c.Approvers) != 2 {
+		t.Errorf("after redo = %s %v", c.Status, c.Approvers)
+	}
+
+	// A reviewer who approved withdraws only their own approval.
+	UpdateReviewStatus(h.db, repoID, "abc123", "unreviewed", "", "alice")
+	if c = get(); c.Status != "unreviewed" || fmt.Sprint(c.Approvers) != "[bob]" {
+		t.Errorf("after alice withdraws = %s %v", c.Status, c.Approvers)
+	}
+	// Anyone else sends it back for review entirely.
+	UpdateReviewStatus(h.db, repoID, "abc123", "unreviewed", "", "carol")
+	if c = get(); c.Status != "unreviewed" || len(c.Approvers) != 0 {
+		t.Errorf("after carol resets = %s %v", c.Status, c.Approvers)
+	}
+	if err := UndoEvent(h.db, lastEvent().ID, "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if c = get(); fmt.Sprint(c.Approvers) != "[bob]" {
+		t.Errorf("after undoing reset = %v", c.Approvers)
+	}
+
+	// Ignoring overrides the tally without touching it.
+	UpdateReviewStatus(h.db, repoID, "abc123", "ignored", "", "carol")
+	if c = get(); c.Status != "ignored" || fmt.Sprint(c.Approvers) != "[bob]" {
+		t.Errorf("after ignore = %s %v", c.Status, c.Approvers)
+	}
+	UpdateReviewStatus(h.db, repoID, "abc123", "reviewed", "", "alice")
+	if c = get(); c.Status != "reviewed" || c.ReviewedBy != "alice" {
+		t.Errorf("after approving ignored = %s by %q", c.Status, c.ReviewedBy)
+	}
+
+	stats, err := GetReviewerStats(h.db, []int64{repoID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%+v", stats) != "[{Reviewer:alice Reviewed:1 Ignored:0} {Reviewer:bob Reviewed:1 Ignored:0}]" {
+		t.Errorf("reviewer stats = %+v", stats)
+	}
+
+	// Approvals survive an export and import into a fresh database.
+	data, err := ExportData(h.db, ExportFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data.Repositories[0].Commits[0].Approvals; len(got) != 2 {
+		t.Fatalf("exported approvals = %+v", got)
+	}
+	other := testDB(t)
+	if _, err := ImportData(other.db, data, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	imported, _ := GetRepoByPath(other.db, data.Repositories[0].Path)
+	approvals, err := ListApprovals(other.db, imported.ID, "abc123")
+	if err != nil || len(approvals) != 2 || approvals[0].Reviewer != "bob" {
+		t.Errorf("imported approvals = %+v, %v", approvals, err)
+	}
+}
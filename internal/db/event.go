@@ -1,11 +1,312 @@
 package db
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
 
-func InsertEvent(db *sql.DB, eventType, commitHash, payload string) error {
+const (
+	EventDetected        = "detected"
+	EventNotified        = "notified"
+	EventStatusChanged   = "status_changed"
+	EventNoteEdited      = "note_edited"
+	EventRuleApplied     = "rule_applied"
+	EventRefDeleted      = "ref_deleted"
+	EventRefForceUpdated = "ref_force_updated"
+	EventCommitRewritten = "commit_rewritten"
+	EventLabelAdded      = "label_added"
+	EventLabelRemoved    = "label_removed"
+	EventRepoRelocated   = "repo_relocated"
+)
+
+var (
+	ErrNotUndoable    = errors.New("event cannot be undone")
+	ErrAlreadyUndone  = errors.New("event already undone")
+	ErrEventNotFound  = errors.New("event not found")
+	errCommitNotFound = errors.New("commit not found")
+)
+
+type Event struct {
+	ID         int64
+	RepoID     int64
+	Type       string
+	CommitHash string
+	CreatedAt  time.Time
+	Payload    string
+}
+
+// Undoable reports whether the event records a change a reviewer made by
+// hand and can take back.
+func (e Event) Undoable() bool {
+	switch e.Type {
+	case EventStatusChanged, EventNoteEdited, EventLabelAdded, EventLabelRemoved:
+		return true
+	}
+	return false
+}
+
+// Payloads, stored as JSON in events.payload. Undoes is set when the event
+// reverses an earlier one.
+
+type Detection struct {
+	RepoID int64  `json:"repo_id"`
+	Branch string `json:"branch"`
+}
+
+type Notification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// StatusChange records By, who made the change, and FromBy, who had made
+// the decision it replaced, so an undo can put the old reviewer back.
+// Approved and Withdrawn are the approvals the change added and took away,
+// leaving Approvals of Required; From and To are equal when an approval
+// didn't complete or break the quota.
+type StatusChange struct {
+	From           string     `json:"from"`
+	To             string     `json:"to"`
+	FromReviewedAt *time.Time `json:"from_reviewed_at,omitempty"`
+	By             string     `json:"by,omitempty"`
+	FromBy         string     `json:"from_by,omitempty"`
+	Approved       []Approval `json:"approved,omitempty"`
+	Withdrawn      []Approval `json:"withdrawn,omitempty"`
+	Approvals      int        `json:"approvals,omitempty"`
+	Required       int        `json:"required,omitempty"`
+	Undoes         int64      `json:"undoes,omitempty"`
+}
+
+type NoteEdit struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Undoes int64  `json:"undoes,omitempty"`
+}
+
+type LabelChange struct {
+	LabelID int64  `json:"label_id"`
+	Label   string `json:"label"`
+	Undoes  int64  `json:"undoes,omitempty"`
+}
+
+type RuleDecision struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Value  string `json:"value,omitempty"`
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// InsertEvent stores an event. A zero repoID or empty commitHash is stored
+// as NULL for events that aren't about a repo or commit.
+func InsertEvent(db *sql.DB, repoID int64, eventType, commitHash, payload string) error {
+	return insertEvent(db, repoID, eventType, commitHash, payload)
+}
+
+func insertEvent(db execer, repoID int64, eventType, commitHash, payload string) error {
+	var repo, hash any
+	if repoID != 0 {
+		repo = repoID
+	}
+	if commitHash != "" {
+		hash = commitHash
+	}
 	_, err := db.Exec(
-		`INSERT INTO events (type, commit_hash, payload) VALUES (?, ?, ?)`,
-		eventType, commitHash, payload,
+		`INSERT INTO events (repo_id, type, commit_hash, payload) VALUES (?, ?, ?, ?)`,
+		repo, eventType, hash, payload,
 	)
 	return err
 }
+
+// RecordEvent stores an event with payload encoded as JSON.
+func RecordEvent(db *sql.DB, repoID int64, eventType, commitHash string, payload any) error {
+	return recordEvent(db, repoID, eventType, commitHash, payload)
+}
+
+func recordEvent(db execer, repoID int64, eventType, commitHash string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return insertEvent(db, repoID, eventType, commitHash, string(data))
+}
+
+// ListEvents returns a commit's history in one repo, oldest first.
+func ListEvents(db *sql.DB, repoID int64, commitHash string) ([]Event, error) {
+	rows, err := db.Query(
+		`SELECT id, COALESCE(repo_id, 0), type, COALESCE(commit_hash, ''), created_at, payload
+		 FROM events WHERE repo_id = ? AND commit_hash = ? ORDER BY id`, repoID, commitHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.RepoID, &e.Type, &e.CommitHash, &e.CreatedAt, &e.Payload); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// UndoneEvents returns the IDs of the events that have been reversed.
+func UndoneEvents(events []Event) map[int64]bool {
+	undone := make(map[int64]bool)
+	for _, e := range events {
+		if id := e.undoes(); e.Undoable() && id != 0 {
+			undone[id] = true
+		}
+	}
+	return undone
+}
+
+// undoes returns the ID of the event e reverses, or zero.
+func (e Event) undoes() int64 {
+	var p struct {
+		Undoes int64 `json:"undoes"`
+	}
+	if json.Unmarshal([]byte(e.Payload), &p) != nil {
+		return 0
+	}
+	return p.Undoes
+}
+
+// UndoEvent puts back the status, note or label an event changed. The
+// reversal is itself recorded as made by by, pointing at the event it undoes.
+func UndoEvent(db *sql.DB, id int64, by string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var e Event
+	err = tx.QueryRow(`SELECT id, COALESCE(repo_id, 0), type, COALESCE(commit_hash, ''), payload FROM events WHERE id = ?`, id).
+		Scan(&e.ID, &e.RepoID, &e.Type, &e.CommitHash, &e.Payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !e.Undoable() {
+		return ErrNotUndoable
+	}
+
+	var undone int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM events WHERE type = ? AND json_extract(payload, '$.undoes') = ?`, e.Type, id,
+	).Scan(&undone)
+	if err != nil {
+		return err
+	}
+	if undone > 0 {
+		return ErrAlreadyUndone
+	}
+
+	cur, err := currentReview(tx, e.RepoID, e.CommitHash)
+	if err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case EventStatusChanged:
+		var p StatusChange
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		prev := reviewState{status: p.From, reviewedAt: p.FromReviewedAt, by: p.FromBy}
+		delta := approvalDelta{approved: p.Withdrawn, withdrawn: p.Approved}
+		if err := applyApprovals(tx, e.RepoID, e.CommitHash, delta); err != nil {
+			return err
+		}
+		if !delta.empty() {
+			if err := tally(tx, e.RepoID, e.CommitHash, &delta); err != nil {
+				return err
+			}
+		}
+		err = setStatus(tx, e.RepoID, e.CommitHash, cur, prev, delta, by, id)
+	case EventNoteEdited:
+		var p NoteEdit
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		err = setNote(tx, e.RepoID, e.CommitHash, cur, p.From, id)
+	case EventLabelAdded, EventLabelRemoved:
+		var p LabelChange
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		err = setLabel(tx, e.RepoID, e.CommitHash, p.LabelID, e.Type == EventLabelRemoved, id)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type reviewState struct {
+	status     string
+	note       string
+	reviewedAt *time.Time
+	by         string
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func currentReview(db queryRower, repoID int64, hash string) (reviewState, error) {
+	var s reviewState
+	err := db.QueryRow(`SELECT status, note, reviewed_at, reviewed_by FROM review_state WHERE repo_id = ? AND commit_hash = ?`, repoID, hash).
+		Scan(&s.status, &s.note, &s.reviewedAt, &s.by)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, errCommitNotFound
+	}
+	return s, err
+}
+
+// setStatus moves a commit from cur to next's status, reviewed_at and
+// reviewer, recording the approvals delta already applied alongside. actor
+// is who is making the change; it differs from next.by only when an undo
+// restores someone else's decision.
+func setStatus(tx *sql.Tx, repoID int64, hash string, cur, next reviewState, delta approvalDelta, actor string, undoes int64) error {
+	if next.status == cur.status && delta.empty() {
+		return nil
+	}
+	if next.status != cur.status {
+		_, err := tx.Exec(`UPDATE review_state SET status = ?, reviewed_at = ?, reviewed_by = ? WHERE repo_id = ? AND commit_hash = ?`,
+			next.status, next.reviewedAt, next.by, repoID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return recordEvent(tx, repoID, EventStatusChanged, hash, statusChange(cur, next, delta, actor, undoes))
+}
+
+func statusChange(cur, next reviewState, delta approvalDelta, actor string, undoes int64) StatusChange {
+	return StatusChange{
+		From: cur.status, To: next.status, FromReviewedAt: cur.reviewedAt,
+		By: actor, FromBy: cur.by,
+		Approved: delta.approved, Withdrawn: delta.withdrawn, Approvals: delta.count, Required: delta.required,
+		Undoes: undoes,
+	}
+}
+
+func setNote(tx *sql.Tx, repoID int64, hash string, cur reviewState, note string, undoes int64) error {
+	if note == cur.note {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE review_state SET note = ? WHERE repo_id = ? AND commit_hash = ?`, note, repoID, hash); err != nil {
+		return err
+	}
+	return recordEvent(tx, repoID, EventNoteEdited, hash, NoteEdit{From: cur.note, To: note, Undoes: undoes})
+}
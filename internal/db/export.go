@@ -0,0 +1,310 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// exportFormat versions the layout of Export, independently of the schema.
+const exportFormat = 1
+
+// Export is review state in a form that outlives the database: repos are
+// identified by path and commits by hash, never by row ids.
+type Export struct {
+	Format       int            `json:"format"`
+	ExportedAt   time.Time      `json:"exported_at"`
+	Labels       []ExportLabel  `json:"labels,omitempty"`
+	Repositories []ExportedRepo `json:"repositories"`
+}
+
+type ExportLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+type ExportedRepo struct {
+	Name    string           `json:"name"`
+	Path    string           `json:"path"`
+	Commits []ExportedCommit `json:"commits"`
+}
+
+type ExportedCommit struct {
+	Hash        string          `json:"hash"`
+	Author      string          `json:"author"`
+	Subject     string          `json:"subject"`
+	Body        string          `json:"body,omitempty"`
+	Branch      string          `json:"branch,omitempty"`
+	Files       []string        `json:"files,omitempty"`
+	CommittedAt time.Time       `json:"committed_at"`
+	DetectedAt  time.Time       `json:"detected_at"`
+	Status      string          `json:"status"`
+	ReviewedAt  *time.Time      `json:"reviewed_at,omitempty"`
+	ReviewedBy  string          `json:"reviewed_by,omitempty"`
+	Approvals   []Approval      `json:"approvals,omitempty"`
+	Note        string          `json:"note,omitempty"`
+	Labels      []string        `json:"labels,omitempty"`
+	Events      []ExportedEvent `json:"events,omitempty"`
+}
+
+type ExportedEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// ExportFilter narrows an export. Zero fields don't filter; Since and Until
+// bound the commit time.
+type ExportFilter struct {
+	RepoPaths []string
+	Status    ReviewFilter
+	Since     time.Time
+	Until     time.Time
+}
+
+// ExportData gathers the repos, commits, review state, labels and commit
+// events that pass f.
+func ExportData(db *sql.DB, f ExportFilter) (Export, error) {
+	out := Export{Format: exportFormat, ExportedAt: time.Now().UTC(), Repositories: []ExportedRepo{}}
+
+	repos, err := ListRepos(db)
+	if err != nil {
+		return out, err
+	}
+	wanted := make(map[string]bool, len(f.RepoPaths))
+	for _, p := range f.RepoPaths {
+		wanted[p] = true
+	}
+
+	usedLabels := make(map[string]bool)
+	for _, r := range repos {
+		if len(wanted) > 0 && !wanted[r.Path] {
+			continue
+		}
+		commits, err := QueryCommits(db, CommitQuery{
+			RepoIDs: []int64{r.ID}, Status: f.Status, Since: f.Since, Until: f.Until,
+		})
+		if err != nil {
+			return out, err
+		}
+		files, err := commitFiles(db, r.ID)
+		if err != nil {
+			return out, err
+		}
+		events, err := repoEvents(db, r.ID)
+		if err != nil {
+			return out, err
+		}
+		approvals, err := repoApprovals(db, r.ID)
+		if err != nil {
+			return out, err
+		}
+
+		repo := ExportedRepo{Name: r.Name, Path: r.Path, Commits: []ExportedCommit{}}
+		for _, c := range commits {
+			ec := ExportedCommit{
+				Hash: c.Hash, Author: c.Author, Subject: c.Subject, Body: c.Body, Branch: c.Branch,
+				Files: files[c.Hash], CommittedAt: c.CommittedAt, DetectedAt: c.DetectedAt,
+				Status: c.Status, ReviewedAt: c.ReviewedAt, ReviewedBy: c.ReviewedBy, Note: c.Note,
+				Approvals: approvals[c.Hash], Events: events[c.Hash],
+			}
+			for _, l := range c.Labels {
+				ec.Labels = append(ec.Labels, l.Name)
+				usedLabels[strings.ToLower(l.Name)] = true
+			}
+			repo.Commits = append(repo.Commits, ec)
+		}
+		out.Repositories = append(out.Repositories, repo)
+	}
+
+	labels, err := ListLabels(db)
+	if err != nil {
+		return out, err
+	}
+	for _, l := range labels {
+		if usedLabels[strings.ToLower(l.Name)] {
+			out.Labels = append(out.Labels, ExportLabel{Name: l.Name, Color: l.Color})
+		}
+	}
+	return out, nil
+}
+
+func commitFiles(db *sql.DB, repoID int64) (map[string][]string, error) {
+	rows, err := db.Query(`SELECT hash, files FROM commits WHERE repo_id = ? AND files != ''`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make(map[string][]string)
+	for rows.Next() {
+		var hash, list string
+		if err := rows.Scan(&hash, &list); err != nil {
+			return nil, err
+		}
+		files[hash] = splitLines(list)
+	}
+	return files, rows.Err()
+}
+
+func repoApprovals(db *sql.DB, repoID int64) (map[string][]Approval, error) {
+	rows, err := db.Query(
+		`SELECT commit_hash, reviewer, approved_at FROM approvals
+		 WHERE repo_id = ? ORDER BY approved_at, reviewer`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	approvals := make(map[string][]Approval)
+	for rows.Next() {
+		var hash string
+		var a Approval
+		if err := rows.Scan(&hash, &a.Reviewer, &a.ApprovedAt); err != nil {
+			return nil, err
+		}
+		approvals[hash] = append(approvals[hash], a)
+	}
+	return approvals, rows.Err()
+}
+
+func repoEvents(db *sql.DB, repoID int64) (map[string][]ExportedEvent, error) {
+	rows, err := db.Query(
+		`SELECT id, type, commit_hash, created_at, payload FROM events
+		 WHERE repo_id = ? AND commit_hash IS NOT NULL ORDER BY id`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make(map[string][]ExportedEvent)
+	for rows.Next() {
+		var e ExportedEvent
+		var hash, payload string
+		if err := rows.Scan(&e.ID, &e.Type, &hash, &e.CreatedAt, &payload); err != nil {
+			return nil, err
+		}
+		if json.Valid([]byte(payload)) {
+			e.Payload = json.RawMessage(payload)
+		}
+		events[hash] = append(events[hash], e)
+	}
+	return events, rows.Err()
+}
+
+// csvHeader is the column layout of CSV exports. CSV carries one row per
+// commit and leaves out bodies, files and events, which don't fit a
+// spreadsheet.
+var csvHeader = []string{
+	"repo_name", "repo_path", "hash", "author", "subject", "branch",
+	"committed_at", "status", "reviewed_at", "reviewed_by", "note", "labels",
+}
+
+// WriteCSV writes e as CSV with csvHeader's columns. Times are RFC 3339 and
+// labels are separated by semicolons.
+func WriteCSV(w io.Writer, e Export) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range e.Repositories {
+		for _, c := range r.Commits {
+			reviewed := ""
+			if c.ReviewedAt != nil {
+				reviewed = c.ReviewedAt.Format(time.RFC3339)
+			}
+			err := cw.Write([]string{
+				r.Name, r.Path, c.Hash, c.Author, c.Subject, c.Branch,
+				c.CommittedAt.Format(time.RFC3339), c.Status, reviewed, c.ReviewedBy, c.Note,
+				strings.Join(c.Labels, ";"),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads a file written by WriteCSV. Columns are found by header
+// name, so reordered or trimmed spreadsheets still import as long as
+// repo_path and hash are there.
+func ReadCSV(r io.Reader) (Export, error) {
+	out := Export{Format: exportFormat}
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return out, fmt.Errorf("read header: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"repo_path", "hash"} {
+		if _, ok := col[required]; !ok {
+			return out, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	repoIdx := make(map[string]int)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		c := ExportedCommit{
+			Hash: get("hash"), Author: get("author"), Subject: get("subject"),
+			Branch: get("branch"), Status: get("status"), ReviewedBy: get("reviewed_by"), Note: get("note"),
+		}
+		if c.CommittedAt, err = parseCSVTime(get("committed_at")); err != nil {
+			return out, fmt.Errorf("line %d: committed_at: %w", line, err)
+		}
+		if s := get("reviewed_at"); s != "" {
+			t, err := parseCSVTime(s)
+			if err != nil {
+				return out, fmt.Errorf("line %d: reviewed_at: %w", line, err)
+			}
+			c.ReviewedAt = &t
+		}
+		for _, l := range strings.Split(get("labels"), ";") {
+			if l = strings.TrimSpace(l); l != "" {
+				c.Labels = append(c.Labels, l)
+			}
+		}
+
+		path := get("repo_path")
+		i, ok := repoIdx[path]
+		if !ok {
+			i = len(out.Repositories)
+			repoIdx[path] = i
+			out.Repositories = append(out.Repositories, ExportedRepo{Name: get("repo_name"), Path: path})
+		}
+		out.Repositories[i].Commits = append(out.Repositories[i].Commits, c)
+	}
+	return out, nil
+}
+
+func parseCSVTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Kinds of repo_identity rows.
+const (
+	IdentityRoot   = "root"
+	IdentityRemote = "remote"
+)
+
+// RepoRelocation is the payload of EventRepoRelocated.
+type RepoRelocation struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SetRepoIdentity replaces the root commits and remote URLs recorded for
+// repoID.
+func SetRepoIdentity(db *sql.DB, repoID int64, roots, remotes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM repo_identity WHERE repo_id = ?`, repoID); err != nil {
+		return err
+	}
+	for kind, values := range map[string][]string{IdentityRoot: roots, IdentityRemote: remotes} {
+		for _, v := range values {
+			_, err := tx.Exec(`INSERT OR IGNORE INTO repo_identity (repo_id, kind, value) VALUES (?, ?, ?)`, repoID, kind, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// HasRepoIdentity reports whether any identity has been recorded for repoID.
+func HasRepoIdentity(db *sql.DB, repoID int64) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM repo_identity WHERE repo_id = ?`, repoID).Scan(&n)
+	return n > 0, err
+}
+
+// FindReposByIdentity returns the repos other than excludeID that look like
+// the same repository: they share a root commit and, when both sides have
+// remotes, at least one remote URL. Forks share roots but not remotes, so
+// the remote check keeps them apart.
+func FindReposByIdentity(db *sql.DB, excludeID int64, roots, remotes []string) ([]Repository, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(roots))
+	args := []any{excludeID, IdentityRoot}
+	for i, r := range roots {
+		placeholders[i] = "?"
+		args = append(args, r)
+	}
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT DISTINCT r.id, r.name, r.path, r.active, r.last_commit_hash, r.required_approvals
+		 FROM repositories r JOIN repo_identity i ON i.repo_id = r.id
+		 WHERE r.id != ? AND i.kind = ? AND i.value IN (%s)
+		 ORDER BY r.id`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []Repository
+	for rows.Next() {
+		var r Repository
+		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash, &r.RequiredApprovals); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return candidates, nil
+	}
+
+	want := make(map[string]bool, len(remotes))
+	for _, r := range remotes {
+		want[r] = true
+	}
+	var result []Repository
+	for _, c := range candidates {
+		theirs, err := identityValues(db, c.ID, IdentityRemote)
+		if err != nil {
+			return nil, err
+		}
+		match := len(theirs) == 0
+		for _, r := range theirs {
+			if want[r] {
+				match = true
+				break
+			}
+		}
+		if match {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func identityValues(db *sql.DB, repoID int64, kind string) ([]string, error) {
+	rows, err := db.Query(`SELECT value FROM repo_identity WHERE repo_id = ? AND kind = ? ORDER BY value`, repoID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// RebindRepo points the existing repo row repoID at newPath, keeping its
+// review history. If newPath already has a row of its own, as it does once
+// the moved checkout has been opened, that row is folded in: commits the old
+// row never saw move over with their state, and the rest of it is dropped.
+func RebindRepo(db *sql.DB, repoID int64, newPath, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldPath string
+	if err := tx.QueryRow(`SELECT path FROM repositories WHERE id = ?`, repoID).Scan(&oldPath); err != nil {
+		return err
+	}
+
+	var newID int64
+	err = tx.QueryRow(`SELECT id FROM repositories WHERE path = ?`, newPath).Scan(&newID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if newID == repoID {
+		return nil
+	}
+
+	if newID != 0 {
+		// Rows move between repos one table at a time, so the keys only
+		// line up again at commit.
+		if _, err := tx.Exec(`PRAGMA defer_foreign_keys = ON`); err != nil {
+			return err
+		}
+		stmts := []string{
+			`CREATE TEMP TABLE rebind_commits (hash TEXT PRIMARY KEY)`,
+			`INSERT INTO rebind_commits SELECT hash FROM commits WHERE repo_id = ?2
+			 AND hash NOT IN (SELECT hash FROM commits WHERE repo_id = ?1)
+			 AND hash NOT IN (SELECT hash FROM archived_commits WHERE repo_id = ?1)`,
+			`UPDATE commits SET repo_id = ?1 WHERE repo_id = ?2 AND hash IN (SELECT hash FROM rebind_commits)`,
+			`UPDATE review_state SET repo_id = ?1 WHERE repo_id = ?2 AND commit_hash IN (SELECT hash FROM rebind_commits)`,
+			`UPDATE commit_labels SET repo_id = ?1 WHERE repo_id = ?2 AND commit_hash IN (SELECT hash FROM rebind_commits)`,
+			`UPDATE approvals SET repo_id = ?1 WHERE repo_id = ?2 AND commit_hash IN (SELECT hash FROM rebind_commits)`,
+			`UPDATE events SET repo_id = ?1 WHERE repo_id = ?2
+			 AND (commit_hash IS NULL OR commit_hash IN (SELECT hash FROM rebind_commits))`,
+			`DROP TABLE temp.rebind_commits`,
+			`DELETE FROM events WHERE repo_id = ?2`,
+			`DELETE FROM commit_labels WHERE repo_id = ?2`,
+			`DELETE FROM approvals WHERE repo_id = ?2`,
+			`DELETE FROM review_state WHERE repo_id = ?2`,
+			`DELETE FROM commits WHERE repo_id = ?2`,
+			`DELETE FROM archived_commits WHERE repo_id = ?2`,
+			`DELETE FROM stats_snapshots WHERE repo_id = ?2`,
+			`DELETE FROM repo_identity WHERE repo_id = ?1`,
+			`UPDATE repo_identity SET repo_id = ?1 WHERE repo_id = ?2`,
+			`UPDATE repositories SET last_commit_hash = COALESCE(
+				(SELECT NULLIF(last_commit_hash, '') FROM repositories WHERE id = ?2), last_commit_hash)
+			 WHERE id = ?1`,
+			`DELETE FROM repositories WHERE id = ?2`,
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt, repoID, newID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE repositories SET path = ?, name = ?, active = 1 WHERE id = ?`, newPath, name, repoID); err != nil {
+		return err
+	}
+	if err := recordEvent(tx, repoID, EventRepoRelocated, "", RepoRelocation{From: oldPath, To: newPath}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
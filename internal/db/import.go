@@ -0,0 +1,377 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MergePolicy decides what an import does to commits that already exist.
+type MergePolicy string
+
+const (
+	// MergeFill takes the imported review only for commits nobody has
+	// touched here yet: still unreviewed and without a note.
+	MergeFill MergePolicy = "fill"
+	// MergeOurs leaves existing commits exactly as they are.
+	MergeOurs MergePolicy = "ours"
+	// MergeTheirs replaces the review of existing commits with the
+	// imported one.
+	MergeTheirs MergePolicy = "theirs"
+)
+
+type ImportOptions struct {
+	Policy MergePolicy
+	// Source names where the data came from in the history of every
+	// commit the import touches.
+	Source string
+	DryRun bool
+}
+
+type ImportResult struct {
+	Repos     int // repos created, shown once their path is tracked here
+	Added     int // commits that were new here
+	Updated   int // existing commits whose review or labels changed
+	Unchanged int
+	Archived  int // skipped because they are archived here
+}
+
+// ImportData merges an export into db in one transaction, matching repos by
+// path and commits by hash within them. New commits arrive with their
+// review, labels and history; existing ones are merged per opts.Policy, with
+// every change recorded as an import in their history. Archived commits stay
+// archived.
+func ImportData(db *sql.DB, e Export, opts ImportOptions) (ImportResult, error) {
+	var res ImportResult
+	if e.Format > exportFormat {
+		return res, fmt.Errorf("export format %d is newer than this build supports (%d)", e.Format, exportFormat)
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = MergeFill
+	case MergeFill, MergeOurs, MergeTheirs:
+	default:
+		return res, fmt.Errorf("unknown merge policy %q", opts.Policy)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	im := &importer{tx: tx, opts: opts, labels: make(map[string]int64), events: make(map[int64]int64)}
+	for _, l := range e.Labels {
+		if _, err := im.label(l.Name, l.Color); err != nil {
+			return res, err
+		}
+	}
+	for _, r := range e.Repositories {
+		if err := im.repo(r, &res); err != nil {
+			return res, err
+		}
+	}
+
+	if opts.DryRun {
+		return res, nil
+	}
+	return res, tx.Commit()
+}
+
+type importer struct {
+	tx     *sql.Tx
+	opts   ImportOptions
+	labels map[string]int64 // lowercased name to id
+	events map[int64]int64  // exported event id to the id it was stored under
+}
+
+func (im *importer) label(name, color string) (int64, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if id, ok := im.labels[key]; ok {
+		return id, nil
+	}
+	id, err := createLabel(im.tx, name, color)
+	if err != nil {
+		return 0, fmt.Errorf("label %q: %w", name, err)
+	}
+	im.labels[key] = id
+	return id, nil
+}
+
+func (im *importer) repo(r ExportedRepo, res *ImportResult) error {
+	if r.Path == "" {
+		return fmt.Errorf("repository %q has no path", r.Name)
+	}
+	var repoID int64
+	err := im.tx.QueryRow(`SELECT id FROM repositories WHERE path = ?`, r.Path).Scan(&repoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		name := r.Name
+		if name == "" {
+			name = filepath.Base(r.Path)
+		}
+		result, err := im.tx.Exec(`INSERT INTO repositories (name, path) VALUES (?, ?)`, name, r.Path)
+		if err != nil {
+			return err
+		}
+		if repoID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		res.Repos++
+	} else if err != nil {
+		return err
+	}
+
+	for _, c := range r.Commits {
+		if err := im.commit(repoID, c, res); err != nil {
+			return fmt.Errorf("%s %s: %w", r.Path, c.Hash[:min(7, len(c.Hash))], err)
+		}
+	}
+	return nil
+}
+
+func (im *importer) commit(repoID int64, c ExportedCommit, res *ImportResult) error {
+	if c.Hash == "" {
+		return fmt.Errorf("commit without hash")
+	}
+	switch c.Status {
+	case "":
+		c.Status = "unreviewed"
+	case "unreviewed", "reviewed", "ignored":
+	default:
+		return fmt.Errorf("unknown status %q", c.Status)
+	}
+
+	var archived bool
+	err := im.tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM archived_commits WHERE repo_id = ? AND hash = ?)`, repoID, c.Hash).Scan(&archived)
+	if err != nil {
+		return err
+	}
+	if archived {
+		res.Archived++
+		return nil
+	}
+
+	cur, err := currentReview(im.tx, repoID, c.Hash)
+	if errors.Is(err, errCommitNotFound) {
+		if err := im.add(repoID, c); err != nil {
+			return err
+		}
+		res.Added++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	changed, err := im.merge(repoID, c, cur)
+	if err != nil {
+		return err
+	}
+	if changed {
+		res.Updated++
+	} else {
+		res.Unchanged++
+	}
+	return nil
+}
+
+func (im *importer) add(repoID int64, c ExportedCommit) error {
+	detected := sqlTime(c.DetectedAt)
+	if c.DetectedAt.IsZero() {
+		detected = sqlTime(time.Now())
+	}
+	_, err := im.tx.Exec(
+		`INSERT INTO commits (repo_id, hash, author, subject, body, branch, files, committed_at, detected_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		repoID, c.Hash, c.Author, c.Subject, c.Body, c.Branch, strings.Join(c.Files, "\n"), c.CommittedAt, detected,
+	)
+	if err != nil {
+		return err
+	}
+	delta := approvalDelta{approved: importedApprovals(c)}
+	if err := applyApprovals(im.tx, repoID, c.Hash, delta); err != nil {
+		return err
+	}
+	if err := tally(im.tx, repoID, c.Hash, &delta); err != nil {
+		return err
+	}
+	next := adopt(theirReview(c), len(delta.approved), time.Now(), delta)
+	_, err = im.tx.Exec(
+		`INSERT INTO review_state (repo_id, commit_hash, status, reviewed_at, reviewed_by, note) VALUES (?, ?, ?, ?, ?, ?)`,
+		repoID, c.Hash, next.status, next.reviewedAt, next.by, c.Note,
+	)
+	if err != nil {
+		return err
+	}
+	for _, name := range c.Labels {
+		id, err := im.label(name, "")
+		if err != nil {
+			return err
+		}
+		_, err = im.tx.Exec(`INSERT OR IGNORE INTO commit_labels (repo_id, commit_hash, label_id) VALUES (?, ?, ?)`,
+			repoID, c.Hash, id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range c.Events {
+		if err := im.event(repoID, c.Hash, e); err != nil {
+			return err
+		}
+	}
+	return im.record(repoID, c.Hash, "add")
+}
+
+// event stores an exported event, pointing the ids in its payload at the
+// rows they became here.
+func (im *importer) event(repoID int64, hash string, e ExportedEvent) error {
+	payload := string(e.Payload)
+	var fields map[string]any
+	if json.Unmarshal(e.Payload, &fields) == nil {
+		if undoes, ok := fields["undoes"].(float64); ok {
+			if id, ok := im.events[int64(undoes)]; ok {
+				fields["undoes"] = id
+			} else {
+				delete(fields, "undoes")
+			}
+		}
+		if name, ok := fields["label"].(string); ok && fields["label_id"] != nil {
+			id, err := im.label(name, "")
+			if err != nil {
+				return err
+			}
+			fields["label_id"] = id
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		payload = string(data)
+	}
+
+	result, err := im.tx.Exec(
+		`INSERT INTO events (repo_id, type, commit_hash, created_at, payload) VALUES (?, ?, ?, ?, ?)`,
+		repoID, e.Type, hash, sqlTime(e.CreatedAt), payload,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	im.events[e.ID] = id
+	return nil
+}
+
+func (im *importer) merge(repoID int64, c ExportedCommit, cur reviewState) (bool, error) {
+	if im.opts.Policy == MergeOurs {
+		return false, nil
+	}
+
+	changed := false
+	untouched := cur.status == "unreviewed" && cur.note == ""
+	if im.opts.Policy == MergeTheirs || untouched {
+		given, err := approvals(im.tx, repoID, c.Hash)
+		if err != nil {
+			return false, err
+		}
+		theirs := importedApprovals(c)
+		var delta approvalDelta
+		for _, a := range theirs {
+			if !slices.ContainsFunc(given, func(g Approval) bool { return g.Reviewer == a.Reviewer }) {
+				delta.approved = append(delta.approved, a)
+			}
+		}
+		// Taking their review means taking their approvals too: ours that
+		// they don't carry are withdrawn, so an imported unreviewed sends
+		// the commit back for review.
+		if im.opts.Policy == MergeTheirs {
+			for _, g := range given {
+				if !slices.ContainsFunc(theirs, func(a Approval) bool { return a.Reviewer == g.Reviewer }) {
+					delta.withdrawn = append(delta.withdrawn, g)
+				}
+			}
+		}
+		if err := applyApprovals(im.tx, repoID, c.Hash, delta); err != nil {
+			return false, err
+		}
+		if err := tally(im.tx, repoID, c.Hash, &delta); err != nil {
+			return false, err
+		}
+		next := adopt(theirReview(c), len(theirs), time.Now(), delta)
+		changed = next.status != cur.status || c.Note != cur.note || !delta.empty()
+		if err := setStatus(im.tx, repoID, c.Hash, cur, next, delta, c.ReviewedBy, 0); err != nil {
+			return false, err
+		}
+		if err := setNote(im.tx, repoID, c.Hash, cur, c.Note, 0); err != nil {
+			return false, err
+		}
+	}
+
+	for _, name := range c.Labels {
+		id, err := im.label(name, "")
+		if err != nil {
+			return false, err
+		}
+		var has bool
+		err = im.tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM commit_labels WHERE repo_id = ? AND commit_hash = ? AND label_id = ?)`,
+			repoID, c.Hash, id).Scan(&has)
+		if err != nil {
+			return false, err
+		}
+		if has {
+			continue
+		}
+		if err := setLabel(im.tx, repoID, c.Hash, id, true, 0); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+	return true, im.record(repoID, c.Hash, "merge "+string(im.opts.Policy))
+}
+
+func (im *importer) record(repoID int64, hash, action string) error {
+	return recordEvent(im.tx, repoID, EventRuleApplied, hash, RuleDecision{
+		Rule: "import", Action: action, Value: im.opts.Source,
+	})
+}
+
+// sqlTime formats t the way CURRENT_TIMESTAMP does, so imported rows sort
+// and compare with ones SQLite stamped itself.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// theirReview is the review c was exported with. What it leaves here
+// depends on this repo's quota; see adopt.
+func theirReview(c ExportedCommit) reviewState {
+	return reviewState{status: c.Status, reviewedAt: c.ReviewedAt, by: c.ReviewedBy}
+}
+
+// importedApprovals are the approvals c carries, leaving out any without a
+// reviewer. Exports from before approvals, and CSV, only have the overall
+// review, which stands as its reviewer's approval as it does when the
+// database is migrated; one nobody signed stands as nobody's.
+func importedApprovals(c ExportedCommit) []Approval {
+	if len(c.Approvals) > 0 || c.Status != "reviewed" {
+		return slices.DeleteFunc(slices.Clone(c.Approvals), func(a Approval) bool { return a.Reviewer == "" })
+	}
+	if c.ReviewedBy == "" {
+		return nil
+	}
+	at := time.Now()
+	if c.ReviewedAt != nil {
+		at = *c.ReviewedAt
+	}
+	return []Approval{{Reviewer: c.ReviewedBy, ApprovedAt: at}}
+}
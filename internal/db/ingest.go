@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewCommit is a commit read from git, ready to be stored.
+type NewCommit struct {
+	Hash        string
+	Author      string
+	Subject     string
+	Body        string
+	Branch      string
+	CommittedAt time.Time
+	Files       []string
+}
+
+// IngestCommits stores a batch of newly seen commits in repoID as unreviewed
+// and, if cursor is set, moves the repo's cursor to it. It all happens in one
+// transaction, so a crash can neither leave commits without review rows nor a
+// cursor past commits that were never stored. Commits already stored or
+// archived are skipped. It returns the hashes that were new.
+func IngestCommits(db *sql.DB, repoID int64, commits []NewCommit, cursor string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ing, err := prepareIngest(tx)
+	if err != nil {
+		return nil, err
+	}
+	defer ing.close()
+
+	var added []string
+	for _, c := range commits {
+		ok, err := ing.insert(repoID, c)
+		if err != nil {
+			return nil, fmt.Errorf("insert commit %s: %w", c.Hash[:min(7, len(c.Hash))], err)
+		}
+		if ok {
+			added = append(added, c.Hash)
+		}
+	}
+	if cursor != "" {
+		if _, err := tx.Exec(`UPDATE repositories SET last_commit_hash = ? WHERE id = ?`, cursor, repoID); err != nil {
+			return nil, fmt.Errorf("update last hash: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// ingester holds the statements IngestCommits runs for every commit.
+type ingester struct {
+	archived, commit, review, event *sql.Stmt
+}
+
+func prepareIngest(tx *sql.Tx) (*ingester, error) {
+	ing := &ingester{}
+	stmts := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&ing.archived, `SELECT EXISTS (SELECT 1 FROM archived_commits WHERE repo_id = ? AND hash = ?)`},
+		{&ing.commit, `INSERT OR IGNORE INTO commits (repo_id, hash, author, subject, body, branch, files, committed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`},
+		{&ing.review, `INSERT OR IGNORE INTO review_state (repo_id, commit_hash) VALUES (?, ?)`},
+		{&ing.event, `INSERT INTO events (repo_id, type, commit_hash, payload) VALUES (?, ?, ?, ?)`},
+	}
+	for _, s := range stmts {
+		stmt, err := tx.Prepare(s.query)
+		if err != nil {
+			ing.close()
+			return nil, err
+		}
+		*s.dst = stmt
+	}
+	return ing, nil
+}
+
+func (ing *ingester) close() {
+	for _, s := range []*sql.Stmt{ing.archived, ing.commit, ing.review, ing.event} {
+		if s != nil {
+			s.Close()
+		}
+	}
+}
+
+func (ing *ingester) insert(repoID int64, c NewCommit) (bool, error) {
+	var archived bool
+	if err := ing.archived.QueryRow(repoID, c.Hash).Scan(&archived); err != nil || archived {
+		return false, err
+	}
+
+	res, err := ing.commit.Exec(repoID, c.Hash, c.Author, c.Subject, c.Body, c.Branch,
+		strings.Join(c.Files, "\n"), c.CommittedAt)
+	if err != nil {
+		return false, err
+	}
+	if _, err := ing.review.Exec(repoID, c.Hash); err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	payload, err := json.Marshal(Detection{RepoID: repoID, Branch: c.Branch})
+	if err != nil {
+		return false, err
+	}
+	if _, err := ing.event.Exec(repoID, EventDetected, c.Hash, string(payload)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Repairs counts what Repair fixed.
+type Repairs struct {
+	ReviewRows  int // commits given the unreviewed row they were missing
+	Orphans     int // review, label and search rows whose commit is gone
+	SearchRows  int // commits added back to the search index
+	LostCursors int // repo cursors reset because their commit was never stored
+}
+
+func (r Repairs) Total() int {
+	return r.ReviewRows + r.Orphans + r.SearchRows + r.LostCursors
+}
+
+func (r Repairs) String() string {
+	return fmt.Sprintf("%d missing review rows, %d orphaned rows, %d unindexed commits, %d lost cursors",
+		r.ReviewRows, r.Orphans, r.SearchRows, r.LostCursors)
+}
+
+// Repair checks the database for rows left inconsistent by a crash or by
+// versions that ingested outside a transaction, and fixes them. A lost
+// cursor is cleared so the repo is seeded again on the next start.
+func Repair(db *sql.DB) (Repairs, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Repairs{}, err
+	}
+	defer tx.Rollback()
+
+	var r Repairs
+	steps := []struct {
+		count *int
+		stmt  string
+	}{
+		{&r.ReviewRows, `INSERT INTO review_state (repo_id, commit_hash)
+			SELECT c.repo_id, c.hash FROM commits c
+			WHERE NOT EXISTS (SELECT 1 FROM review_state r WHERE r.repo_id = c.repo_id AND r.commit_hash = c.hash)`},
+		{&r.Orphans, `DELETE FROM review_state
+			WHERE NOT EXISTS (SELECT 1 FROM commits c WHERE c.repo_id = review_state.repo_id AND c.hash = review_state.commit_hash)`},
+		{&r.Orphans, `DELETE FROM commit_labels
+			WHERE NOT EXISTS (SELECT 1 FROM commits c WHERE c.repo_id = commit_labels.repo_id AND c.hash = commit_labels.commit_hash)`},
+		{&r.Orphans, `DELETE FROM approvals
+			WHERE NOT EXISTS (SELECT 1 FROM commits c WHERE c.repo_id = approvals.repo_id AND c.hash = approvals.commit_hash)`},
+		{&r.Orphans, `DELETE FROM commit_search WHERE rowid NOT IN (SELECT id FROM commits)`},
+		{&r.SearchRows, `INSERT INTO commit_search (rowid, subject, body, author, note, files)
+			SELECT c.id, c.subject, c.body, c.author, COALESCE(r.note, ''), c.files
+			FROM commits c LEFT JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+			WHERE c.id NOT IN (SELECT rowid FROM commit_search)`},
+		{&r.LostCursors, `UPDATE repositories SET last_commit_hash = ''
+			WHERE last_commit_hash != ''
+			  AND NOT EXISTS (SELECT 1 FROM commits c WHERE c.repo_id = repositories.id AND c.hash = repositories.last_commit_hash)
+			  AND NOT EXISTS (SELECT 1 FROM archived_commits a WHERE a.repo_id = repositories.id AND a.hash = repositories.last_commit_hash)`},
+	}
+	for _, s := range steps {
+		res, err := tx.Exec(s.stmt)
+		if err != nil {
+			return Repairs{}, err
+		}
+		n, _ := res.RowsAffected()
+		*s.count += int(n)
+	}
+	return r, tx.Commit()
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrLabelNotFound = errors.New("label not found")
+
+type Label struct {
+	ID    int64
+	Name  string
+	Color string
+}
+
+type LabelStats struct {
+	Label
+	Stats
+}
+
+// CreateLabel adds a label, or returns the existing one with the same name
+// (case-insensitive). A non-empty color replaces the stored one.
+func CreateLabel(db *sql.DB, name, color string) (int64, error) {
+	return createLabel(db, name, color)
+}
+
+func createLabel(db interface {
+	execer
+	queryRower
+}, name, color string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, fmt.Errorf("label name is empty")
+	}
+	_, err := db.Exec(
+		`INSERT INTO labels (name, color) VALUES (?, ?)
+		 ON CONFLICT(name) DO UPDATE SET color = excluded.color WHERE excluded.color != ''`,
+		name, color,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = db.QueryRow(`SELECT id FROM labels WHERE name = ?`, name).Scan(&id)
+	return id, err
+}
+
+func ListLabels(db *sql.DB) ([]Label, error) {
+	rows, err := db.Query(`SELECT id, name, color FROM labels ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []Label
+	for rows.Next() {
+		var l Label
+		if err := rows.Scan(&l.ID, &l.Name, &l.Color); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// DeleteLabel removes a label and takes it off every commit.
+func DeleteLabel(db *sql.DB, id int64) error {
+	_, err := db.Exec(`DELETE FROM labels WHERE id = ?`, id)
+	return err
+}
+
+// AddLabel puts a label on a commit, recording the change in its history.
+// Adding a label the commit already has does nothing.
+func AddLabel(db *sql.DB, repoID int64, hash string, labelID int64) error {
+	return changeLabel(db, repoID, hash, labelID, true, 0)
+}
+
+// RemoveLabel takes a label off a commit, recording the change.
+func RemoveLabel(db *sql.DB, repoID int64, hash string, labelID int64) error {
+	return changeLabel(db, repoID, hash, labelID, false, 0)
+}
+
+func changeLabel(db *sql.DB, repoID int64, hash string, labelID int64, add bool, undoes int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setLabel(tx, repoID, hash, labelID, add, undoes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setLabel(tx *sql.Tx, repoID int64, hash string, labelID int64, add bool, undoes int64) error {
+	var name string
+	err := tx.QueryRow(`SELECT name FROM labels WHERE id = ?`, labelID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLabelNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := currentReview(tx, repoID, hash); err != nil {
+		return err
+	}
+
+	var res sql.Result
+	eventType := EventLabelAdded
+	if add {
+		res, err = tx.Exec(`INSERT OR IGNORE INTO commit_labels (repo_id, commit_hash, label_id) VALUES (?, ?, ?)`,
+			repoID, hash, labelID)
+	} else {
+		eventType = EventLabelRemoved
+		res, err = tx.Exec(`DELETE FROM commit_labels WHERE repo_id = ? AND commit_hash = ? AND label_id = ?`,
+			repoID, hash, labelID)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	return recordEvent(tx, repoID, eventType, hash, LabelChange{LabelID: labelID, Label: name, Undoes: undoes})
+}
+
+// ApplyRuleLabel puts a label on a commit on behalf of a configured rule,
+// creating the label if needed. The decision is recorded against the rule
+// rather than as a manual change. It reports whether the label was new to
+// the commit.
+func ApplyRuleLabel(db *sql.DB, repoID int64, hash, rule, label, color string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	labelID, err := createLabel(tx, label, color)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(`INSERT OR IGNORE INTO commit_labels (repo_id, commit_hash, label_id) VALUES (?, ?, ?)`,
+		repoID, hash, labelID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	err = recordEvent(tx, repoID, EventRuleApplied, hash, RuleDecision{Rule: rule, Action: "label", Value: label})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetLabelStats counts commits per label and review status across repoIDs.
+// Labels with no commits there are included with zero counts.
+func GetLabelStats(db *sql.DB, repoIDs []int64) ([]LabelStats, error) {
+	labels, err := ListLabels(db)
+	if err != nil || len(labels) == 0 || len(repoIDs) == 0 {
+		result := make([]LabelStats, len(labels))
+		for i, l := range labels {
+			result[i].Label = l
+		}
+		return result, err
+	}
+
+	placeholders := make([]string, len(repoIDs))
+	args := make([]any, len(repoIDs))
+	for i, id := range repoIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT cl.label_id, r.status, COUNT(*)
+		 FROM commit_labels cl
+		 JOIN review_state r ON r.repo_id = cl.repo_id AND r.commit_hash = cl.commit_hash
+		 WHERE cl.repo_id IN (%s)
+		 GROUP BY cl.label_id, r.status`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]*Stats)
+	for rows.Next() {
+		var id int64
+		var status string
+		var n int
+		if err := rows.Scan(&id, &status, &n); err != nil {
+			return nil, err
+		}
+		s := counts[id]
+		if s == nil {
+			s = &Stats{}
+			counts[id] = s
+		}
+		s.add(status, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]LabelStats, len(labels))
+	for i, l := range labels {
+		result[i].Label = l
+		if s := counts[l.ID]; s != nil {
+			result[i].Stats = *s
+		}
+	}
+	return result, nil
+}
+
+// attachLabels fills in the Labels of each row.
+func attachLabels(db *sql.DB, rows []*CommitRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	seen := make(map[int64]bool)
+	var placeholders []string
+	var args []any
+	for _, c := range rows {
+		if !seen[c.RepoID] {
+			seen[c.RepoID] = true
+			placeholders = append(placeholders, "?")
+			args = append(args, c.RepoID)
+		}
+	}
+
+	res, err := db.Query(fmt.Sprintf(
+		`SELECT cl.repo_id, cl.commit_hash, l.id, l.name, l.color
+		 FROM commit_labels cl JOIN labels l ON l.id = cl.label_id
+		 WHERE cl.repo_id IN (%s)
+		 ORDER BY l.name COLLATE NOCASE`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	type key struct {
+		repoID int64
+		hash   string
+	}
+	byCommit := make(map[key][]Label)
+	for res.Next() {
+		var k key
+		var l Label
+		if err := res.Scan(&k.repoID, &k.hash, &l.ID, &l.Name, &l.Color); err != nil {
+			return err
+		}
+		byCommit[k] = append(byCommit[k], l)
+	}
+	if err := res.Err(); err != nil {
+		return err
+	}
+	for _, c := range rows {
+		c.Labels = byCommit[key{c.RepoID, c.Hash}]
+	}
+	return nil
+}
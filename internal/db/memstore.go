@@ -0,0 +1,1226 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var errRepoNotFound = errors.New("repo not found")
+
+// MemStore is a Store that keeps everything in memory, so the TUI and
+// ingest code can be tested without touching disk. It follows the same
+// rules as SQLStore, with two simplifications: search ranks by weighted
+// term hits rather than BM25, and archiving keeps only the fact that a hash
+// was retired.
+type MemStore struct {
+	mu sync.Mutex
+
+	repos     map[int64]*Repository
+	identity  map[int64]map[string][]string
+	commits   map[commitKey]*memCommit
+	archived  map[commitKey]bool
+	labels    map[int64]*Label
+	events    []Event
+	snapshots map[snapshotKey]Stats
+
+	lastRepo, lastCommit, lastLabel, lastEvent int64
+}
+
+type commitKey struct {
+	repoID int64
+	hash   string
+}
+
+type snapshotKey struct {
+	day    string
+	repoID int64
+}
+
+type memCommit struct {
+	NewCommit
+	id         int64
+	detectedAt time.Time
+	review     reviewState
+	approvals  []Approval
+	labels     map[int64]bool
+}
+
+var _ Store = (*MemStore)(nil)
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		repos:     make(map[int64]*Repository),
+		identity:  make(map[int64]map[string][]string),
+		commits:   make(map[commitKey]*memCommit),
+		archived:  make(map[commitKey]bool),
+		labels:    make(map[int64]*Label),
+		snapshots: make(map[snapshotKey]Stats),
+	}
+}
+
+func (s *MemStore) Close() error {
+	return nil
+}
+
+func (s *MemStore) UpsertRepo(name, path string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repoAt(path); r != nil {
+		r.Name = name
+		return r.ID, nil
+	}
+	s.lastRepo++
+	s.repos[s.lastRepo] = &Repository{ID: s.lastRepo, Name: name, Path: path, Active: true, RequiredApprovals: 1}
+	return s.lastRepo, nil
+}
+
+func (s *MemStore) repoAt(path string) *Repository {
+	for _, r := range s.repos {
+		if r.Path == path {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *MemStore) GetRepoByPath(path string) (*Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repoAt(path)
+	if r == nil {
+		return nil, nil
+	}
+	c := *r
+	return &c, nil
+}
+
+func (s *MemStore) ListRepos() ([]Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.sortedRepos(func(Repository) bool { return true })
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (s *MemStore) ListActiveRepos() ([]Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedRepos(func(r Repository) bool { return r.Active }), nil
+}
+
+// sortedRepos returns copies of the repos keep accepts, by ID.
+func (s *MemStore) sortedRepos(keep func(Repository) bool) []Repository {
+	var result []Repository
+	for _, r := range s.repos {
+		if keep(*r) {
+			result = append(result, *r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func (s *MemStore) SetRepoActive(repoID int64, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repos[repoID]; r != nil {
+		r.Active = active
+	}
+	return nil
+}
+
+func (s *MemStore) UpdateLastCommitHash(repoID int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repos[repoID]; r != nil {
+		r.LastCommitHash = hash
+	}
+	return nil
+}
+
+func (s *MemStore) SetRequiredApprovals(repoID int64, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repos[repoID]; r != nil {
+		r.RequiredApprovals = max(n, 1)
+	}
+	return nil
+}
+
+func (s *MemStore) DeleteRepo(repoID int64, purge bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repos[repoID]
+	if r == nil {
+		return nil
+	}
+	if !purge {
+		r.Active = false
+		return nil
+	}
+	s.events = slices.DeleteFunc(s.events, func(e Event) bool { return e.RepoID == repoID })
+	for k := range s.commits {
+		if k.repoID == repoID {
+			delete(s.commits, k)
+		}
+	}
+	for k := range s.archived {
+		if k.repoID == repoID {
+			delete(s.archived, k)
+		}
+	}
+	for k := range s.snapshots {
+		if k.repoID == repoID {
+			delete(s.snapshots, k)
+		}
+	}
+	delete(s.identity, repoID)
+	delete(s.repos, repoID)
+	return nil
+}
+
+func (s *MemStore) SetRepoIdentity(repoID int64, roots, remotes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := make(map[string][]string)
+	for kind, values := range map[string][]string{IdentityRoot: roots, IdentityRemote: remotes} {
+		if len(values) > 0 {
+			values = slices.Clone(values)
+			slices.Sort(values)
+			id[kind] = slices.Compact(values)
+		}
+	}
+	delete(s.identity, repoID)
+	if len(id) > 0 {
+		s.identity[repoID] = id
+	}
+	return nil
+}
+
+func (s *MemStore) HasRepoIdentity(repoID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.identity[repoID]) > 0, nil
+}
+
+func (s *MemStore) FindReposByIdentity(excludeID int64, roots, remotes []string) ([]Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(roots) == 0 {
+		return nil, nil
+	}
+	shares := func(have, want []string) bool {
+		return slices.ContainsFunc(have, func(v string) bool { return slices.Contains(want, v) })
+	}
+	return s.sortedRepos(func(r Repository) bool {
+		id := s.identity[r.ID]
+		if r.ID == excludeID || !shares(id[IdentityRoot], roots) {
+			return false
+		}
+		theirs := id[IdentityRemote]
+		return len(remotes) == 0 || len(theirs) == 0 || shares(theirs, remotes)
+	}), nil
+}
+
+func (s *MemStore) RebindRepo(repoID int64, newPath, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repos[repoID]
+	if r == nil {
+		return sql.ErrNoRows
+	}
+	oldPath := r.Path
+	if other := s.repoAt(newPath); other != nil {
+		if other.ID == repoID {
+			return nil
+		}
+		s.fold(r, other)
+	}
+	r.Path, r.Name, r.Active = newPath, name, true
+	return s.recordEvent(repoID, EventRepoRelocated, "", RepoRelocation{From: oldPath, To: newPath})
+}
+
+// fold moves the commits of from that into never saw over to into, with
+// their state and events, and drops the rest of from.
+func (s *MemStore) fold(into, from *Repository) {
+	moved := make(map[string]bool)
+	for k, c := range s.commits {
+		if k.repoID != from.ID {
+			continue
+		}
+		delete(s.commits, k)
+		to := commitKey{into.ID, k.hash}
+		if s.commits[to] == nil && !s.archived[to] {
+			s.commits[to] = c
+			moved[k.hash] = true
+		}
+	}
+	s.events = slices.DeleteFunc(s.events, func(e Event) bool {
+		return e.RepoID == from.ID && e.CommitHash != "" && !moved[e.CommitHash]
+	})
+	for i, e := range s.events {
+		if e.RepoID == from.ID {
+			s.events[i].RepoID = into.ID
+		}
+	}
+	for k := range s.archived {
+		if k.repoID == from.ID {
+			delete(s.archived, k)
+		}
+	}
+	for k := range s.snapshots {
+		if k.repoID == from.ID {
+			delete(s.snapshots, k)
+		}
+	}
+	delete(s.identity, into.ID)
+	if id := s.identity[from.ID]; id != nil {
+		s.identity[into.ID] = id
+		delete(s.identity, from.ID)
+	}
+	if from.LastCommitHash != "" {
+		into.LastCommitHash = from.LastCommitHash
+	}
+	delete(s.repos, from.ID)
+}
+
+func (s *MemStore) IngestCommits(repoID int64, commits []NewCommit, cursor string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repos[repoID]
+	if r == nil {
+		return nil, errRepoNotFound
+	}
+	now := time.Now()
+	var added []string
+	for _, c := range commits {
+		k := commitKey{repoID, c.Hash}
+		if s.archived[k] || s.commits[k] != nil {
+			continue
+		}
+		s.lastCommit++
+		c.Files = slices.Clone(c.Files)
+		s.commits[k] = &memCommit{NewCommit: c, id: s.lastCommit, detectedAt: now, review: reviewState{status: "unreviewed"}}
+		if err := s.recordEvent(repoID, EventDetected, c.Hash, Detection{RepoID: repoID, Branch: c.Branch}); err != nil {
+			return nil, err
+		}
+		added = append(added, c.Hash)
+	}
+	if cursor != "" {
+		r.LastCommitHash = cursor
+	}
+	return added, nil
+}
+
+func (s *MemStore) InsertCommit(repoID int64, hash, author, subject, body, branch string, committedAt time.Time, files []string) error {
+	_, err := s.IngestCommits(repoID, []NewCommit{{
+		Hash: hash, Author: author, Subject: subject, Body: body, Branch: branch,
+		CommittedAt: committedAt, Files: files,
+	}}, "")
+	return err
+}
+
+func (s *MemStore) KnownHashes(repoID int64, hashes []string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := make(map[string]bool)
+	for _, h := range hashes {
+		k := commitKey{repoID, h}
+		if s.commits[k] != nil || s.archived[k] {
+			known[h] = true
+		}
+	}
+	return known, nil
+}
+
+// memTimeLayout formats times for sorting and cursors; it is fixed-width,
+// so the strings order like the times.
+const memTimeLayout = "2006-01-02 15:04:05.000000000"
+
+func (c *memCommit) sortValue(key SortKey) string {
+	switch key {
+	case SortDetected:
+		return c.detectedAt.UTC().Format(memTimeLayout)
+	case SortReviewed:
+		if c.review.reviewedAt == nil {
+			return ""
+		}
+		return c.review.reviewedAt.UTC().Format(memTimeLayout)
+	case SortAuthor:
+		return c.Author
+	}
+	return c.CommittedAt.UTC().Format(memTimeLayout)
+}
+
+func (s *MemStore) QueryCommits(q CommitQuery) ([]CommitRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sortKey := q.Sort
+	if sortKey == "" {
+		sortKey = SortCommitted
+	}
+	if _, ok := sortColumns[sortKey]; !ok {
+		return nil, fmt.Errorf("unknown sort key %q", q.Sort)
+	}
+	var afterValue string
+	var afterID int64
+	if q.After != "" {
+		var err error
+		if afterValue, afterID, err = decodeCursor(sortKey, q.After); err != nil {
+			return nil, err
+		}
+	}
+	// before reports whether a sorts ahead of b in the listing.
+	before := func(aValue string, aID int64, bValue string, bID int64) bool {
+		if aValue != bValue {
+			return (aValue < bValue) == q.Asc
+		}
+		return aID != bID && (aID < bID) == q.Asc
+	}
+
+	author := strings.ToLower(q.Author)
+	path := strings.Trim(q.Path, "/")
+	terms := searchTerms(q.Text)
+	var keys []commitKey
+	for k, c := range s.commits {
+		switch {
+		case len(q.RepoIDs) > 0 && !slices.Contains(q.RepoIDs, k.repoID),
+			q.Status != "" && q.Status != FilterAll && c.review.status != string(q.Status),
+			!strings.Contains(strings.ToLower(c.Author), author),
+			q.Branch != "" && c.Branch != q.Branch,
+			!q.Since.IsZero() && c.CommittedAt.Before(q.Since),
+			!q.Until.IsZero() && !c.CommittedAt.Before(q.Until),
+			q.Label != 0 && !c.labels[q.Label],
+			path != "" && !slices.ContainsFunc(c.Files, func(f string) bool {
+				return f == path || strings.HasPrefix(f, path+"/")
+			}),
+			len(terms) > 0 && !matchesAll(terms, c.searchFields()...),
+			q.After != "" && !before(afterValue, afterID, c.sortValue(sortKey), c.id):
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.commits[keys[i]], s.commits[keys[j]]
+		return before(a.sortValue(sortKey), a.id, b.sortValue(sortKey), b.id)
+	})
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+	}
+
+	var result []CommitRow
+	for _, k := range keys {
+		c := s.commits[k]
+		row := s.commitRow(k, c)
+		row.Cursor = encodeCursor(sortKey, c.sortValue(sortKey), c.id)
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+func (s *MemStore) commitRow(k commitKey, c *memCommit) CommitRow {
+	r := s.repos[k.repoID]
+	row := CommitRow{
+		Hash: k.hash, RepoID: k.repoID, RepoName: r.Name,
+		Author: c.Author, Subject: c.Subject, Body: c.Body, Branch: c.Branch,
+		CommittedAt: c.CommittedAt, DetectedAt: c.detectedAt,
+		Status: c.review.status, ReviewedBy: c.review.by, Note: c.review.note,
+		RequiredApprovals: r.RequiredApprovals,
+	}
+	if c.review.reviewedAt != nil {
+		at := *c.review.reviewedAt
+		row.ReviewedAt = &at
+	}
+	for _, a := range c.approvals {
+		row.Approvers = append(row.Approvers, a.Reviewer)
+	}
+	for id := range c.labels {
+		row.Labels = append(row.Labels, *s.labels[id])
+	}
+	sortLabels(row.Labels)
+	return row
+}
+
+func sortLabels(labels []Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := strings.ToLower(labels[i].Name), strings.ToLower(labels[j].Name)
+		if a != b {
+			return a < b
+		}
+		return labels[i].ID < labels[j].ID
+	})
+}
+
+// searchFields are the texts search looks in, in the order of
+// searchWeights: subject, body, author, note and changed files.
+func (c *memCommit) searchFields() []string {
+	return []string{c.Subject, c.Body, c.Author, c.review.note, strings.Join(c.Files, "\n")}
+}
+
+// searchWeights mirror SearchCommits' bm25 weights.
+var searchWeights = []float64{10, 1, 2, 5, 1}
+
+func (s *MemStore) SearchCommits(repoIDs []int64, query string, limit int) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 || len(repoIDs) == 0 {
+		return nil, nil
+	}
+
+	type hit struct {
+		SearchResult
+		id int64
+	}
+	var hits []hit
+	for k, c := range s.commits {
+		fields := c.searchFields()
+		if !slices.Contains(repoIDs, k.repoID) || !matchesAll(terms, fields...) {
+			continue
+		}
+		h := hit{SearchResult: SearchResult{CommitRow: s.commitRow(k, c)}, id: c.id}
+		for i, f := range fields {
+			h.Rank -= searchWeights[i] * float64(termHits(terms, f))
+		}
+		h.SubjectMatch = highlight(c.Subject, terms)
+		h.AuthorMatch = highlight(c.Author, terms)
+		for _, f := range []string{c.review.note, c.Body, fields[4]} {
+			if marked := highlight(f, terms); strings.Contains(marked, MatchStart) {
+				h.Snippet = snippet(marked, 8)
+				break
+			}
+		}
+		hits = append(hits, h)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch {
+		case a.Rank != b.Rank:
+			return a.Rank < b.Rank
+		case !a.CommittedAt.Equal(b.CommittedAt):
+			return a.CommittedAt.After(b.CommittedAt)
+		}
+		return a.id < b.id
+	})
+	if limit >= 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	var results []SearchResult
+	for _, h := range hits {
+		results = append(results, h.SearchResult)
+	}
+	return results, nil
+}
+
+// searchTerms splits a query into the lower-cased words search matches as
+// prefixes, as matchQuery does for FTS5.
+func searchTerms(query string) []string {
+	return tokens(query)
+}
+
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !isTokenRune(r) })
+}
+
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func matchesTerm(word string, terms []string) bool {
+	return slices.ContainsFunc(terms, func(t string) bool { return strings.HasPrefix(word, t) })
+}
+
+// matchesAll reports whether every term starts a word in one of fields.
+func matchesAll(terms []string, fields ...string) bool {
+	for _, t := range terms {
+		found := slices.ContainsFunc(fields, func(f string) bool {
+			return slices.ContainsFunc(tokens(f), func(w string) bool { return strings.HasPrefix(w, t) })
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func termHits(terms []string, field string) int {
+	n := 0
+	for _, w := range tokens(field) {
+		if matchesTerm(w, terms) {
+			n++
+		}
+	}
+	return n
+}
+
+// highlight wraps the words of text that match terms in MatchStart and
+// MatchEnd.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := text[start:end]
+		if matchesTerm(strings.ToLower(word), terms) {
+			word = MatchStart + word + MatchEnd
+		}
+		b.WriteString(word)
+		start = -1
+	}
+	for i, r := range text {
+		if isTokenRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		b.WriteRune(r)
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return b.String()
+}
+
+// snippet cuts marked text down to about n words around its first match.
+func snippet(marked string, n int) string {
+	words := strings.Fields(marked)
+	i := slices.IndexFunc(words, func(w string) bool { return strings.Contains(w, MatchStart) })
+	from := max(0, i-2)
+	to := min(len(words), from+n)
+	s := strings.Join(words[from:to], " ")
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(words) {
+		s += "…"
+	}
+	return s
+}
+
+func (s *MemStore) ArchiveCommits(before time.Time, purge bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[commitKey]time.Time)
+	for _, e := range s.events {
+		k := commitKey{e.RepoID, e.CommitHash}
+		if e.CreatedAt.After(active[k]) {
+			active[k] = e.CreatedAt
+		}
+	}
+	retired := make(map[commitKey]bool)
+	for k, c := range s.commits {
+		if c.review.status != "reviewed" && c.review.status != "ignored" {
+			continue
+		}
+		if !c.detectedAt.Before(before) || !active[k].Before(before) {
+			continue
+		}
+		retired[k] = true
+		s.archived[k] = true
+		delete(s.commits, k)
+	}
+	if purge {
+		s.events = slices.DeleteFunc(s.events, func(e Event) bool {
+			return retired[commitKey{e.RepoID, e.CommitHash}]
+		})
+	}
+	return len(retired), nil
+}
+
+func (s *MemStore) UpdateReviewStatus(repoID int64, hash, status, note, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if by == "" && approves(status) {
+		return ErrNoReviewer
+	}
+	k := commitKey{repoID, hash}
+	if s.commits[k] == nil {
+		return errCommitNotFound
+	}
+	return s.updateReview(k, status, note, by, time.Now())
+}
+
+func (s *MemStore) UpdateSharedReviewStatus(hash, status, note, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if by == "" && approves(status) {
+		return ErrNoReviewer
+	}
+	keys := s.sharedKeys(hash)
+	if len(keys) == 0 {
+		return errCommitNotFound
+	}
+	rollback := s.begin(keys)
+	now := time.Now()
+	for _, k := range keys {
+		if err := s.updateReview(k, status, note, by, now); err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemStore) UpdateNote(repoID int64, hash, note string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := commitKey{repoID, hash}
+	if s.commits[k] == nil {
+		return errCommitNotFound
+	}
+	return s.setNote(k, s.commits[k].review, note, 0)
+}
+
+func (s *MemStore) UpdateSharedNote(hash, note string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.sharedKeys(hash)
+	if len(keys) == 0 {
+		return errCommitNotFound
+	}
+	rollback := s.begin(keys)
+	for _, k := range keys {
+		if err := s.setNote(k, s.commits[k].review, note, 0); err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// begin saves the review state of the commits at keys and the event log,
+// and returns a func that puts them back: MemStore's stand-in for the
+// transaction SQLStore updates several commits in.
+func (s *MemStore) begin(keys []commitKey) (rollback func()) {
+	saved := make(map[commitKey]memCommit, len(keys))
+	for _, k := range keys {
+		c := *s.commits[k]
+		c.approvals = slices.Clone(c.approvals)
+		saved[k] = c
+	}
+	events, lastEvent := len(s.events), s.lastEvent
+	return func() {
+		for k, c := range saved {
+			*s.commits[k] = c
+		}
+		s.events, s.lastEvent = s.events[:events], lastEvent
+	}
+}
+
+// sharedKeys returns the commits with hash in every repo, by repo ID.
+func (s *MemStore) sharedKeys(hash string) []commitKey {
+	var keys []commitKey
+	for k := range s.commits {
+		if k.hash == hash {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].repoID < keys[j].repoID })
+	return keys
+}
+
+func (s *MemStore) updateReview(k commitKey, status, note, by string, now time.Time) error {
+	c := s.commits[k]
+	cur := c.review
+	next := reviewState{status: status, by: by}
+	var delta approvalDelta
+	if approves(status) {
+		delta = approvalChange(slices.Clone(c.approvals), status, by, now)
+		c.applyApprovals(delta)
+		s.tally(k, &delta)
+		next = settle(cur, status, by, now, delta)
+	}
+	if err := s.setStatus(k, cur, next, delta, by, 0); err != nil {
+		return err
+	}
+	return s.setNote(k, cur, note, 0)
+}
+
+func (c *memCommit) applyApprovals(delta approvalDelta) {
+	for _, a := range delta.withdrawn {
+		c.approvals = slices.DeleteFunc(c.approvals, func(b Approval) bool { return b.Reviewer == a.Reviewer })
+	}
+	for _, a := range delta.approved {
+		if !slices.ContainsFunc(c.approvals, func(b Approval) bool { return b.Reviewer == a.Reviewer }) {
+			c.approvals = append(c.approvals, a)
+		}
+	}
+	sort.SliceStable(c.approvals, func(i, j int) bool {
+		a, b := c.approvals[i], c.approvals[j]
+		if !a.ApprovedAt.Equal(b.ApprovedAt) {
+			return a.ApprovedAt.Before(b.ApprovedAt)
+		}
+		return a.Reviewer < b.Reviewer
+	})
+}
+
+func (s *MemStore) tally(k commitKey, delta *approvalDelta) {
+	delta.count = len(s.commits[k].approvals)
+	delta.required = s.repos[k.repoID].RequiredApprovals
+}
+
+func (s *MemStore) setStatus(k commitKey, cur, next reviewState, delta approvalDelta, actor string, undoes int64) error {
+	if next.status == cur.status && delta.empty() {
+		return nil
+	}
+	if next.status != cur.status {
+		c := s.commits[k]
+		c.review.status, c.review.reviewedAt, c.review.by = next.status, next.reviewedAt, next.by
+	}
+	return s.recordEvent(k.repoID, EventStatusChanged, k.hash, statusChange(cur, next, delta, actor, undoes))
+}
+
+func (s *MemStore) setNote(k commitKey, cur reviewState, note string, undoes int64) error {
+	if note == cur.note {
+		return nil
+	}
+	s.commits[k].review.note = note
+	return s.recordEvent(k.repoID, EventNoteEdited, k.hash, NoteEdit{From: cur.note, To: note, Undoes: undoes})
+}
+
+func (s *MemStore) InheritSharedReview(repoID int64, hashes []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]commitKey, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = commitKey{repoID, hash}
+		if s.commits[keys[i]] == nil {
+			return 0, errCommitNotFound
+		}
+	}
+
+	rollback := s.begin(keys)
+	n := 0
+	for _, hash := range hashes {
+		k := commitKey{repoID, hash}
+		c := s.commits[k]
+		cur := c.review
+		if cur.status != "unreviewed" || cur.note != "" {
+			continue
+		}
+		fromRepo, from := s.sharedReview(k)
+		if from == nil {
+			continue
+		}
+
+		delta := approvalDelta{approved: slices.Clone(from.approvals)}
+		c.applyApprovals(delta)
+		s.tally(k, &delta)
+		next := adopt(from.review, len(from.approvals), time.Now(), delta)
+		if err := s.setStatus(k, cur, next, delta, from.review.by, 0); err != nil {
+			rollback()
+			return 0, err
+		}
+		if err := s.setNote(k, cur, from.review.note, 0); err != nil {
+			rollback()
+			return 0, err
+		}
+		err := s.recordEvent(repoID, EventRuleApplied, hash, RuleDecision{
+			Rule: "share_review", Action: "inherit", Value: fmt.Sprintf("repo %d", fromRepo),
+		})
+		if err != nil {
+			rollback()
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// sharedReview finds the latest review another repo has recorded for k's
+// hash, as InheritSharedReview's query orders them.
+func (s *MemStore) sharedReview(k commitKey) (int64, *memCommit) {
+	var fromRepo int64
+	var from *memCommit
+	later := func(a *memCommit, aRepo int64) bool {
+		at, bt := a.review.reviewedAt, from.review.reviewedAt
+		switch {
+		case (at == nil) != (bt == nil):
+			return at != nil
+		case at != nil && !at.Equal(*bt):
+			return at.After(*bt)
+		}
+		return aRepo < fromRepo
+	}
+	for other, c := range s.commits {
+		if other.hash != k.hash || other.repoID == k.repoID {
+			continue
+		}
+		if c.review.status == "unreviewed" && c.review.note == "" {
+			continue
+		}
+		if from == nil || later(c, other.repoID) {
+			fromRepo, from = other.repoID, c
+		}
+	}
+	return fromRepo, from
+}
+
+func (s *MemStore) ListApprovals(repoID int64, hash string) ([]Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c := s.commits[commitKey{repoID, hash}]; c != nil {
+		return slices.Clone(c.approvals), nil
+	}
+	return nil, nil
+}
+
+func (s *MemStore) CreateLabel(name, color string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createLabel(name, color)
+}
+
+func (s *MemStore) createLabel(name, color string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, fmt.Errorf("label name is empty")
+	}
+	for _, l := range s.labels {
+		if strings.EqualFold(l.Name, name) {
+			if color != "" {
+				l.Color = color
+			}
+			return l.ID, nil
+		}
+	}
+	s.lastLabel++
+	s.labels[s.lastLabel] = &Label{ID: s.lastLabel, Name: name, Color: color}
+	return s.lastLabel, nil
+}
+
+func (s *MemStore) ListLabels() ([]Label, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLabels(), nil
+}
+
+func (s *MemStore) sortedLabels() []Label {
+	var labels []Label
+	for _, l := range s.labels {
+		labels = append(labels, *l)
+	}
+	sortLabels(labels)
+	return labels
+}
+
+func (s *MemStore) DeleteLabel(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.labels, id)
+	for _, c := range s.commits {
+		delete(c.labels, id)
+	}
+	return nil
+}
+
+func (s *MemStore) AddLabel(repoID int64, hash string, labelID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setLabel(commitKey{repoID, hash}, labelID, true, 0)
+}
+
+func (s *MemStore) RemoveLabel(repoID int64, hash string, labelID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setLabel(commitKey{repoID, hash}, labelID, false, 0)
+}
+
+func (s *MemStore) setLabel(k commitKey, labelID int64, add bool, undoes int64) error {
+	l := s.labels[labelID]
+	if l == nil {
+		return ErrLabelNotFound
+	}
+	c := s.commits[k]
+	if c == nil {
+		return errCommitNotFound
+	}
+	if c.labels[labelID] == add {
+		return nil
+	}
+
+	eventType := EventLabelAdded
+	if add {
+		if c.labels == nil {
+			c.labels = make(map[int64]bool)
+		}
+		c.labels[labelID] = true
+	} else {
+		eventType = EventLabelRemoved
+		delete(c.labels, labelID)
+	}
+	return s.recordEvent(k.repoID, eventType, k.hash, LabelChange{LabelID: labelID, Label: l.Name, Undoes: undoes})
+}
+
+func (s *MemStore) ApplyRuleLabel(repoID int64, hash, rule, label, color string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.commits[commitKey{repoID, hash}]
+	if c == nil {
+		return false, errCommitNotFound
+	}
+	labelID, err := s.createLabel(label, color)
+	if err != nil {
+		return false, err
+	}
+	if c.labels[labelID] {
+		return false, nil
+	}
+	if c.labels == nil {
+		c.labels = make(map[int64]bool)
+	}
+	c.labels[labelID] = true
+	err = s.recordEvent(repoID, EventRuleApplied, hash, RuleDecision{Rule: rule, Action: "label", Value: label})
+	return err == nil, err
+}
+
+func (s *MemStore) InsertEvent(repoID int64, eventType, commitHash, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insertEvent(repoID, eventType, commitHash, payload)
+	return nil
+}
+
+func (s *MemStore) insertEvent(repoID int64, eventType, commitHash, payload string) {
+	s.lastEvent++
+	s.events = append(s.events, Event{
+		ID: s.lastEvent, RepoID: repoID, Type: eventType, CommitHash: commitHash,
+		CreatedAt: time.Now(), Payload: payload,
+	})
+}
+
+func (s *MemStore) RecordEvent(repoID int64, eventType, commitHash string, payload any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recordEvent(repoID, eventType, commitHash, payload)
+}
+
+func (s *MemStore) recordEvent(repoID int64, eventType, commitHash string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	s.insertEvent(repoID, eventType, commitHash, string(data))
+	return nil
+}
+
+func (s *MemStore) ListEvents(repoID int64, commitHash string) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Events without a repo or commit match nothing, as NULLs don't in SQL.
+	if repoID == 0 || commitHash == "" {
+		return nil, nil
+	}
+	var events []Event
+	for _, e := range s.events {
+		if e.RepoID == repoID && e.CommitHash == commitHash {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *MemStore) UndoEvent(id int64, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.events, func(e Event) bool { return e.ID == id })
+	if i < 0 {
+		return ErrEventNotFound
+	}
+	e := s.events[i]
+	if !e.Undoable() {
+		return ErrNotUndoable
+	}
+	if slices.ContainsFunc(s.events, func(u Event) bool { return u.Type == e.Type && u.undoes() == id }) {
+		return ErrAlreadyUndone
+	}
+
+	k := commitKey{e.RepoID, e.CommitHash}
+	c := s.commits[k]
+	if c == nil {
+		return errCommitNotFound
+	}
+	cur := c.review
+
+	switch e.Type {
+	case EventStatusChanged:
+		var p StatusChange
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		prev := reviewState{status: p.From, reviewedAt: p.FromReviewedAt, by: p.FromBy}
+		delta := approvalDelta{approved: p.Withdrawn, withdrawn: p.Approved}
+		c.applyApprovals(delta)
+		if !delta.empty() {
+			s.tally(k, &delta)
+		}
+		return s.setStatus(k, cur, prev, delta, by, id)
+	case EventNoteEdited:
+		var p NoteEdit
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		return s.setNote(k, cur, p.From, id)
+	default:
+		var p LabelChange
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("decode event %d: %w", id, err)
+		}
+		return s.setLabel(k, p.LabelID, e.Type == EventLabelRemoved, id)
+	}
+}
+
+func (s *MemStore) GetStats(repoID int64) (Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats([]int64{repoID}), nil
+}
+
+func (s *MemStore) GetAggregateStats(repoIDs []int64) (Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats(repoIDs), nil
+}
+
+func (s *MemStore) stats(repoIDs []int64) Stats {
+	var st Stats
+	for k, c := range s.commits {
+		if slices.Contains(repoIDs, k.repoID) {
+			st.add(c.review.status, 1)
+		}
+	}
+	return st
+}
+
+func (s *MemStore) GetReviewerStats(repoIDs []int64) ([]ReviewerStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]*ReviewerStats)
+	count := func(reviewer string) *ReviewerStats {
+		if counts[reviewer] == nil {
+			counts[reviewer] = &ReviewerStats{Reviewer: reviewer}
+		}
+		return counts[reviewer]
+	}
+	for k, c := range s.commits {
+		if !slices.Contains(repoIDs, k.repoID) {
+			continue
+		}
+		for _, a := range c.approvals {
+			count(a.Reviewer).Reviewed++
+		}
+		if c.review.status == "ignored" {
+			count(c.review.by).Ignored++
+		}
+	}
+
+	var result []ReviewerStats
+	for _, rs := range counts {
+		result = append(result, *rs)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Reviewed+a.Ignored != b.Reviewed+b.Ignored {
+			return a.Reviewed+a.Ignored > b.Reviewed+b.Ignored
+		}
+		return a.Reviewer < b.Reviewer
+	})
+	return result, nil
+}
+
+func (s *MemStore) GetLabelStats(repoIDs []int64) ([]LabelStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	labels := s.sortedLabels()
+	result := make([]LabelStats, len(labels))
+	for i, l := range labels {
+		result[i].Label = l
+		for k, c := range s.commits {
+			if c.labels[l.ID] && slices.Contains(repoIDs, k.repoID) {
+				result[i].add(c.review.status, 1)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *MemStore) SnapshotStats(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := now.Local().Format("2006-01-02")
+	for id, r := range s.repos {
+		if r.Active {
+			s.snapshots[snapshotKey{day, id}] = s.stats([]int64{id})
+		}
+	}
+	return nil
+}
+
+func (s *MemStore) ListSnapshots(repoIDs []int64, since time.Time) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from := since.Local().Format("2006-01-02")
+	days := make(map[string]*Snapshot)
+	for k, st := range s.snapshots {
+		if k.day < from || len(repoIDs) > 0 && !slices.Contains(repoIDs, k.repoID) {
+			continue
+		}
+		snap := days[k.day]
+		if snap == nil {
+			snap = &Snapshot{Day: k.day}
+			days[k.day] = snap
+		}
+		snap.Total += st.Total
+		snap.Unreviewed += st.Unreviewed
+		snap.Reviewed += st.Reviewed
+		snap.Ignored += st.Ignored
+	}
+
+	var result []Snapshot
+	for _, snap := range days {
+		result = append(result, *snap)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Day < result[j].Day })
+	return result, nil
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is the review counts of the given repos at the end of a day, or
+// at the last time Apollo recorded them that day.
+type Snapshot struct {
+	Day string
+	Stats
+}
+
+// SnapshotStats records today's counts for every active repo, replacing any
+// taken earlier the same day, so the last run of the day wins.
+func SnapshotStats(db *sql.DB, now time.Time) error {
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO stats_snapshots (day, repo_id, total, unreviewed, reviewed, ignored)
+		 SELECT ?, rp.id, COUNT(r.commit_hash),
+		        COALESCE(SUM(r.status = 'unreviewed'), 0),
+		        COALESCE(SUM(r.status = 'reviewed'), 0),
+		        COALESCE(SUM(r.status = 'ignored'), 0)
+		 FROM repositories rp
+		 LEFT JOIN review_state r ON r.repo_id = rp.id
+		 WHERE rp.active = 1
+		 GROUP BY rp.id`, now.Local().Format("2006-01-02"))
+	return err
+}
+
+// ListSnapshots returns the daily counts for repoIDs, or every repo when
+// repoIDs is empty, summed per day from since on, oldest first.
+func ListSnapshots(db *sql.DB, repoIDs []int64, since time.Time) ([]Snapshot, error) {
+	where, args := repoFilter("repo_id", repoIDs)
+	where = append(where, `day >= ?`)
+	args = append(args, since.Local().Format("2006-01-02"))
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT day, SUM(total), SUM(unreviewed), SUM(reviewed), SUM(ignored)
+		 FROM stats_snapshots WHERE %s
+		 GROUP BY day ORDER BY day`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		if err := rows.Scan(&s.Day, &s.Total, &s.Unreviewed, &s.Reviewed, &s.Ignored); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// Percentiles summarizes a set of durations.
+type Percentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// DayCount is a number of events on one local day.
+type DayCount struct {
+	Day   string
+	Count int
+}
+
+// AgeBucket counts the unreviewed commits waiting less than Max, and longer
+// than the bucket before it. The last bucket has no Max.
+type AgeBucket struct {
+	Label string
+	Max   time.Duration
+	Count int
+}
+
+// OldestUnreviewed is the commit that has waited longest in one repo, with
+// how many unreviewed commits the repo has in all.
+type OldestUnreviewed struct {
+	RepoID     int64
+	RepoName   string
+	Hash       string
+	Subject    string
+	DetectedAt time.Time
+	Unreviewed int
+}
+
+// Metrics describes review throughput since a point in time and the backlog
+// as it stands.
+type Metrics struct {
+	Since time.Time
+	// TimeToReview runs from detection to review, over commits reviewed
+	// since Since.
+	TimeToReview  Percentiles
+	ReviewsPerDay []DayCount
+	Backlog       []AgeBucket
+	Oldest        []OldestUnreviewed
+	Snapshots     []Snapshot
+}
+
+// ReviewsPerDayAvg is the mean number of reviews per day across the window.
+func (m Metrics) ReviewsPerDayAvg(now time.Time) float64 {
+	days := now.Sub(m.Since).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	return float64(m.TimeToReview.Count) / days
+}
+
+var backlogBuckets = []AgeBucket{
+	{Label: "< 1 day", Max: 24 * time.Hour},
+	{Label: "1-7 days", Max: 7 * 24 * time.Hour},
+	{Label: "7-30 days", Max: 30 * 24 * time.Hour},
+	{Label: "> 30 days"},
+}
+
+// GetMetrics computes Metrics for repoIDs, or every repo when repoIDs is
+// empty, as of now.
+func GetMetrics(db *sql.DB, repoIDs []int64, since, now time.Time) (Metrics, error) {
+	m := Metrics{Since: since}
+
+	where, args := repoFilter("c.repo_id", repoIDs)
+	where = append(where, `r.status = 'reviewed'`, `c.detected_at IS NOT NULL`, `julianday(r.reviewed_at) >= julianday(?)`)
+	args = append(args, sqlTime(since))
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT c.detected_at, r.reviewed_at
+		 FROM commits c JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+		 WHERE %s`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return m, err
+	}
+	var waits []time.Duration
+	perDay := make(map[string]int)
+	for rows.Next() {
+		var detected, reviewed time.Time
+		if err := rows.Scan(&detected, &reviewed); err != nil {
+			rows.Close()
+			return m, err
+		}
+		waits = append(waits, max(reviewed.Sub(detected), 0))
+		perDay[reviewed.Local().Format("2006-01-02")]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return m, err
+	}
+	m.TimeToReview = percentiles(waits)
+	if !since.IsZero() {
+		for day := since.Local(); !day.After(now); day = day.AddDate(0, 0, 1) {
+			key := day.Format("2006-01-02")
+			m.ReviewsPerDay = append(m.ReviewsPerDay, DayCount{Day: key, Count: perDay[key]})
+		}
+	}
+
+	where, args = repoFilter("c.repo_id", repoIDs)
+	where = append(where, `r.status = 'unreviewed'`, `c.detected_at IS NOT NULL`)
+	rows, err = db.Query(fmt.Sprintf(
+		`SELECT c.repo_id, rp.name, c.hash, c.subject, c.detected_at
+		 FROM commits c
+		 JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+		 JOIN repositories rp ON rp.id = c.repo_id
+		 WHERE %s
+		 ORDER BY julianday(c.detected_at), c.id`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return m, err
+	}
+	m.Backlog = append([]AgeBucket(nil), backlogBuckets...)
+	oldest := make(map[int64]int)
+	for rows.Next() {
+		var o OldestUnreviewed
+		if err := rows.Scan(&o.RepoID, &o.RepoName, &o.Hash, &o.Subject, &o.DetectedAt); err != nil {
+			rows.Close()
+			return m, err
+		}
+		age := now.Sub(o.DetectedAt)
+		for i := range m.Backlog {
+			if m.Backlog[i].Max == 0 || age < m.Backlog[i].Max {
+				m.Backlog[i].Count++
+				break
+			}
+		}
+		if i, ok := oldest[o.RepoID]; ok {
+			m.Oldest[i].Unreviewed++
+			continue
+		}
+		o.Unreviewed = 1
+		oldest[o.RepoID] = len(m.Oldest)
+		m.Oldest = append(m.Oldest, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return m, err
+	}
+
+	m.Snapshots, err = ListSnapshots(db, repoIDs, since)
+	return m, err
+}
+
+// percentiles uses the nearest-rank method, which never invents a value
+// that wasn't observed.
+func percentiles(d []time.Duration) Percentiles {
+	p := Percentiles{Count: len(d)}
+	if len(d) == 0 {
+		return p
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	rank := func(pct int) time.Duration {
+		i := (pct*len(d)+99)/100 - 1
+		return d[max(i, 0)]
+	}
+	p.P50, p.P90, p.P99 = rank(50), rank(90), rank(99)
+	return p
+}
+
+func repoFilter(column string, repoIDs []int64) ([]string, []any) {
+	if len(repoIDs) == 0 {
+		return []string{"1 = 1"}, nil
+	}
+	placeholders := make([]string, len(repoIDs))
+	args := make([]any, len(repoIDs))
+	for i, id := range repoIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return []string{fmt.Sprintf(`%s IN (%s)`, column, strings.Join(placeholders, ","))}, args
+}
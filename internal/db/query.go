@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SortKey orders the results of a CommitQuery.
+type SortKey string
+
+const (
+	SortCommitted SortKey = "committed"
+	SortDetected  SortKey = "detected"
+	SortReviewed  SortKey = "reviewed"
+	SortAuthor    SortKey = "author"
+)
+
+// sortColumns are the expressions behind each SortKey. They are compared as
+// stored, so a cursor can hold the exact value of the row it stops at.
+var sortColumns = map[SortKey]string{
+	SortCommitted: `c.committed_at`,
+	SortDetected:  `COALESCE(c.detected_at, '')`,
+	SortReviewed:  `COALESCE(r.reviewed_at, '')`,
+	SortAuthor:    `c.author`,
+}
+
+var ErrBadCursor = errors.New("invalid cursor")
+
+// CommitQuery selects commits with their review state. Zero fields don't
+// filter, so the zero query lists every commit, newest first.
+type CommitQuery struct {
+	RepoIDs []int64
+	Status  ReviewFilter
+	// Author matches any part of the author, ignoring case.
+	Author string
+	Branch string
+	// Since and Until bound the commit time: Since inclusive, Until not.
+	Since time.Time
+	Until time.Time
+	Label int64
+	// Path matches commits that touched the file at Path or anything
+	// under it.
+	Path string
+	// Text is matched like SearchCommits' query, against subjects, bodies,
+	// authors, notes and changed files.
+	Text string
+
+	Sort SortKey
+	Asc  bool
+	// Limit caps the page size; zero means no limit. After continues from
+	// the commit whose Cursor it is.
+	Limit int
+	After string
+}
+
+// QueryCommits runs q. Each returned commit carries the Cursor for the page
+// after it, so a full page's last Cursor fetches the next one.
+func QueryCommits(db *sql.DB, q CommitQuery) ([]CommitRow, error) {
+	sortKey := q.Sort
+	if sortKey == "" {
+		sortKey = SortCommitted
+	}
+	sortCol, ok := sortColumns[sortKey]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", q.Sort)
+	}
+
+	var where []string
+	var args []any
+	if len(q.RepoIDs) > 0 {
+		placeholders := make([]string, len(q.RepoIDs))
+		for i, id := range q.RepoIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		where = append(where, fmt.Sprintf(`c.repo_id IN (%s)`, strings.Join(placeholders, ",")))
+	}
+	if q.Status != "" && q.Status != FilterAll {
+		where = append(where, `r.status = ?`)
+		args = append(args, string(q.Status))
+	}
+	if q.Author != "" {
+		where = append(where, `c.author LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.Author)+"%")
+	}
+	if q.Branch != "" {
+		where = append(where, `c.branch = ?`)
+		args = append(args, q.Branch)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, `julianday(c.committed_at) >= julianday(?)`)
+		args = append(args, sqlTime(q.Since))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, `julianday(c.committed_at) < julianday(?)`)
+		args = append(args, sqlTime(q.Until))
+	}
+	if q.Label != 0 {
+		where = append(where, `EXISTS (SELECT 1 FROM commit_labels cl
+			WHERE cl.repo_id = c.repo_id AND cl.commit_hash = c.hash AND cl.label_id = ?)`)
+		args = append(args, q.Label)
+	}
+	if path := strings.Trim(q.Path, "/"); path != "" {
+		// files holds one path per line.
+		where = append(where, `(char(10) || c.files || char(10) LIKE ? ESCAPE '\'
+			OR char(10) || c.files || char(10) LIKE ? ESCAPE '\')`)
+		p := escapeLike(path)
+		args = append(args, "%\n"+p+"\n%", "%\n"+p+"/%")
+	}
+	if match := matchQuery(q.Text); match != "" {
+		where = append(where, `c.id IN (SELECT rowid FROM commit_search WHERE commit_search MATCH ?)`)
+		args = append(args, match)
+	}
+
+	dir, cmp := "DESC", "<"
+	if q.Asc {
+		dir, cmp = "ASC", ">"
+	}
+	if q.After != "" {
+		value, id, err := decodeCursor(sortKey, q.After)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf(`(%[1]s %[2]s ? OR (%[1]s = ? AND c.id %[2]s ?))`, sortCol, cmp))
+		args = append(args, value, value, id)
+	}
+
+	query := fmt.Sprintf(`SELECT c.id, CAST(%s AS TEXT),
+	                 c.hash, c.repo_id, rp.name, c.author, c.subject, c.body, c.branch,
+	                 c.committed_at, c.detected_at,
+	                 r.status, r.reviewed_at, r.reviewed_by, r.note, rp.required_approvals, %s
+	          FROM commits c
+	          JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+	          JOIN repositories rp ON rp.id = c.repo_id`, sortCol, approversColumn)
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s, c.id %s`, sortCol, dir, dir)
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommitRows(db, rows, sortKey)
+}
+
+// scanCommitRows reads and closes rows, then attaches each commit's labels.
+func scanCommitRows(db *sql.DB, rows *sql.Rows, sortKey SortKey) ([]CommitRow, error) {
+	defer rows.Close()
+	var result []CommitRow
+	for rows.Next() {
+		var c CommitRow
+		var id int64
+		var sortValue string
+		var approvers sql.NullString
+		if err := rows.Scan(&id, &sortValue, &c.Hash, &c.RepoID, &c.RepoName, &c.Author, &c.Subject, &c.Body, &c.Branch,
+			&c.CommittedAt, &c.DetectedAt, &c.Status, &c.ReviewedAt, &c.ReviewedBy, &c.Note,
+			&c.RequiredApprovals, &approvers); err != nil {
+			return nil, err
+		}
+		c.scanApprovers(approvers)
+		c.Cursor = encodeCursor(sortKey, sortValue, id)
+		result = append(result, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	ptrs := make([]*CommitRow, len(result))
+	for i := range result {
+		ptrs[i] = &result[i]
+	}
+	return result, attachLabels(db, ptrs)
+}
+
+// A cursor is the sort key, row id and sort value of the last commit on a
+// page. The key is in it so a cursor can't be replayed against a different
+// ordering.
+func encodeCursor(key SortKey, value string, id int64) string {
+	raw := string(key) + "\x00" + strconv.FormatInt(id, 10) + "\x00" + value
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(key SortKey, cursor string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrBadCursor
+	}
+	parts := strings.SplitN(string(raw), "\x00", 3)
+	if len(parts) != 3 || SortKey(parts[0]) != key {
+		return "", 0, ErrBadCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, ErrBadCursor
+	}
+	return parts[2], id, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -8,33 +8,30 @@ type Repository struct {
 	Path           string
 	Active         bool
 	LastCommitHash string
+	// RequiredApprovals is how many distinct reviewers must approve a
+	// commit before it counts as reviewed.
+	RequiredApprovals int
 }
 
+// UpsertRepo adds a repo, or renames the one already at path, and returns
+// its ID. The ID is read back with RETURNING: LastInsertId is the
+// connection's last insert, which after a conflict is some other row's.
 func UpsertRepo(db *sql.DB, name, path string) (int64, error) {
-	res, err := db.Exec(
+	var id int64
+	err := db.QueryRow(
 		`INSERT INTO repositories (name, path) VALUES (?, ?)
-		 ON CONFLICT(path) DO UPDATE SET name=excluded.name`,
+		 ON CONFLICT(path) DO UPDATE SET name=excluded.name
+		 RETURNING id`,
 		name, path,
-	)
-	if err != nil {
-		return 0, err
-	}
-
-	id, err := res.LastInsertId()
-	if err != nil || id == 0 {
-		row := db.QueryRow(`SELECT id FROM repositories WHERE path = ?`, path)
-		if err := row.Scan(&id); err != nil {
-			return 0, err
-		}
-	}
-	return id, nil
+	).Scan(&id)
+	return id, err
 }
 
 func GetRepoByPath(db *sql.DB, path string) (*Repository, error) {
 	r := &Repository{}
 	err := db.QueryRow(
-		`SELECT id, name, path, active, last_commit_hash FROM repositories WHERE path = ?`, path,
-	).Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash)
+		`SELECT id, name, path, active, last_commit_hash, required_approvals FROM repositories WHERE path = ?`, path,
+	).Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash, &r.RequiredApprovals)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -45,7 +42,7 @@ func GetRepoByPath(db *sql.DB, path string) (*Repository, error) {
 }
 
 func ListActiveRepos(db *sql.DB) ([]Repository, error) {
-	rows, err := db.Query(`SELECT id, name, path, active, last_commit_hash FROM repositories WHERE active = 1`)
+	rows, err := db.Query(`SELECT id, name, path, active, last_commit_hash, required_approvals FROM repositories WHERE active = 1`)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +51,7 @@ func ListActiveRepos(db *sql.DB) ([]Repository, error) {
 	var result []Repository
 	for rows.Next() {
 		var r Repository
-		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash, &r.RequiredApprovals); err != nil {
 			return nil, err
 		}
 		result = append(result, r)
@@ -66,3 +63,59 @@ func UpdateLastCommitHash(db *sql.DB, repoID int64, hash string) error {
 	_, err := db.Exec(`UPDATE repositories SET last_commit_hash = ? WHERE id = ?`, hash, repoID)
 	return err
 }
+
+func SetRepoActive(db *sql.DB, repoID int64, active bool) error {
+	_, err := db.Exec(`UPDATE repositories SET active = ? WHERE id = ?`, active, repoID)
+	return err
+}
+
+func ListRepos(db *sql.DB) ([]Repository, error) {
+	rows, err := db.Query(`SELECT id, name, path, active, last_commit_hash, required_approvals FROM repositories ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Repository
+	for rows.Next() {
+		var r Repository
+		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &r.Active, &r.LastCommitHash, &r.RequiredApprovals); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// DeleteRepo removes a repository. With purge its commits, archived ones
+// included, review state and commit events go too; without it the row is only
+// deactivated so the history can be picked up again if the repo is re-added.
+func DeleteRepo(db *sql.DB, repoID int64, purge bool) error {
+	if !purge {
+		return SetRepoActive(db, repoID, false)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`DELETE FROM events WHERE repo_id = ?`,
+		`DELETE FROM commit_labels WHERE repo_id = ?`,
+		`DELETE FROM archived_commits WHERE repo_id = ?`,
+		`DELETE FROM repo_identity WHERE repo_id = ?`,
+		`DELETE FROM stats_snapshots WHERE repo_id = ?`,
+		`DELETE FROM approvals WHERE repo_id = ?`,
+		`DELETE FROM review_state WHERE repo_id = ?`,
+		`DELETE FROM commits WHERE repo_id = ?`,
+		`DELETE FROM repositories WHERE id = ?`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, repoID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
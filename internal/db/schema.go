@@ -1,42 +1,418 @@
 package db
 
-var migrations = []string{
-	`CREATE TABLE IF NOT EXISTS repositories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// migration moves the schema from version-1 to version. Migrations are
+// append-only: once released, a migration's statements never change.
+// Destructive migrations (dropping or rebuilding tables) run with foreign
+// keys off and only after the database has been backed up.
+type migration struct {
+	version     int
+	name        string
+	destructive bool
+	stmts       []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		// IF NOT EXISTS lets this adopt databases created before schema
+		// versioning, which already have these tables.
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS repositories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				path TEXT NOT NULL UNIQUE,
+				active INTEGER NOT NULL DEFAULT 1,
+				last_commit_hash TEXT NOT NULL DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS commits (
+				hash TEXT PRIMARY KEY,
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				author TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				body TEXT NOT NULL DEFAULT '',
+				branch TEXT NOT NULL DEFAULT '',
+				committed_at DATETIME NOT NULL,
+				detected_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS review_state (
+				commit_hash TEXT PRIMARY KEY REFERENCES commits(hash),
+				status TEXT NOT NULL DEFAULT 'unreviewed',
+				reviewed_at DATETIME,
+				note TEXT NOT NULL DEFAULT ''
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				commit_hash TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				payload TEXT NOT NULL DEFAULT ''
+			)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_commits_repo_time ON commits(repo_id, committed_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_review_status ON review_state(status)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_commit ON events(commit_hash, type)`,
+		},
+	},
+	{
+		version:     2,
+		name:        "key commits by repo and hash",
+		destructive: true,
+		stmts: []string{
+			`CREATE TABLE commits_new (
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				hash TEXT NOT NULL,
+				author TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				body TEXT NOT NULL DEFAULT '',
+				branch TEXT NOT NULL DEFAULT '',
+				committed_at DATETIME NOT NULL,
+				detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (repo_id, hash)
+			)`,
+			`INSERT INTO commits_new (repo_id, hash, author, subject, body, branch, committed_at, detected_at)
+			 SELECT repo_id, hash, author, subject, body, branch, committed_at, detected_at FROM commits`,
+
+			`CREATE TABLE review_state_new (
+				repo_id INTEGER NOT NULL,
+				commit_hash TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'unreviewed',
+				reviewed_at DATETIME,
+				note TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (repo_id, commit_hash),
+				FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+			)`,
+			`INSERT INTO review_state_new (repo_id, commit_hash, status, reviewed_at, note)
+			 SELECT c.repo_id, r.commit_hash, r.status, r.reviewed_at, r.note
+			 FROM review_state r JOIN commits c ON c.hash = r.commit_hash`,
+
+			`DROP TABLE review_state`,
+			`DROP TABLE commits`,
+			`ALTER TABLE commits_new RENAME TO commits`,
+			`ALTER TABLE review_state_new RENAME TO review_state`,
+			`CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at)`,
+			`CREATE INDEX idx_commits_hash ON commits(hash)`,
+			`CREATE INDEX idx_review_status ON review_state(status)`,
+
+			// Commit events take the repo of their commit; ref events carry
+			// the repo path in their payload.
+			`ALTER TABLE events ADD COLUMN repo_id INTEGER`,
+			`UPDATE events SET repo_id = COALESCE(
+				(SELECT repo_id FROM commits WHERE hash = events.commit_hash),
+				CASE WHEN json_valid(payload) THEN
+					(SELECT id FROM repositories WHERE path = json_extract(events.payload, '$.repo'))
+				END
+			)`,
+			`DROP INDEX idx_events_commit`,
+			`CREATE INDEX idx_events_commit ON events(repo_id, commit_hash, type)`,
+		},
+	},
+	{
+		version:     3,
+		name:        "full-text search",
+		destructive: true,
+		// commits gets an integer id so the search index can follow its rows
+		// by rowid; VACUUM is free to renumber implicit rowids.
+		stmts: []string{
+			`CREATE TABLE commits_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				hash TEXT NOT NULL,
+				author TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				body TEXT NOT NULL DEFAULT '',
+				branch TEXT NOT NULL DEFAULT '',
+				files TEXT NOT NULL DEFAULT '',
+				committed_at DATETIME NOT NULL,
+				detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (repo_id, hash)
+			)`,
+			`INSERT INTO commits_new (repo_id, hash, author, subject, body, branch, committed_at, detected_at)
+			 SELECT repo_id, hash, author, subject, body, branch, committed_at, detected_at FROM commits`,
+			`DROP TABLE commits`,
+			`ALTER TABLE commits_new RENAME TO commits`,
+			`CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at)`,
+			`CREATE INDEX idx_commits_hash ON commits(hash)`,
+
+			`CREATE VIRTUAL TABLE commit_search USING fts5(subject, body, author, note, files)`,
+			`INSERT INTO commit_search (rowid, subject, body, author, note, files)
+			 SELECT c.id, c.subject, c.body, c.author, COALESCE(r.note, ''), c.files
+			 FROM commits c LEFT JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash`,
+
+			`CREATE TRIGGER commit_search_insert AFTER INSERT ON commits BEGIN
+				INSERT INTO commit_search (rowid, subject, body, author, note, files)
+				VALUES (new.id, new.subject, new.body, new.author, '', new.files);
+			END`,
+			`CREATE TRIGGER commit_search_update AFTER UPDATE OF subject, body, author, files ON commits BEGIN
+				UPDATE commit_search SET subject = new.subject, body = new.body, author = new.author, files = new.files
+				WHERE rowid = new.id;
+			END`,
+			`CREATE TRIGGER commit_search_delete AFTER DELETE ON commits BEGIN
+				DELETE FROM commit_search WHERE rowid = old.id;
+			END`,
+			`CREATE TRIGGER commit_search_note AFTER UPDATE OF note ON review_state BEGIN
+				UPDATE commit_search SET note = new.note
+				WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+			END`,
+			`CREATE TRIGGER commit_search_note_insert AFTER INSERT ON review_state WHEN new.note != '' BEGIN
+				UPDATE commit_search SET note = new.note
+				WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+			END`,
+		},
+	},
+	{
+		version: 4,
+		name:    "labels",
+		stmts: []string{
+			`CREATE TABLE labels (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				color TEXT NOT NULL DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE commit_labels (
+				repo_id INTEGER NOT NULL,
+				commit_hash TEXT NOT NULL,
+				label_id INTEGER NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (repo_id, commit_hash, label_id),
+				FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX idx_commit_labels_label ON commit_labels(label_id)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "archived commits",
+		stmts: []string{
+			`CREATE TABLE archived_commits (
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				hash TEXT NOT NULL,
+				author TEXT NOT NULL DEFAULT '',
+				subject TEXT NOT NULL DEFAULT '',
+				body TEXT NOT NULL DEFAULT '',
+				branch TEXT NOT NULL DEFAULT '',
+				files TEXT NOT NULL DEFAULT '',
+				note TEXT NOT NULL DEFAULT '',
+				labels TEXT NOT NULL DEFAULT '',
+				committed_at DATETIME NOT NULL,
+				detected_at DATETIME,
+				status TEXT NOT NULL,
+				reviewed_at DATETIME,
+				purged INTEGER NOT NULL DEFAULT 0,
+				archived_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (repo_id, hash)
+			)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "repo identity",
+		stmts: []string{
+			`CREATE TABLE repo_identity (
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				kind TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY (repo_id, kind, value)
+			)`,
+			`CREATE INDEX idx_repo_identity_value ON repo_identity(kind, value)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "reviewed by",
+		stmts: []string{
+			`ALTER TABLE review_state ADD COLUMN reviewed_by TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE archived_commits ADD COLUMN reviewed_by TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 8,
+		name:    "stats snapshots",
+		stmts: []string{
+			`CREATE TABLE stats_snapshots (
+				day TEXT NOT NULL,
+				repo_id INTEGER NOT NULL REFERENCES repositories(id),
+				total INTEGER NOT NULL,
+				unreviewed INTEGER NOT NULL,
+				reviewed INTEGER NOT NULL,
+				ignored INTEGER NOT NULL,
+				PRIMARY KEY (day, repo_id)
+			)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "approvals",
+		stmts: []string{
+			`ALTER TABLE repositories ADD COLUMN required_approvals INTEGER NOT NULL DEFAULT 1`,
+			`CREATE TABLE approvals (
+				repo_id INTEGER NOT NULL,
+				commit_hash TEXT NOT NULL,
+				reviewer TEXT NOT NULL,
+				approved_at DATETIME NOT NULL,
+				PRIMARY KEY (repo_id, commit_hash, reviewer),
+				FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+			)`,
+			// Every existing review stands as its reviewer's approval.
+			`INSERT INTO approvals (repo_id, commit_hash, reviewer, approved_at)
+			 SELECT repo_id, commit_hash, reviewed_by, COALESCE(reviewed_at, CURRENT_TIMESTAMP)
+			 FROM review_state WHERE status = 'reviewed'`,
+		},
+	},
+	{
+		version: 10,
+		name:    "unsigned approvals",
+		stmts: []string{
+			// Version 9 also backfilled reviews nobody signed, which then
+			// all counted as the same nameless approver. They stay
+			// reviewed without one.
+			`DELETE FROM approvals WHERE reviewer = ''`,
+		},
+	},
+	{
+		version: 11,
+		name:    "archived approvals",
+		stmts: []string{
+			`ALTER TABLE archived_commits ADD COLUMN approvers TEXT NOT NULL DEFAULT ''`,
+			// Archiving used to drop the approvals; the reviewer who
+			// completed the review is the one left on record.
+			`UPDATE archived_commits SET approvers = reviewed_by
+			 WHERE status = 'reviewed' AND purged = 0 AND reviewed_by != ''`,
+		},
+	},
+}
+
+// LatestVersion is the schema version this build writes.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion reports the version recorded in db, 0 for a database that
+// predates versioning or is empty.
+func SchemaVersion(db *sql.DB) (int, error) {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&exists)
+	if err != nil || exists == 0 {
+		return 0, err
+	}
+	var version int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// migrate applies every migration newer than the database's version, each in
+// its own transaction. path is where the database lives on disk, used to
+// back it up before a destructive step.
+func migrate(db *sql.DB, path string, migrations []migration) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema v%d is newer than this build supports (v%d)", current, latest)
+	}
+	// A database from before versioning reads as v0 but still has data
+	// worth backing up.
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_version'`).Scan(&tables)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
 		name TEXT NOT NULL,
-		path TEXT NOT NULL UNIQUE,
-		active INTEGER NOT NULL DEFAULT 1,
-		last_commit_hash TEXT NOT NULL DEFAULT '',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`,
-
-	`CREATE TABLE IF NOT EXISTS commits (
-		hash TEXT PRIMARY KEY,
-		repo_id INTEGER NOT NULL REFERENCES repositories(id),
-		author TEXT NOT NULL,
-		subject TEXT NOT NULL,
-		body TEXT NOT NULL DEFAULT '',
-		branch TEXT NOT NULL DEFAULT '',
-		committed_at DATETIME NOT NULL,
-		detected_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`,
-
-	`CREATE TABLE IF NOT EXISTS review_state (
-		commit_hash TEXT PRIMARY KEY REFERENCES commits(hash),
-		status TEXT NOT NULL DEFAULT 'unreviewed',
-		reviewed_at DATETIME,
-		note TEXT NOT NULL DEFAULT ''
-	)`,
-
-	`CREATE TABLE IF NOT EXISTS events (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		type TEXT NOT NULL,
-		commit_hash TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		payload TEXT NOT NULL DEFAULT ''
-	)`,
-
-	`CREATE INDEX IF NOT EXISTS idx_commits_repo_time ON commits(repo_id, committed_at)`,
-	`CREATE INDEX IF NOT EXISTS idx_review_status ON review_state(status)`,
-	`CREATE INDEX IF NOT EXISTS idx_events_commit ON events(commit_hash, type)`,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	backedUp := false
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if m.destructive && !backedUp && tables > 0 {
+			if _, err := backupBeforeMigrate(db, path, current); err != nil {
+				return fmt.Errorf("backup before migration %d: %w", m.version, err)
+			}
+			backedUp = true
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	// foreign_keys can't be toggled inside a transaction, and rebuilding a
+	// referenced table trips the constraints midway.
+	if m.destructive {
+		if _, err := db.Exec("PRAGMA foreign_keys=OFF"); err != nil {
+			return err
+		}
+		defer db.Exec("PRAGMA foreign_keys=ON")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if m.destructive {
+		if err := checkForeignKeys(tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func checkForeignKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return fmt.Errorf("foreign key violations after migration")
+	}
+	return rows.Err()
+}
+
+// backupBeforeMigrate copies the database next to itself, tagged with the
+// version it was at, and returns the copy's path.
+func backupBeforeMigrate(db *sql.DB, path string, version int) (string, error) {
+	dest := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102T150405"))
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
 }
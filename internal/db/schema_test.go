@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadFixture builds a database file from testdata/<name>.sql without
+// running any migrations.
+func loadFixture(t *testing.T, name string) string {
+	t.Helper()
+	script, err := os.ReadFile(filepath.Join("testdata", name+".sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name+".db")
+	raw, err := sql.Open("sqlite", "file:"+path+"?_time_format=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(string(script)); err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return path
+}
+
+// TestMigrateFixtures opens a database from every historical schema version
+// and checks it reaches the latest version with its data intact. Add a
+// fixture here whenever a migration is added.
+func TestMigrateFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "v*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures")
+	}
+
+	for _, f := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(f), ".sql")
+		t.Run(name, func(t *testing.T) {
+			db, err := Open(loadFixture(t, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			version, err := SchemaVersion(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != LatestVersion() {
+				t.Errorf("version = %d, want %d", version, LatestVersion())
+			}
+
+			repo, err := GetRepoByPath(db, "/code/fixture")
+			if err != nil || repo == nil {
+				t.Fatalf("fixture repo: %v, %v", repo, err)
+			}
+			if repo.LastCommitHash != strings.Repeat("c", 40) {
+				t.Errorf("last commit = %q", repo.LastCommitHash)
+			}
+
+			commits, err := QueryCommits(db, CommitQuery{RepoIDs: []int64{repo.ID}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(commits) != 3 {
+				t.Fatalf("commits = %d, want 3", len(commits))
+			}
+			first := commits[len(commits)-1]
+			if first.Subject != "first" || first.Status != "reviewed" || first.Note != "fixture note" || first.ReviewedAt == nil {
+				t.Errorf("first commit = %+v", first)
+			}
+			// Reviews from before reviewers were recorded have no one to
+			// stand as their approval.
+			wantApprovers := 1
+			if first.ReviewedBy == "" {
+				wantApprovers = 0
+			}
+			if len(first.Approvers) != wantApprovers || first.RequiredApprovals != 1 {
+				t.Errorf("first commit approvals = %q of %d", first.Approvers, first.RequiredApprovals)
+			}
+
+			stats, err := GetStats(db, repo.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Reviewed != 1 || stats.Ignored != 1 || stats.Unreviewed != 1 {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			found, err := SearchCommits(db, []int64{repo.ID}, "fixture note", 10)
+			if err != nil || len(found) != 1 || found[0].Subject != "first" {
+				t.Errorf("search for note = %+v, %v", found, err)
+			}
+
+			// Archived reviews keep their approvers, or for ones archived
+			// before that, the reviewer on record.
+			archived, err := ListArchived(db, []int64{repo.ID}, "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, a := range archived {
+				if a.ReviewedBy == "" && len(a.Approvers) != 0 ||
+					a.ReviewedBy != "" && (len(a.Approvers) == 0 || a.Approvers[len(a.Approvers)-1] != a.ReviewedBy) {
+					t.Errorf("archived approvers = %q by %q", a.Approvers, a.ReviewedBy)
+				}
+			}
+
+			var unsigned int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM approvals WHERE reviewer = ''`).Scan(&unsigned); err != nil || unsigned != 0 {
+				t.Errorf("approvals without a reviewer = %d, %v", unsigned, err)
+			}
+
+			var refEvents int
+			err = db.QueryRow(`SELECT COUNT(*) FROM events WHERE repo_id = ? AND type = ?`, repo.ID, EventRefDeleted).Scan(&refEvents)
+			if err != nil || refEvents != 1 {
+				t.Errorf("ref events for fixture repo = %d, %v", refEvents, err)
+			}
+		})
+	}
+}
+
+func TestOpenIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for range 2 {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(migrations) {
+		t.Errorf("schema_version rows = %d, want %d", n, len(migrations))
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	h := testDB(t)
+	if _, err := h.db.Exec(`INSERT INTO schema_version (version, name) VALUES (?, 'future')`, LatestVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(h.db, "", migrations); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("err = %v, want newer-schema error", err)
+	}
+}
+
+func TestMigrationRollsBackOnError(t *testing.T) {
+	h := testDB(t)
+	steps := append(append([]migration(nil), migrations...), migration{
+		version: LatestVersion() + 1,
+		name:    "broken",
+		stmts:   []string{`CREATE TABLE half_done (id INTEGER)`, `NOT SQL`},
+	})
+
+	if err := migrate(h.db, "", steps); err == nil {
+		t.Fatal("expected error")
+	}
+	if v, _ := SchemaVersion(h.db); v != LatestVersion() {
+		t.Errorf("version = %d, want %d", v, LatestVersion())
+	}
+	var n int
+	h.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n)
+	if n != 0 {
+		t.Error("failed migration left a table behind")
+	}
+}
+
+func TestDestructiveMigrationBacksUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repoID, _ := UpsertRepo(db, "test", "/tmp/test")
+	if _, err := db.Exec(`UPDATE repositories SET last_commit_hash = 'before' WHERE id = ?`, repoID); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := append(append([]migration(nil), migrations...), migration{
+		version:     LatestVersion() + 1,
+		name:        "rebuild repositories",
+		destructive: true,
+		stmts: []string{
+			`CREATE TABLE repositories_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				path TEXT NOT NULL UNIQUE,
+				active INTEGER NOT NULL DEFAULT 1,
+				last_commit_hash TEXT NOT NULL DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`INSERT INTO repositories_new SELECT id, name, path, active, 'after', created_at FROM repositories`,
+			`DROP TABLE repositories`,
+			`ALTER TABLE repositories_new RENAME TO repositories`,
+		},
+	})
+	if err := migrate(db, path, steps); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(path + ".v*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	old, err := sql.Open("sqlite", "file:"+backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	var hash string
+	if err := old.QueryRow(`SELECT last_commit_hash FROM repositories WHERE id = ?`, repoID).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if hash != "before" {
+		t.Errorf("backup has %q, want pre-migration data", hash)
+	}
+	if v, _ := SchemaVersion(old); v != LatestVersion() {
+		t.Errorf("backup version = %d, want %d", v, LatestVersion())
+	}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Markers wrapped around matched terms in a SearchResult's highlighted
+// fields. They are control characters so they can't clash with commit text.
+const (
+	MatchStart = "\x02"
+	MatchEnd   = "\x03"
+)
+
+type SearchResult struct {
+	CommitRow
+	Rank float64
+	// SubjectMatch and AuthorMatch are the full subject and author with
+	// matches marked.
+	SubjectMatch string
+	AuthorMatch  string
+	// Snippet is an excerpt from the note, body or changed files when the
+	// match is there, empty otherwise.
+	Snippet string
+}
+
+// SearchCommits finds commits in repoIDs whose subject, body, author, note
+// or changed files match query, best matches first. Every word in query
+// must match, each as a prefix, so results narrow as the user types.
+func SearchCommits(db *sql.DB, repoIDs []int64, query string, limit int) ([]SearchResult, error) {
+	match := matchQuery(query)
+	if match == "" || len(repoIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(repoIDs))
+	args := []any{match}
+	for i, id := range repoIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, limit)
+
+	// Subject matches weigh most, then notes, then author.
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT c.hash, c.repo_id, rp.name, c.author, c.subject, c.body, c.branch,
+		        c.committed_at, c.detected_at,
+		        r.status, r.reviewed_at, r.reviewed_by, r.note, rp.required_approvals, %s,
+		        bm25(commit_search, 10.0, 1.0, 2.0, 5.0, 1.0) AS score,
+		        highlight(commit_search, 0, char(2), char(3)),
+		        highlight(commit_search, 2, char(2), char(3)),
+		        snippet(commit_search, 3, char(2), char(3), '…', 8),
+		        snippet(commit_search, 1, char(2), char(3), '…', 8),
+		        snippet(commit_search, 4, char(2), char(3), '…', 8)
+		 FROM commit_search
+		 JOIN commits c ON c.id = commit_search.rowid
+		 JOIN review_state r ON r.repo_id = c.repo_id AND r.commit_hash = c.hash
+		 JOIN repositories rp ON rp.id = c.repo_id
+		 WHERE commit_search MATCH ? AND c.repo_id IN (%s)
+		 ORDER BY score, c.committed_at DESC
+		 LIMIT ?`, approversColumn, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var s SearchResult
+		var note, body, files string
+		var approvers sql.NullString
+		c := &s.CommitRow
+		if err := rows.Scan(&c.Hash, &c.RepoID, &c.RepoName, &c.Author, &c.Subject, &c.Body, &c.Branch,
+			&c.CommittedAt, &c.DetectedAt, &c.Status, &c.ReviewedAt, &c.ReviewedBy, &c.Note,
+			&c.RequiredApprovals, &approvers,
+			&s.Rank, &s.SubjectMatch, &s.AuthorMatch, &note, &body, &files); err != nil {
+			return nil, err
+		}
+		c.scanApprovers(approvers)
+		for _, snip := range []string{note, body, files} {
+			if strings.Contains(snip, MatchStart) {
+				s.Snippet = strings.Join(strings.Fields(snip), " ")
+				break
+			}
+		}
+		results = append(results, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	ptrs := make([]*CommitRow, len(results))
+	for i := range results {
+		ptrs[i] = &results[i].CommitRow
+	}
+	return results, attachLabels(db, ptrs)
+}
+
+// matchQuery turns free text into an FTS5 query: each word becomes a quoted
+// prefix term, so punctuation the user types can't break the syntax.
+func matchQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Store is Apollo's review data: repos, their commits and review state,
+// labels, events and stats. SQLStore keeps it in the SQLite database;
+// MemStore keeps it in memory for tests. Both pass the same contract tests
+// in store_test.go.
+type Store interface {
+	UpsertRepo(name, path string) (int64, error)
+	GetRepoByPath(path string) (*Repository, error)
+	ListRepos() ([]Repository, error)
+	ListActiveRepos() ([]Repository, error)
+	SetRepoActive(repoID int64, active bool) error
+	UpdateLastCommitHash(repoID int64, hash string) error
+	SetRequiredApprovals(repoID int64, n int) error
+	DeleteRepo(repoID int64, purge bool) error
+	SetRepoIdentity(repoID int64, roots, remotes []string) error
+	HasRepoIdentity(repoID int64) (bool, error)
+	FindReposByIdentity(excludeID int64, roots, remotes []string) ([]Repository, error)
+	RebindRepo(repoID int64, newPath, name string) error
+
+	IngestCommits(repoID int64, commits []NewCommit, cursor string) ([]string, error)
+	InsertCommit(repoID int64, hash, author, subject, body, branch string, committedAt time.Time, files []string) error
+	KnownHashes(repoID int64, hashes []string) (map[string]bool, error)
+	QueryCommits(q CommitQuery) ([]CommitRow, error)
+	SearchCommits(repoIDs []int64, query string, limit int) ([]SearchResult, error)
+	ArchiveCommits(before time.Time, purge bool) (int, error)
+
+	UpdateReviewStatus(repoID int64, hash, status, note, by string) error
+	UpdateSharedReviewStatus(hash, status, note, by string) error
+	UpdateNote(repoID int64, hash, note string) error
+	UpdateSharedNote(hash, note string) error
+	InheritSharedReview(repoID int64, hashes []string) (int, error)
+	ListApprovals(repoID int64, hash string) ([]Approval, error)
+
+	CreateLabel(name, color string) (int64, error)
+	ListLabels() ([]Label, error)
+	DeleteLabel(id int64) error
+	AddLabel(repoID int64, hash string, labelID int64) error
+	RemoveLabel(repoID int64, hash string, labelID int64) error
+	ApplyRuleLabel(repoID int64, hash, rule, label, color string) (bool, error)
+
+	InsertEvent(repoID int64, eventType, commitHash, payload string) error
+	RecordEvent(repoID int64, eventType, commitHash string, payload any) error
+	ListEvents(repoID int64, commitHash string) ([]Event, error)
+	UndoEvent(id int64, by string) error
+
+	GetStats(repoID int64) (Stats, error)
+	GetAggregateStats(repoIDs []int64) (Stats, error)
+	GetReviewerStats(repoIDs []int64) ([]ReviewerStats, error)
+	GetLabelStats(repoIDs []int64) ([]LabelStats, error)
+	SnapshotStats(now time.Time) error
+	ListSnapshots(repoIDs []int64, since time.Time) ([]Snapshot, error)
+
+	Close() error
+}
+
+// FileStore is a Store kept in a file, which can be compacted and backed up.
+type FileStore interface {
+	Store
+	Compact() (before, after int64, err error)
+	ScheduledBackup(dir string, every time.Duration, keep int) (string, error)
+}
+
+// SQLStore is the Store over an open database. Its methods are the package
+// functions of the same name.
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ FileStore = (*SQLStore)(nil)
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// DB returns the underlying database, for what the Store doesn't cover.
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) UpsertRepo(name, path string) (int64, error) {
+	return UpsertRepo(s.db, name, path)
+}
+
+func (s *SQLStore) GetRepoByPath(path string) (*Repository, error) {
+	return GetRepoByPath(s.db, path)
+}
+
+func (s *SQLStore) ListRepos() ([]Repository, error) {
+	return ListRepos(s.db)
+}
+
+func (s *SQLStore) ListActiveRepos() ([]Repository, error) {
+	return ListActiveRepos(s.db)
+}
+
+func (s *SQLStore) SetRepoActive(repoID int64, active bool) error {
+	return SetRepoActive(s.db, repoID, active)
+}
+
+func (s *SQLStore) UpdateLastCommitHash(repoID int64, hash string) error {
+	return UpdateLastCommitHash(s.db, repoID, hash)
+}
+
+func (s *SQLStore) SetRequiredApprovals(repoID int64, n int) error {
+	return SetRequiredApprovals(s.db, repoID, n)
+}
+
+func (s *SQLStore) DeleteRepo(repoID int64, purge bool) error {
+	return DeleteRepo(s.db, repoID, purge)
+}
+
+func (s *SQLStore) SetRepoIdentity(repoID int64, roots, remotes []string) error {
+	return SetRepoIdentity(s.db, repoID, roots, remotes)
+}
+
+func (s *SQLStore) HasRepoIdentity(repoID int64) (bool, error) {
+	return HasRepoIdentity(s.db, repoID)
+}
+
+func (s *SQLStore) FindReposByIdentity(excludeID int64, roots, remotes []string) ([]Repository, error) {
+	return FindReposByIdentity(s.db, excludeID, roots, remotes)
+}
+
+func (s *SQLStore) RebindRepo(repoID int64, newPath, name string) error {
+	return RebindRepo(s.db, repoID, newPath, name)
+}
+
+func (s *SQLStore) IngestCommits(repoID int64, commits []NewCommit, cursor string) ([]string, error) {
+	return IngestCommits(s.db, repoID, commits, cursor)
+}
+
+func (s *SQLStore) InsertCommit(repoID int64, hash, author, subject, body, branch string, committedAt time.Time, files []string) error {
+	return InsertCommit(s.db, repoID, hash, author, subject, body, branch, committedAt, files)
+}
+
+func (s *SQLStore) KnownHashes(repoID int64, hashes []string) (map[string]bool, error) {
+	return KnownHashes(s.db, repoID, hashes)
+}
+
+func (s *SQLStore) QueryCommits(q CommitQuery) ([]CommitRow, error) {
+	return QueryCommits(s.db, q)
+}
+
+func (s *SQLStore) SearchCommits(repoIDs []int64, query string, limit int) ([]SearchResult, error) {
+	return SearchCommits(s.db, repoIDs, query, limit)
+}
+
+func (s *SQLStore) ArchiveCommits(before time.Time, purge bool) (int, error) {
+	return ArchiveCommits(s.db, before, purge)
+}
+
+func (s *SQLStore) UpdateReviewStatus(repoID int64, hash, status, note, by string) error {
+	return UpdateReviewStatus(s.db, repoID, hash, status, note, by)
+}
+
+func (s *SQLStore) UpdateSharedReviewStatus(hash, status, note, by string) error {
+	return UpdateSharedReviewStatus(s.db, hash, status, note, by)
+}
+
+func (s *SQLStore) UpdateNote(repoID int64, hash, note string) error {
+	return UpdateNote(s.db, repoID, hash, note)
+}
+
+func (s *SQLStore) UpdateSharedNote(hash, note string) error {
+	return UpdateSharedNote(s.db, hash, note)
+}
+
+func (s *SQLStore) InheritSharedReview(repoID int64, hashes []string) (int, error) {
+	return InheritSharedReview(s.db, repoID, hashes)
+}
+
+func (s *SQLStore) ListApprovals(repoID int64, hash string) ([]Approval, error) {
+	return ListApprovals(s.db, repoID, hash)
+}
+
+func (s *SQLStore) CreateLabel(name, color string) (int64, error) {
+	return CreateLabel(s.db, name, color)
+}
+
+func (s *SQLStore) ListLabels() ([]Label, error) {
+	return ListLabels(s.db)
+}
+
+func (s *SQLStore) DeleteLabel(id int64) error {
+	return DeleteLabel(s.db, id)
+}
+
+func (s *SQLStore) AddLabel(repoID int64, hash string, labelID int64) error {
+	return AddLabel(s.db, repoID, hash, labelID)
+}
+
+func (s *SQLStore) RemoveLabel(repoID int64, hash string, labelID int64) error {
+	return RemoveLabel(s.db, repoID, hash, labelID)
+}
+
+func (s *SQLStore) ApplyRuleLabel(repoID int64, hash, rule, label, color string) (bool, error) {
+	return ApplyRuleLabel(s.db, repoID, hash, rule, label, color)
+}
+
+func (s *SQLStore) InsertEvent(repoID int64, eventType, commitHash, payload string) error {
+	return InsertEvent(s.db, repoID, eventType, commitHash, payload)
+}
+
+func (s *SQLStore) RecordEvent(repoID int64, eventType, commitHash string, payload any) error {
+	return RecordEvent(s.db, repoID, eventType, commitHash, payload)
+}
+
+func (s *SQLStore) ListEvents(repoID int64, commitHash string) ([]Event, error) {
+	return ListEvents(s.db, repoID, commitHash)
+}
+
+func (s *SQLStore) UndoEvent(id int64, by string) error {
+	return UndoEvent(s.db, id, by)
+}
+
+func (s *SQLStore) GetStats(repoID int64) (Stats, error) {
+	return GetStats(s.db, repoID)
+}
+
+func (s *SQLStore) GetAggregateStats(repoIDs []int64) (Stats, error) {
+	return GetAggregateStats(s.db, repoIDs)
+}
+
+func (s *SQLStore) GetReviewerStats(repoIDs []int64) ([]ReviewerStats, error) {
+	return GetReviewerStats(s.db, repoIDs)
+}
+
+func (s *SQLStore) GetLabelStats(repoIDs []int64) ([]LabelStats, error) {
+	return GetLabelStats(s.db, repoIDs)
+}
+
+func (s *SQLStore) SnapshotStats(now time.Time) error {
+	return SnapshotStats(s.db, now)
+}
+
+func (s *SQLStore) ListSnapshots(repoIDs []int64, since time.Time) ([]Snapshot, error) {
+	return ListSnapshots(s.db, repoIDs, since)
+}
+
+func (s *SQLStore) Compact() (before, after int64, err error) {
+	return Compact(s.db)
+}
+
+func (s *SQLStore) ScheduledBackup(dir string, every time.Duration, keep int) (string, error) {
+	return ScheduledBackup(s.db, dir, every, keep)
+}
@@ -0,0 +1,863 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewSQLStore(testDB(t).db) })
+}
+
+func TestMemStore(t *testing.T) {
+	testStore(t, func(*testing.T) Store { return NewMemStore() })
+}
+
+// A shared decision that fails in one repo leaves all of them as they were,
+// as SQLStore's transaction does.
+func TestMemStoreSharedReviewRollsBack(t *testing.T) {
+	s := NewMemStore()
+	fork := mustUpsert(t, s, "fork", "/code/fork")
+	upstream := mustUpsert(t, s, "upstream", "/code/upstream")
+	mustInsert(t, s, fork, "abc", "alice", "msg", time.Now())
+	mustInsert(t, s, upstream, "abc", "alice", "msg", time.Now())
+	s.UpdateSharedReviewStatus("abc", "reviewed", "lgtm", "alice")
+	events := len(s.events)
+
+	// A review time JSON can't hold fails the event in the second repo.
+	bad := time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.commits[commitKey{upstream, "abc"}].review.reviewedAt = &bad
+	if err := s.UpdateSharedReviewStatus("abc", "unreviewed", "no", "bob"); err == nil {
+		t.Fatal("the update should fail")
+	}
+	c := mustCommit(t, s, fork, "abc")
+	if c.Status != "reviewed" || c.Note != "lgtm" || strings.Join(c.Approvers, ",") != "alice" || len(s.events) != events {
+		t.Errorf("fork = %+v with %d new events, want it untouched", c, len(s.events)-events)
+	}
+}
+
+// testStore is the contract every Store implementation has to meet.
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"Repos", testStoreRepos},
+		{"Ingest", testStoreIngest},
+		{"Query", testStoreQuery},
+		{"Paging", testStorePaging},
+		{"Review", testStoreReview},
+		{"Notes", testStoreNotes},
+		{"Undo", testStoreUndo},
+		{"SharedReview", testStoreSharedReview},
+		{"Labels", testStoreLabels},
+		{"Events", testStoreEvents},
+		{"Stats", testStoreStats},
+		{"Snapshots", testStoreSnapshots},
+		{"Search", testStoreSearch},
+		{"Identity", testStoreIdentity},
+		{"Rebind", testStoreRebind},
+		{"Archive", testStoreArchive},
+		{"DeleteRepo", testStoreDeleteRepo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.run(t, open(t)) })
+	}
+}
+
+func mustUpsert(t *testing.T, s Store, name, path string) int64 {
+	t.Helper()
+	id, err := s.UpsertRepo(name, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustInsert(t *testing.T, s Store, repoID int64, hash, author, subject string, at time.Time, files ...string) {
+	t.Helper()
+	if err := s.InsertCommit(repoID, hash, author, subject, "", "main", at, files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustCommit(t *testing.T, s Store, repoID int64, hash string) CommitRow {
+	t.Helper()
+	commits, err := s.QueryCommits(CommitQuery{RepoIDs: []int64{repoID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commits {
+		if c.Hash == hash {
+			return c
+		}
+	}
+	t.Fatalf("commit %s not found in repo %d", hash, repoID)
+	return CommitRow{}
+}
+
+func storeEventTypes(t *testing.T, s Store, repoID int64, hash string) []string {
+	t.Helper()
+	events, err := s.ListEvents(repoID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func hashes(commits []CommitRow) []string {
+	var result []string
+	for _, c := range commits {
+		result = append(result, c.Hash)
+	}
+	return result
+}
+
+func testStoreRepos(t *testing.T, s Store) {
+	id := mustUpsert(t, s, "beta", "/code/beta")
+	if again := mustUpsert(t, s, "renamed", "/code/beta"); again != id {
+		t.Errorf("upsert of a known path = %d, want %d", again, id)
+	}
+	alpha := mustUpsert(t, s, "alpha", "/code/alpha")
+
+	r, err := s.GetRepoByPath("/code/beta")
+	if err != nil || r == nil || r.Name != "renamed" || !r.Active || r.RequiredApprovals != 1 {
+		t.Fatalf("repo = %+v, %v", r, err)
+	}
+	if r, err := s.GetRepoByPath("/code/missing"); r != nil || err != nil {
+		t.Errorf("missing repo = %+v, %v", r, err)
+	}
+
+	s.UpdateLastCommitHash(id, "abc")
+	s.SetRequiredApprovals(id, 0)
+	s.SetRepoActive(alpha, false)
+	repos, _ := s.ListRepos()
+	if len(repos) != 2 || repos[0].ID != alpha || repos[1].ID != id {
+		t.Errorf("repos = %+v, want sorted by name", repos)
+	}
+	if repos[1].LastCommitHash != "abc" || repos[1].RequiredApprovals != 1 {
+		t.Errorf("repo = %+v, want cursor abc and at least one approval", repos[1])
+	}
+	active, _ := s.ListActiveRepos()
+	if len(active) != 1 || active[0].ID != id {
+		t.Errorf("active = %+v", active)
+	}
+}
+
+func testStoreIngest(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	now := time.Now()
+	batch := []NewCommit{
+		{Hash: "aaa", Author: "alice", Subject: "first", Branch: "main", CommittedAt: now, Files: []string{"a.go"}},
+		{Hash: "bbb", Author: "bob", Subject: "second", Branch: "main", CommittedAt: now},
+	}
+	added, err := s.IngestCommits(repo, batch, "bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(added, ",") != "aaa,bbb" {
+		t.Errorf("added = %v", added)
+	}
+	if added, _ := s.IngestCommits(repo, batch, ""); len(added) != 0 {
+		t.Errorf("re-ingest added %v", added)
+	}
+	if r, _ := s.GetRepoByPath("/code/test"); r.LastCommitHash != "bbb" {
+		t.Errorf("cursor = %q", r.LastCommitHash)
+	}
+
+	known, err := s.KnownHashes(repo, []string{"aaa", "ccc"})
+	if err != nil || !known["aaa"] || known["ccc"] {
+		t.Errorf("known = %v, %v", known, err)
+	}
+	c := mustCommit(t, s, repo, "aaa")
+	if c.Status != "unreviewed" || c.RepoName != "test" || c.Author != "alice" || !c.CommittedAt.Equal(now) || c.DetectedAt.IsZero() {
+		t.Errorf("commit = %+v", c)
+	}
+	if got := storeEventTypes(t, s, repo, "aaa"); strings.Join(got, ",") != EventDetected {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func testStoreQuery(t *testing.T, s Store) {
+	alpha := mustUpsert(t, s, "alpha", "/code/alpha")
+	beta := mustUpsert(t, s, "beta", "/code/beta")
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mustInsert(t, s, alpha, "a1", "Alice <alice@example.com>", "Fix watcher leak", base, "internal/watcher/watcher.go")
+	mustInsert(t, s, alpha, "a2", "Bob <bob@example.com>", "Tidy docs", base.Add(time.Hour), "docs/README.md")
+	s.InsertCommit(alpha, "a3", "alice", "Bump deps", "", "release", base.Add(2*time.Hour), []string{"go.mod"})
+	mustInsert(t, s, beta, "b1", "carol", "Watcher rewrite", base.Add(3*time.Hour))
+	s.UpdateReviewStatus(alpha, "a2", "reviewed", "", "tester")
+
+	for name, tt := range map[string]struct {
+		q    CommitQuery
+		want string
+	}{
+		"all":        {CommitQuery{}, "b1,a3,a2,a1"},
+		"repo":       {CommitQuery{RepoIDs: []int64{beta}}, "b1"},
+		"status":     {CommitQuery{Status: FilterReviewed}, "a2"},
+		"author":     {CommitQuery{Author: "ALICE"}, "a3,a1"},
+		"branch":     {CommitQuery{Branch: "release"}, "a3"},
+		"window":     {CommitQuery{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, "a3,a2"},
+		"path":       {CommitQuery{Path: "internal/"}, "a1"},
+		"file":       {CommitQuery{Path: "go.mod"}, "a3"},
+		"text":       {CommitQuery{Text: "watch"}, "b1,a1"},
+		"ascending":  {CommitQuery{Asc: true, Limit: 2}, "a1,a2"},
+		"by author":  {CommitQuery{Sort: SortAuthor, Asc: true}, "a1,a2,a3,b1"},
+		"by review":  {CommitQuery{Sort: SortReviewed, Limit: 1}, "a2"},
+		"no matches": {CommitQuery{Author: "nobody"}, ""},
+	} {
+		commits, err := s.QueryCommits(tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := strings.Join(hashes(commits), ","); got != tt.want {
+			t.Errorf("%s = %s, want %s", name, got, tt.want)
+		}
+	}
+	if _, err := s.QueryCommits(CommitQuery{Sort: "size"}); err == nil {
+		t.Error("unknown sort key should fail")
+	}
+}
+
+func testStorePaging(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	base := time.Now().Add(-time.Hour)
+	for i, h := range []string{"c1", "c2", "c3", "c4", "c5"} {
+		// Two commits share a time, so paging has to break the tie.
+		mustInsert(t, s, repo, h, "alice", h, base.Add(time.Duration(i/2)*time.Minute))
+	}
+	all, _ := s.QueryCommits(CommitQuery{})
+
+	var paged []CommitRow
+	q := CommitQuery{Limit: 2}
+	for {
+		page, err := s.QueryCommits(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if len(page) < q.Limit {
+			break
+		}
+		q.After = page[len(page)-1].Cursor
+	}
+	if got, want := strings.Join(hashes(paged), ","), strings.Join(hashes(all), ","); got != want || len(all) != 5 {
+		t.Errorf("paged = %s, want %s", got, want)
+	}
+
+	if _, err := s.QueryCommits(CommitQuery{After: "nonsense"}); !errors.Is(err, ErrBadCursor) {
+		t.Errorf("bad cursor = %v", err)
+	}
+	if _, err := s.QueryCommits(CommitQuery{Sort: SortAuthor, After: all[0].Cursor}); !errors.Is(err, ErrBadCursor) {
+		t.Errorf("cursor from another sort = %v", err)
+	}
+}
+
+func testStoreReview(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	mustInsert(t, s, repo, "abc", "alice", "msg", time.Now())
+	s.SetRequiredApprovals(repo, 2)
+
+	if err := s.UpdateReviewStatus(repo, "abc", "reviewed", "", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	c := mustCommit(t, s, repo, "abc")
+	if c.Status != "unreviewed" || strings.Join(c.Approvers, ",") != "alice" || c.RequiredApprovals != 2 || c.Approved() {
+		t.Errorf("after one approval = %+v", c)
+	}
+
+	s.UpdateReviewStatus(repo, "abc", "reviewed", "looks fine", "bob")
+	c = mustCommit(t, s, repo, "abc")
+	if c.Status != "reviewed" || c.ReviewedBy != "bob" || c.ReviewedAt == nil || c.Note != "looks fine" || !c.Approved() {
+		t.Errorf("after two approvals = %+v", c)
+	}
+	approvals, _ := s.ListApprovals(repo, "abc")
+	if len(approvals) != 2 || approvals[0].Reviewer != "alice" || approvals[1].Reviewer != "bob" {
+		t.Errorf("approvals = %+v", approvals)
+	}
+
+	s.UpdateReviewStatus(repo, "abc", "unreviewed", "looks fine", "bob")
+	c = mustCommit(t, s, repo, "abc")
+	if c.Status != "unreviewed" || strings.Join(c.Approvers, ",") != "alice" {
+		t.Errorf("after bob withdraws = %+v", c)
+	}
+	s.UpdateReviewStatus(repo, "abc", "unreviewed", "looks fine", "carol")
+	if c = mustCommit(t, s, repo, "abc"); len(c.Approvers) != 0 {
+		t.Errorf("sending back without an approval should clear them, got %v", c.Approvers)
+	}
+	s.UpdateReviewStatus(repo, "abc", "ignored", "looks fine", "carol")
+	if c = mustCommit(t, s, repo, "abc"); c.Status != "ignored" || c.ReviewedBy != "carol" {
+		t.Errorf("ignored = %+v", c)
+	}
+
+	got := storeEventTypes(t, s, repo, "abc")
+	want := []string{EventDetected, EventStatusChanged, EventStatusChanged, EventNoteEdited,
+		EventStatusChanged, EventStatusChanged, EventStatusChanged}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if err := s.UpdateReviewStatus(repo, "missing", "reviewed", "", "tester"); err == nil {
+		t.Error("reviewing an unknown commit should fail")
+	}
+
+	// Without a reviewer a decision would count as a nameless approval.
+	for _, status := range []string{"reviewed", "unreviewed"} {
+		if err := s.UpdateReviewStatus(repo, "abc", status, "", ""); !errors.Is(err, ErrNoReviewer) {
+			t.Errorf("%s without a reviewer = %v", status, err)
+		}
+		if err := s.UpdateSharedReviewStatus("abc", status, "", ""); !errors.Is(err, ErrNoReviewer) {
+			t.Errorf("shared %s without a reviewer = %v", status, err)
+		}
+	}
+	if err := s.UpdateReviewStatus(repo, "abc", "unreviewed", "", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateReviewStatus(repo, "abc", "ignored", "", ""); err != nil {
+		t.Errorf("ignoring needs no reviewer, got %v", err)
+	}
+
+	// Raising the quota leaves a reviewed commit reviewed, even when more
+	// approvals come in, until somebody sends it back.
+	mustInsert(t, s, repo, "def", "alice", "msg", time.Now())
+	s.SetRequiredApprovals(repo, 1)
+	s.UpdateReviewStatus(repo, "def", "reviewed", "", "alice")
+	s.SetRequiredApprovals(repo, 3)
+	s.UpdateReviewStatus(repo, "def", "reviewed", "", "bob")
+	if c = mustCommit(t, s, repo, "def"); c.Status != "reviewed" || c.ReviewedBy != "alice" || len(c.Approvers) != 2 {
+		t.Errorf("approved again after raising the quota = %+v", c)
+	}
+	s.UpdateReviewStatus(repo, "def", "unreviewed", "", "carol")
+	if c = mustCommit(t, s, repo, "def"); c.Status != "unreviewed" || len(c.Approvers) != 0 {
+		t.Errorf("sent back after raising the quota = %+v", c)
+	}
+}
+
+func testStoreNotes(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	mirror := mustUpsert(t, s, "mirror", "/code/mirror")
+	mustInsert(t, s, repo, "abc", "alice", "msg", time.Now())
+	mustInsert(t, s, mirror, "abc", "alice", "msg", time.Now())
+	s.SetRequiredApprovals(repo, 2)
+	s.UpdateReviewStatus(repo, "abc", "reviewed", "", "alice")
+
+	// A note is no decision: it neither withdraws alice's approval nor
+	// counts as one.
+	if err := s.UpdateNote(repo, "abc", "needs a second look"); err != nil {
+		t.Fatal(err)
+	}
+	c := mustCommit(t, s, repo, "abc")
+	if c.Status != "unreviewed" || c.Note != "needs a second look" || strings.Join(c.Approvers, ",") != "alice" {
+		t.Errorf("after note on a partly approved commit = %+v", c)
+	}
+	s.UpdateReviewStatus(repo, "abc", "reviewed", c.Note, "bob")
+	s.UpdateNote(repo, "abc", "done")
+	c = mustCommit(t, s, repo, "abc")
+	if c.Status != "reviewed" || c.ReviewedBy != "bob" || strings.Join(c.Approvers, ",") != "alice,bob" {
+		t.Errorf("after note on a reviewed commit = %+v", c)
+	}
+	got := storeEventTypes(t, s, repo, "abc")
+	want := []string{EventDetected, EventStatusChanged, EventNoteEdited, EventStatusChanged, EventNoteEdited}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	if err := s.UpdateSharedNote("abc", "shared"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{repo, mirror} {
+		if c := mustCommit(t, s, id, "abc"); c.Note != "shared" {
+			t.Errorf("repo %d note = %q", id, c.Note)
+		}
+	}
+	if c := mustCommit(t, s, mirror, "abc"); c.Status != "unreviewed" || len(c.Approvers) != 0 {
+		t.Errorf("shared note changed the mirror's review: %+v", c)
+	}
+	if err := s.UpdateNote(repo, "missing", "x"); err == nil {
+		t.Error("a note on an unknown commit should fail")
+	}
+	if err := s.UpdateSharedNote("missing", "x"); err == nil {
+		t.Error("a shared note on an unknown commit should fail")
+	}
+}
+
+func testStoreUndo(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	mustInsert(t, s, repo, "abc", "alice", "msg", time.Now())
+	s.SetRequiredApprovals(repo, 2)
+	s.UpdateReviewStatus(repo, "abc", "reviewed", "", "alice")
+	s.UpdateReviewStatus(repo, "abc", "reviewed", "ok", "bob")
+	s.UpdateReviewStatus(repo, "abc", "unreviewed", "ok", "bob")
+
+	events, _ := s.ListEvents(repo, "abc")
+	last := events[len(events)-1]
+	if err := s.UndoEvent(last.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	c := mustCommit(t, s, repo, "abc")
+	if c.Status != "reviewed" || c.ReviewedBy != "bob" || strings.Join(c.Approvers, ",") != "alice,bob" {
+		t.Errorf("after undo = %+v", c)
+	}
+	if err := s.UndoEvent(last.ID, "bob"); !errors.Is(err, ErrAlreadyUndone) {
+		t.Errorf("second undo = %v", err)
+	}
+	if err := s.UndoEvent(events[0].ID, "bob"); !errors.Is(err, ErrNotUndoable) {
+		t.Errorf("undo detection = %v", err)
+	}
+	if err := s.UndoEvent(9999, "bob"); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("undo missing = %v", err)
+	}
+
+	note := slices.IndexFunc(events, func(e Event) bool { return e.Type == EventNoteEdited })
+	if err := s.UndoEvent(events[note].ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if c := mustCommit(t, s, repo, "abc"); c.Note != "" {
+		t.Errorf("note after undo = %q", c.Note)
+	}
+	events, _ = s.ListEvents(repo, "abc")
+	undone := UndoneEvents(events)
+	if !undone[last.ID] || !undone[events[note].ID] || len(undone) != 2 {
+		t.Errorf("undone = %v", undone)
+	}
+}
+
+func testStoreSharedReview(t *testing.T, s Store) {
+	fork := mustUpsert(t, s, "fork", "/code/fork")
+	upstream := mustUpsert(t, s, "upstream", "/code/upstream")
+	mirror := mustUpsert(t, s, "mirror", "/code/mirror")
+	now := time.Now()
+	mustInsert(t, s, fork, "abc", "alice", "msg", now)
+	mustInsert(t, s, upstream, "abc", "alice", "msg", now)
+
+	if err := s.UpdateSharedReviewStatus("abc", "reviewed", "lgtm", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{fork, upstream} {
+		if c := mustCommit(t, s, id, "abc"); c.Status != "reviewed" || c.Note != "lgtm" {
+			t.Errorf("repo %d = %+v", id, c)
+		}
+	}
+	if err := s.UpdateSharedReviewStatus("missing", "reviewed", "", "tester"); err == nil {
+		t.Error("sharing a review of an unknown commit should fail")
+	}
+
+	// A shared decision lands in every repo at once, or in none.
+	mustInsert(t, s, fork, "xyz", "alice", "msg", now)
+	mustInsert(t, s, upstream, "xyz", "alice", "msg", now)
+	s.UpdateSharedReviewStatus("xyz", "reviewed", "lgtm", "bob")
+	a, b := mustCommit(t, s, fork, "xyz"), mustCommit(t, s, upstream, "xyz")
+	if a.ReviewedAt == nil || b.ReviewedAt == nil || !a.ReviewedAt.Equal(*b.ReviewedAt) {
+		t.Errorf("reviewed at %v and %v, want the same time", a.ReviewedAt, b.ReviewedAt)
+	}
+	before := len(storeEventTypes(t, s, fork, "xyz")) + len(storeEventTypes(t, s, upstream, "xyz"))
+	if err := s.UpdateSharedReviewStatus("xyz", "unreviewed", "nope", ""); !errors.Is(err, ErrNoReviewer) {
+		t.Errorf("shared decision without a reviewer = %v", err)
+	}
+	after := len(storeEventTypes(t, s, fork, "xyz")) + len(storeEventTypes(t, s, upstream, "xyz"))
+	if c := mustCommit(t, s, upstream, "xyz"); c.Status != "reviewed" || c.Note != "lgtm" || after != before {
+		t.Errorf("a rejected shared decision changed %+v, %d events", c, after-before)
+	}
+
+	mustInsert(t, s, mirror, "abc", "alice", "msg", now)
+	mustInsert(t, s, mirror, "def", "bob", "msg", now)
+	n, err := s.InheritSharedReview(mirror, []string{"abc", "def"})
+	if err != nil || n != 1 {
+		t.Fatalf("inherited = %d, %v", n, err)
+	}
+	c := mustCommit(t, s, mirror, "abc")
+	if c.Status != "reviewed" || c.Note != "lgtm" || c.ReviewedBy != "alice" || strings.Join(c.Approvers, ",") != "alice" {
+		t.Errorf("mirror = %+v", c)
+	}
+	got := storeEventTypes(t, s, mirror, "abc")
+	want := []string{EventDetected, EventStatusChanged, EventNoteEdited, EventRuleApplied}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if n, _ := s.InheritSharedReview(mirror, []string{"abc"}); n != 0 {
+		t.Error("a commit with its own review should not inherit again")
+	}
+
+	// One approval doesn't make a commit reviewed in a repo that needs two.
+	strict := mustUpsert(t, s, "strict", "/code/strict")
+	s.SetRequiredApprovals(strict, 2)
+	mustInsert(t, s, strict, "abc", "alice", "msg", now)
+	if n, err := s.InheritSharedReview(strict, []string{"abc"}); err != nil || n != 1 {
+		t.Fatalf("inherited = %d, %v", n, err)
+	}
+	c = mustCommit(t, s, strict, "abc")
+	if c.Status != "unreviewed" || c.Note != "lgtm" || strings.Join(c.Approvers, ",") != "alice" {
+		t.Errorf("strict = %+v", c)
+	}
+}
+
+func testStoreLabels(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	now := time.Now()
+	mustInsert(t, s, repo, "abc", "alice", "msg", now)
+	mustInsert(t, s, repo, "def", "bob", "msg", now)
+
+	sec, err := s.CreateLabel("security", "#ff0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := s.CreateLabel(" Security ", ""); again != sec {
+		t.Errorf("same name = %d, want %d", again, sec)
+	}
+	if _, err := s.CreateLabel("  ", ""); err == nil {
+		t.Error("empty label name should fail")
+	}
+	if err := s.AddLabel(repo, "abc", sec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddLabel(repo, "abc", 9999); !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("unknown label = %v", err)
+	}
+
+	added, err := s.ApplyRuleLabel(repo, "def", "deps", "Deps", "")
+	if err != nil || !added {
+		t.Fatalf("rule label = %v, %v", added, err)
+	}
+	if added, _ := s.ApplyRuleLabel(repo, "def", "deps", "deps", ""); added {
+		t.Error("applying a rule label twice should report nothing new")
+	}
+	labels, _ := s.ListLabels()
+	if len(labels) != 2 || labels[0].Name != "Deps" || labels[1].Name != "security" || labels[1].Color != "#ff0000" {
+		t.Errorf("labels = %+v", labels)
+	}
+
+	commits, _ := s.QueryCommits(CommitQuery{Label: sec})
+	if len(commits) != 1 || commits[0].Hash != "abc" || len(commits[0].Labels) != 1 || commits[0].Labels[0].ID != sec {
+		t.Errorf("labelled = %+v", commits)
+	}
+	s.UpdateReviewStatus(repo, "abc", "reviewed", "", "tester")
+	stats, _ := s.GetLabelStats([]int64{repo})
+	if len(stats) != 2 || stats[1].Total != 1 || stats[1].Reviewed != 1 || stats[0].Unreviewed != 1 {
+		t.Errorf("label stats = %+v", stats)
+	}
+
+	s.RemoveLabel(repo, "abc", sec)
+	events, _ := s.ListEvents(repo, "abc")
+	if err := s.UndoEvent(events[len(events)-1].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if c := mustCommit(t, s, repo, "abc"); len(c.Labels) != 1 {
+		t.Errorf("undoing the removal should put the label back, got %+v", c.Labels)
+	}
+	s.DeleteLabel(sec)
+	if c := mustCommit(t, s, repo, "abc"); len(c.Labels) != 0 {
+		t.Errorf("deleted label still on commit: %+v", c.Labels)
+	}
+}
+
+func testStoreEvents(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	mustInsert(t, s, repo, "abc", "alice", "msg", time.Now())
+
+	if err := s.RecordEvent(repo, EventNotified, "abc", Notification{Title: "t", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertEvent(repo, EventRefDeleted, "", `{"ref":"x"}`); err != nil {
+		t.Fatal(err)
+	}
+	s.InsertEvent(0, EventRefDeleted, "abc", "")
+
+	events, err := s.ListEvents(repo, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Type != EventNotified || events[1].Payload != `{"title":"t","body":"b"}` {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[0].ID >= events[1].ID || events[1].CreatedAt.IsZero() || events[1].RepoID != repo {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func testStoreStats(t *testing.T, s Store) {
+	alpha := mustUpsert(t, s, "alpha", "/code/alpha")
+	beta := mustUpsert(t, s, "beta", "/code/beta")
+	now := time.Now()
+	for _, h := range []string{"a1", "a2", "a3"} {
+		mustInsert(t, s, alpha, h, "alice", h, now)
+	}
+	mustInsert(t, s, beta, "b1", "bob", "b1", now)
+	s.UpdateReviewStatus(alpha, "a1", "reviewed", "", "alice")
+	s.UpdateReviewStatus(alpha, "a2", "reviewed", "", "bob")
+	s.UpdateReviewStatus(alpha, "a3", "ignored", "", "bob")
+
+	if st, _ := s.GetStats(alpha); st != (Stats{Total: 3, Reviewed: 2, Ignored: 1}) {
+		t.Errorf("alpha = %+v", st)
+	}
+	if st, _ := s.GetAggregateStats([]int64{alpha, beta}); st != (Stats{Total: 4, Unreviewed: 1, Reviewed: 2, Ignored: 1}) {
+		t.Errorf("aggregate = %+v", st)
+	}
+	if st, _ := s.GetAggregateStats(nil); st != (Stats{}) {
+		t.Errorf("no repos = %+v", st)
+	}
+
+	reviewers, _ := s.GetReviewerStats([]int64{alpha, beta})
+	want := []ReviewerStats{{Reviewer: "bob", Reviewed: 1, Ignored: 1}, {Reviewer: "alice", Reviewed: 1}}
+	if !slices.Equal(reviewers, want) {
+		t.Errorf("reviewers = %+v, want %+v", reviewers, want)
+	}
+
+	s.SetRepoActive(beta, false)
+	if err := s.SnapshotStats(now); err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateReviewStatus(alpha, "a1", "unreviewed", "", "alice")
+	s.SnapshotStats(now)
+	snaps, _ := s.ListSnapshots(nil, now.AddDate(0, 0, -1))
+	if len(snaps) != 1 || snaps[0].Day != now.Local().Format("2006-01-02") || snaps[0].Stats != (Stats{Total: 3, Unreviewed: 1, Reviewed: 1, Ignored: 1}) {
+		t.Errorf("snapshots = %+v, want today's latest counts for active repos", snaps)
+	}
+	if snaps, _ := s.ListSnapshots([]int64{beta}, now.AddDate(0, 0, -1)); len(snaps) != 0 {
+		t.Errorf("inactive repo snapshots = %+v", snaps)
+	}
+}
+
+func testStoreSnapshots(t *testing.T, s Store) {
+	alpha := mustUpsert(t, s, "alpha", "/code/alpha")
+	beta := mustUpsert(t, s, "beta", "/code/beta")
+	idle := mustUpsert(t, s, "idle", "/code/idle")
+	now := time.Now()
+	mustInsert(t, s, alpha, "a1", "alice", "a1", now)
+	mustInsert(t, s, alpha, "a2", "alice", "a2", now)
+	mustInsert(t, s, beta, "b1", "bob", "b1", now)
+	day := func(t time.Time) string { return t.Local().Format("2006-01-02") }
+
+	lastWeek, yesterday := now.AddDate(0, 0, -7), now.AddDate(0, 0, -1)
+	for _, at := range []time.Time{yesterday, lastWeek} {
+		if err := s.SnapshotStats(at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.UpdateReviewStatus(alpha, "a1", "reviewed", "", "alice")
+	s.UpdateReviewStatus(beta, "b1", "ignored", "", "bob")
+	s.SnapshotStats(now)
+
+	snaps, err := s.ListSnapshots(nil, yesterday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Snapshot{
+		{Day: day(yesterday), Stats: Stats{Total: 3, Unreviewed: 3}},
+		{Day: day(now), Stats: Stats{Total: 3, Unreviewed: 1, Reviewed: 1, Ignored: 1}},
+	}
+	if !slices.Equal(snaps, want) {
+		t.Errorf("snapshots since yesterday = %+v, want %+v", snaps, want)
+	}
+
+	snaps, _ = s.ListSnapshots([]int64{alpha}, lastWeek)
+	want = []Snapshot{
+		{Day: day(lastWeek), Stats: Stats{Total: 2, Unreviewed: 2}},
+		{Day: day(yesterday), Stats: Stats{Total: 2, Unreviewed: 2}},
+		{Day: day(now), Stats: Stats{Total: 2, Unreviewed: 1, Reviewed: 1}},
+	}
+	if !slices.Equal(snaps, want) {
+		t.Errorf("alpha's snapshots = %+v, want %+v", snaps, want)
+	}
+	if snaps, _ := s.ListSnapshots([]int64{alpha, beta}, now); len(snaps) != 1 || snaps[0].Stats != (Stats{Total: 3, Unreviewed: 1, Reviewed: 1, Ignored: 1}) {
+		t.Errorf("alpha and beta today = %+v", snaps)
+	}
+	if snaps, _ := s.ListSnapshots([]int64{idle}, lastWeek); len(snaps) != 3 || snaps[2].Stats != (Stats{}) {
+		t.Errorf("a repo without commits = %+v, want an empty count each day", snaps)
+	}
+	if snaps, _ := s.ListSnapshots([]int64{9999}, lastWeek); len(snaps) != 0 {
+		t.Errorf("unknown repo = %+v", snaps)
+	}
+	if snaps, _ := s.ListSnapshots(nil, now.AddDate(0, 0, 1)); len(snaps) != 0 {
+		t.Errorf("snapshots from tomorrow = %+v", snaps)
+	}
+}
+
+func testStoreSearch(t *testing.T, s Store) {
+	alpha := mustUpsert(t, s, "alpha", "/code/alpha")
+	beta := mustUpsert(t, s, "beta", "/code/beta")
+	now := time.Now()
+	mustInsert(t, s, alpha, "a1", "alice", "Fix watcher leak", now, "internal/watcher/watcher.go")
+	s.InsertCommit(alpha, "a2", "bob", "Tidy docs", "mentions the watcher once", "main", now, nil)
+	mustInsert(t, s, alpha, "a3", "carol", "Bump deps", now, "go.mod")
+	mustInsert(t, s, beta, "b1", "dave", "Watcher rewrite", now)
+	s.UpdateReviewStatus(alpha, "a3", "reviewed", "check the lockfile", "tester")
+
+	results, err := s.SearchCommits([]int64{alpha}, "watch", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Hash != "a1" || results[1].Hash != "a2" {
+		t.Fatalf("results = %+v, want subject match ranked above body match", results)
+	}
+	if results[0].SubjectMatch != "Fix "+MatchStart+"watcher"+MatchEnd+" leak" {
+		t.Errorf("subject = %q", results[0].SubjectMatch)
+	}
+	if !strings.Contains(results[1].Snippet, MatchStart+"watcher"+MatchEnd) {
+		t.Errorf("snippet = %q", results[1].Snippet)
+	}
+	for query, want := range map[string]string{
+		"lockfile": "a3",
+		"go.mod":   "a3",
+		"fix leak": "a1",
+		"nothing":  "",
+	} {
+		results, _ := s.SearchCommits([]int64{alpha}, query, 10)
+		got := ""
+		if len(results) > 0 {
+			got = results[0].Hash
+		}
+		if got != want {
+			t.Errorf("%q: top = %q, want %q", query, got, want)
+		}
+	}
+	if results, _ := s.SearchCommits([]int64{alpha, beta}, "watcher", 1); len(results) != 1 {
+		t.Errorf("limit ignored: %d results", len(results))
+	}
+	if results, _ := s.SearchCommits(nil, "watcher", 10); len(results) != 0 {
+		t.Error("no repos should find nothing")
+	}
+}
+
+func testStoreIdentity(t *testing.T, s Store) {
+	orig := mustUpsert(t, s, "orig", "/code/orig")
+	fork := mustUpsert(t, s, "fork", "/code/fork")
+	bare := mustUpsert(t, s, "bare", "/code/bare")
+	moved := mustUpsert(t, s, "moved", "/code/moved")
+	s.SetRepoIdentity(orig, []string{"root"}, []string{"git@example.com:orig"})
+	s.SetRepoIdentity(fork, []string{"root"}, []string{"git@example.com:fork"})
+	s.SetRepoIdentity(bare, []string{"root"}, nil)
+
+	if has, _ := s.HasRepoIdentity(orig); !has {
+		t.Error("identity not recorded")
+	}
+	if has, _ := s.HasRepoIdentity(moved); has {
+		t.Error("identity recorded for a repo without one")
+	}
+	found, err := s.FindReposByIdentity(moved, []string{"root"}, []string{"git@example.com:orig"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].ID != orig || found[1].ID != bare {
+		t.Errorf("found = %+v, want the original and the repo without remotes", found)
+	}
+	if found, _ := s.FindReposByIdentity(moved, nil, nil); len(found) != 0 {
+		t.Errorf("no roots found %+v", found)
+	}
+}
+
+func testStoreRebind(t *testing.T, s Store) {
+	old := mustUpsert(t, s, "old", "/code/old")
+	now := time.Now()
+	mustInsert(t, s, old, "aaa", "alice", "seen before", now)
+	s.UpdateReviewStatus(old, "aaa", "reviewed", "", "alice")
+	s.SetRepoIdentity(old, []string{"root"}, nil)
+
+	fresh := mustUpsert(t, s, "new", "/code/new")
+	mustInsert(t, s, fresh, "aaa", "alice", "seen before", now)
+	mustInsert(t, s, fresh, "bbb", "bob", "seen after the move", now)
+	s.UpdateLastCommitHash(fresh, "bbb")
+	s.SetRepoIdentity(fresh, []string{"root"}, []string{"git@example.com:x"})
+
+	if err := s.RebindRepo(old, "/code/new", "new"); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.GetRepoByPath("/code/new")
+	if r == nil || r.ID != old || r.Name != "new" || r.LastCommitHash != "bbb" || !r.Active {
+		t.Fatalf("rebound repo = %+v", r)
+	}
+	if repos, _ := s.ListRepos(); len(repos) != 1 {
+		t.Errorf("repos = %+v, want the new row folded in", repos)
+	}
+	commits, _ := s.QueryCommits(CommitQuery{})
+	if strings.Join(hashes(commits), ",") != "bbb,aaa" {
+		t.Errorf("commits = %v", hashes(commits))
+	}
+	if c := mustCommit(t, s, old, "aaa"); c.Status != "reviewed" {
+		t.Errorf("kept review = %+v", c)
+	}
+	if got := storeEventTypes(t, s, old, "bbb"); len(got) != 1 {
+		t.Errorf("moved commit events = %v", got)
+	}
+	if found, _ := s.FindReposByIdentity(0, []string{"root"}, []string{"git@example.com:x"}); len(found) != 1 || found[0].ID != old {
+		t.Errorf("identity after rebind = %+v", found)
+	}
+	if err := s.RebindRepo(old, "/code/new", "other"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testStoreArchive(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	now := time.Now()
+	for _, h := range []string{"aaa", "bbb", "ccc"} {
+		mustInsert(t, s, repo, h, "alice", h, now)
+	}
+	s.UpdateReviewStatus(repo, "aaa", "reviewed", "", "tester")
+	s.UpdateReviewStatus(repo, "bbb", "ignored", "", "")
+
+	if n, _ := s.ArchiveCommits(now.Add(-time.Hour), false); n != 0 {
+		t.Errorf("archived %d commits with recent activity", n)
+	}
+	n, err := s.ArchiveCommits(now.Add(time.Hour), false)
+	if err != nil || n != 2 {
+		t.Fatalf("archived = %d, %v", n, err)
+	}
+	commits, _ := s.QueryCommits(CommitQuery{})
+	if strings.Join(hashes(commits), ",") != "ccc" {
+		t.Errorf("left = %v", hashes(commits))
+	}
+	known, _ := s.KnownHashes(repo, []string{"aaa", "bbb"})
+	if !known["aaa"] || !known["bbb"] {
+		t.Errorf("archived hashes should stay known: %v", known)
+	}
+	if added, _ := s.IngestCommits(repo, []NewCommit{{Hash: "aaa", Author: "alice", Subject: "aaa", CommittedAt: now}}, ""); len(added) != 0 {
+		t.Error("an archived commit should not come back")
+	}
+	if st, _ := s.GetStats(repo); st.Total != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	if got := storeEventTypes(t, s, repo, "aaa"); len(got) == 0 {
+		t.Error("archiving without purge should keep events")
+	}
+
+	s.UpdateReviewStatus(repo, "ccc", "reviewed", "", "tester")
+	s.ArchiveCommits(now.Add(time.Hour), true)
+	if got := storeEventTypes(t, s, repo, "ccc"); len(got) != 0 {
+		t.Errorf("purge left events %v", got)
+	}
+}
+
+func testStoreDeleteRepo(t *testing.T, s Store) {
+	repo := mustUpsert(t, s, "test", "/code/test")
+	mustInsert(t, s, repo, "abc", "alice", "msg", time.Now())
+
+	if err := s.DeleteRepo(repo, false); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := s.GetRepoByPath("/code/test"); r == nil || r.Active {
+		t.Errorf("deleted without purge = %+v, want kept inactive", r)
+	}
+	if again := mustUpsert(t, s, "test", "/code/test"); again != repo {
+		t.Error("re-adding should find the old row")
+	}
+
+	if err := s.DeleteRepo(repo, true); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := s.GetRepoByPath("/code/test"); r != nil {
+		t.Errorf("purged repo = %+v", r)
+	}
+	if commits, _ := s.QueryCommits(CommitQuery{}); len(commits) != 0 {
+		t.Errorf("purged commits = %v", hashes(commits))
+	}
+	if got := storeEventTypes(t, s, repo, "abc"); len(got) != 0 {
+		t.Errorf("purged events = %v", got)
+	}
+}
@@ -0,0 +1,65 @@
+-- Schema version 1: the initial schema, now recorded in schema_version.
+CREATE TABLE schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_version (version, name) VALUES (1, 'initial schema');
+
+CREATE TABLE repositories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL UNIQUE,
+	active INTEGER NOT NULL DEFAULT 1,
+	last_commit_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE commits (
+	hash TEXT PRIMARY KEY,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	author TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	committed_at DATETIME NOT NULL,
+	detected_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE review_state (
+	commit_hash TEXT PRIMARY KEY REFERENCES commits(hash),
+	status TEXT NOT NULL DEFAULT 'unreviewed',
+	reviewed_at DATETIME,
+	note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	commit_hash TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	payload TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at);
+CREATE INDEX idx_review_status ON review_state(status);
+CREATE INDEX idx_events_commit ON events(commit_hash, type);
+
+INSERT INTO repositories (id, name, path, last_commit_hash) VALUES
+	(1, 'fixture', '/code/fixture', 'cccccccccccccccccccccccccccccccccccccccc'),
+	(2, 'other', '/code/other', '');
+
+INSERT INTO commits (hash, repo_id, author, subject, body, branch, committed_at) VALUES
+	('aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 1, 'alice', 'first', '', 'main', '2024-01-01 10:00:00'),
+	('bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 1, 'bob', 'second', 'details', 'main', '2024-01-02 10:00:00'),
+	('cccccccccccccccccccccccccccccccccccccccc', 1, 'alice', 'third', '', 'feature', '2024-01-03 10:00:00'),
+	('dddddddddddddddddddddddddddddddddddddddd', 2, 'carol', 'elsewhere', '', 'main', '2024-01-04 10:00:00');
+
+INSERT INTO review_state (commit_hash, status, reviewed_at, note) VALUES
+	('aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 'reviewed', '2024-01-05 09:00:00', 'fixture note'),
+	('bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 'ignored', NULL, ''),
+	('cccccccccccccccccccccccccccccccccccccccc', 'unreviewed', NULL, ''),
+	('dddddddddddddddddddddddddddddddddddddddd', 'unreviewed', NULL, '');
+
+INSERT INTO events (type, commit_hash, payload) VALUES
+	('ref_deleted', NULL, '{"repo":"/code/fixture","ref":"refs/heads/old"}');
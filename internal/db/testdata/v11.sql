@@ -0,0 +1,191 @@
+-- Schema version 11: archived commits keep their approvers.
+CREATE TABLE schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_version (version, name) VALUES
+	(1, 'initial schema'),
+	(2, 'key commits by repo and hash'),
+	(3, 'full-text search'),
+	(4, 'labels'),
+	(5, 'archived commits'),
+	(6, 'repo identity'),
+	(7, 'reviewed by'),
+	(8, 'stats snapshots'),
+	(9, 'approvals'),
+	(10, 'unsigned approvals'),
+	(11, 'archived approvals');
+
+CREATE TABLE repositories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL UNIQUE,
+	active INTEGER NOT NULL DEFAULT 1,
+	last_commit_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	required_approvals INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE commits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	hash TEXT NOT NULL,
+	author TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	files TEXT NOT NULL DEFAULT '',
+	committed_at DATETIME NOT NULL,
+	detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (repo_id, hash)
+);
+
+CREATE TABLE review_state (
+	repo_id INTEGER NOT NULL,
+	commit_hash TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'unreviewed',
+	reviewed_at DATETIME,
+	note TEXT NOT NULL DEFAULT '',
+	reviewed_by TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (repo_id, commit_hash),
+	FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+);
+
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	commit_hash TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	payload TEXT NOT NULL DEFAULT '',
+	repo_id INTEGER
+);
+
+CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at);
+CREATE INDEX idx_commits_hash ON commits(hash);
+CREATE INDEX idx_review_status ON review_state(status);
+CREATE INDEX idx_events_commit ON events(repo_id, commit_hash, type);
+
+CREATE VIRTUAL TABLE commit_search USING fts5(subject, body, author, note, files);
+
+CREATE TRIGGER commit_search_insert AFTER INSERT ON commits BEGIN
+	INSERT INTO commit_search (rowid, subject, body, author, note, files)
+	VALUES (new.id, new.subject, new.body, new.author, '', new.files);
+END;
+CREATE TRIGGER commit_search_update AFTER UPDATE OF subject, body, author, files ON commits BEGIN
+	UPDATE commit_search SET subject = new.subject, body = new.body, author = new.author, files = new.files
+	WHERE rowid = new.id;
+END;
+CREATE TRIGGER commit_search_delete AFTER DELETE ON commits BEGIN
+	DELETE FROM commit_search WHERE rowid = old.id;
+END;
+CREATE TRIGGER commit_search_note AFTER UPDATE OF note ON review_state BEGIN
+	UPDATE commit_search SET note = new.note
+	WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+END;
+CREATE TRIGGER commit_search_note_insert AFTER INSERT ON review_state WHEN new.note != '' BEGIN
+	UPDATE commit_search SET note = new.note
+	WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+END;
+
+CREATE TABLE labels (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	color TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE commit_labels (
+	repo_id INTEGER NOT NULL,
+	commit_hash TEXT NOT NULL,
+	label_id INTEGER NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (repo_id, commit_hash, label_id),
+	FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash) ON DELETE CASCADE
+);
+CREATE INDEX idx_commit_labels_label ON commit_labels(label_id);
+
+CREATE TABLE archived_commits (
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	hash TEXT NOT NULL,
+	author TEXT NOT NULL DEFAULT '',
+	subject TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	files TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL DEFAULT '',
+	labels TEXT NOT NULL DEFAULT '',
+	committed_at DATETIME NOT NULL,
+	detected_at DATETIME,
+	status TEXT NOT NULL,
+	reviewed_at DATETIME,
+	purged INTEGER NOT NULL DEFAULT 0,
+	archived_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	reviewed_by TEXT NOT NULL DEFAULT '',
+	approvers TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (repo_id, hash)
+);
+
+CREATE TABLE repo_identity (
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (repo_id, kind, value)
+);
+CREATE INDEX idx_repo_identity_value ON repo_identity(kind, value);
+
+CREATE TABLE stats_snapshots (
+	day TEXT NOT NULL,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	total INTEGER NOT NULL,
+	unreviewed INTEGER NOT NULL,
+	reviewed INTEGER NOT NULL,
+	ignored INTEGER NOT NULL,
+	PRIMARY KEY (day, repo_id)
+);
+
+CREATE TABLE approvals (
+	repo_id INTEGER NOT NULL,
+	commit_hash TEXT NOT NULL,
+	reviewer TEXT NOT NULL,
+	approved_at DATETIME NOT NULL,
+	PRIMARY KEY (repo_id, commit_hash, reviewer),
+	FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+);
+
+INSERT INTO repositories (id, name, path, last_commit_hash, required_approvals) VALUES
+	(1, 'fixture', '/code/fixture', 'cccccccccccccccccccccccccccccccccccccccc', 1),
+	(2, 'other', '/code/other', '', 2);
+
+INSERT INTO commits (hash, repo_id, author, subject, body, branch, files, committed_at) VALUES
+	('aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 1, 'alice', 'first', '', 'main', 'README.md', '2024-01-01 10:00:00'),
+	('bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 1, 'bob', 'second', 'details', 'main', '', '2024-01-02 10:00:00'),
+	('cccccccccccccccccccccccccccccccccccccccc', 1, 'alice', 'third', '', 'feature', 'main.go', '2024-01-03 10:00:00'),
+	('dddddddddddddddddddddddddddddddddddddddd', 2, 'carol', 'elsewhere', '', 'main', '', '2024-01-04 10:00:00');
+
+INSERT INTO review_state (repo_id, commit_hash, status, reviewed_at, note, reviewed_by) VALUES
+	(1, 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 'reviewed', '2024-01-05 09:00:00', 'fixture note', 'Alice <alice@example.com>'),
+	(1, 'bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 'ignored', NULL, '', ''),
+	(1, 'cccccccccccccccccccccccccccccccccccccccc', 'unreviewed', NULL, '', ''),
+	(2, 'dddddddddddddddddddddddddddddddddddddddd', 'unreviewed', NULL, '', '');
+
+INSERT INTO events (repo_id, type, commit_hash, payload) VALUES
+	(1, 'ref_deleted', NULL, '{"repo":"/code/fixture","ref":"refs/heads/old"}');
+
+INSERT INTO labels (id, name, color) VALUES (1, 'security', '#ef5350');
+INSERT INTO commit_labels (repo_id, commit_hash, label_id) VALUES
+	(1, 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 1);
+
+INSERT INTO archived_commits (repo_id, hash, author, subject, branch, note, labels, committed_at, detected_at, status, reviewed_at, reviewed_by, approvers) VALUES
+	(1, 'eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee', 'alice', 'ancient', 'main', 'archived note', 'security', '2023-01-01 10:00:00', '2023-01-01 10:05:00', 'reviewed', '2023-01-02 09:00:00', 'Bob <bob@example.com>', 'Alice <alice@example.com>' || char(10) || 'Bob <bob@example.com>');
+
+INSERT INTO repo_identity (repo_id, kind, value) VALUES
+	(1, 'root', 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa'),
+	(1, 'remote', 'git@example.com:fixture');
+
+INSERT INTO stats_snapshots (day, repo_id, total, unreviewed, reviewed, ignored) VALUES
+	('2024-01-04', 1, 3, 2, 1, 0),
+	('2024-01-05', 1, 3, 1, 1, 1);
+
+INSERT INTO approvals (repo_id, commit_hash, reviewer, approved_at) VALUES
+	(1, 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 'Alice <alice@example.com>', '2024-01-05 09:00:00'),
+	(2, 'dddddddddddddddddddddddddddddddddddddddd', 'Carol <carol@example.com>', '2024-01-05 10:00:00');
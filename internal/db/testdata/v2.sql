@@ -0,0 +1,74 @@
+-- Schema version 2: commits and review state keyed by (repo_id, hash),
+-- events tagged with their repo.
+CREATE TABLE schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_version (version, name) VALUES
+	(1, 'initial schema'),
+	(2, 'key commits by repo and hash');
+
+CREATE TABLE repositories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL UNIQUE,
+	active INTEGER NOT NULL DEFAULT 1,
+	last_commit_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE commits (
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	hash TEXT NOT NULL,
+	author TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	committed_at DATETIME NOT NULL,
+	detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (repo_id, hash)
+);
+
+CREATE TABLE review_state (
+	repo_id INTEGER NOT NULL,
+	commit_hash TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'unreviewed',
+	reviewed_at DATETIME,
+	note TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (repo_id, commit_hash),
+	FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+);
+
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	commit_hash TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	payload TEXT NOT NULL DEFAULT '',
+	repo_id INTEGER
+);
+
+CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at);
+CREATE INDEX idx_commits_hash ON commits(hash);
+CREATE INDEX idx_review_status ON review_state(status);
+CREATE INDEX idx_events_commit ON events(repo_id, commit_hash, type);
+
+INSERT INTO repositories (id, name, path, last_commit_hash) VALUES
+	(1, 'fixture', '/code/fixture', 'cccccccccccccccccccccccccccccccccccccccc'),
+	(2, 'other', '/code/other', '');
+
+INSERT INTO commits (hash, repo_id, author, subject, body, branch, committed_at) VALUES
+	('aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 1, 'alice', 'first', '', 'main', '2024-01-01 10:00:00'),
+	('bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 1, 'bob', 'second', 'details', 'main', '2024-01-02 10:00:00'),
+	('cccccccccccccccccccccccccccccccccccccccc', 1, 'alice', 'third', '', 'feature', '2024-01-03 10:00:00'),
+	('dddddddddddddddddddddddddddddddddddddddd', 2, 'carol', 'elsewhere', '', 'main', '2024-01-04 10:00:00');
+
+INSERT INTO review_state (repo_id, commit_hash, status, reviewed_at, note) VALUES
+	(1, 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 'reviewed', '2024-01-05 09:00:00', 'fixture note'),
+	(1, 'bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 'ignored', NULL, ''),
+	(1, 'cccccccccccccccccccccccccccccccccccccccc', 'unreviewed', NULL, ''),
+	(2, 'dddddddddddddddddddddddddddddddddddddddd', 'unreviewed', NULL, '');
+
+INSERT INTO events (repo_id, type, commit_hash, payload) VALUES
+	(1, 'ref_deleted', NULL, '{"repo":"/code/fixture","ref":"refs/heads/old"}');
@@ -0,0 +1,99 @@
+-- Schema version 3: commits get an integer id feeding the commit_search
+-- full-text index, which triggers keep in step.
+CREATE TABLE schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_version (version, name) VALUES
+	(1, 'initial schema'),
+	(2, 'key commits by repo and hash'),
+	(3, 'full-text search');
+
+CREATE TABLE repositories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL UNIQUE,
+	active INTEGER NOT NULL DEFAULT 1,
+	last_commit_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE commits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id),
+	hash TEXT NOT NULL,
+	author TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	files TEXT NOT NULL DEFAULT '',
+	committed_at DATETIME NOT NULL,
+	detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (repo_id, hash)
+);
+
+CREATE TABLE review_state (
+	repo_id INTEGER NOT NULL,
+	commit_hash TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'unreviewed',
+	reviewed_at DATETIME,
+	note TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (repo_id, commit_hash),
+	FOREIGN KEY (repo_id, commit_hash) REFERENCES commits(repo_id, hash)
+);
+
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	commit_hash TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	payload TEXT NOT NULL DEFAULT '',
+	repo_id INTEGER
+);
+
+CREATE INDEX idx_commits_repo_time ON commits(repo_id, committed_at);
+CREATE INDEX idx_commits_hash ON commits(hash);
+CREATE INDEX idx_review_status ON review_state(status);
+CREATE INDEX idx_events_commit ON events(repo_id, commit_hash, type);
+
+CREATE VIRTUAL TABLE commit_search USING fts5(subject, body, author, note, files);
+
+CREATE TRIGGER commit_search_insert AFTER INSERT ON commits BEGIN
+	INSERT INTO commit_search (rowid, subject, body, author, note, files)
+	VALUES (new.id, new.subject, new.body, new.author, '', new.files);
+END;
+CREATE TRIGGER commit_search_update AFTER UPDATE OF subject, body, author, files ON commits BEGIN
+	UPDATE commit_search SET subject = new.subject, body = new.body, author = new.author, files = new.files
+	WHERE rowid = new.id;
+END;
+CREATE TRIGGER commit_search_delete AFTER DELETE ON commits BEGIN
+	DELETE FROM commit_search WHERE rowid = old.id;
+END;
+CREATE TRIGGER commit_search_note AFTER UPDATE OF note ON review_state BEGIN
+	UPDATE commit_search SET note = new.note
+	WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+END;
+CREATE TRIGGER commit_search_note_insert AFTER INSERT ON review_state WHEN new.note != '' BEGIN
+	UPDATE commit_search SET note = new.note
+	WHERE rowid = (SELECT id FROM commits WHERE repo_id = new.repo_id AND hash = new.commit_hash);
+END;
+
+INSERT INTO repositories (id, name, path, last_commit_hash) VALUES
+	(1, 'fixture', '/code/fixture', 'cccccccccccccccccccccccccccccccccccccccc'),
+	(2, 'other', '/code/other', '');
+
+INSERT INTO commits (hash, repo_id, author, subject, body, branch, files, committed_at) VALUES
+	('aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 1, 'alice', 'first', '', 'main', 'README.md', '2024-01-01 10:00:00'),
+	('bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 1, 'bob', 'second', 'details', 'main', '', '2024-01-02 10:00:00'),
+	('cccccccccccccccccccccccccccccccccccccccc', 1, 'alice', 'third', '', 'feature', 'main.go', '2024-01-03 10:00:00'),
+	('dddddddddddddddddddddddddddddddddddddddd', 2, 'carol', 'elsewhere', '', 'main', '', '2024-01-04 10:00:00');
+
+INSERT INTO review_state (repo_id, commit_hash, status, reviewed_at, note) VALUES
+	(1, 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', 'reviewed', '2024-01-05 09:00:00', 'fixture note'),
+	(1, 'bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb', 'ignored', NULL, ''),
+	(1, 'cccccccccccccccccccccccccccccccccccccccc', 'unreviewed', NULL, ''),
+	(2, 'dddddddddddddddddddddddddddddddddddddddd', 'unreviewed', NULL, '');
+
+INSERT INTO events (repo_id, type, commit_hash, payload) VALUES
+	(1, 'ref_deleted', NULL, '{"repo":"/code/fixture","ref":"refs/heads/old"}');
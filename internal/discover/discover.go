@@ -0,0 +1,131 @@
+package discover
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const DefaultDepth = 3
+
+type Root struct {
+	Path     string
+	MaxDepth int
+	Ignore   []string
+}
+
+func (r Root) depth() int {
+	if r.MaxDepth <= 0 {
+		return DefaultDepth
+	}
+	return r.MaxDepth
+}
+
+// ignored matches patterns against both the directory name and its path
+// relative to the root, so "node_modules" and "work/archive/*" both work.
+func (r Root) ignored(path string) bool {
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pat := range r.Ignore {
+		if ok, _ := filepath.Match(pat, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pat, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Root) levelOf(path string) int {
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// IsRepo reports whether path is the top of a git worktree.
+func IsRepo(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+// Scan returns the git repositories under root, never descending into a
+// repository once found.
+func Scan(root Root) ([]string, error) {
+	var repos []string
+	err := walkDirs(root, func(path string, isRepo bool) {
+		if isRepo {
+			repos = append(repos, path)
+		}
+	})
+	return repos, err
+}
+
+// ScanAll merges the repositories under every root. Missing roots are
+// skipped so one unmounted drive doesn't hide the rest.
+func ScanAll(roots []Root) ([]string, error) {
+	seen := make(map[string]struct{})
+	var all []string
+	var errs []error
+	for _, root := range roots {
+		repos, err := Scan(root)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		for _, p := range repos {
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			all = append(all, p)
+		}
+	}
+	sort.Strings(all)
+	return all, errors.Join(errs...)
+}
+
+// Under reports whether path lies inside any of the roots.
+func Under(roots []Root, path string) bool {
+	for _, r := range roots {
+		if path == r.Path || strings.HasPrefix(path, r.Path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func walkDirs(root Root, visit func(path string, isRepo bool)) error {
+	maxDepth := root.depth()
+	return filepath.WalkDir(root.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root.Path {
+				return err
+			}
+			return fs.SkipDir
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || (path != root.Path && root.ignored(path)) {
+			return fs.SkipDir
+		}
+		if IsRepo(path) {
+			visit(path, true)
+			return fs.SkipDir
+		}
+		visit(path, false)
+		if root.levelOf(path) >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+package discover
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func initRepo(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "init")
+	cmd.Dir = path
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s %v", out, err)
+	}
+}
+
+func TestScanFindsReposWithinDepth(t *testing.T) {
+	root := t.TempDir()
+	initRepo(t, filepath.Join(root, "a"))
+	initRepo(t, filepath.Join(root, "org", "b"))
+	initRepo(t, filepath.Join(root, "deep", "x", "y", "c"))
+	initRepo(t, filepath.Join(root, "a", "nested"))
+
+	got, err := Scan(Root{Path: root, MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "a"), filepath.Join(root, "org", "b")}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestScanIgnore(t *testing.T) {
+	root := t.TempDir()
+	initRepo(t, filepath.Join(root, "keep"))
+	initRepo(t, filepath.Join(root, "node_modules", "pkg"))
+	initRepo(t, filepath.Join(root, "archive", "old"))
+
+	got, err := Scan(Root{Path: root, Ignore: []string{"node_modules", "archive/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != filepath.Join(root, "keep") {
+		t.Errorf("got %v, want only keep", got)
+	}
+}
+
+func TestScanAllSkipsMissingRoot(t *testing.T) {
+	root := t.TempDir()
+	initRepo(t, filepath.Join(root, "a"))
+
+	got, err := ScanAll([]Root{{Path: filepath.Join(root, "missing")}, {Path: root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("got %v, want 1 repo", got)
+	}
+}
+
+func TestUnder(t *testing.T) {
+	roots := []Root{{Path: "/code"}}
+	if !Under(roots, "/code/a") {
+		t.Error("/code/a should be under /code")
+	}
+	if Under(roots, "/codex/a") {
+		t.Error("/codex/a should not be under /code")
+	}
+}
+
+func waitRepos(t *testing.T, ch <-chan Update, want int) []string {
+	t.Helper()
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case u := <-ch:
+			if len(u.Repos) == want {
+				return u.Repos
+			}
+		case <-deadline:
+			t.Fatalf("timeout waiting for %d repos", want)
+		}
+	}
+}
+
+func TestWatchPicksUpNewAndRemovedRepos(t *testing.T) {
+	root := t.TempDir()
+	initRepo(t, filepath.Join(root, "a"))
+
+	ch, stop, err := Watch([]Root{{Path: root, MaxDepth: 2}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	initRepo(t, filepath.Join(root, "org", "b"))
+	repos := waitRepos(t, ch, 2)
+	if !slices.Contains(repos, filepath.Join(root, "org", "b")) {
+		t.Errorf("repos = %v, want org/b", repos)
+	}
+
+	os.RemoveAll(filepath.Join(root, "a"))
+	repos = waitRepos(t, ch, 1)
+	if repos[0] != filepath.Join(root, "org", "b") {
+		t.Errorf("repos = %v, want only org/b", repos)
+	}
+}
+
+func TestWatchClosesOnCleanup(t *testing.T) {
+	ch, stop, err := Watch([]Root{{Path: t.TempDir(), MaxDepth: 1}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("update after cleanup")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cleanup")
+	}
+}
+
+func TestWatchKeepsReposUnderUnreadableRoot(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "mnt", "b")
+	initRepo(t, filepath.Join(a, "x"))
+	initRepo(t, filepath.Join(b, "y"))
+
+	ch, stop, err := Watch([]Root{{Path: a, MaxDepth: 2}, {Path: b, MaxDepth: 2}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// With a file where its parent was, b can't be read at all.
+	os.RemoveAll(filepath.Join(dir, "mnt"))
+	if err := os.WriteFile(filepath.Join(dir, "mnt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	initRepo(t, filepath.Join(a, "z"))
+
+	var sawErr bool
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case u := <-ch:
+			sawErr = sawErr || u.Err != nil
+			if !slices.Contains(u.Repos, filepath.Join(b, "y")) {
+				t.Fatalf("repos = %v, lost the one under the unreadable root", u.Repos)
+			}
+			if slices.Contains(u.Repos, filepath.Join(a, "z")) {
+				if !sawErr {
+					t.Error("the failed scan should be reported")
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for the new repo")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package discover
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Update is the full set of repositories under the roots. Err is set when
+// the underlying watcher, or the scan, reported an error since the last
+// update; events may have been lost, so the set comes from a fresh scan.
+type Update struct {
+	Repos []string
+	Err   error
+}
+
+// Watch keeps the roots under observation and sends the full set of
+// repositories whenever it changes. Only the latest set is kept if the
+// consumer falls behind, though an error it hasn't seen yet is carried
+// over. The channel closes when the watcher stops, whether by cleanup or
+// because fsnotify shut down.
+func Watch(roots []Root, debounce time.Duration) (<-chan Update, func(), error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	arm := func() {
+		for _, root := range roots {
+			_ = walkDirs(root, func(path string, isRepo bool) {
+				if !isRepo {
+					_ = w.Add(path)
+				}
+			})
+		}
+	}
+	arm()
+
+	last, _ := ScanAll(roots)
+	ch := make(chan Update, 1)
+	done := make(chan struct{})
+
+	send := func(u Update) {
+		select {
+		case ch <- u:
+			return
+		default:
+		}
+		select {
+		case old := <-ch:
+			if u.Err == nil {
+				u.Err = old.Err
+			}
+		default:
+		}
+		ch <- u
+	}
+
+	go func() {
+		defer close(ch)
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		var pending error
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+				arm()
+				repos, err := rescan(roots, last)
+				pending = errors.Join(pending, err)
+				if slices.Equal(repos, last) && pending == nil {
+					continue
+				}
+				last = repos
+				send(Update{Repos: repos, Err: pending})
+				pending = nil
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+				timer.Reset(debounce)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				pending = err
+				timer.Reset(debounce)
+			}
+		}
+	}()
+
+	cleanup := func() {
+		close(done)
+		w.Close()
+	}
+
+	return ch, cleanup, nil
+}
+
+// rescan scans the roots again. A root that can't be scanned, because it is
+// unreadable or unmounted for now, keeps the repos last found under it
+// rather than reporting them gone.
+func rescan(roots []Root, last []string) ([]string, error) {
+	var found []string
+	var errs []error
+	for _, root := range roots {
+		repos, err := Scan(root)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			for _, p := range last {
+				if Under([]Root{root}, p) {
+					found = append(found, p)
+				}
+			}
+		}
+		found = append(found, repos...)
+	}
+	slices.Sort(found)
+	return slices.Compact(found), errors.Join(errs...)
+}
@@ -3,9 +3,11 @@ package git
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -62,24 +64,7 @@ func (r *Repo) ReadNewCommits(sinceHash string, limit int) ([]CommitInfo, error)
 			return errStop
 		}
 
-		msg := strings.TrimSpace(c.Message)
-		subject, body := splitMessage(msg)
-
-		parents := make([]string, 0, c.NumParents())
-		c.Parents().ForEach(func(p *object.Commit) error {
-			parents = append(parents, p.Hash.String())
-			return nil
-		})
-
-		commits = append(commits, CommitInfo{
-			Hash:      c.Hash.String(),
-			Author:    c.Author.Name,
-			Subject:   subject,
-			Body:      body,
-			Branch:    branch,
-			Timestamp: c.Author.When,
-			Parents:   parents,
-		})
+		commits = append(commits, toCommitInfo(c, branch))
 		return nil
 	})
 
@@ -91,10 +76,169 @@ func (r *Repo) ReadNewCommits(sinceHash string, limit int) ([]CommitInfo, error)
 	return commits, nil
 }
 
+// ReadRange returns the commits reachable from newHash, stopping at oldHash
+// or after limit commits. Branch is taken from ref rather than HEAD so that
+// pushes to branches other than the checked out one are attributed correctly.
+func (r *Repo) ReadRange(ref, oldHash, newHash string, limit int) ([]CommitInfo, error) {
+	iter, err := r.repo.Log(&gogit.LogOptions{
+		From:  plumbing.NewHash(newHash),
+		Order: gogit.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+	defer iter.Close()
+
+	branch := ShortRefName(ref)
+	var commits []CommitInfo
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash.String() == oldHash || len(commits) >= limit {
+			return errStop
+		}
+		commits = append(commits, toCommitInfo(c, branch))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+
+	reverse(commits)
+	return commits, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from descendant.
+func (r *Repo) IsAncestor(ancestor, descendant string) (bool, error) {
+	a, err := r.repo.CommitObject(plumbing.NewHash(ancestor))
+	if err != nil {
+		return false, err
+	}
+	d, err := r.repo.CommitObject(plumbing.NewHash(descendant))
+	if err != nil {
+		return false, err
+	}
+	return a.IsAncestor(d)
+}
+
+// Identity finds the root commits reachable from HEAD and the remote URLs.
+// A repo without commits yet has no roots. Walking to the roots reads the
+// whole history, so callers keep the result.
+func (r *Repo) Identity() (Identity, error) {
+	var id Identity
+	remotes, err := r.repo.Remotes()
+	if err != nil {
+		return id, fmt.Errorf("remotes: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, rm := range remotes {
+		for _, u := range rm.Config().URLs {
+			u = NormalizeRemote(u)
+			if u != "" && !seen[u] {
+				seen[u] = true
+				id.Remotes = append(id.Remotes, u)
+			}
+		}
+	}
+	sort.Strings(id.Remotes)
+
+	ref, err := r.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return id, nil
+	}
+	if err != nil {
+		return id, fmt.Errorf("head: %w", err)
+	}
+	iter, err := r.repo.Log(&gogit.LogOptions{From: ref.Hash()})
+	if err != nil {
+		return id, fmt.Errorf("log: %w", err)
+	}
+	defer iter.Close()
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.NumParents() == 0 {
+			id.Roots = append(id.Roots, c.Hash.String())
+		}
+		return nil
+	})
+	sort.Strings(id.Roots)
+	return id, err
+}
+
+// NormalizeRemote trims the differences that don't change which repository
+// a URL points at: a trailing slash or .git suffix.
+func NormalizeRemote(url string) string {
+	url = strings.TrimSuffix(strings.TrimSpace(url), "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+func ShortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
 func (r *Repo) SeedCommits(n int) ([]CommitInfo, error) {
 	return r.ReadNewCommits("", n)
 }
 
+func toCommitInfo(c *object.Commit, branch string) CommitInfo {
+	msg := strings.TrimSpace(c.Message)
+	subject, body := splitMessage(msg)
+
+	parents := make([]string, 0, c.NumParents())
+	for _, p := range c.ParentHashes {
+		parents = append(parents, p.String())
+	}
+
+	return CommitInfo{
+		Hash:      c.Hash.String(),
+		Author:    c.Author.Name,
+		Subject:   subject,
+		Body:      body,
+		Branch:    branch,
+		Timestamp: c.Author.When,
+		Parents:   parents,
+		Files:     changedFiles(c),
+	}
+}
+
+// maxFiles caps how many paths are kept per commit; they only feed search.
+const maxFiles = 200
+
+// changedFiles lists the paths a commit touched relative to its first
+// parent. Errors leave the list empty rather than failing the read.
+func changedFiles(c *object.Commit) []string {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil
+	}
+	var parent *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil
+		}
+		if parent, err = p.Tree(); err != nil {
+			return nil
+		}
+	}
+	changes, err := object.DiffTree(parent, tree)
+	if err != nil {
+		return nil
+	}
+
+	files := make([]string, 0, min(len(changes), maxFiles))
+	for _, ch := range changes[:min(len(changes), maxFiles)] {
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
 func splitMessage(msg string) (subject, body string) {
 	parts := strings.SplitN(msg, "\n", 2)
 	subject = strings.TrimSpace(parts[0])
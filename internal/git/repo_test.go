@@ -122,4 +122,121 @@ func TestCommitInfoFields(t *testing.T) {
 	if c.Hash == "" {
 		t.Error("hash is empty")
 	}
+	if len(c.Files) != 1 || c.Files[0] != "file.txt" {
+		t.Errorf("files = %v, want [file.txt]", c.Files)
+	}
+}
+
+func TestChangedFilesAgainstParent(t *testing.T) {
+	dir := setupTestRepo(t, 2)
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "docs", "guide.md"), []byte("hi"), 0644)
+	cmd := exec.Command("git", "add", ".")
+	cmd.Dir = dir
+	cmd.Run()
+	cmd = exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "-m", "docs")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	r, _ := OpenRepo(dir)
+	commits, _ := r.SeedCommits(3)
+	if got := commits[2].Files; len(got) != 1 || got[0] != "docs/guide.md" {
+		t.Errorf("files = %v, want only the added path", got)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	dir := setupTestRepo(t, 5)
+	r, _ := OpenRepo(dir)
+	all, _ := r.SeedCommits(50)
+
+	commits, err := r.ReadRange("refs/heads/feature/x", all[1].Hash, all[4].Hash, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("len = %d, want 3", len(commits))
+	}
+	if commits[0].Hash != all[2].Hash || commits[2].Hash != all[4].Hash {
+		t.Error("expected oldest-first order ending at new tip")
+	}
+	if commits[0].Branch != "feature/x" {
+		t.Errorf("branch = %q, want feature/x", commits[0].Branch)
+	}
+
+	limited, err := r.ReadRange("refs/heads/main", "", all[4].Hash, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 2 {
+		t.Errorf("limited len = %d, want 2", len(limited))
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	dir := setupTestRepo(t, 3)
+	r, _ := OpenRepo(dir)
+	all, _ := r.SeedCommits(50)
+
+	ok, err := r.IsAncestor(all[0].Hash, all[2].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("first commit should be ancestor of last")
+	}
+
+	ok, err = r.IsAncestor(all[2].Hash, all[0].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("last commit should not be ancestor of first")
+	}
+}
+
+func TestShortRefName(t *testing.T) {
+	tests := map[string]string{
+		"refs/heads/main":          "main",
+		"refs/heads/feature/x":     "feature/x",
+		"refs/tags/v1":             "v1",
+		"refs/remotes/origin/main": "origin/main",
+		"HEAD":                     "HEAD",
+	}
+	for in, want := range tests {
+		if got := ShortRefName(in); got != want {
+			t.Errorf("ShortRefName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	dir := setupTestRepo(t, 3)
+	cmd := exec.Command("git", "remote", "add", "origin", "https://example.com/apollo.git/")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	r, err := OpenRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := r.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := r.SeedCommits(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commits[0].Hash
+	if len(id.Roots) != 1 || id.Roots[0] != root {
+		t.Errorf("roots = %v, want [%s]", id.Roots, root)
+	}
+	if len(id.Remotes) != 1 || id.Remotes[0] != "https://example.com/apollo" {
+		t.Errorf("remotes = %v", id.Remotes)
+	}
 }
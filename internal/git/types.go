@@ -10,4 +10,12 @@ type CommitInfo struct {
 	Branch    string
 	Timestamp time.Time
 	Parents   []string
+	Files     []string
+}
+
+// Identity is what stays the same when a checkout moves: the root commits its
+// history grows from and the URLs of its remotes.
+type Identity struct {
+	Roots   []string
+	Remotes []string
 }
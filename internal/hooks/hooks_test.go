@@ -0,0 +1,247 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/walter/apollo/internal/watcher"
+)
+
+func setupRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	git(t, dir, "init")
+	git(t, dir, "checkout", "-b", "main")
+	return dir
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@test.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s %v", args, out, err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// fakeApollo records each hook invocation instead of talking to a socket.
+func fakeApollo(t *testing.T) (bin, log string) {
+	t.Helper()
+	dir := t.TempDir()
+	log = filepath.Join(dir, "calls.log")
+	bin = filepath.Join(dir, "apollo")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\ncat >> " + log + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, log
+}
+
+func TestInstallChainsExistingHook(t *testing.T) {
+	dir := setupRepo(t)
+	hooksDir, err := HooksDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(hooksDir, 0755)
+	chainedLog := filepath.Join(t.TempDir(), "chained.log")
+	existing := "#!/bin/sh\necho ran >> " + chainedLog + "\n"
+	os.WriteFile(filepath.Join(hooksDir, "post-commit"), []byte(existing), 0755)
+
+	bin, log := fakeApollo(t)
+	if err := Install(dir, bin); err != nil {
+		t.Fatal(err)
+	}
+	if !Installed(dir) {
+		t.Fatal("Installed should report true after Install")
+	}
+
+	git(t, dir, "commit", "--allow-empty", "-m", "one")
+
+	if data, _ := os.ReadFile(chainedLog); !strings.Contains(string(data), "ran") {
+		t.Error("existing post-commit hook did not run")
+	}
+	data, _ := os.ReadFile(log)
+	if !strings.Contains(string(data), "hooks notify post-commit") {
+		t.Errorf("apollo not notified, log:\n%s", data)
+	}
+	if !strings.Contains(string(data), "hooks notify reference-transaction committed") {
+		t.Errorf("reference-transaction not notified, log:\n%s", data)
+	}
+}
+
+func TestInstallPreservesExitStatus(t *testing.T) {
+	dir := setupRepo(t)
+	git(t, dir, "commit", "--allow-empty", "-m", "one")
+	hooksDir, _ := HooksDir(dir)
+	os.MkdirAll(hooksDir, 0755)
+	os.WriteFile(filepath.Join(hooksDir, "reference-transaction"), []byte("#!/bin/sh\n[ \"$1\" = prepared ] && exit 1\nexit 0\n"), 0755)
+
+	bin, _ := fakeApollo(t)
+	if err := Install(dir, bin); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("git", "branch", "blocked")
+	cmd.Dir = dir
+	if err := cmd.Run(); err == nil {
+		t.Error("chained hook rejection should still abort the transaction")
+	}
+}
+
+func TestInstallIsIdempotentAndUninstallRestores(t *testing.T) {
+	dir := setupRepo(t)
+	hooksDir, _ := HooksDir(dir)
+	os.MkdirAll(hooksDir, 0755)
+	original := "#!/bin/sh\nexit 0\n"
+	os.WriteFile(filepath.Join(hooksDir, "post-merge"), []byte(original), 0755)
+
+	bin, _ := fakeApollo(t)
+	Install(dir, bin)
+	Install(dir, bin)
+
+	chained, err := os.ReadFile(filepath.Join(hooksDir, "post-merge"+chainedSuffix))
+	if err != nil || string(chained) != original {
+		t.Fatalf("chained hook = %q, %v", chained, err)
+	}
+
+	if err := Uninstall(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := os.ReadFile(filepath.Join(hooksDir, "post-merge"))
+	if string(restored) != original {
+		t.Errorf("restored = %q, want original", restored)
+	}
+	if _, err := os.Stat(filepath.Join(hooksDir, "post-commit")); !os.IsNotExist(err) {
+		t.Error("apollo-only hook should be removed")
+	}
+	if Installed(dir) {
+		t.Error("Installed should be false after Uninstall")
+	}
+}
+
+func TestReinstallOverForeignHookKeepsBackup(t *testing.T) {
+	dir := setupRepo(t)
+	hooksDir, _ := HooksDir(dir)
+	os.MkdirAll(hooksDir, 0755)
+	path := filepath.Join(hooksDir, "post-commit")
+	original := "#!/bin/sh\necho original\n"
+	os.WriteFile(path, []byte(original), 0755)
+
+	bin, _ := fakeApollo(t)
+	if err := Install(dir, bin); err != nil {
+		t.Fatal(err)
+	}
+	// Another tool replaces Apollo's hook with its own.
+	foreign := "#!/bin/sh\necho foreign\n"
+	os.WriteFile(path, []byte(foreign), 0755)
+	if err := Install(dir, bin); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(path + chainedSuffix); string(data) != foreign {
+		t.Errorf("chained hook = %q, want the foreign one", data)
+	}
+	if data, _ := os.ReadFile(path + chainedSuffix + ".1"); string(data) != original {
+		t.Errorf("backup = %q, want the original hook", data)
+	}
+	os.WriteFile(path, []byte(foreign), 0755)
+	Install(dir, bin)
+	if _, err := os.Stat(path + chainedSuffix + ".2"); err != nil {
+		t.Errorf("a third install should keep a second backup: %v", err)
+	}
+}
+
+func TestParseReferenceTransaction(t *testing.T) {
+	stdin := strings.NewReader(zeroHash + " abc refs/heads/new\nabc " + zeroHash + " refs/heads/old\n")
+	n, ok, err := Parse("/repo", "reference-transaction", []string{"committed"}, stdin)
+	if err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if len(n.Updates) != 2 {
+		t.Fatalf("updates = %+v", n.Updates)
+	}
+	if n.Updates[0].Old != "" || n.Updates[0].New != "abc" || n.Updates[1].New != "" {
+		t.Errorf("zero hashes not normalized: %+v", n.Updates)
+	}
+
+	if _, ok, _ := Parse("/repo", "reference-transaction", []string{"prepared"}, strings.NewReader("")); ok {
+		t.Error("prepared phase should not notify")
+	}
+}
+
+func TestParsePostRewrite(t *testing.T) {
+	n, ok, err := Parse("/repo", "post-rewrite", []string{"amend"}, strings.NewReader("aaa bbb\nccc ddd extra\n"))
+	if err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if len(n.Rewrites) != 2 || n.Rewrites[1].Old != "ccc" || n.Rewrites[1].New != "ddd" {
+		t.Errorf("rewrites = %+v", n.Rewrites)
+	}
+}
+
+func TestSendWithoutListener(t *testing.T) {
+	err := Send(filepath.Join(t.TempDir(), "none.sock"), Notification{Repo: "/repo"})
+	if !errors.Is(err, ErrNoListener) {
+		t.Errorf("err = %v, want ErrNoListener", err)
+	}
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "a.sock")
+	srv, err := Listen(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if _, err := Listen(sock); err == nil {
+		t.Error("second listener should be refused")
+	}
+
+	n := Notification{
+		Repo:     "/repo",
+		Hook:     "reference-transaction",
+		Updates:  []RefUpdate{{Ref: "refs/heads/x", New: "abc"}},
+		Rewrites: []Rewrite{{Old: "a", New: "b"}},
+	}
+	if err := Send(sock, n); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-srv.Events():
+		if ev.RepoPath != "/repo" || len(ev.Changes) != 1 || ev.Changes[0].Kind != watcher.RefCreated {
+			t.Errorf("event = %+v", ev)
+		}
+		if len(ev.Rewrites) != 1 || ev.Rewrites[0].New != "b" {
+			t.Errorf("rewrites = %+v", ev.Rewrites)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "stale.sock")
+	os.WriteFile(sock, nil, 0600)
+
+	srv, err := Listen(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+}
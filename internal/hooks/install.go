@@ -0,0 +1,160 @@
+package hooks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	marker        = "# apollo-hook"
+	chainedSuffix = ".pre-apollo"
+)
+
+// Names are the hooks Apollo installs. reference-transaction and
+// post-rewrite receive their payload on stdin; the others only need a nudge.
+var Names = []string{"post-commit", "post-merge", "post-rewrite", "reference-transaction"}
+
+func readsStdin(name string) bool {
+	return name == "post-rewrite" || name == "reference-transaction"
+}
+
+func HooksDir(repoPath string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("locate hooks dir: %w", err)
+	}
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoPath, dir)
+	}
+	return dir, nil
+}
+
+// Install writes Apollo's hooks into repoPath. Any existing hook is moved
+// aside to <name>.pre-apollo and still runs first, with its exit status
+// preserved, so installing never changes what the repo's own hooks do. A
+// hook that replaced Apollo's since it was installed is chained the same
+// way; the one it displaced is kept as <name>.pre-apollo.1, .2 and so on.
+func Install(repoPath, apolloBin string) error {
+	dir, err := HooksDir(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		if existing, err := os.ReadFile(path); err == nil && !isApolloHook(existing) {
+			if err := keepChained(path + chainedSuffix); err != nil {
+				return fmt.Errorf("preserve %s: %w", name, err)
+			}
+			if err := os.Rename(path, path+chainedSuffix); err != nil {
+				return fmt.Errorf("preserve %s: %w", name, err)
+			}
+		}
+		if err := os.WriteFile(path, []byte(script(name, apolloBin)), 0755); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// keepChained moves a hook already chained at path out of the way, to the
+// first of path.1, path.2, ... that is free, so it isn't overwritten.
+func keepChained(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	for n := 1; ; n++ {
+		backup := fmt.Sprintf("%s.%d", path, n)
+		_, err := os.Lstat(backup)
+		if errors.Is(err, fs.ErrNotExist) {
+			return os.Rename(path, backup)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Uninstall removes Apollo's hooks and restores whatever they replaced.
+func Uninstall(repoPath string) error {
+	dir, err := HooksDir(repoPath)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil || !isApolloHook(data) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if _, err := os.Stat(path + chainedSuffix); err == nil {
+			if err := os.Rename(path+chainedSuffix, path); err != nil {
+				return fmt.Errorf("restore %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Installed reports whether every Apollo hook is present in repoPath.
+func Installed(repoPath string) bool {
+	dir, err := HooksDir(repoPath)
+	if err != nil {
+		return false
+	}
+	for _, name := range Names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !isApolloHook(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func isApolloHook(data []byte) bool {
+	return bytes.Contains(data, []byte(marker))
+}
+
+func script(name, apolloBin string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(marker + "\n")
+	fmt.Fprintf(&b, "chained=\"$(dirname \"$0\")/%s%s\"\n", name, chainedSuffix)
+	b.WriteString("status=0\n")
+
+	if readsStdin(name) {
+		b.WriteString("input=$(cat; echo x)\ninput=${input%x}\n")
+		b.WriteString("if [ -x \"$chained\" ]; then\n")
+		b.WriteString("\tprintf '%s' \"$input\" | \"$chained\" \"$@\" || status=$?\n")
+		b.WriteString("fi\n")
+		fmt.Fprintf(&b, "printf '%%s' \"$input\" | %s hooks notify %s \"$@\" >/dev/null 2>&1\n", shellQuote(apolloBin), name)
+	} else {
+		b.WriteString("if [ -x \"$chained\" ]; then\n")
+		b.WriteString("\t\"$chained\" \"$@\" || status=$?\n")
+		b.WriteString("fi\n")
+		fmt.Fprintf(&b, "%s hooks notify %s \"$@\" </dev/null >/dev/null 2>&1\n", shellQuote(apolloBin), name)
+	}
+
+	b.WriteString("exit $status\n")
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,118 @@
+package hooks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const zeroHash = "0000000000000000000000000000000000000000"
+
+type RefUpdate struct {
+	Ref string `json:"ref"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type Rewrite struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type Notification struct {
+	Repo     string      `json:"repo"`
+	Hook     string      `json:"hook"`
+	Args     []string    `json:"args,omitempty"`
+	Updates  []RefUpdate `json:"updates,omitempty"`
+	Rewrites []Rewrite   `json:"rewrites,omitempty"`
+}
+
+// ErrNoListener means no Apollo process owns the socket. Hooks treat it as
+// success: the next Apollo start catches up from its cursor.
+var ErrNoListener = errors.New("no apollo listening")
+
+// Parse builds a notification from a hook invocation. It returns ok=false
+// for invocations that carry nothing worth reporting, such as the prepared
+// and aborted phases of reference-transaction.
+func Parse(repoPath, hook string, args []string, stdin io.Reader) (Notification, bool, error) {
+	n := Notification{Repo: repoPath, Hook: hook, Args: args}
+
+	switch hook {
+	case "reference-transaction":
+		if len(args) == 0 || args[0] != "committed" {
+			return n, false, nil
+		}
+		err := scanLines(stdin, func(fields []string) {
+			if len(fields) < 3 {
+				return
+			}
+			n.Updates = append(n.Updates, RefUpdate{Old: unzero(fields[0]), New: unzero(fields[1]), Ref: fields[2]})
+		})
+		if err != nil {
+			return n, false, err
+		}
+		return n, len(n.Updates) > 0, nil
+	case "post-rewrite":
+		err := scanLines(stdin, func(fields []string) {
+			if len(fields) < 2 {
+				return
+			}
+			n.Rewrites = append(n.Rewrites, Rewrite{Old: fields[0], New: fields[1]})
+		})
+		if err != nil {
+			return n, false, err
+		}
+		return n, true, nil
+	}
+	return n, true, nil
+}
+
+func scanLines(r io.Reader, fn func([]string)) error {
+	if r == nil {
+		return nil
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if fields := strings.Fields(sc.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+	return sc.Err()
+}
+
+func unzero(h string) string {
+	if h == zeroHash {
+		return ""
+	}
+	return h
+}
+
+// Send delivers n to the Apollo listening on sockPath.
+func Send(sockPath string, n Notification) error {
+	conn, err := net.DialTimeout("unix", sockPath, 200*time.Millisecond)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return ErrNoListener
+		}
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	return json.NewEncoder(conn).Encode(n)
+}
+
+// RepoRoot resolves the worktree a hook is running in.
+func RepoRoot() (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return os.Getwd()
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/walter/apollo/internal/watcher"
+)
+
+// Server accepts notifications from installed hooks on a unix socket and
+// republishes them as watcher events, so hook-driven repos share the ingest
+// path with watched ones.
+type Server struct {
+	ln   net.Listener
+	path string
+	out  chan watcher.Event
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Running reports whether a live Apollo answers on sockPath.
+func Running(sockPath string) bool {
+	conn, err := net.DialTimeout("unix", sockPath, 200*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Listen claims sockPath. A stale socket left by a crashed process is
+// replaced; one still answered by a live Apollo is an error.
+func Listen(sockPath string) (*Server, error) {
+	if _, err := os.Stat(sockPath); err == nil {
+		if Running(sockPath) {
+			return nil, errors.New("another apollo is listening on " + sockPath)
+		}
+		os.Remove(sockPath)
+	}
+
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:   ln,
+		path: sockPath,
+		out:  make(chan watcher.Event, 16),
+		done: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+func (s *Server) Events() <-chan watcher.Event {
+	return s.out
+}
+
+func (s *Server) Close() {
+	close(s.done)
+	s.ln.Close()
+	s.wg.Wait()
+	close(s.out)
+	os.Remove(s.path)
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	dec := json.NewDecoder(conn)
+	for {
+		var n Notification
+		if err := dec.Decode(&n); err != nil {
+			return
+		}
+		select {
+		case s.out <- ToEvent(n):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func ToEvent(n Notification) watcher.Event {
+	ev := watcher.Event{RepoPath: n.Repo}
+	for _, u := range n.Updates {
+		ev.Changes = append(ev.Changes, watcher.Classify(n.Repo, u.Ref, u.Old, u.New))
+	}
+	for _, r := range n.Rewrites {
+		ev.Rewrites = append(ev.Rewrites, watcher.Rewrite{Old: r.Old, New: r.New})
+	}
+	ev.Rescan = len(ev.Changes) == 0 && len(ev.Rewrites) == 0
+	return ev
+}
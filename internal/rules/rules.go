@@ -0,0 +1,104 @@
+// Package rules decides which labels configured rules put on new commits.
+package rules
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/git"
+)
+
+type Rule struct {
+	Name  string
+	Label string
+	Color string
+
+	subject *regexp.Regexp
+	author  *regexp.Regexp
+	branch  *regexp.Regexp
+	paths   []string
+}
+
+// Compile checks and prepares the configured label rules.
+func Compile(specs []config.LabelRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for i, s := range specs {
+		r := Rule{Name: s.Name, Label: strings.TrimSpace(s.Label), Color: s.Color, paths: s.Paths}
+		if r.Name == "" {
+			r.Name = r.Label
+		}
+		if r.Label == "" {
+			return nil, fmt.Errorf("label rule %d: no label", i+1)
+		}
+		var err error
+		if r.subject, err = compile(s.Subject); err != nil {
+			return nil, fmt.Errorf("label rule %q: subject: %w", r.Name, err)
+		}
+		if r.author, err = compile(s.Author); err != nil {
+			return nil, fmt.Errorf("label rule %q: author: %w", r.Name, err)
+		}
+		if r.branch, err = compile(s.Branch); err != nil {
+			return nil, fmt.Errorf("label rule %q: branch: %w", r.Name, err)
+		}
+		for _, p := range s.Paths {
+			if _, err := path.Match(strings.TrimSuffix(p, "/**"), ""); err != nil {
+				return nil, fmt.Errorf("label rule %q: path %q: %w", r.Name, p, err)
+			}
+		}
+		if r.subject == nil && r.author == nil && r.branch == nil && len(r.paths) == 0 {
+			return nil, fmt.Errorf("label rule %q: no conditions", r.Name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// Match reports whether c meets every condition of the rule.
+func (r Rule) Match(c git.CommitInfo) bool {
+	if r.subject != nil && !r.subject.MatchString(c.Subject) {
+		return false
+	}
+	if r.author != nil && !r.author.MatchString(c.Author) {
+		return false
+	}
+	if r.branch != nil && !r.branch.MatchString(c.Branch) {
+		return false
+	}
+	if len(r.paths) > 0 && !r.touches(c.Files) {
+		return false
+	}
+	return true
+}
+
+// touches matches each glob against the full path and the base name, so
+// "*.sql" and "db/migrations/*" both work. A trailing "/**" matches
+// everything under a directory.
+func (r Rule) touches(files []string) bool {
+	for _, f := range files {
+		for _, pat := range r.paths {
+			if dir, ok := strings.CutSuffix(pat, "/**"); ok {
+				if f == dir || strings.HasPrefix(f, dir+"/") {
+					return true
+				}
+				continue
+			}
+			if ok, _ := path.Match(pat, f); ok {
+				return true
+			}
+			if ok, _ := path.Match(pat, path.Base(f)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
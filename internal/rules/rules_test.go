@@ -0,0 +1,58 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/git"
+)
+
+func TestMatch(t *testing.T) {
+	rules, err := Compile([]config.LabelRule{
+		{Label: "security", Subject: `(?i)\bcve\b|security`},
+		{Label: "db", Paths: []string{"*.sql", "internal/db/**"}},
+		{Name: "bot deps", Label: "deps", Author: "^dependabot", Paths: []string{"go.mod"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		commit git.CommitInfo
+		want   []string
+	}{
+		{git.CommitInfo{Subject: "Fix CVE-2024-1 in parser"}, []string{"security"}},
+		{git.CommitInfo{Subject: "Add index", Files: []string{"schema/v4.sql"}}, []string{"db"}},
+		{git.CommitInfo{Subject: "Tidy", Files: []string{"internal/db/commit.go"}}, []string{"db"}},
+		{git.CommitInfo{Subject: "Tidy", Files: []string{"internal/dbx/x.go"}}, nil},
+		{git.CommitInfo{Subject: "Bump", Author: "dependabot[bot]", Files: []string{"go.mod"}}, []string{"deps"}},
+		{git.CommitInfo{Subject: "Bump", Author: "alice", Files: []string{"go.mod"}}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range rules {
+			if r.Match(tt.commit) {
+				got = append(got, r.Label)
+			}
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%+v: labels = %v, want %v", tt.commit, got, tt.want)
+		}
+	}
+	if rules[2].Name != "bot deps" || rules[0].Name != "security" {
+		t.Errorf("names = %q, %q", rules[2].Name, rules[0].Name)
+	}
+}
+
+func TestCompileRejectsBadRules(t *testing.T) {
+	for name, spec := range map[string]config.LabelRule{
+		"no label":      {Subject: "x"},
+		"no conditions": {Label: "x"},
+		"bad regexp":    {Label: "x", Subject: "("},
+		"bad glob":      {Label: "x", Paths: []string{"["}},
+	} {
+		if _, err := Compile([]config.LabelRule{spec}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
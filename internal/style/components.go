@@ -49,3 +49,19 @@ func StatusBadge(status string) string {
 		return " "
 	}
 }
+
+// LabelColor is the label's own color if it has a valid one, otherwise a
+// palette color picked by id so it stays stable.
+func LabelColor(color string, id int64) lipgloss.Color {
+	if len(color) == 7 && color[0] == '#' {
+		return lipgloss.Color(color)
+	}
+	return LabelPalette[int(id%int64(len(LabelPalette)))]
+}
+
+func LabelChip(name, color string, id int64) string {
+	return lipgloss.NewStyle().
+		Foreground(SlateDeep).
+		Background(LabelColor(color, id)).
+		Render(" " + name + " ")
+}
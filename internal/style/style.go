@@ -83,6 +83,11 @@ var (
 
 	ColDivStyle = lipgloss.NewStyle().
 			Foreground(BlueDim)
+
+	Match = lipgloss.NewStyle().
+		Background(BlueMuted).
+		Foreground(White).
+		Bold(true)
 )
 
 func StatusIcon(status string) string {
@@ -22,6 +22,11 @@ var (
 	ErrColor          = lipgloss.Color("#EF5350")
 )
 
+// LabelPalette colors labels created without one.
+var LabelPalette = []lipgloss.Color{
+	"#E57373", "#FFB74D", "#FFF176", "#81C784", "#4DD0E1", "#9575CD", "#F06292", "#A1887F",
+}
+
 const (
 	BorderVert = "│"
 	BorderHoriz = "─"
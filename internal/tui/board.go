@@ -44,7 +44,7 @@ func (m Model) renderColumn(colID ColumnID, width, height int) string {
 		c := col.Commits[idx]
 		selected := active && idx == col.Cursor
 
-		if m.expandedHash == c.Hash {
+		if m.isExpanded(c) {
 			cards = append(cards, m.renderExpandedCard(c, cardW))
 		} else {
 			cards = append(cards, m.renderCard(c, cardW, selected))
@@ -62,7 +62,13 @@ func (m Model) visibleCardRange(colID ColumnID, height int) (int, int) {
 	}
 
 	cardHeight := 5
+	if m.search != "" {
+		cardHeight++
+	}
 	expandedExtra := 8
+	if len(m.history) > 0 {
+		expandedExtra += 2 + min(len(m.history), historyRows)
+	}
 	availableHeight := height - 2
 
 	visibleSlots := availableHeight / cardHeight
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/walter/apollo/internal/db"
@@ -12,14 +13,36 @@ func (m Model) renderCard(c db.CommitRow, width int, selected bool) string {
 	hash := style.CardHash.Render(c.Hash[:min(7, len(c.Hash))])
 	icon := style.StatusIcon(c.Status)
 	subject := style.CardSubject.Render(truncate(c.Subject, width-2))
+	author := style.CardMeta.Render(truncate(c.Author, 12))
+	match := m.searchMatch(c)
+	if match != nil {
+		subject = highlightMatches(match.SubjectMatch, width-2, style.CardSubject)
+		author = highlightMatches(match.AuthorMatch, 12, style.CardMeta)
+	}
 
-	metaParts := truncate(c.Author, 12) + " · " + truncate(c.Branch, 12)
+	metaParts := " · " + truncate(c.Branch, 12)
 	if len(m.handles) > 1 && c.RepoName != "" {
 		metaParts += " · " + truncate(c.RepoName, 14)
 	}
-	meta := style.CardMeta.Render(metaParts)
+	if approvals := approvalsText(c); approvals != "" {
+		metaParts += " · " + approvals
+	}
+	meta := author + style.CardMeta.Render(metaParts)
+
+	top := icon + " " + hash
+	if len(c.Labels) > 0 {
+		top += " " + labelChips(c.Labels, width-12)
+	}
 
-	content := fmt.Sprintf("%s %s\n%s\n%s", icon, hash, subject, meta)
+	content := fmt.Sprintf("%s\n%s\n%s", top, subject, meta)
+	// Every card gets the snippet line during a search so heights stay even.
+	if m.search != "" {
+		snippet := ""
+		if match != nil {
+			snippet = highlightMatches(match.Snippet, width-2, style.Muted)
+		}
+		content += "\n" + snippet
+	}
 	return style.Card(content, width, selected)
 }
 
@@ -27,10 +50,19 @@ func (m Model) renderExpandedCard(c db.CommitRow, width int) string {
 	hash := style.CardHash.Render(c.Hash)
 	icon := style.StatusIcon(c.Status)
 	subject := style.CardSubject.Render(c.Subject)
+	if match := m.searchMatch(c); match != nil {
+		subject = highlightMatches(match.SubjectMatch, len(c.Subject), style.CardSubject)
+	}
 	author := style.DetailLabel.Render("Author: ") + style.DetailValue.Render(c.Author)
 	branch := style.DetailLabel.Render("Branch: ") + style.DetailValue.Render(c.Branch)
 	date := style.DetailLabel.Render("Date:   ") + style.DetailValue.Render(c.CommittedAt.Format(time.RFC1123))
 	status := style.DetailLabel.Render("Status: ") + style.StatusBadge(c.Status) + " " + style.DetailValue.Render(c.Status)
+	if c.ReviewedBy != "" && c.Status != "unreviewed" {
+		status += style.CardMeta.Render(" by ") + style.DetailValue.Render(c.ReviewedBy)
+	}
+	if approvals := approvalsText(c); approvals != "" {
+		status += style.CardMeta.Render(" · " + approvals)
+	}
 
 	content := fmt.Sprintf("%s %s\n%s\n\n%s\n%s\n%s\n%s", icon, hash, subject, author, branch, date, status)
 
@@ -38,6 +70,12 @@ func (m Model) renderExpandedCard(c db.CommitRow, width int) string {
 		repo := style.DetailLabel.Render("Repo:   ") + style.DetailValue.Render(c.RepoName)
 		content += "\n" + repo
 	}
+	if len(c.Labels) > 0 {
+		content += "\n" + style.DetailLabel.Render("Labels: ") + labelChips(c.Labels, width-12)
+	}
+	if c.RequiredApprovals > 1 && len(c.Approvers) > 0 {
+		content += "\n" + style.DetailLabel.Render("Approved: ") + style.DetailValue.Render(strings.Join(c.Approvers, ", "))
+	}
 
 	if c.Body != "" {
 		body := style.CardMeta.Render(truncate(c.Body, width*3))
@@ -47,6 +85,18 @@ func (m Model) renderExpandedCard(c db.CommitRow, width int) string {
 		note := style.DetailLabel.Render("Note: ") + style.DetailValue.Render(c.Note)
 		content += "\n" + note
 	}
+	if history := m.historyView(width); history != "" {
+		content += "\n\n" + history
+	}
 
 	return style.ExpandedCard(content, width)
 }
+
+// approvalsText is the "1/2 approvals" tally of a commit still collecting
+// sign-offs in a repo that needs more than one.
+func approvalsText(c db.CommitRow) string {
+	if c.Status != "unreviewed" || c.RequiredApprovals <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d approvals", len(c.Approvers), c.RequiredApprovals)
+}
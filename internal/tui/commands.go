@@ -1,80 +1,175 @@
 package tui
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/walter/apollo/internal/config"
 	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/discover"
 	"github.com/walter/apollo/internal/git"
+	"github.com/walter/apollo/internal/hooks"
 	"github.com/walter/apollo/internal/watcher"
 )
 
 func (m Model) initRepos() tea.Cmd {
 	return func() tea.Msg {
-		paths := m.cfg.ResolvedPaths()
-		handles := make([]RepoHandle, len(paths))
-
-		for i, path := range paths {
-			h := RepoHandle{Path: path, Name: repoName(path)}
+		roots := m.scanRoots()
+		// A root that can't be read still leaves the others' repos, and the
+		// configured ones, to load.
+		discovered, scanErr := discover.ScanAll(roots)
+		if scanErr != nil {
+			scanErr = fmt.Errorf("scan roots: %w", scanErr)
+		}
 
-			repo, err := git.OpenRepo(path)
-			if err != nil {
-				h.Err = fmt.Errorf("open repo %q: %w", path, err)
-				handles[i] = h
+		configured := m.cfg.ResolvedPaths()
+		seen := make(map[string]bool, len(configured))
+		var handles []RepoHandle
+		for _, path := range configured {
+			seen[path] = true
+			handles = append(handles, m.openHandle(path, false))
+		}
+		for _, path := range discovered {
+			if seen[path] || m.cfg.IsExcluded(path) {
 				continue
 			}
-			h.Repo = repo
+			h := m.openHandle(path, false)
+			h.Discovered = true
+			handles = append(handles, h)
+		}
 
-			repoID, err := db.UpsertRepo(m.database, h.Name, path)
-			if err != nil {
-				h.Err = fmt.Errorf("upsert repo %q: %w", path, err)
-				handles[i] = h
-				continue
+		// Repos under a root that failed to scan haven't necessarily gone.
+		if scanErr == nil {
+			if err := m.deactivateVanished(roots, discovered); err != nil {
+				return ErrorMsg{Err: err}
 			}
-			h.RepoID = repoID
-			handles[i] = h
 		}
 
-		return ReposInitializedMsg{Handles: handles}
+		return ReposInitializedMsg{Handles: handles, Err: scanErr}
+	}
+}
+
+// openHandle opens path and registers it. Repos previously deactivated stay
+// inactive unless activate is set, which is how explicit additions and
+// rediscovered repos bring them back.
+func (m Model) openHandle(path string, activate bool) RepoHandle {
+	h := RepoHandle{Path: path, Name: repoName(path), Paused: m.cfg.IsPaused(path)}
+
+	repo, err := git.OpenRepo(path)
+	if err != nil {
+		h.Err = fmt.Errorf("open repo %q: %w", path, err)
+		return h
+	}
+	h.Repo = repo
+
+	known, err := m.store.GetRepoByPath(path)
+	if err != nil {
+		h.Err = fmt.Errorf("look up repo %q: %w", path, err)
+		return h
+	}
+	repoID, err := m.store.UpsertRepo(h.Name, path)
+	if err != nil {
+		h.Err = fmt.Errorf("upsert repo %q: %w", path, err)
+		return h
+	}
+	h.RepoID = repoID
+	if err := m.store.SetRequiredApprovals(repoID, m.cfg.ApprovalsFor(path)); err != nil {
+		h.Err = fmt.Errorf("configure repo %q: %w", path, err)
+		return h
+	}
+	if err := m.recordIdentity(&h, known == nil); err != nil {
+		h.Err = fmt.Errorf("identify repo %q: %w", path, err)
+		return h
+	}
+
+	if activate {
+		if err := m.store.SetRepoActive(repoID, true); err != nil {
+			h.Err = fmt.Errorf("activate repo %q: %w", path, err)
+		}
+		return h
+	}
+	if r, err := m.store.GetRepoByPath(path); err == nil && r != nil {
+		h.Inactive = !r.Active
+	}
+	return h
+}
+
+func (m Model) scanRoots() []discover.Root {
+	var roots []discover.Root
+	for _, r := range m.cfg.ResolvedScanRoots() {
+		roots = append(roots, discover.Root{Path: r.Path, MaxDepth: r.MaxDepth, Ignore: r.Ignore})
+	}
+	return roots
+}
+
+// deactivateVanished marks repos under a scan root inactive once they are no
+// longer found there. Their history stays in the database.
+func (m Model) deactivateVanished(roots []discover.Root, found []string) error {
+	if len(roots) == 0 {
+		return nil
+	}
+	present := make(map[string]bool, len(found))
+	for _, p := range found {
+		present[p] = true
 	}
+	repos, err := m.store.ListActiveRepos()
+	if err != nil {
+		return err
+	}
+	for _, r := range repos {
+		if present[r.Path] || !discover.Under(roots, r.Path) || discover.IsRepo(r.Path) {
+			continue
+		}
+		if err := m.store.SetRepoActive(r.ID, false); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m Model) seedAllCommits() tea.Cmd {
 	return func() tea.Msg {
-		var results []RepoSeedResult
-		for _, h := range m.handles {
-			if h.Err != nil || h.Repo == nil {
-				continue
-			}
+		return AllSeedDoneMsg{PerRepo: m.seedCommits(m.handles)}
+	}
+}
 
-			r, err := db.GetRepoByPath(m.database, h.Path)
-			if err != nil || r == nil {
-				continue
-			}
+func (m Model) seedCommits(handles []RepoHandle) []RepoSeedResult {
+	var results []RepoSeedResult
+	for _, h := range handles {
+		if h.Err != nil || h.Repo == nil || h.Inactive {
+			continue
+		}
 
-			var commits []git.CommitInfo
-			if r.LastCommitHash == "" {
-				commits, err = h.Repo.SeedCommits(m.cfg.SeedDepth)
-			} else {
-				commits, err = h.Repo.ReadNewCommits(r.LastCommitHash, m.cfg.SeedDepth)
-			}
-			if err != nil || len(commits) == 0 {
-				continue
-			}
+		r, err := m.store.GetRepoByPath(h.Path)
+		if err != nil || r == nil {
+			continue
+		}
 
-			results = append(results, RepoSeedResult{
-				RepoID:  h.RepoID,
-				Path:    h.Path,
-				Commits: commits,
-			})
+		var commits []git.CommitInfo
+		if r.LastCommitHash == "" {
+			commits, err = h.Repo.SeedCommits(m.cfg.SeedDepth)
+		} else {
+			commits, err = h.Repo.ReadNewCommits(r.LastCommitHash, m.cfg.SeedDepth)
 		}
-		return AllSeedDoneMsg{PerRepo: results}
+		if err != nil || len(commits) == 0 {
+			continue
+		}
+
+		results = append(results, RepoSeedResult{
+			RepoID:  h.RepoID,
+			Path:    h.Path,
+			Commits: commits,
+		})
 	}
+	return results
 }
 
-func (m Model) persistAllCommits(results []RepoSeedResult) tea.Cmd {
+func (m Model) persistAllCommits(results []RepoSeedResult, notify bool) tea.Cmd {
 	return func() tea.Msg {
 		for _, res := range results {
 			handle := m.handleByPath(res.Path)
@@ -83,24 +178,15 @@ func (m Model) persistAllCommits(results []RepoSeedResult) tea.Cmd {
 				name = handle.Name
 			}
 
-			for _, c := range res.Commits {
-				if err := db.InsertCommit(m.database, res.RepoID, c.Hash, c.Author, c.Subject, c.Body, c.Branch, c.Timestamp); err != nil {
-					return ErrorMsg{Err: fmt.Errorf("insert commit %s: %w", c.Hash[:7], err)}
-				}
-			}
-
 			last := res.Commits[len(res.Commits)-1]
-			if err := db.UpdateLastCommitHash(m.database, res.RepoID, last.Hash); err != nil {
-				return ErrorMsg{Err: fmt.Errorf("update last hash: %w", err)}
+			fresh, err := m.storeCommits(res.RepoID, res.Commits, last.Hash)
+			if err != nil {
+				return ErrorMsg{Err: err}
 			}
 
-			if m.notifier != nil {
-				prefix := ""
-				if len(m.handles) > 1 && name != "" {
-					prefix = "[" + name + "] "
-				}
-				for _, c := range res.Commits {
-					m.notifier.Notify(prefix+"New commit", c.Subject)
+			if notify {
+				if err := m.notifyCommits(res.RepoID, name, fresh); err != nil {
+					return ErrorMsg{Err: err}
 				}
 			}
 		}
@@ -114,11 +200,11 @@ func (m Model) loadAllCommits() tea.Cmd {
 		if len(ids) == 0 {
 			return CommitsLoadedMsg{}
 		}
-		commits, err := db.ListAllCommits(m.database, ids, db.FilterAll)
+		commits, err := m.store.QueryCommits(db.CommitQuery{RepoIDs: ids})
 		if err != nil {
 			return ErrorMsg{Err: err}
 		}
-		stats, err := db.GetAggregateStats(m.database, ids)
+		stats, err := m.store.GetAggregateStats(ids)
 		if err != nil {
 			return ErrorMsg{Err: err}
 		}
@@ -126,24 +212,148 @@ func (m Model) loadAllCommits() tea.Cmd {
 	}
 }
 
+// startAllWatchers routes repos with Apollo's git hooks installed through the
+// hook socket and watches the rest through one shared fsnotify instance. If
+// the socket can't be claimed, hooked repos fall back to the watcher like
+// everything else.
 func (m Model) startAllWatchers() tea.Cmd {
 	return func() tea.Msg {
 		mux := watcher.NewMux()
-		for i := range m.handles {
-			h := &m.handles[i]
-			if h.Err != nil || h.Repo == nil {
+		srv, err := hooks.Listen(config.SocketPath())
+		if err != nil {
+			srv = nil
+		} else {
+			mux.Add(srv.Events())
+		}
+		shared, err := watcher.NewShared(m.watchOptions(""), watcher.DefaultBackoff)
+		if err != nil {
+			shared = nil
+		} else {
+			mux.Add(shared.Events())
+		}
+		return WatchersReadyMsg{Mux: mux, Shared: shared, Hooks: srv, Watches: m.startWatches(m.handles, mux, shared, srv)}
+	}
+}
+
+func (m Model) watchRepos(handles []RepoHandle) tea.Cmd {
+	if m.mux == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return ReposWatchedMsg{Watches: m.startWatches(handles, m.mux, m.shared, m.hooks)}
+	}
+}
+
+// startWatches adds each repo to the shared watcher. Repos configured for
+// polling, or that the shared watcher can't take (e.g. inotify watch limits),
+// get their own supervised poller instead.
+func (m Model) startWatches(handles []RepoHandle, mux *watcher.Mux, shared *watcher.Shared, srv *hooks.Server) []WatchResult {
+	var results []WatchResult
+	for _, h := range handles {
+		if !h.Watchable() {
+			continue
+		}
+		res := WatchResult{Path: h.Path}
+		if srv != nil && hooks.Installed(h.Path) {
+			res.Mode = watcher.ModeHook
+			results = append(results, res)
+			continue
+		}
+		opts := m.watchOptions(h.Path)
+		if shared != nil && !opts.ForcePoll {
+			if err := shared.Add(h.Path); err == nil {
+				path := h.Path
+				res.Stop, res.Mode = func() { shared.Remove(path) }, watcher.ModeNotify
+				results = append(results, res)
 				continue
 			}
-			ch, stop, err := watcher.Watch(h.Path, time.Duration(m.cfg.DebounceMs)*time.Millisecond)
-			if err != nil {
-				h.Err = fmt.Errorf("watch %q: %w", h.Path, err)
-				continue
+			opts.ForcePoll = true
+		}
+		ch, stop, mode, err := watcher.Supervise(h.Path, opts, watcher.DefaultBackoff)
+		if err != nil {
+			res.Err = fmt.Errorf("watch %q: %w", h.Path, err)
+			results = append(results, res)
+			continue
+		}
+		res.Stop, res.Mode = stop, mode
+		mux.Add(ch)
+		results = append(results, res)
+	}
+	return results
+}
+
+func (m Model) startDiscovery() tea.Cmd {
+	roots := m.scanRoots()
+	if len(roots) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		ch, stop, err := discover.Watch(roots, time.Second)
+		if err != nil {
+			return DiscoveryStoppedMsg{Err: fmt.Errorf("watch scan roots: %w", err)}
+		}
+		return DiscoveryReadyMsg{Ch: ch, Stop: stop}
+	}
+}
+
+// discoveryRetry is how long discovery waits before watching the scan roots
+// again after its watcher failed.
+const discoveryRetry = 10 * time.Second
+
+func retryDiscovery() tea.Cmd {
+	return tea.Tick(discoveryRetry, func(time.Time) tea.Msg {
+		return DiscoveryRetryMsg{}
+	})
+}
+
+func (m Model) listenDiscovery() tea.Cmd {
+	if m.discoveryCh == nil {
+		return nil
+	}
+	ch := m.discoveryCh
+	return func() tea.Msg {
+		u, ok := <-ch
+		if !ok {
+			return DiscoveryStoppedMsg{Err: errors.New("watching scan roots stopped; retrying")}
+		}
+		return ReposDiscoveredMsg{Paths: u.Repos, Err: u.Err}
+	}
+}
+
+func (m Model) addRepos(paths []string, discovered bool) tea.Cmd {
+	return func() tea.Msg {
+		handles := make([]RepoHandle, len(paths))
+		for i, p := range paths {
+			handles[i] = m.openHandle(p, true)
+			handles[i].Discovered = discovered
+		}
+		return ReposAddedMsg{Handles: handles}
+	}
+}
+
+func (m Model) seedRepos(handles []RepoHandle) tea.Cmd {
+	return func() tea.Msg {
+		return ReposSeededMsg{PerRepo: m.seedCommits(handles)}
+	}
+}
+
+func (m Model) deactivateRepos(ids []int64) tea.Cmd {
+	return func() tea.Msg {
+		for _, id := range ids {
+			if err := m.store.SetRepoActive(id, false); err != nil {
+				return ErrorMsg{Err: err}
 			}
-			h.WatchCh = ch
-			h.Stop = stop
-			mux.Add(ch)
 		}
-		return WatchersReadyMsg{Mux: mux}
+		return ReposDeactivatedMsg{RepoIDs: ids}
+	}
+}
+
+func (m Model) watchOptions(path string) watcher.Options {
+	return watcher.Options{
+		Debounce:     time.Duration(m.cfg.DebounceMs) * time.Millisecond,
+		MaxLatency:   time.Duration(m.cfg.MaxLatencyMs) * time.Millisecond,
+		PollInterval: time.Duration(m.cfg.PollIntervalMs) * time.Millisecond,
+		ForcePoll:    m.cfg.ShouldPoll(path),
 	}
 }
 
@@ -157,29 +367,144 @@ func (m Model) listenMux() tea.Cmd {
 		if !ok {
 			return nil
 		}
-		return WatcherEventMsg{RepoPath: ev.RepoPath}
+		return WatcherEventMsg{Event: ev}
 	}
 }
 
-func (m Model) readNewCommitsForRepo(repoPath string) tea.Cmd {
+func (m Model) readNewCommitsForRepo(ev watcher.Event) tea.Cmd {
 	return func() tea.Msg {
-		h := m.handleByPath(repoPath)
-		if h == nil || h.Repo == nil {
+		// Hook-mode repos have no watcher of their own to stop, and events
+		// may already be queued when a repo is paused or deactivated.
+		h := m.handleByPath(ev.RepoPath)
+		if h == nil || !h.Watchable() {
 			return NewCommitsMsg{}
 		}
-		r, err := db.GetRepoByPath(m.database, h.Path)
-		if err != nil || r == nil {
-			return NewCommitsMsg{}
+
+		for _, rw := range ev.Rewrites {
+			if err := recordRewriteEvent(m.store, h.RepoID, h.Path, rw); err != nil {
+				return ErrorMsg{Err: err}
+			}
 		}
-		commits, err := h.Repo.ReadNewCommits(r.LastCommitHash, m.cfg.SeedDepth)
+
+		var commits []git.CommitInfo
+		cursor := ""
+		if len(ev.Changes) > 0 {
+			batch, c, err := m.ingestRefChanges(h, ev.Changes)
+			if err != nil {
+				return ErrorMsg{Err: err}
+			}
+			commits, cursor = batch, c
+		}
+		if ev.Rescan || (len(ev.Changes) == 0 && len(ev.Rewrites) == 0) {
+			r, err := m.store.GetRepoByPath(h.Path)
+			if err != nil || r == nil {
+				return NewCommitsMsg{}
+			}
+			batch, err := h.Repo.ReadNewCommits(r.LastCommitHash, m.cfg.SeedDepth)
+			if err != nil {
+				return ErrorMsg{Err: err}
+			}
+			if len(batch) > 0 {
+				cursor = batch[len(batch)-1].Hash
+			}
+			commits = append(commits, batch...)
+		}
+
+		commits, err := m.dropKnownCommits(h.RepoID, commits)
 		if err != nil {
 			return ErrorMsg{Err: err}
 		}
-		return NewCommitsMsg{RepoID: h.RepoID, Commits: commits}
+		return NewCommitsMsg{RepoID: h.RepoID, Commits: commits, Cursor: cursor}
+	}
+}
+
+// ingestRefChanges reads only the commits introduced by each changed branch.
+// Deletions and force-updates of branches are recorded as events since they
+// can drop commits out of reach. Tags and remote-tracking refs are passed
+// over: fetches move them all the time, and what they reach is reviewed
+// once a branch here points at it. The repo cursor only moves when HEAD's
+// branch changed.
+func (m Model) ingestRefChanges(h *RepoHandle, changes []watcher.RefChange) ([]git.CommitInfo, string, error) {
+	headRef := "refs/heads/" + h.Repo.CurrentBranch()
+	var commits []git.CommitInfo
+	cursor := ""
+
+	for _, c := range changes {
+		if !strings.HasPrefix(c.Ref, "refs/heads/") {
+			continue
+		}
+		switch c.Kind {
+		case watcher.RefDeleted:
+			if err := recordRefEvent(m.store, h.RepoID, db.EventRefDeleted, c.Old, h.Path, c); err != nil {
+				return nil, "", err
+			}
+			continue
+		case watcher.RefForceUpdate:
+			if err := recordRefEvent(m.store, h.RepoID, db.EventRefForceUpdated, c.New, h.Path, c); err != nil {
+				return nil, "", err
+			}
+		}
+
+		batch, err := h.Repo.ReadRange(c.Ref, c.Old, c.New, m.cfg.SeedDepth)
+		if err != nil {
+			return nil, "", fmt.Errorf("read %s: %w", c.Ref, err)
+		}
+		commits = append(commits, batch...)
+		if c.Ref == headRef {
+			cursor = c.New
+		}
+	}
+	return commits, cursor, nil
+}
+
+func recordRewriteEvent(store db.Store, repoID int64, repoPath string, rw watcher.Rewrite) error {
+	payload, err := json.Marshal(struct {
+		Repo string `json:"repo"`
+		Old  string `json:"old"`
+		New  string `json:"new"`
+	}{repoPath, rw.Old, rw.New})
+	if err != nil {
+		return err
+	}
+	return store.InsertEvent(repoID, db.EventCommitRewritten, rw.Old, string(payload))
+}
+
+func (m Model) dropKnownCommits(repoID int64, commits []git.CommitInfo) ([]git.CommitInfo, error) {
+	hashes := make([]string, len(commits))
+	for i, c := range commits {
+		hashes[i] = c.Hash
+	}
+	known, err := m.store.KnownHashes(repoID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var fresh []git.CommitInfo
+	for _, c := range commits {
+		if known[c.Hash] {
+			continue
+		}
+		known[c.Hash] = true
+		fresh = append(fresh, c)
+	}
+	return fresh, nil
+}
+
+func recordRefEvent(store db.Store, repoID int64, eventType, hash, repoPath string, c watcher.RefChange) error {
+	payload, err := json.Marshal(struct {
+		Repo string `json:"repo"`
+		Ref  string `json:"ref"`
+		Old  string `json:"old,omitempty"`
+		New  string `json:"new,omitempty"`
+		Kind string `json:"kind"`
+	}{repoPath, c.Ref, c.Old, c.New, c.Kind.String()})
+	if err != nil {
+		return err
 	}
+	return store.InsertEvent(repoID, eventType, hash, string(payload))
 }
 
-func (m Model) persistCommits(repoID int64, commits []git.CommitInfo) tea.Cmd {
+func (m Model) persistCommits(repoID int64, commits []git.CommitInfo, cursor string) tea.Cmd {
 	return func() tea.Msg {
 		var handle *RepoHandle
 		for i := range m.handles {
@@ -189,37 +514,226 @@ func (m Model) persistCommits(repoID int64, commits []git.CommitInfo) tea.Cmd {
 			}
 		}
 
-		for _, c := range commits {
-			if err := db.InsertCommit(m.database, repoID, c.Hash, c.Author, c.Subject, c.Body, c.Branch, c.Timestamp); err != nil {
-				return ErrorMsg{Err: fmt.Errorf("insert commit %s: %w", c.Hash[:7], err)}
+		fresh, err := m.storeCommits(repoID, commits, cursor)
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+
+		if handle != nil {
+			if err := m.notifyCommits(repoID, handle.Name, fresh); err != nil {
+				return ErrorMsg{Err: err}
 			}
 		}
 
-		last := commits[len(commits)-1]
-		if err := db.UpdateLastCommitHash(m.database, repoID, last.Hash); err != nil {
-			return ErrorMsg{Err: fmt.Errorf("update last hash: %w", err)}
+		return CommitsPersistedMsg{}
+	}
+}
+
+// storeCommits ingests one repo's batch together with its cursor and returns
+// the commits that were new. Shared reviews, label rules and notifications
+// only apply to those.
+func (m Model) storeCommits(repoID int64, commits []git.CommitInfo, cursor string) ([]git.CommitInfo, error) {
+	batch := make([]db.NewCommit, len(commits))
+	for i, c := range commits {
+		batch[i] = db.NewCommit{
+			Hash: c.Hash, Author: c.Author, Subject: c.Subject, Body: c.Body,
+			Branch: c.Branch, CommittedAt: c.Timestamp, Files: c.Files,
 		}
+	}
+	added, err := m.store.IngestCommits(repoID, batch, cursor)
+	if err != nil {
+		return nil, err
+	}
 
-		if m.notifier != nil && handle != nil {
-			prefix := ""
-			if len(m.handles) > 1 {
-				prefix = "[" + handle.Name + "] "
-			}
-			for _, c := range commits {
-				m.notifier.Notify(prefix+"New commit", c.Subject)
-			}
+	isNew := make(map[string]bool, len(added))
+	for _, h := range added {
+		isNew[h] = true
+	}
+	var fresh []git.CommitInfo
+	for _, c := range commits {
+		if isNew[c.Hash] {
+			fresh = append(fresh, c)
+			delete(isNew, c.Hash)
 		}
+	}
 
-		return CommitsPersistedMsg{}
+	if err := m.inheritSharedReview(repoID, fresh); err != nil {
+		return nil, err
+	}
+	if err := m.applyLabelRules(repoID, fresh); err != nil {
+		return nil, err
 	}
+	return fresh, nil
 }
 
-func (m Model) updateReview(hash, status string) tea.Cmd {
+// notifyCommits sends a desktop notification per commit and records each
+// one that went out in the commit's history.
+func (m Model) notifyCommits(repoID int64, name string, commits []git.CommitInfo) error {
+	if m.notifier == nil || m.cfg.Notifications.Off {
+		return nil
+	}
+	prefix := ""
+	if p := strings.TrimSpace(m.cfg.Notifications.Prefix); p != "" {
+		prefix = p + " "
+	}
+	if len(m.handles) > 1 && name != "" {
+		prefix += "[" + name + "] "
+	}
+	for _, c := range commits {
+		title := prefix + "New commit"
+		if err := m.notifier.Notify(title, c.Subject); err != nil {
+			continue
+		}
+		err := m.store.RecordEvent(repoID, db.EventNotified, c.Hash, db.Notification{Title: title, Body: c.Subject})
+		if err != nil {
+			return fmt.Errorf("record notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// inheritSharedReview copies reviews other repos already made on the same
+// commits when share_review is on.
+func (m Model) inheritSharedReview(repoID int64, commits []git.CommitInfo) error {
+	if !m.cfg.ShareReview || len(commits) == 0 {
+		return nil
+	}
+	hashes := make([]string, len(commits))
+	for i, c := range commits {
+		hashes[i] = c.Hash
+	}
+	if _, err := m.store.InheritSharedReview(repoID, hashes); err != nil {
+		return fmt.Errorf("inherit shared review: %w", err)
+	}
+	return nil
+}
+
+// errNoReviewer explains db.ErrNoReviewer in terms of the config.
+var errNoReviewer = fmt.Errorf(`%w: set "reviewer" in the config, or git's user.name or user.email`, db.ErrNoReviewer)
+
+// updateReview records the reviewer's decision on c, across every repo
+// holding the commit when share_review is on.
+func (m Model) updateReview(c db.CommitRow, status string) tea.Cmd {
+	if m.cfg.Reviewer == "" && (status == "reviewed" || status == "unreviewed") {
+		return func() tea.Msg { return ErrorMsg{Err: errNoReviewer} }
+	}
 	return func() tea.Msg {
-		if err := db.UpdateReviewStatus(m.database, hash, status, ""); err != nil {
+		var err error
+		if m.cfg.ShareReview {
+			err = m.store.UpdateSharedReviewStatus(c.Hash, status, c.Note, m.cfg.Reviewer)
+		} else {
+			err = m.store.UpdateReviewStatus(c.RepoID, c.Hash, status, c.Note, m.cfg.Reviewer)
+		}
+		if err != nil {
 			return ErrorMsg{Err: err}
 		}
-		return ReviewUpdatedMsg{Hash: hash, Status: status}
+		return ReviewUpdatedMsg{RepoID: c.RepoID, Hash: c.Hash, Status: status}
+	}
+}
+
+// saveNote stores note for c, across every repo holding the commit when
+// share_review is on. A note is no decision, so the review and its
+// approvals stay as they are.
+func (m Model) saveNote(c db.CommitRow, note string) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		if m.cfg.ShareReview {
+			err = m.store.UpdateSharedNote(c.Hash, note)
+		} else {
+			err = m.store.UpdateNote(c.RepoID, c.Hash, note)
+		}
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return ReviewUpdatedMsg{RepoID: c.RepoID, Hash: c.Hash, Status: c.Status}
+	}
+}
+
+// gcStartDelay keeps the first retention run clear of startup work.
+const gcStartDelay = time.Minute
+
+// scheduleGC queues the next retention run, or nothing when retention is
+// off.
+func (m Model) scheduleGC(after time.Duration) tea.Cmd {
+	if m.cfg.Retention.Days <= 0 || after <= 0 {
+		return nil
+	}
+	return tea.Tick(after, func(time.Time) tea.Msg {
+		return GCTickMsg{}
+	})
+}
+
+// runGC retires commits past the retention window and, for a store kept in
+// a file, compacts it if anything went. Failures are reported without stopping later runs.
+func (m Model) runGC() tea.Cmd {
+	r := m.cfg.Retention
+	return func() tea.Msg {
+		n, err := m.store.ArchiveCommits(time.Now().AddDate(0, 0, -r.Days), r.Purge)
+		if err != nil {
+			return GCDoneMsg{Err: fmt.Errorf("retention: %w", err)}
+		}
+		if fs, ok := m.store.(db.FileStore); ok && n > 0 {
+			if _, _, err := fs.Compact(); err != nil {
+				return GCDoneMsg{Retired: n, Err: fmt.Errorf("compact: %w", err)}
+			}
+		}
+		return GCDoneMsg{Retired: n}
+	}
+}
+
+// Backups are checked for shortly after startup and then hourly; the
+// configured interval decides whether one is actually taken.
+const (
+	backupStartDelay    = 30 * time.Second
+	backupCheckInterval = time.Hour
+)
+
+func (m Model) scheduleBackup(after time.Duration) tea.Cmd {
+	if _, ok := m.store.(db.FileStore); !ok || m.cfg.Backups.Keep <= 0 || m.cfg.Backups.IntervalHours <= 0 {
+		return nil
+	}
+	return tea.Tick(after, func(time.Time) tea.Msg {
+		return BackupTickMsg{}
+	})
+}
+
+// runBackup takes a rotated backup if the newest one is older than the
+// configured interval. Stores without a file have nothing to back up.
+func (m Model) runBackup() tea.Cmd {
+	b := m.cfg.Backups
+	fs, ok := m.store.(db.FileStore)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		every := time.Duration(b.IntervalHours) * time.Hour
+		path, err := fs.ScheduledBackup(config.BackupDir(), every, b.Keep)
+		if err != nil {
+			return BackupDoneMsg{Err: fmt.Errorf("backup: %w", err)}
+		}
+		return BackupDoneMsg{Path: path}
+	}
+}
+
+// Stats snapshots are refreshed hourly so the day's row ends close to the
+// day's final counts, even if Apollo isn't running at midnight.
+const (
+	snapshotStartDelay = 10 * time.Second
+	snapshotInterval   = time.Hour
+)
+
+func scheduleSnapshot(after time.Duration) tea.Cmd {
+	return tea.Tick(after, func(time.Time) tea.Msg {
+		return SnapshotTickMsg{}
+	})
+}
+
+func (m Model) runSnapshot() tea.Cmd {
+	return func() tea.Msg {
+		if err := m.store.SnapshotStats(time.Now()); err != nil {
+			return SnapshotDoneMsg{Err: fmt.Errorf("stats snapshot: %w", err)}
+		}
+		return SnapshotDoneMsg{}
 	}
 }
 
@@ -0,0 +1,169 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/style"
+)
+
+// historyRows is how many timeline entries an expanded card shows at once.
+const historyRows = 5
+
+func (m Model) loadHistory(repoID int64, hash string) tea.Cmd {
+	return func() tea.Msg {
+		events, err := m.store.ListEvents(repoID, hash)
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return HistoryLoadedMsg{RepoID: repoID, Hash: hash, Events: events}
+	}
+}
+
+func (m Model) undoEvent(e db.Event) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.store.UndoEvent(e.ID, m.cfg.Reviewer); err != nil {
+			return ErrorMsg{Err: fmt.Errorf("undo: %w", err)}
+		}
+		return ReviewUpdatedMsg{RepoID: e.RepoID, Hash: e.CommitHash}
+	}
+}
+
+// selectedEvent returns the timeline entry under the cursor. The timeline
+// lists newest first, so cursor 0 is the last event.
+func (m Model) selectedEvent() *db.Event {
+	i := len(m.history) - 1 - m.historyCursor
+	if i < 0 || i >= len(m.history) {
+		return nil
+	}
+	return &m.history[i]
+}
+
+func (m Model) historyView(width int) string {
+	if len(m.history) == 0 {
+		return ""
+	}
+	undone := db.UndoneEvents(m.history)
+
+	start := max(0, min(m.historyCursor-historyRows+1, len(m.history)-historyRows))
+	end := min(start+historyRows, len(m.history))
+
+	lines := []string{style.DetailLabel.Render(fmt.Sprintf("History (%d)", len(m.history)))}
+	for pos := start; pos < end; pos++ {
+		e := m.history[len(m.history)-1-pos]
+		line := e.CreatedAt.Local().Format("Jan 02 15:04") + "  " + describeEvent(e)
+		switch {
+		case undone[e.ID]:
+			line += " (undone)"
+		case pos == m.historyCursor && e.Undoable():
+			line += " · z undo"
+		}
+		line = truncate(line, width-4)
+
+		switch {
+		case pos == m.historyCursor:
+			lines = append(lines, style.Selected.Render("> "+line))
+		case undone[e.ID]:
+			lines = append(lines, style.Muted.Render("  "+line))
+		default:
+			lines = append(lines, style.CardMeta.Render("  "+line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func describeEvent(e db.Event) string {
+	switch e.Type {
+	case db.EventDetected:
+		var p db.Detection
+		json.Unmarshal([]byte(e.Payload), &p)
+		return "detected on " + p.Branch
+	case db.EventNotified:
+		return "notified"
+	case db.EventStatusChanged:
+		var p db.StatusChange
+		json.Unmarshal([]byte(e.Payload), &p)
+		line := undoPrefix(p.Undoes) + p.From + " → " + p.To
+		if p.From == p.To {
+			line = undoPrefix(p.Undoes) + p.To
+		}
+		if approvals := describeApprovals(p); approvals != "" {
+			line += " · " + approvals
+		}
+		if p.By != "" {
+			line += " by " + p.By
+		}
+		return line
+	case db.EventNoteEdited:
+		var p db.NoteEdit
+		json.Unmarshal([]byte(e.Payload), &p)
+		return undoPrefix(p.Undoes) + "note " + quoteNote(p.From) + " → " + quoteNote(p.To)
+	case db.EventRuleApplied:
+		var p db.RuleDecision
+		json.Unmarshal([]byte(e.Payload), &p)
+		return strings.TrimSpace("rule " + p.Rule + ": " + p.Action + " " + p.Value)
+	case db.EventLabelAdded, db.EventLabelRemoved:
+		var p db.LabelChange
+		json.Unmarshal([]byte(e.Payload), &p)
+		if e.Type == db.EventLabelAdded {
+			return undoPrefix(p.Undoes) + "labeled " + p.Label
+		}
+		return undoPrefix(p.Undoes) + "unlabeled " + p.Label
+	case db.EventRefDeleted:
+		return "branch deleted"
+	case db.EventRefForceUpdated:
+		return "branch force-updated"
+	case db.EventCommitRewritten:
+		var p struct {
+			New string `json:"new"`
+		}
+		json.Unmarshal([]byte(e.Payload), &p)
+		if p.New == "" {
+			return "rewritten"
+		}
+		return "rewritten as " + p.New[:min(7, len(p.New))]
+	}
+	return e.Type
+}
+
+// describeApprovals says what a status change did to the commit's
+// approvals, in repos that need more than one.
+func describeApprovals(p db.StatusChange) string {
+	if p.Required <= 1 {
+		return ""
+	}
+	var parts []string
+	switch n := len(p.Approved); {
+	case n == 1:
+		parts = append(parts, "approved")
+	case n > 1:
+		parts = append(parts, fmt.Sprintf("%d approvals added", n))
+	}
+	switch n := len(p.Withdrawn); {
+	case n == 1:
+		parts = append(parts, "approval withdrawn")
+	case n > 1:
+		parts = append(parts, fmt.Sprintf("%d approvals withdrawn", n))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s (%d/%d)", strings.Join(parts, ", "), p.Approvals, p.Required)
+}
+
+func undoPrefix(undoes int64) string {
+	if undoes != 0 {
+		return "undo: "
+	}
+	return ""
+}
+
+func quoteNote(note string) string {
+	if note == "" {
+		return "(empty)"
+	}
+	return fmt.Sprintf("%q", truncate(note, 20))
+}
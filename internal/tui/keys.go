@@ -18,6 +18,13 @@ const (
 	ActionBack
 	ActionCopy
 	ActionNote
+	ActionRepos
+	ActionHistoryPrev
+	ActionHistoryNext
+	ActionUndo
+	ActionSearch
+	ActionLabels
+	ActionProfiles
 )
 
 func MapKey(msg tea.KeyMsg) Action {
@@ -50,6 +57,20 @@ func MapKey(msg tea.KeyMsg) Action {
 		return ActionLeft
 	case "n":
 		return ActionNote
+	case "m":
+		return ActionRepos
+	case "[":
+		return ActionHistoryPrev
+	case "]":
+		return ActionHistoryNext
+	case "z":
+		return ActionUndo
+	case "/":
+		return ActionSearch
+	case "t":
+		return ActionLabels
+	case "P":
+		return ActionProfiles
 	default:
 		return ActionNone
 	}
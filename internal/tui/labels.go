@@ -0,0 +1,219 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/git"
+	"github.com/walter/apollo/internal/style"
+)
+
+func (m Model) loadLabels() tea.Cmd {
+	ids := m.repoIDs()
+	return func() tea.Msg {
+		labels, err := m.store.GetLabelStats(ids)
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return LabelsLoadedMsg{Labels: labels}
+	}
+}
+
+func (m Model) selectedLabel() *db.LabelStats {
+	if m.labelCursor < 0 || m.labelCursor >= len(m.labels) {
+		return nil
+	}
+	return &m.labels[m.labelCursor]
+}
+
+func hasLabel(c db.CommitRow, id int64) bool {
+	for _, l := range c.Labels {
+		if l.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// updateLabelKeys drives the label picker, which acts on the card selected
+// when it was opened.
+func (m Model) updateLabelKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, m.quit()
+	case "esc", "t":
+		m.screen = ScreenBoard
+	case "k", "up":
+		if m.labelCursor > 0 {
+			m.labelCursor--
+		}
+	case "j", "down":
+		if m.labelCursor < len(m.labels)-1 {
+			m.labelCursor++
+		}
+	case "enter", " ":
+		c, l := m.selectedCommit(), m.selectedLabel()
+		if c != nil && l != nil {
+			return m, m.toggleLabel(*c, l.ID, !hasLabel(*c, l.ID))
+		}
+	case "a":
+		m.labelInput.SetValue("")
+		m.labelInput.Focus()
+		m.screen = ScreenLabelAdd
+	case "f":
+		if l := m.selectedLabel(); l != nil {
+			if m.labelFilter == l.ID {
+				m.labelFilter = 0
+			} else {
+				m.labelFilter = l.ID
+			}
+			m.refreshColumns()
+			m.screen = ScreenBoard
+		}
+	}
+	return m, nil
+}
+
+func (m Model) updateLabelAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		name, color, err := parseLabelInput(m.labelInput.Value())
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.err = nil
+		m.screen = ScreenLabels
+		return m, m.createLabel(name, color)
+	case "esc":
+		m.screen = ScreenLabels
+	default:
+		var cmd tea.Cmd
+		m.labelInput, cmd = m.labelInput.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// parseLabelInput reads "name" or "name #rrggbb".
+func parseLabelInput(input string) (name, color string, err error) {
+	fields := strings.Fields(input)
+	if n := len(fields); n > 1 && strings.HasPrefix(fields[n-1], "#") {
+		color = fields[n-1]
+		fields = fields[:n-1]
+		if len(color) != 7 {
+			return "", "", fmt.Errorf("color %s should look like #rrggbb", color)
+		}
+	}
+	name = strings.Join(fields, " ")
+	if name == "" {
+		return "", "", fmt.Errorf("label name is empty")
+	}
+	return name, color, nil
+}
+
+func (m Model) createLabel(name, color string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.store.CreateLabel(name, color); err != nil {
+			return ErrorMsg{Err: fmt.Errorf("create label: %w", err)}
+		}
+		return LabelsChangedMsg{}
+	}
+}
+
+func (m Model) toggleLabel(c db.CommitRow, labelID int64, add bool) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		if add {
+			err = m.store.AddLabel(c.RepoID, c.Hash, labelID)
+		} else {
+			err = m.store.RemoveLabel(c.RepoID, c.Hash, labelID)
+		}
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return LabelsChangedMsg{}
+	}
+}
+
+// applyLabelRules labels freshly stored commits per the configured rules.
+func (m Model) applyLabelRules(repoID int64, commits []git.CommitInfo) error {
+	for _, c := range commits {
+		for _, r := range m.rules {
+			if !r.Match(c) {
+				continue
+			}
+			if _, err := m.store.ApplyRuleLabel(repoID, c.Hash, r.Name, r.Label, r.Color); err != nil {
+				return fmt.Errorf("label rule %s: %w", r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m Model) labelFilterName() string {
+	for _, l := range m.labels {
+		if l.ID == m.labelFilter {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+// labelChips renders as many of the labels as fit in width, then a count of
+// the rest.
+func labelChips(labels []db.Label, width int) string {
+	var chips []string
+	used := 0
+	for i, l := range labels {
+		w := len(l.Name) + 3
+		if used+w > width {
+			chips = append(chips, style.Muted.Render(fmt.Sprintf("+%d", len(labels)-i)))
+			break
+		}
+		chips = append(chips, style.LabelChip(l.Name, l.Color, l.ID))
+		used += w
+	}
+	return strings.Join(chips, " ")
+}
+
+func (m Model) labelPickerView() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	title := " Labels"
+	c := m.selectedCommit()
+	if c != nil {
+		title += " for " + c.Hash[:min(7, len(c.Hash))] + " " + truncate(c.Subject, max(m.width-30, 10))
+	}
+	b.WriteString(style.DetailLabel.Render(title) + "\n\n")
+
+	if len(m.labels) == 0 {
+		b.WriteString(style.Muted.Render("  No labels yet, press a to create one") + "\n")
+	}
+
+	for i, l := range m.labels {
+		check := "[ ]"
+		if c != nil && hasLabel(*c, l.ID) {
+			check = "[x]"
+		}
+		filter := ""
+		if l.ID == m.labelFilter {
+			filter = style.Muted.Render(" (filter)")
+		}
+		counts := fmt.Sprintf("%4d open %4d total", l.Unreviewed, l.Total)
+		line := fmt.Sprintf("%s %s  %s%s", check, style.LabelChip(l.Name, l.Color, l.ID), counts, filter)
+		if i == m.labelCursor {
+			b.WriteString(style.Selected.Render("> ") + line + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	if m.screen == ScreenLabelAdd {
+		b.WriteString("\n" + style.DetailLabel.Render(" New label: ") + m.labelInput.View() + "\n")
+		b.WriteString(style.Muted.Render(" name, optionally followed by #rrggbb  enter: create  esc: cancel"))
+	}
+	return b.String()
+}
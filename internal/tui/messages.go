@@ -2,12 +2,17 @@ package tui
 
 import (
 	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/discover"
 	"github.com/walter/apollo/internal/git"
+	"github.com/walter/apollo/internal/hooks"
 	"github.com/walter/apollo/internal/watcher"
 )
 
+// ReposInitializedMsg carries the repos to load at startup. Err is set
+// when some scan root couldn't be read; Handles has the rest.
 type ReposInitializedMsg struct {
 	Handles []RepoHandle
+	Err     error
 }
 
 type RepoSeedResult struct {
@@ -20,17 +25,71 @@ type AllSeedDoneMsg struct {
 	PerRepo []RepoSeedResult
 }
 
+type WatchResult struct {
+	Path string
+	Stop func()
+	Mode watcher.Mode
+	Err  error
+}
+
 type WatchersReadyMsg struct {
-	Mux *watcher.Mux
+	Mux     *watcher.Mux
+	Shared  *watcher.Shared
+	Hooks   *hooks.Server
+	Watches []WatchResult
+}
+
+type ReposWatchedMsg struct {
+	Watches []WatchResult
+}
+
+type DiscoveryReadyMsg struct {
+	Ch   <-chan discover.Update
+	Stop func()
+}
+
+// ReposDiscoveredMsg is the set of repos under the scan roots. Err is an
+// error the discovery watcher hit since the last set.
+type ReposDiscoveredMsg struct {
+	Paths []string
+	Err   error
+}
+
+// DiscoveryStoppedMsg reports that the scan roots are no longer watched,
+// because the watcher couldn't start or shut down. Discovery is retried
+// after discoveryRetry.
+type DiscoveryStoppedMsg struct {
+	Err error
+}
+
+type DiscoveryRetryMsg struct{}
+
+type ReposAddedMsg struct {
+	Handles []RepoHandle
+}
+
+type RepoReboundMsg struct {
+	Path    string
+	OldPath string
+	RepoID  int64
+}
+
+type ReposSeededMsg struct {
+	PerRepo []RepoSeedResult
+}
+
+type ReposDeactivatedMsg struct {
+	RepoIDs []int64
 }
 
 type WatcherEventMsg struct {
-	RepoPath string
+	watcher.Event
 }
 
 type NewCommitsMsg struct {
 	RepoID  int64
 	Commits []git.CommitInfo
+	Cursor  string
 }
 
 type CommitsPersistedMsg struct{}
@@ -41,10 +100,52 @@ type CommitsLoadedMsg struct {
 }
 
 type ReviewUpdatedMsg struct {
+	RepoID int64
 	Hash   string
 	Status string
 }
 
+type SearchResultsMsg struct {
+	Query   string
+	Results []db.SearchResult
+}
+
+type LabelsLoadedMsg struct {
+	Labels []db.LabelStats
+}
+
+type LabelsChangedMsg struct{}
+
+type HistoryLoadedMsg struct {
+	RepoID int64
+	Hash   string
+	Events []db.Event
+}
+
+type GCTickMsg struct{}
+
+type GCDoneMsg struct {
+	Retired int
+	Err     error
+}
+
+type BackupTickMsg struct{}
+
+type BackupDoneMsg struct {
+	Path string
+	Err  error
+}
+
+type ProfilesLoadedMsg struct {
+	Profiles []string
+}
+
+type SnapshotTickMsg struct{}
+
+type SnapshotDoneMsg struct {
+	Err error
+}
+
 type CopiedMsg struct {
 	Hash string
 }
@@ -54,3 +155,10 @@ type CopyFlashTickMsg struct{}
 type ErrorMsg struct {
 	Err error
 }
+
+type RepoUpdatedMsg struct{}
+
+type RepoStatsMsg struct {
+	Stats     map[int64]db.Stats
+	Reviewers []db.ReviewerStats
+}
@@ -1,14 +1,18 @@
 package tui
 
 import (
-	"database/sql"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/walter/apollo/internal/config"
 	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/discover"
+	"github.com/walter/apollo/internal/hooks"
 	"github.com/walter/apollo/internal/notifier"
+	"github.com/walter/apollo/internal/rules"
 	"github.com/walter/apollo/internal/style"
 	"github.com/walter/apollo/internal/watcher"
 )
@@ -18,6 +22,15 @@ type Screen int
 const (
 	ScreenBoard Screen = iota
 	ScreenNote
+	ScreenRepos
+	ScreenRepoAdd
+	ScreenRepoRemove
+	ScreenSearch
+	ScreenLabels
+	ScreenLabelAdd
+	ScreenRebind
+	ScreenProfiles
+	ScreenProfileAdd
 )
 
 type ColumnID int
@@ -53,38 +66,91 @@ func (col *BoardColumn) ClampCursor() {
 
 type Model struct {
 	cfg      config.Config
-	database *sql.DB
+	store    db.Store
 	notifier notifier.Notifier
+	rules    []rules.Rule
 
-	handles  []RepoHandle
+	handles   []RepoHandle
 	handleIdx map[string]int
-	mux      *watcher.Mux
-
-	screen       Screen
-	columns      [NumColumns]BoardColumn
-	activeCol    ColumnID
-	expandedHash string
-	copiedHash   string
-	stats        db.Stats
-	noteInput    textinput.Model
+	mux       *watcher.Mux
+	shared    *watcher.Shared
+	hooks     *hooks.Server
+
+	discoveryCh   <-chan discover.Update
+	stopDiscovery func()
+
+	screen        Screen
+	columns       [NumColumns]BoardColumn
+	activeCol     ColumnID
+	expandedRepo  int64
+	expandedHash  string
+	history       []db.Event
+	historyCursor int
+	copiedHash    string
+	stats         db.Stats
+	noteInput     textinput.Model
+	commits       []db.CommitRow
+
+	searchInput   textinput.Model
+	search        string
+	searchResults []db.SearchResult
+	searchIdx     map[commitKey]int
+
+	labels      []db.LabelStats
+	labelCursor int
+	labelInput  textinput.Model
+	labelFilter int64
+
+	repoCursor int
+	repoInput  textinput.Model
+	repoStats  map[int64]db.Stats
+	reviewers  []db.ReviewerStats
+	rebinds    []RepoHandle
+
+	profiles      []string
+	profileCursor int
+	profileInput  textinput.Model
+	switchTo      string
 
 	width  int
 	height int
 	err    error
 }
 
-func NewModel(cfg config.Config, database *sql.DB, n notifier.Notifier) Model {
+func NewModel(cfg config.Config, store db.Store, n notifier.Notifier) Model {
 	ti := textinput.New()
 	ti.Placeholder = "Enter note..."
 	ti.CharLimit = 256
 
+	ri := textinput.New()
+	ri.Placeholder = "/path/to/repo"
+	ri.CharLimit = 1024
+
+	si := textinput.New()
+	si.Prompt = "/ "
+	si.Placeholder = "search subjects, notes, authors, files..."
+	si.CharLimit = 256
+
+	li := textinput.New()
+	li.Placeholder = "follow-up #ffb74d"
+	li.CharLimit = 64
+
+	pi := textinput.New()
+	pi.Placeholder = "work"
+	pi.CharLimit = 64
+
 	m := Model{
-		cfg:       cfg,
-		database:  database,
-		notifier:  n,
-		handleIdx: make(map[string]int),
-		noteInput: ti,
+		cfg:          cfg,
+		store:        store,
+		notifier:     n,
+		handleIdx:    make(map[string]int),
+		noteInput:    ti,
+		repoInput:    ri,
+		searchInput:  si,
+		labelInput:   li,
+		profileInput: pi,
 	}
+	m.rules, m.err = rules.Compile(cfg.LabelRules)
 
 	m.columns[ColNeedsReview] = BoardColumn{
 		ID: ColNeedsReview, Title: "Needs Review", Status: "unreviewed",
@@ -100,7 +166,8 @@ func NewModel(cfg config.Config, database *sql.DB, n notifier.Notifier) Model {
 }
 
 func (m Model) Init() tea.Cmd {
-	return m.initRepos()
+	return tea.Batch(m.initRepos(), m.scheduleGC(gcStartDelay), m.scheduleBackup(backupStartDelay),
+		scheduleSnapshot(snapshotStartDelay))
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -110,48 +177,204 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 
 	case tea.KeyMsg:
-		if m.screen == ScreenNote {
+		switch m.screen {
+		case ScreenNote:
 			return m.updateNote(msg)
+		case ScreenRepos:
+			return m.updateRepoKeys(msg)
+		case ScreenRepoAdd:
+			return m.updateRepoAdd(msg)
+		case ScreenRepoRemove:
+			return m.updateRepoRemove(msg)
+		case ScreenSearch:
+			return m.updateSearch(msg)
+		case ScreenLabels:
+			return m.updateLabelKeys(msg)
+		case ScreenLabelAdd:
+			return m.updateLabelAdd(msg)
+		case ScreenRebind:
+			return m.updateRebind(msg)
+		case ScreenProfiles:
+			return m.updateProfileKeys(msg)
+		case ScreenProfileAdd:
+			return m.updateProfileAdd(msg)
 		}
 		return m.updateKeys(msg)
 
 	case ReposInitializedMsg:
-		m.handles = msg.Handles
-		m.handleIdx = make(map[string]int, len(msg.Handles))
-		for i, h := range msg.Handles {
-			m.handleIdx[h.Path] = i
+		if msg.Err != nil {
+			m.err = msg.Err
 		}
+		m.handles = msg.Handles
+		m.reindexHandles()
+		m.queueRebinds(msg.Handles)
 		return m, m.seedAllCommits()
 
 	case AllSeedDoneMsg:
 		if len(msg.PerRepo) > 0 {
-			return m, tea.Batch(m.persistAllCommits(msg.PerRepo), m.startAllWatchers())
+			return m, tea.Batch(m.persistAllCommits(msg.PerRepo, true), m.startAllWatchers())
 		}
 		return m, tea.Batch(m.loadAllCommits(), m.startAllWatchers())
 
 	case WatchersReadyMsg:
 		m.mux = msg.Mux
-		return m, m.listenMux()
+		m.shared = msg.Shared
+		m.hooks = msg.Hooks
+		m.applyWatches(msg.Watches)
+		return m, tea.Batch(m.listenMux(), m.startDiscovery())
+
+	case ReposWatchedMsg:
+		m.applyWatches(msg.Watches)
+
+	case DiscoveryReadyMsg:
+		m.discoveryCh = msg.Ch
+		m.stopDiscovery = msg.Stop
+		return m, m.listenDiscovery()
+
+	case ReposDiscoveredMsg:
+		if msg.Err != nil {
+			m.err = fmt.Errorf("discovery: %w", msg.Err)
+		}
+		added, removed := m.diffDiscovered(msg.Paths)
+		cmds := []tea.Cmd{m.listenDiscovery()}
+		if len(added) > 0 {
+			cmds = append(cmds, m.addRepos(added, true))
+		}
+		if len(removed) > 0 {
+			cmds = append(cmds, m.deactivateRepos(m.dropHandles(removed)))
+		}
+		return m, tea.Batch(cmds...)
+
+	case DiscoveryStoppedMsg:
+		m.err = msg.Err
+		if m.stopDiscovery != nil {
+			m.stopDiscovery()
+		}
+		m.discoveryCh, m.stopDiscovery = nil, nil
+		return m, retryDiscovery()
+
+	case DiscoveryRetryMsg:
+		return m, m.startDiscovery()
+
+	case ReposAddedMsg:
+		m.handles = append(m.handles, msg.Handles...)
+		m.reindexHandles()
+		for _, h := range msg.Handles {
+			if !h.Discovered {
+				m.cfg.RepoPaths = config.AddPath(m.cfg.RepoPaths, h.Path)
+				m.cfg.ExcludedPaths = config.RemovePath(m.cfg.ExcludedPaths, h.Path)
+			}
+		}
+		m.queueRebinds(msg.Handles)
+		return m, tea.Batch(m.seedRepos(msg.Handles), m.watchRepos(msg.Handles), m.loadRepoStats())
+
+	case RepoReboundMsg:
+		m.applyRebind(msg)
+		return m, tea.Batch(m.loadAllCommits(), m.loadRepoStats())
+
+	case RepoUpdatedMsg:
+		return m, tea.Batch(m.loadAllCommits(), m.loadRepoStats())
+
+	case RepoStatsMsg:
+		m.repoStats = msg.Stats
+		m.reviewers = msg.Reviewers
+
+	case ReposSeededMsg:
+		if len(msg.PerRepo) > 0 {
+			return m, m.persistAllCommits(msg.PerRepo, false)
+		}
+		return m, m.loadAllCommits()
+
+	case ReposDeactivatedMsg:
+		return m, m.loadAllCommits()
 
 	case WatcherEventMsg:
-		return m, tea.Batch(m.readNewCommitsForRepo(msg.RepoPath), m.listenMux())
+		if msg.Type != watcher.EventChange {
+			m.applyWatcherHealth(msg.Event)
+			return m, m.listenMux()
+		}
+		return m, tea.Batch(m.readNewCommitsForRepo(msg.Event), m.listenMux())
 
 	case NewCommitsMsg:
-		if len(msg.Commits) == 0 {
+		if len(msg.Commits) == 0 && msg.Cursor == "" {
 			return m, nil
 		}
-		return m, m.persistCommits(msg.RepoID, msg.Commits)
+		return m, m.persistCommits(msg.RepoID, msg.Commits, msg.Cursor)
 
 	case CommitsPersistedMsg:
 		return m, m.loadAllCommits()
 
 	case CommitsLoadedMsg:
 		m.stats = msg.Stats
-		m.partitionCommits(msg.Commits)
+		m.commits = msg.Commits
+		if m.search != "" {
+			return m, m.runSearch(m.search)
+		}
+		m.refreshColumns()
+
+	case SearchResultsMsg:
+		if msg.Query == m.search {
+			m.setSearchResults(msg.Results)
+		}
 
 	case ReviewUpdatedMsg:
+		if m.expandedHash != "" {
+			return m, tea.Batch(m.loadAllCommits(), m.loadHistory(m.expandedRepo, m.expandedHash))
+		}
 		return m, m.loadAllCommits()
 
+	case ProfilesLoadedMsg:
+		m.profiles = msg.Profiles
+		m.profileCursor = max(slices.Index(m.profiles, config.Profile()), 0)
+
+	case LabelsLoadedMsg:
+		m.labels = msg.Labels
+		m.labelCursor = min(m.labelCursor, max(0, len(m.labels)-1))
+
+	case LabelsChangedMsg:
+		cmds := []tea.Cmd{m.loadAllCommits(), m.loadLabels()}
+		if m.expandedHash != "" {
+			cmds = append(cmds, m.loadHistory(m.expandedRepo, m.expandedHash))
+		}
+		return m, tea.Batch(cmds...)
+
+	case HistoryLoadedMsg:
+		if msg.RepoID == m.expandedRepo && msg.Hash == m.expandedHash {
+			m.history = msg.Events
+			m.historyCursor = min(m.historyCursor, max(0, len(m.history)-1))
+		}
+
+	case GCTickMsg:
+		return m, m.runGC()
+
+	case GCDoneMsg:
+		if msg.Err != nil {
+			m.err = msg.Err
+		}
+		cmd := m.scheduleGC(time.Duration(m.cfg.Retention.IntervalHours) * time.Hour)
+		if msg.Retired > 0 {
+			return m, tea.Batch(cmd, m.loadAllCommits(), m.loadRepoStats())
+		}
+		return m, cmd
+
+	case BackupTickMsg:
+		return m, m.runBackup()
+
+	case BackupDoneMsg:
+		if msg.Err != nil {
+			m.err = msg.Err
+		}
+		return m, m.scheduleBackup(backupCheckInterval)
+
+	case SnapshotTickMsg:
+		return m, m.runSnapshot()
+
+	case SnapshotDoneMsg:
+		if msg.Err != nil {
+			m.err = msg.Err
+		}
+		return m, scheduleSnapshot(snapshotInterval)
+
 	case CopiedMsg:
 		m.copiedHash = msg.Hash
 		return m, tea.Tick(2*time.Second, func(time.Time) tea.Msg {
@@ -168,9 +391,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// refreshColumns fills the columns from the search results while a search
+// is active, otherwise from every loaded commit.
+func (m *Model) refreshColumns() {
+	if m.search == "" {
+		m.partitionCommits(m.commits)
+		return
+	}
+	rows := make([]db.CommitRow, len(m.searchResults))
+	for i, r := range m.searchResults {
+		rows[i] = r.CommitRow
+	}
+	m.partitionCommits(rows)
+}
+
 func (m *Model) partitionCommits(all []db.CommitRow) {
 	buckets := [NumColumns][]db.CommitRow{}
 	for _, c := range all {
+		if m.labelFilter != 0 && !hasLabel(c, m.labelFilter) {
+			continue
+		}
 		switch c.Status {
 		case "unreviewed":
 			buckets[ColNeedsReview] = append(buckets[ColNeedsReview], c)
@@ -186,10 +426,102 @@ func (m *Model) partitionCommits(all []db.CommitRow) {
 	}
 }
 
+func (m *Model) reindexHandles() {
+	m.handleIdx = make(map[string]int, len(m.handles))
+	for i, h := range m.handles {
+		m.handleIdx[h.Path] = i
+	}
+}
+
+func (m *Model) applyWatches(results []WatchResult) {
+	for _, res := range results {
+		idx, ok := m.handleIdx[res.Path]
+		if !ok {
+			if res.Stop != nil {
+				res.Stop()
+			}
+			continue
+		}
+		h := &m.handles[idx]
+		if res.Err != nil {
+			h.Err = res.Err
+			continue
+		}
+		h.Watching = true
+		h.Stop = res.Stop
+		h.Mode = res.Mode
+	}
+}
+
+// diffDiscovered compares a fresh scan against the repos discovered so far.
+// Configured repos are never removed by discovery.
+func (m Model) diffDiscovered(paths []string) (added, removed []string) {
+	found := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		found[p] = true
+		if _, ok := m.handleIdx[p]; !ok && !m.cfg.IsExcluded(p) {
+			added = append(added, p)
+		}
+	}
+	for _, h := range m.handles {
+		if h.Discovered && !found[h.Path] {
+			removed = append(removed, h.Path)
+		}
+	}
+	return added, removed
+}
+
+// dropHandles stops and forgets the given repos, returning their database
+// IDs so the caller can deactivate them.
+func (m *Model) dropHandles(paths []string) []int64 {
+	drop := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		drop[p] = true
+	}
+
+	var ids []int64
+	kept := make([]RepoHandle, 0, len(m.handles))
+	for _, h := range m.handles {
+		if !drop[h.Path] {
+			kept = append(kept, h)
+			continue
+		}
+		if h.Stop != nil {
+			h.Stop()
+		}
+		if h.RepoID != 0 {
+			ids = append(ids, h.RepoID)
+		}
+	}
+	m.handles = kept
+	m.reindexHandles()
+	return ids
+}
+
+func (m *Model) applyWatcherHealth(ev watcher.Event) {
+	idx, ok := m.handleIdx[ev.RepoPath]
+	if !ok {
+		return
+	}
+	h := &m.handles[idx]
+	switch ev.Type {
+	case watcher.EventError, watcher.EventStopped:
+		h.Health.LastErr = ev.Err
+		h.Health.LastErrAt = time.Now()
+		if ev.Type == watcher.EventStopped {
+			h.Health.Down = true
+		}
+	case watcher.EventRestarted:
+		h.Health.Down = false
+		h.Health.Restarts = ev.Restarts
+		h.Mode = ev.Mode
+	}
+}
+
 func (m Model) repoIDs() []int64 {
 	var ids []int64
 	for _, h := range m.handles {
-		if h.Err == nil && h.RepoID != 0 {
+		if h.Err == nil && h.RepoID != 0 && !h.Inactive {
 			ids = append(ids, h.RepoID)
 		}
 	}
@@ -237,29 +569,66 @@ func (m Model) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case ActionExpand:
 		if c := col.Selected(); c != nil {
-			if m.expandedHash == c.Hash {
+			if m.isExpanded(*c) {
 				m.expandedHash = ""
 			} else {
-				m.expandedHash = c.Hash
+				m.expandedRepo, m.expandedHash = c.RepoID, c.Hash
+				m.history, m.historyCursor = nil, 0
+				return m, m.loadHistory(c.RepoID, c.Hash)
 			}
 		}
 
+	case ActionHistoryPrev:
+		if m.expandedHash != "" && m.historyCursor > 0 {
+			m.historyCursor--
+		}
+
+	case ActionHistoryNext:
+		if m.expandedHash != "" && m.historyCursor < len(m.history)-1 {
+			m.historyCursor++
+		}
+
+	case ActionUndo:
+		if e := m.selectedEvent(); m.expandedHash != "" && e != nil && e.Undoable() && !db.UndoneEvents(m.history)[e.ID] {
+			return m, m.undoEvent(*e)
+		}
+
 	case ActionBack:
+		switch {
+		case m.expandedHash != "":
+		case m.search != "":
+			m.clearSearch()
+		case m.labelFilter != 0:
+			m.labelFilter = 0
+			m.refreshColumns()
+		}
+		m.expandedHash = ""
+
+	case ActionLabels:
 		m.expandedHash = ""
+		m.screen = ScreenLabels
+		return m, m.loadLabels()
+
+	case ActionSearch:
+		m.expandedHash = ""
+		m.searchInput.SetValue(m.search)
+		m.searchInput.CursorEnd()
+		m.searchInput.Focus()
+		m.screen = ScreenSearch
 
 	case ActionReview:
 		if c := col.Selected(); c != nil {
-			return m, m.updateReview(c.Hash, "reviewed")
+			return m, m.updateReview(*c, "reviewed")
 		}
 
 	case ActionUnreview:
 		if c := col.Selected(); c != nil {
-			return m, m.updateReview(c.Hash, "unreviewed")
+			return m, m.updateReview(*c, "unreviewed")
 		}
 
 	case ActionIgnore:
 		if c := col.Selected(); c != nil {
-			return m, m.updateReview(c.Hash, "ignored")
+			return m, m.updateReview(*c, "ignored")
 		}
 
 	case ActionCopy:
@@ -267,6 +636,17 @@ func (m Model) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, m.copyHashCmd(c.Hash[:min(7, len(c.Hash))])
 		}
 
+	case ActionProfiles:
+		m.expandedHash = ""
+		m.screen = ScreenProfiles
+		return m, loadProfiles
+
+	case ActionRepos:
+		m.expandedHash = ""
+		m.screen = ScreenRepos
+		m.repoCursor = min(m.repoCursor, max(0, len(m.handles)-1))
+		return m, m.loadRepoStats()
+
 	case ActionNote:
 		if c := col.Selected(); c != nil {
 			m.noteInput.SetValue(c.Note)
@@ -284,10 +664,7 @@ func (m Model) updateNote(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if c := m.selectedCommit(); c != nil {
 			note := m.noteInput.Value()
 			m.screen = ScreenBoard
-			return m, func() tea.Msg {
-				db.UpdateReviewStatus(m.database, c.Hash, c.Status, note)
-				return ReviewUpdatedMsg{Hash: c.Hash, Status: c.Status}
-			}
+			return m, m.saveNote(*c, note)
 		}
 		m.screen = ScreenBoard
 	case "esc":
@@ -305,14 +682,26 @@ func (m Model) View() string {
 		return "Loading..."
 	}
 
-	header := style.HeaderBar.Render("Apollo")
+	title := "Apollo"
+	if p := config.Profile(); p != config.DefaultProfile {
+		title += " · " + p
+	}
+	header := style.HeaderBar.Render(title)
 	var body string
 
 	switch m.screen {
-	case ScreenBoard:
+	case ScreenBoard, ScreenSearch:
 		body = m.boardView()
 	case ScreenNote:
 		body = m.noteInputView()
+	case ScreenRepos, ScreenRepoAdd, ScreenRepoRemove:
+		body = m.repoManagerView()
+	case ScreenLabels, ScreenLabelAdd:
+		body = m.labelPickerView()
+	case ScreenRebind:
+		body = m.rebindView()
+	case ScreenProfiles, ScreenProfileAdd:
+		body = m.profilesView()
 	}
 
 	errLine := m.errorView()
@@ -326,14 +715,29 @@ func (m Model) selectedCommit() *db.CommitRow {
 	return m.columns[m.activeCol].Selected()
 }
 
+// isExpanded reports whether c is the open card. The same commit can sit in
+// several repos, so the repo is part of the match.
+func (m Model) isExpanded(c db.CommitRow) bool {
+	return m.expandedHash != "" && m.expandedHash == c.Hash && m.expandedRepo == c.RepoID
+}
+
 func (m Model) quit() tea.Cmd {
 	for _, h := range m.handles {
 		if h.Stop != nil {
 			h.Stop()
 		}
 	}
+	if m.shared != nil {
+		m.shared.Close()
+	}
 	if m.mux != nil {
 		m.mux.Close()
 	}
+	if m.hooks != nil {
+		m.hooks.Close()
+	}
+	if m.stopDiscovery != nil {
+		m.stopDiscovery()
+	}
 	return tea.Quit
 }
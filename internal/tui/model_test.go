@@ -1,35 +1,52 @@
 package tui
 
 import (
+	"database/sql"
+	"errors"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/walter/apollo/internal/config"
 	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/discover"
+	"github.com/walter/apollo/internal/git"
 	"github.com/walter/apollo/internal/notifier"
+	"github.com/walter/apollo/internal/watcher"
 )
 
 func testModel(t *testing.T) Model {
 	t.Helper()
-	dbPath := filepath.Join(t.TempDir(), "test.db")
-	database, err := db.Open(dbPath)
+	cfg := config.Defaults()
+	cfg.RepoPaths = []string{t.TempDir()}
+	cfg.Reviewer = "tester"
+
+	return NewModel(cfg, db.NewMemStore(), &notifier.Fallback{})
+}
+
+// sqliteTestModel is testModel over a database file, for tests that depend
+// on how SQLite behaves or reach into its tables.
+func sqliteTestModel(t *testing.T) (Model, *sql.DB) {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() { database.Close() })
-
-	cfg := config.Defaults()
-	cfg.RepoPaths = []string{t.TempDir()}
-
-	return NewModel(cfg, database, &notifier.Fallback{})
+	m := testModel(t)
+	m.store = db.NewSQLStore(database)
+	return m, database
 }
 
 func seedTestCommits(t *testing.T, m *Model, n int) {
 	t.Helper()
 	path := m.cfg.ResolvedPaths()[0]
-	repoID, err := db.UpsertRepo(m.database, "test", path)
+	repoID, err := m.store.UpsertRepo("test", path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -39,18 +56,18 @@ func seedTestCommits(t *testing.T, m *Model, n int) {
 	now := time.Now()
 	for i := range n {
 		hash := string(rune('a'+i)) + "bcdef1234567890abcdef1234567890abcdef12"
-		db.InsertCommit(m.database, repoID, hash, "alice", "commit "+string(rune('A'+i)), "", "main", now.Add(time.Duration(i)*time.Minute))
+		m.store.InsertCommit(repoID, hash, "alice", "commit "+string(rune('A'+i)), "", "main", now.Add(time.Duration(i)*time.Minute), nil)
 	}
 }
 
 func loadAndPartition(t *testing.T, m *Model) {
 	t.Helper()
 	ids := m.repoIDs()
-	commits, err := db.ListAllCommits(m.database, ids, db.FilterAll)
+	commits, err := m.store.QueryCommits(db.CommitQuery{RepoIDs: ids})
 	if err != nil {
 		t.Fatal(err)
 	}
-	stats, err := db.GetAggregateStats(m.database, ids)
+	stats, err := m.store.GetAggregateStats(ids)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -183,6 +200,266 @@ func TestCardExpansion(t *testing.T) {
 	}
 }
 
+func TestHistoryTimelineUndo(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 1)
+	m.width = 120
+	m.height = 40
+	loadAndPartition(t, &m)
+	c := m.columns[ColNeedsReview].Commits[0]
+
+	result, cmd := m.updateKeys(tea.KeyMsg{Type: tea.KeyEnter})
+	rm := result.(Model)
+	msg := cmd().(HistoryLoadedMsg)
+	result, _ = rm.Update(msg)
+	rm = result.(Model)
+	if len(rm.history) != 1 || rm.history[0].Type != db.EventDetected {
+		t.Fatalf("history = %+v, want detection only", rm.history)
+	}
+
+	if _, ok := rm.updateReview(c, "ignored")().(ReviewUpdatedMsg); !ok {
+		t.Fatal("review update failed")
+	}
+	result, _ = rm.Update(rm.loadHistory(c.RepoID, c.Hash)())
+	rm = result.(Model)
+	if len(rm.history) != 2 || !strings.Contains(rm.historyView(80), "unreviewed → ignored") {
+		t.Fatalf("timeline = %q", rm.historyView(80))
+	}
+
+	_, cmd = rm.updateKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	if cmd == nil {
+		t.Fatal("z should undo the newest entry")
+	}
+	if _, ok := cmd().(ReviewUpdatedMsg); !ok {
+		t.Fatal("undo failed")
+	}
+	loadAndPartition(t, &rm)
+	if len(rm.columns[ColNeedsReview].Commits) != 1 {
+		t.Error("undo should move the commit back to needs review")
+	}
+
+	result, _ = rm.Update(rm.loadHistory(c.RepoID, c.Hash)())
+	rm = result.(Model)
+	result, _ = rm.updateKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	rm = result.(Model)
+	if !strings.Contains(rm.historyView(80), "(undone)") {
+		t.Errorf("timeline should mark the undone entry: %q", rm.historyView(80))
+	}
+	if _, cmd := rm.updateKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}}); cmd != nil {
+		t.Error("an undone entry can't be undone again")
+	}
+}
+
+func TestNotificationsAreRecorded(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 0)
+	commits := []git.CommitInfo{{Hash: strings.Repeat("f", 40), Author: "bob", Subject: "hello", Branch: "main", Timestamp: time.Now()}}
+
+	if _, ok := m.persistCommits(m.handles[0].RepoID, commits, "")().(CommitsPersistedMsg); !ok {
+		t.Fatal("persist failed")
+	}
+	events, err := m.store.ListEvents(m.handles[0].RepoID, commits[0].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Type != db.EventDetected || events[1].Type != db.EventNotified {
+		t.Errorf("events = %+v, want detected then notified", events)
+	}
+
+	m.store = unrecordedStore{m.store}
+	commits[0].Hash = strings.Repeat("e", 40)
+	if msg, ok := m.persistCommits(m.handles[0].RepoID, commits, "")().(ErrorMsg); !ok || !strings.Contains(msg.Err.Error(), "disk full") {
+		t.Errorf("msg = %#v, want the failure to record the notification", msg)
+	}
+}
+
+// unrecordedStore fails to record events.
+type unrecordedStore struct{ db.Store }
+
+func (unrecordedStore) RecordEvent(int64, string, string, any) error {
+	return errors.New("disk full")
+}
+
+func TestReviewNeedsReviewer(t *testing.T) {
+	m := testModel(t)
+	m.cfg.Reviewer = ""
+	seedTestCommits(t, &m, 1)
+	commits, _ := m.store.QueryCommits(db.CommitQuery{RepoIDs: m.repoIDs()})
+	c := commits[0]
+
+	for _, status := range []string{"reviewed", "unreviewed"} {
+		if msg, ok := m.updateReview(c, status)().(ErrorMsg); !ok || !errors.Is(msg.Err, errNoReviewer) {
+			t.Errorf("%s without a reviewer = %#v", status, msg)
+		}
+	}
+	if approvers, _ := m.store.ListApprovals(c.RepoID, c.Hash); len(approvers) != 0 {
+		t.Errorf("approvals = %v, want none", approvers)
+	}
+	if _, ok := m.saveNote(c, "a note")().(ReviewUpdatedMsg); !ok {
+		t.Error("a note is no decision and should go through")
+	}
+	if _, ok := m.updateReview(c, "ignored")().(ReviewUpdatedMsg); !ok {
+		t.Error("ignoring a commit needs no approval and should go through")
+	}
+}
+
+func TestShareReviewAcrossRepos(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 1)
+	hash := "abcdef1234567890abcdef1234567890abcdef12"
+	forkID, _ := m.store.UpsertRepo("fork", "/tmp/fork")
+	m.handles = append(m.handles, RepoHandle{Path: "/tmp/fork", Name: "fork", RepoID: forkID})
+	m.handleIdx["/tmp/fork"] = 1
+	m.store.InsertCommit(forkID, hash, "alice", "commit A", "", "main", time.Now(), nil)
+
+	loadAndPartition(t, &m)
+	c := m.columns[ColNeedsReview].Commits[0]
+	m.updateReview(c, "reviewed")()
+	loadAndPartition(t, &m)
+	if len(m.columns[ColNeedsReview].Commits) != 1 {
+		t.Fatalf("without share_review only one repo should change, needs review = %d", len(m.columns[ColNeedsReview].Commits))
+	}
+
+	m.cfg.ShareReview = true
+	c = m.columns[ColNeedsReview].Commits[0]
+	m.updateReview(c, "ignored")()
+	loadAndPartition(t, &m)
+	if len(m.columns[ColNeedsReview].Commits) != 0 {
+		t.Errorf("shared review should reach both repos, needs review = %d", len(m.columns[ColNeedsReview].Commits))
+	}
+}
+
+func TestSearchFiltersBoard(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 3)
+	m.width, m.height = 120, 30
+	loadAndPartition(t, &m)
+	m.commits = m.columns[ColNeedsReview].Commits
+
+	result, _ := m.updateKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	m = result.(Model)
+	if m.screen != ScreenSearch {
+		t.Fatalf("screen = %v, want search", m.screen)
+	}
+	for _, r := range "commit b" {
+		result, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = result.(Model)
+	}
+	if m.search != "commit b" {
+		t.Fatalf("search = %q", m.search)
+	}
+	result, _ = m.Update(m.runSearch(m.search)())
+	m = result.(Model)
+
+	got := m.columns[ColNeedsReview].Commits
+	if len(got) != 1 || got[0].Subject != "commit B" {
+		t.Fatalf("filtered = %+v, want only commit B", got)
+	}
+	if match := m.searchMatch(got[0]); match == nil || !strings.Contains(match.SubjectMatch, db.MatchStart) {
+		t.Errorf("match = %+v, want highlighted subject", match)
+	}
+	if !strings.Contains(m.View(), "1 matches") {
+		t.Error("status bar should count matches")
+	}
+
+	result, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = result.(Model)
+	if m.screen != ScreenBoard || len(m.columns[ColNeedsReview].Commits) != 1 {
+		t.Fatal("enter should keep the filter on the board")
+	}
+	result, _ = m.updateKeys(tea.KeyMsg{Type: tea.KeyEsc})
+	m = result.(Model)
+	if m.search != "" || len(m.columns[ColNeedsReview].Commits) != 3 {
+		t.Errorf("esc should clear the search, got %d commits", len(m.columns[ColNeedsReview].Commits))
+	}
+}
+
+func TestHighlightMatches(t *testing.T) {
+	marked := "Fix " + db.MatchStart + "watcher" + db.MatchEnd + " leak"
+	plain := lipgloss.NewStyle()
+	if got := highlightMatches(marked, 40, plain); !strings.Contains(got, "watcher") || !strings.Contains(got, " leak") {
+		t.Errorf("full = %q", got)
+	}
+	if got := highlightMatches(marked, 8, plain); !strings.Contains(got, "Fix wat") || strings.Contains(got, "leak") || !strings.HasSuffix(got, "…") {
+		t.Errorf("truncated = %q", got)
+	}
+}
+
+func TestLabelPicker(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 2)
+	m.width, m.height = 120, 30
+	loadAndPartition(t, &m)
+	m.commits = m.columns[ColNeedsReview].Commits
+
+	result, cmd := m.updateKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	m = result.(Model)
+	if m.screen != ScreenLabels || cmd == nil {
+		t.Fatal("t should open the label picker")
+	}
+
+	result, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	m = result.(Model)
+	m.labelInput.SetValue("follow-up #ffb74d")
+	result, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = result.(Model)
+	if _, ok := cmd().(LabelsChangedMsg); !ok {
+		t.Fatal("create label failed")
+	}
+	result, _ = m.Update(m.loadLabels()())
+	m = result.(Model)
+	if len(m.labels) != 1 || m.labels[0].Color != "#ffb74d" {
+		t.Fatalf("labels = %+v", m.labels)
+	}
+
+	_, cmd = m.Update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+	if _, ok := cmd().(LabelsChangedMsg); !ok {
+		t.Fatal("toggle failed")
+	}
+	loadAndPartition(t, &m)
+	m.commits = append(m.columns[ColNeedsReview].Commits[:0:0], m.columns[ColNeedsReview].Commits...)
+	labeled := m.columns[ColNeedsReview].Commits[0]
+	if len(labeled.Labels) != 1 || !strings.Contains(m.renderCard(labeled, 40, false), "follow-up") {
+		t.Errorf("card should show the chip, labels = %+v", labeled.Labels)
+	}
+
+	result, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}})
+	m = result.(Model)
+	if m.screen != ScreenBoard || len(m.columns[ColNeedsReview].Commits) != 1 {
+		t.Fatalf("filter should leave one card, got %d", len(m.columns[ColNeedsReview].Commits))
+	}
+	if !strings.Contains(m.statusBar(), "label: follow-up") {
+		t.Error("status bar should name the label filter")
+	}
+	result, _ = m.updateKeys(tea.KeyMsg{Type: tea.KeyEsc})
+	m = result.(Model)
+	if len(m.columns[ColNeedsReview].Commits) != 2 {
+		t.Error("esc should clear the label filter")
+	}
+}
+
+func TestLabelRulesOnIngest(t *testing.T) {
+	m := testModel(t)
+	m.cfg.LabelRules = []config.LabelRule{{Name: "schema", Label: "db", Paths: []string{"*.sql"}}}
+	m = NewModel(m.cfg, m.store, &notifier.Fallback{})
+	seedTestCommits(t, &m, 0)
+
+	commits := []git.CommitInfo{
+		{Hash: strings.Repeat("1", 40), Author: "bob", Subject: "migrate", Branch: "main", Timestamp: time.Now(), Files: []string{"schema/v2.sql"}},
+		{Hash: strings.Repeat("2", 40), Author: "bob", Subject: "docs", Branch: "main", Timestamp: time.Now(), Files: []string{"README.md"}},
+	}
+	if msg, ok := m.persistCommits(m.handles[0].RepoID, commits, "")().(CommitsPersistedMsg); !ok {
+		t.Fatalf("persist = %#v", msg)
+	}
+	loadAndPartition(t, &m)
+	for _, c := range m.columns[ColNeedsReview].Commits {
+		want := c.Subject == "migrate"
+		if got := len(c.Labels) == 1 && c.Labels[0].Name == "db"; got != want {
+			t.Errorf("%s labels = %+v", c.Subject, c.Labels)
+		}
+	}
+}
+
 func TestStatusChangeMovesBetweenColumns(t *testing.T) {
 	m := testModel(t)
 	seedTestCommits(t, &m, 3)
@@ -194,8 +471,8 @@ func TestStatusChangeMovesBetweenColumns(t *testing.T) {
 		t.Fatalf("needs review = %d, want 3", len(m.columns[ColNeedsReview].Commits))
 	}
 
-	hash := m.columns[ColNeedsReview].Commits[0].Hash
-	db.UpdateReviewStatus(m.database, hash, "reviewed", "")
+	c := m.columns[ColNeedsReview].Commits[0]
+	m.store.UpdateReviewStatus(c.RepoID, c.Hash, "reviewed", "", "tester")
 
 	loadAndPartition(t, &m)
 
@@ -207,6 +484,109 @@ func TestStatusChangeMovesBetweenColumns(t *testing.T) {
 	}
 }
 
+func TestReviewRecordsReviewer(t *testing.T) {
+	m := testModel(t)
+	m.cfg.Reviewer = "Ada <ada@example.com>"
+	seedTestCommits(t, &m, 1)
+	m.width = 120
+	m.height = 40
+	loadAndPartition(t, &m)
+
+	c := m.columns[ColNeedsReview].Commits[0]
+	if _, ok := m.updateReview(c, "reviewed")().(ReviewUpdatedMsg); !ok {
+		t.Fatal("review not saved")
+	}
+	loadAndPartition(t, &m)
+	got := m.columns[ColReviewed].Commits[0]
+	if got.ReviewedBy != m.cfg.Reviewer {
+		t.Errorf("ReviewedBy = %q, want %q", got.ReviewedBy, m.cfg.Reviewer)
+	}
+	if card := m.renderExpandedCard(got, 80); !strings.Contains(card, "by Ada") {
+		t.Error("expanded card should show the reviewer")
+	}
+}
+
+func TestReviewNeedsRequiredApprovals(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 1)
+	m.width = 120
+	m.height = 40
+	m.store.SetRequiredApprovals(m.handles[0].RepoID, 2)
+	loadAndPartition(t, &m)
+
+	m.cfg.Reviewer = "ada"
+	m.updateReview(m.columns[ColNeedsReview].Commits[0], "reviewed")()
+	loadAndPartition(t, &m)
+	if len(m.columns[ColNeedsReview].Commits) != 1 {
+		t.Fatal("one approval of two should leave the commit in needs review")
+	}
+	c := m.columns[ColNeedsReview].Commits[0]
+	if card := m.renderCard(c, 60, false); !strings.Contains(card, "1/2 approvals") {
+		t.Errorf("card should show the tally:\n%s", card)
+	}
+
+	m.cfg.Reviewer = "grace"
+	m.updateReview(c, "reviewed")()
+	loadAndPartition(t, &m)
+	if len(m.columns[ColReviewed].Commits) != 1 {
+		t.Fatal("second approval should move the commit to reviewed")
+	}
+	if got := m.columns[ColReviewed].Commits[0]; got.ReviewedBy != "grace" || len(got.Approvers) != 2 {
+		t.Errorf("reviewed = %q with %v", got.ReviewedBy, got.Approvers)
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	os.MkdirAll(config.ProfileDir("oss"), 0755)
+	m := testModel(t)
+	m.width = 120
+	m.height = 40
+
+	result, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("P")})
+	m = result.(Model)
+	if m.screen != ScreenProfiles || cmd == nil {
+		t.Fatalf("screen = %v, cmd = %v", m.screen, cmd)
+	}
+	result, _ = m.Update(cmd())
+	m = result.(Model)
+	if len(m.profiles) != 2 || m.profileCursor != 0 {
+		t.Fatalf("profiles = %v, cursor %d", m.profiles, m.profileCursor)
+	}
+
+	// Choosing the current profile just goes back to the board.
+	result, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = result.(Model)
+	if m.screen != ScreenBoard || cmd != nil || m.SwitchProfile() != "" {
+		t.Fatalf("reselecting current profile: screen %v, switch %q", m.screen, m.SwitchProfile())
+	}
+
+	m.screen = ScreenProfiles
+	result, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	result, cmd = result.(Model).Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = result.(Model)
+	if m.SwitchProfile() != "oss" || cmd == nil {
+		t.Fatalf("switch = %q", m.SwitchProfile())
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("switching should end the session")
+	}
+
+	// New profiles are named in place and switched to straight away.
+	m = testModel(t)
+	m.screen = ScreenProfiles
+	result, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	m = result.(Model)
+	for _, name := range []string{"bad/name", "client-a"} {
+		m.profileInput.SetValue(name)
+		result, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m = result.(Model)
+	}
+	if m.SwitchProfile() != "client-a" {
+		t.Errorf("switch = %q, want client-a", m.SwitchProfile())
+	}
+}
+
 func TestCommitsLoadedMsg(t *testing.T) {
 	m := testModel(t)
 	m.width = 120
@@ -260,6 +640,7 @@ func TestMapKey(t *testing.T) {
 		{"i", ActionIgnore},
 		{"c", ActionCopy},
 		{"n", ActionNote},
+		{"m", ActionRepos},
 	}
 	for _, tt := range tests {
 		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(tt.key)}
@@ -287,8 +668,8 @@ func TestMultiRepoHandles(t *testing.T) {
 	pathA := t.TempDir()
 	pathB := t.TempDir()
 
-	repoA, _ := db.UpsertRepo(m.database, "alpha", pathA)
-	repoB, _ := db.UpsertRepo(m.database, "beta", pathB)
+	repoA, _ := m.store.UpsertRepo("alpha", pathA)
+	repoB, _ := m.store.UpsertRepo("beta", pathB)
 
 	m.handles = []RepoHandle{
 		{Path: pathA, Name: "alpha", RepoID: repoA},
@@ -311,3 +692,228 @@ func TestMultiRepoHandles(t *testing.T) {
 		t.Error("handleByPath should return nil for unknown path")
 	}
 }
+
+func TestRefEventsOnlyForBranches(t *testing.T) {
+	m := testModel(t)
+	path := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-b", "main", path},
+		{"-C", path, "-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "--allow-empty", "-m", "root"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	repo, err := git.OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoID, _ := m.store.UpsertRepo("test", path)
+	h := &RepoHandle{Path: path, Name: "test", RepoID: repoID, Repo: repo}
+
+	gone, moved := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	_, _, err = m.ingestRefChanges(h, []watcher.RefChange{
+		{Ref: "refs/remotes/origin/main", Old: gone, New: moved, Kind: watcher.RefForceUpdate},
+		{Ref: "refs/remotes/origin/old", Old: gone, Kind: watcher.RefDeleted},
+		{Ref: "refs/tags/v1", Old: moved, Kind: watcher.RefDeleted},
+		{Ref: "refs/heads/topic", Old: gone, Kind: watcher.RefDeleted},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := m.store.ListEvents(repoID, moved); len(events) != 0 {
+		t.Errorf("tag and remote-tracking changes recorded %d events", len(events))
+	}
+	events, _ := m.store.ListEvents(repoID, gone)
+	if len(events) != 1 || events[0].Type != db.EventRefDeleted || !strings.Contains(events[0].Payload, "refs/heads/topic") {
+		t.Errorf("events = %+v, want the topic branch deletion only", events)
+	}
+}
+
+func TestWatcherHealthEvents(t *testing.T) {
+	m := testModel(t)
+	path := m.cfg.ResolvedPaths()[0]
+	m.handles = []RepoHandle{{Path: path, Name: "test"}}
+	m.handleIdx = map[string]int{path: 0}
+
+	result, _ := m.Update(WatcherEventMsg{Event: watcher.Event{RepoPath: path, Type: watcher.EventStopped, Err: errors.New("gone")}})
+	rm := result.(Model)
+	h := rm.handles[0].Health
+	if !h.Down || h.LastErr == nil {
+		t.Fatalf("health after stop = %+v", h)
+	}
+
+	result, _ = rm.Update(WatcherEventMsg{Event: watcher.Event{RepoPath: path, Type: watcher.EventRestarted, Restarts: 1, Mode: watcher.ModePoll}})
+	rm = result.(Model)
+	h = rm.handles[0].Health
+	if h.Down || h.Restarts != 1 {
+		t.Errorf("health after restart = %+v", h)
+	}
+	if rm.handles[0].Mode != watcher.ModePoll {
+		t.Error("restarted in poll mode should mark handle polling")
+	}
+}
+
+func TestDiscoveryAddsAndDropsRepos(t *testing.T) {
+	m := testModel(t)
+	configured := m.cfg.ResolvedPaths()[0]
+	gone, _ := m.store.UpsertRepo("gone", "/code/gone")
+	m.handles = []RepoHandle{
+		{Path: configured, Name: "configured"},
+		{Path: "/code/gone", Name: "gone", RepoID: gone, Discovered: true},
+		{Path: "/code/kept", Name: "kept", Discovered: true},
+	}
+	m.reindexHandles()
+
+	added, removed := m.diffDiscovered([]string{"/code/kept", "/code/new"})
+	if len(added) != 1 || added[0] != "/code/new" {
+		t.Errorf("added = %v, want [/code/new]", added)
+	}
+	if len(removed) != 1 || removed[0] != "/code/gone" {
+		t.Errorf("removed = %v, want [/code/gone]", removed)
+	}
+
+	ids := m.dropHandles(removed)
+	if len(ids) != 1 || ids[0] != gone {
+		t.Errorf("ids = %v, want [%d]", ids, gone)
+	}
+	if m.handleByPath("/code/gone") != nil || m.handleByPath(configured) == nil || m.handleByPath("/code/kept") == nil {
+		t.Error("dropHandles should only remove the vanished repo")
+	}
+
+	msg := m.deactivateRepos(ids)()
+	if _, ok := msg.(ReposDeactivatedMsg); !ok {
+		t.Fatalf("msg = %T", msg)
+	}
+	if r, _ := m.store.GetRepoByPath("/code/gone"); r == nil || r.Active {
+		t.Error("vanished repo should be deactivated")
+	}
+}
+
+func TestDiscoveryErrorsAndRestart(t *testing.T) {
+	m := testModel(t)
+	result, _ := m.Update(ReposDiscoveredMsg{Err: errors.New("queue overflow")})
+	m = result.(Model)
+	if m.err == nil || !strings.Contains(m.err.Error(), "queue overflow") {
+		t.Errorf("err = %v, want the watcher error shown", m.err)
+	}
+
+	ch := make(chan discover.Update)
+	close(ch)
+	stopped := false
+	m.discoveryCh, m.stopDiscovery = ch, func() { stopped = true }
+	msg, ok := m.listenDiscovery()().(DiscoveryStoppedMsg)
+	if !ok {
+		t.Fatal("a closed discovery channel should report DiscoveryStoppedMsg")
+	}
+	result, cmd := m.Update(msg)
+	m = result.(Model)
+	if m.err == nil || !stopped || m.discoveryCh != nil || cmd == nil {
+		t.Errorf("err = %v, stopped = %v, ch = %v, retry = %v", m.err, stopped, m.discoveryCh, cmd != nil)
+	}
+
+	m.cfg.ScanRoots = []config.ScanRoot{{Path: t.TempDir(), MaxDepth: 1}}
+	_, cmd = m.Update(DiscoveryRetryMsg{})
+	ready, ok := cmd().(DiscoveryReadyMsg)
+	if !ok {
+		t.Fatal("retry should watch the scan roots again")
+	}
+	ready.Stop()
+}
+
+func TestInitReposSurvivesUnreadableRoot(t *testing.T) {
+	m := testModel(t)
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", filepath.Join(root, "a")).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	// A root below a plain file can't be read at all.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocked := filepath.Join(file, "code")
+	stale, _ := m.store.UpsertRepo("stale", filepath.Join(blocked, "x"))
+	m.cfg.ScanRoots = []config.ScanRoot{{Path: root, MaxDepth: 1}, {Path: blocked, MaxDepth: 1}}
+
+	msg, ok := m.initRepos()().(ReposInitializedMsg)
+	if !ok {
+		t.Fatal("a root that can't be read shouldn't stop the rest loading")
+	}
+	if msg.Err == nil || len(msg.Handles) != 2 || msg.Handles[1].Path != filepath.Join(root, "a") {
+		t.Errorf("err = %v, handles = %+v", msg.Err, msg.Handles)
+	}
+	if r, _ := m.store.GetRepoByPath(filepath.Join(blocked, "x")); r == nil || r.ID != stale || !r.Active {
+		t.Error("a repo under the unreadable root should stay active")
+	}
+	result, _ := m.Update(msg)
+	if m = result.(Model); m.err == nil || len(m.handles) != 2 {
+		t.Errorf("err = %v, handles = %d", m.err, len(m.handles))
+	}
+}
+
+func TestStartWatchesUsesSharedWatcher(t *testing.T) {
+	m := testModel(t)
+	repo := initGitRepo(t)
+	h := m.openHandle(repo, true)
+	polled := m.openHandle(initGitRepo(t), true)
+	m.cfg.PollPaths = []string{polled.Path}
+
+	mux := watcher.NewMux()
+	defer mux.Close()
+	shared, err := watcher.NewShared(m.watchOptions(""), watcher.DefaultBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+
+	results := m.startWatches([]RepoHandle{h, polled}, mux, shared, nil)
+	if len(results) != 2 || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].Mode != watcher.ModeNotify || shared.Len() != 1 {
+		t.Errorf("repo should join the shared watcher, mode = %v, len = %d", results[0].Mode, shared.Len())
+	}
+	if results[1].Mode != watcher.ModePoll {
+		t.Errorf("poll path mode = %v, want poll", results[1].Mode)
+	}
+
+	for _, res := range results {
+		res.Stop()
+	}
+	if shared.Len() != 0 {
+		t.Error("stop should remove the repo from the shared watcher")
+	}
+}
+
+func TestRetentionRunsInBackground(t *testing.T) {
+	// Commits are backdated in the database itself, and compaction needs
+	// a file.
+	m, database := sqliteTestModel(t)
+	if m.scheduleGC(time.Hour) != nil {
+		t.Error("retention is off by default and should not be scheduled")
+	}
+
+	m.cfg.Retention.Days = 7
+	seedTestCommits(t, &m, 2)
+	loadAndPartition(t, &m)
+	c := m.columns[ColNeedsReview].Commits[0]
+	if err := m.store.UpdateReviewStatus(c.RepoID, c.Hash, "reviewed", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(0, 0, -8).UTC().Format("2006-01-02 15:04:05")
+	database.Exec(`UPDATE commits SET detected_at = ?`, old)
+	database.Exec(`UPDATE events SET created_at = ?`, old)
+
+	msg, ok := m.runGC()().(GCDoneMsg)
+	if !ok || msg.Err != nil || msg.Retired != 1 {
+		t.Fatalf("gc = %#v", msg)
+	}
+	if _, cmd := m.Update(msg); cmd == nil {
+		t.Error("gc should reschedule and reload the board")
+	}
+	loadAndPartition(t, &m)
+	if len(m.columns[ColReviewed].Commits) != 0 || len(m.columns[ColNeedsReview].Commits) != 1 {
+		t.Error("reviewed commit should have been archived")
+	}
+}
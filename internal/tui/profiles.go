@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/style"
+)
+
+// SwitchProfile returns the profile the user chose to switch to before
+// quitting, or "" when they just quit.
+func (m Model) SwitchProfile() string {
+	return m.switchTo
+}
+
+func loadProfiles() tea.Msg {
+	profiles, err := config.ListProfiles()
+	if err != nil {
+		return ErrorMsg{Err: fmt.Errorf("list profiles: %w", err)}
+	}
+	return ProfilesLoadedMsg{Profiles: profiles}
+}
+
+// switchProfile ends the session so main can start over under name.
+// Nothing is shared between profiles, so there is no state to carry over.
+func (m Model) switchProfile(name string) (tea.Model, tea.Cmd) {
+	if name == config.Profile() {
+		m.screen = ScreenBoard
+		return m, nil
+	}
+	m.switchTo = name
+	return m, m.quit()
+}
+
+func (m Model) updateProfileKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, m.quit()
+	case "esc", "P":
+		m.screen = ScreenBoard
+	case "k", "up":
+		if m.profileCursor > 0 {
+			m.profileCursor--
+		}
+	case "j", "down":
+		if m.profileCursor < len(m.profiles)-1 {
+			m.profileCursor++
+		}
+	case "enter":
+		if m.profileCursor < len(m.profiles) {
+			return m.switchProfile(m.profiles[m.profileCursor])
+		}
+	case "a":
+		m.profileInput.SetValue("")
+		m.profileInput.Focus()
+		m.screen = ScreenProfileAdd
+	}
+	return m, nil
+}
+
+func (m Model) updateProfileAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		name := strings.TrimSpace(m.profileInput.Value())
+		if err := config.ValidProfile(name); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.err = nil
+		return m.switchProfile(name)
+	case "esc":
+		m.screen = ScreenProfiles
+	default:
+		var cmd tea.Cmd
+		m.profileInput, cmd = m.profileInput.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m Model) profilesView() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	b.WriteString(style.DetailLabel.Render(" Profiles") + "\n\n")
+	for i, name := range m.profiles {
+		line := name
+		if name == config.Profile() {
+			line += style.Muted.Render(" (current)")
+		}
+		line += "  " + style.Muted.Render(config.ProfileDir(name))
+		if i == m.profileCursor {
+			b.WriteString(style.Selected.Render("> ") + line + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	b.WriteString("\n" + style.Muted.Render("  Each profile has its own config, database and notifications.") + "\n")
+
+	if m.screen == ScreenProfileAdd {
+		b.WriteString("\n" + style.DetailLabel.Render(" New profile: ") + m.profileInput.View() + "\n")
+		b.WriteString(style.Muted.Render(" enter: create and switch  esc: cancel"))
+	}
+	return b.String()
+}
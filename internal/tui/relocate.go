@@ -0,0 +1,133 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/style"
+)
+
+// recordIdentity stores the root commits and remotes of h's repo the first
+// time it is seen. A path Apollo has never tracked that matches a known repo
+// whose checkout is gone is most likely that repo moved, so h remembers it
+// for the rebind prompt.
+func (m Model) recordIdentity(h *RepoHandle, isNew bool) error {
+	if !isNew {
+		has, err := m.store.HasRepoIdentity(h.RepoID)
+		if err != nil || has {
+			return err
+		}
+	}
+	id, err := h.Repo.Identity()
+	if err != nil {
+		return err
+	}
+	if err := m.store.SetRepoIdentity(h.RepoID, id.Roots, id.Remotes); err != nil {
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+
+	candidates, err := m.store.FindReposByIdentity(h.RepoID, id.Roots, id.Remotes)
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c.Path); os.IsNotExist(err) {
+			h.Relocated = &c
+			return nil
+		}
+	}
+	return nil
+}
+
+// queueRebinds collects the handles that look like moved repos and opens the
+// prompt for the first one.
+func (m *Model) queueRebinds(handles []RepoHandle) {
+	for _, h := range handles {
+		if h.Relocated != nil {
+			m.rebinds = append(m.rebinds, h)
+		}
+	}
+	if len(m.rebinds) > 0 && m.screen == ScreenBoard {
+		m.screen = ScreenRebind
+	}
+}
+
+func (m Model) updateRebind(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.rebinds) == 0 {
+		m.screen = ScreenBoard
+		return m, nil
+	}
+	h := m.rebinds[0]
+
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "y":
+		cmd = m.rebindRepo(h)
+	case "n", "esc":
+	case "ctrl+c":
+		return m, m.quit()
+	default:
+		return m, nil
+	}
+	m.rebinds = m.rebinds[1:]
+	if len(m.rebinds) == 0 {
+		m.screen = ScreenBoard
+	}
+	return m, cmd
+}
+
+func (m Model) rebindRepo(h RepoHandle) tea.Cmd {
+	old := *h.Relocated
+	return func() tea.Msg {
+		if err := m.store.RebindRepo(old.ID, h.Path, h.Name); err != nil {
+			return ErrorMsg{Err: fmt.Errorf("rebind %s: %w", h.Name, err)}
+		}
+		err := config.Update(func(c *config.Config) {
+			c.RepoPaths = config.RemovePath(c.RepoPaths, old.Path)
+			c.PausedPaths = config.RemovePath(c.PausedPaths, old.Path)
+			c.PollPaths = config.RemovePath(c.PollPaths, old.Path)
+			if config.ExpandHome(c.RepoPath) == old.Path {
+				c.RepoPath = ""
+			}
+		})
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("save config: %w", err)}
+		}
+		return RepoReboundMsg{Path: h.Path, OldPath: old.Path, RepoID: old.ID}
+	}
+}
+
+// applyRebind points the moved checkout's handle at the repo it was rebound
+// to and drops the one for the old location.
+func (m *Model) applyRebind(msg RepoReboundMsg) {
+	m.dropHandles([]string{msg.OldPath})
+	m.cfg.RepoPaths = config.RemovePath(m.cfg.RepoPaths, msg.OldPath)
+	m.cfg.PausedPaths = config.RemovePath(m.cfg.PausedPaths, msg.OldPath)
+	if idx, ok := m.handleIdx[msg.Path]; ok {
+		m.handles[idx].RepoID = msg.RepoID
+		m.handles[idx].Relocated = nil
+	}
+}
+
+func (m Model) rebindView() string {
+	if len(m.rebinds) == 0 {
+		return ""
+	}
+	h := m.rebinds[0]
+	var b strings.Builder
+	b.WriteString("\n")
+	b.WriteString(style.DetailLabel.Render(" "+h.Name+" looks like a moved repository") + "\n\n")
+	b.WriteString("  now at   " + h.Path + "\n")
+	b.WriteString("  was at   " + style.Muted.Render(h.Relocated.Path) + "\n\n")
+	b.WriteString(style.Muted.Render("  Rebinding keeps the review history of the old location.") + "\n")
+	if n := len(m.rebinds) - 1; n > 0 {
+		b.WriteString(style.Muted.Render(fmt.Sprintf("  %d more to go", n)) + "\n")
+	}
+	return b.String()
+}
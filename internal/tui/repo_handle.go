@@ -1,16 +1,45 @@
 package tui
 
 import (
+	"time"
+
+	"github.com/walter/apollo/internal/db"
 	"github.com/walter/apollo/internal/git"
 	"github.com/walter/apollo/internal/watcher"
 )
 
 type RepoHandle struct {
-	Path    string
-	Name    string
-	RepoID  int64
-	Repo    *git.Repo
-	WatchCh <-chan watcher.Event
-	Stop    func()
-	Err     error
+	Path     string
+	Name     string
+	RepoID   int64
+	Repo     *git.Repo
+	Watching bool
+	Stop     func()
+	Mode     watcher.Mode
+	Health   RepoHealth
+	Err      error
+
+	Discovered bool
+	Paused     bool
+	Inactive   bool
+
+	// Relocated is the repo this checkout used to be tracked as, when it
+	// looks like that one was moved here.
+	Relocated *db.Repository
+}
+
+// Watchable reports whether the repo should have a live watcher.
+func (h RepoHandle) Watchable() bool {
+	return h.Err == nil && h.Repo != nil && !h.Paused && !h.Inactive
+}
+
+type RepoHealth struct {
+	LastErr   error
+	LastErrAt time.Time
+	Restarts  int
+	Down      bool
+}
+
+func (h RepoHealth) Healthy() bool {
+	return !h.Down && h.LastErr == nil
 }
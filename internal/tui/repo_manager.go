@@ -0,0 +1,343 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/discover"
+	"github.com/walter/apollo/internal/git"
+	"github.com/walter/apollo/internal/style"
+	"github.com/walter/apollo/internal/watcher"
+)
+
+func (m Model) selectedHandle() *RepoHandle {
+	if m.repoCursor < 0 || m.repoCursor >= len(m.handles) {
+		return nil
+	}
+	return &m.handles[m.repoCursor]
+}
+
+func (m Model) updateRepoKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, m.quit()
+	case "esc", "m":
+		m.screen = ScreenBoard
+	case "k", "up":
+		if m.repoCursor > 0 {
+			m.repoCursor--
+		}
+	case "j", "down":
+		if m.repoCursor < len(m.handles)-1 {
+			m.repoCursor++
+		}
+	case "a":
+		m.repoInput.SetValue("")
+		m.repoInput.Focus()
+		m.screen = ScreenRepoAdd
+	case "p":
+		if h := m.selectedHandle(); h != nil && h.Err == nil && !h.Inactive {
+			return m, m.togglePause(h)
+		}
+	case "d":
+		if h := m.selectedHandle(); h != nil && h.Err == nil {
+			return m, m.toggleActive(h)
+		}
+	case "x":
+		if m.selectedHandle() != nil {
+			m.screen = ScreenRepoRemove
+		}
+	}
+	return m, nil
+}
+
+func (m Model) updateRepoAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		path, err := m.validateRepoPath(m.repoInput.Value())
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.err = nil
+		m.screen = ScreenRepos
+		return m, m.addConfiguredRepo(path)
+	case "esc":
+		m.screen = ScreenRepos
+	default:
+		var cmd tea.Cmd
+		m.repoInput, cmd = m.repoInput.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m Model) updateRepoRemove(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	h := m.selectedHandle()
+	if h == nil {
+		m.screen = ScreenRepos
+		return m, nil
+	}
+
+	var purge bool
+	switch msg.String() {
+	case "k":
+		purge = false
+	case "p":
+		purge = true
+	case "esc":
+		m.screen = ScreenRepos
+		return m, nil
+	default:
+		return m, nil
+	}
+
+	// A repo under a scan root would only be found again; removing it
+	// excludes it from discovery until it is added back by hand.
+	path, repoID := h.Path, h.RepoID
+	exclude := discover.Under(m.scanRoots(), path)
+	m.dropHandles([]string{path})
+	m.cfg.RepoPaths = config.RemovePath(m.cfg.RepoPaths, path)
+	m.cfg.PausedPaths = config.RemovePath(m.cfg.PausedPaths, path)
+	if exclude {
+		m.cfg.ExcludedPaths = config.AddPath(m.cfg.ExcludedPaths, path)
+	}
+	m.repoCursor = min(m.repoCursor, max(0, len(m.handles)-1))
+	m.screen = ScreenRepos
+	return m, m.removeRepo(path, repoID, purge, exclude)
+}
+
+// validateRepoPath resolves user input to an absolute repo path that isn't
+// tracked yet.
+func (m Model) validateRepoPath(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	path, err := filepath.Abs(config.ExpandHome(input))
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+	if _, err := git.OpenRepo(path); err != nil {
+		return "", fmt.Errorf("%s is not a git repository", path)
+	}
+	if _, ok := m.handleIdx[path]; ok {
+		return "", fmt.Errorf("%s is already tracked", path)
+	}
+	return path, nil
+}
+
+func (m Model) addConfiguredRepo(path string) tea.Cmd {
+	return func() tea.Msg {
+		err := config.Update(func(c *config.Config) {
+			c.RepoPaths = config.AddPath(c.RepoPaths, path)
+			c.ExcludedPaths = config.RemovePath(c.ExcludedPaths, path)
+		})
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("save config: %w", err)}
+		}
+		return ReposAddedMsg{Handles: []RepoHandle{m.openHandle(path, true)}}
+	}
+}
+
+func (m *Model) togglePause(h *RepoHandle) tea.Cmd {
+	path := h.Path
+	if h.Paused {
+		h.Paused = false
+		m.cfg.PausedPaths = config.RemovePath(m.cfg.PausedPaths, path)
+		return tea.Batch(m.persistPaused(path, false), m.watchRepos([]RepoHandle{*h}))
+	}
+
+	h.Paused = true
+	m.stopWatch(h)
+	m.cfg.PausedPaths = config.AddPath(m.cfg.PausedPaths, path)
+	return m.persistPaused(path, true)
+}
+
+func (m *Model) toggleActive(h *RepoHandle) tea.Cmd {
+	repoID := h.RepoID
+	if h.Inactive {
+		h.Inactive = false
+		handle := *h
+		return tea.Batch(m.setRepoActive(repoID, true), m.seedRepos([]RepoHandle{handle}), m.watchRepos([]RepoHandle{handle}))
+	}
+
+	h.Inactive = true
+	m.stopWatch(h)
+	return m.setRepoActive(repoID, false)
+}
+
+func (m *Model) stopWatch(h *RepoHandle) {
+	if h.Stop != nil {
+		h.Stop()
+	}
+	h.Stop = nil
+	h.Watching = false
+}
+
+func (m Model) persistPaused(path string, paused bool) tea.Cmd {
+	return func() tea.Msg {
+		err := config.Update(func(c *config.Config) {
+			if paused {
+				c.PausedPaths = config.AddPath(c.PausedPaths, path)
+			} else {
+				c.PausedPaths = config.RemovePath(c.PausedPaths, path)
+			}
+		})
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("save config: %w", err)}
+		}
+		return nil
+	}
+}
+
+func (m Model) setRepoActive(repoID int64, active bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.store.SetRepoActive(repoID, active); err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return RepoUpdatedMsg{}
+	}
+}
+
+func (m Model) removeRepo(path string, repoID int64, purge, exclude bool) tea.Cmd {
+	return func() tea.Msg {
+		err := config.Update(func(c *config.Config) {
+			c.RepoPaths = config.RemovePath(c.RepoPaths, path)
+			c.PausedPaths = config.RemovePath(c.PausedPaths, path)
+			c.PollPaths = config.RemovePath(c.PollPaths, path)
+			if exclude {
+				c.ExcludedPaths = config.AddPath(c.ExcludedPaths, path)
+			}
+			if config.ExpandHome(c.RepoPath) == path {
+				c.RepoPath = ""
+			}
+		})
+		if err != nil {
+			return ErrorMsg{Err: fmt.Errorf("save config: %w", err)}
+		}
+		if repoID != 0 {
+			if err := m.store.DeleteRepo(repoID, purge); err != nil {
+				return ErrorMsg{Err: err}
+			}
+		}
+		return RepoUpdatedMsg{}
+	}
+}
+
+func (m Model) loadRepoStats() tea.Cmd {
+	return func() tea.Msg {
+		stats := make(map[int64]db.Stats, len(m.handles))
+		for _, h := range m.handles {
+			if h.RepoID == 0 {
+				continue
+			}
+			s, err := m.store.GetStats(h.RepoID)
+			if err != nil {
+				return ErrorMsg{Err: err}
+			}
+			stats[h.RepoID] = s
+		}
+		reviewers, err := m.store.GetReviewerStats(m.repoIDs())
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return RepoStatsMsg{Stats: stats, Reviewers: reviewers}
+	}
+}
+
+func (m Model) repoWatchLabel(h RepoHandle) string {
+	switch {
+	case h.Err != nil:
+		return style.Error.Render("error")
+	case h.Inactive:
+		return style.Muted.Render("inactive")
+	case h.Paused:
+		return style.Muted.Render("paused")
+	case h.Health.Down:
+		return style.Error.Render("down")
+	case !h.Watching && h.Mode != watcher.ModeHook:
+		return style.Muted.Render("idle")
+	}
+	return h.Mode.String()
+}
+
+func (m Model) repoHealthLabel(h RepoHandle) string {
+	switch {
+	case h.Err != nil:
+		return h.Err.Error()
+	case h.Health.LastErr != nil:
+		label := h.Health.LastErr.Error()
+		if h.Health.Restarts > 0 {
+			label += fmt.Sprintf(" (%d restarts)", h.Health.Restarts)
+		}
+		return label
+	case h.Health.Restarts > 0:
+		return fmt.Sprintf("ok (%d restarts)", h.Health.Restarts)
+	}
+	return "ok"
+}
+
+func (m Model) repoManagerView() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	b.WriteString(style.DetailLabel.Render(fmt.Sprintf(" Repositories (%d)", len(m.handles))) + "\n\n")
+
+	if len(m.handles) == 0 {
+		b.WriteString(style.Muted.Render("  No repositories tracked") + "\n")
+	}
+
+	nameW := 20
+	for i, h := range m.handles {
+		s := m.repoStats[h.RepoID]
+		counts := fmt.Sprintf("%4d total %4d open", s.Total, s.Unreviewed)
+		line := fmt.Sprintf("%-*s  %-10s  %s  %s",
+			nameW, truncate(h.Name, nameW), m.repoWatchLabel(h), counts,
+			style.Muted.Render(truncate(m.repoHealthLabel(h), 40)))
+		path := style.CardMeta.Render("    " + truncate(h.Path, max(m.width-6, 10)))
+
+		if i == m.repoCursor {
+			b.WriteString(style.Selected.Render("> "+line) + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString(path + "\n")
+	}
+	b.WriteString(m.reviewersView())
+
+	switch m.screen {
+	case ScreenRepoAdd:
+		b.WriteString("\n" + style.DetailLabel.Render(" Add repository: ") + m.repoInput.View() + "\n")
+		b.WriteString(style.Muted.Render(" enter: add  esc: cancel"))
+	case ScreenRepoRemove:
+		if h := m.selectedHandle(); h != nil {
+			b.WriteString("\n" + style.Error.Render(" Remove "+h.Name+"?") + "\n")
+			b.WriteString(style.Muted.Render(" k: keep commits  p: purge commits  esc: cancel"))
+		}
+	}
+	return b.String()
+}
+
+func (m Model) reviewersView() string {
+	if len(m.reviewers) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n" + style.DetailLabel.Render(" Reviewers") + "\n")
+	for _, r := range m.reviewers {
+		name := r.Reviewer
+		if name == "" {
+			name = "(unknown)"
+		}
+		b.WriteString(fmt.Sprintf("  %-32s %4d reviewed %4d ignored\n", truncate(name, 32), r.Reviewed, r.Ignored))
+	}
+	return b.String()
+}
@@ -0,0 +1,376 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/git"
+	"github.com/walter/apollo/internal/watcher"
+)
+
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	out, err := exec.Command("git", "init", dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	return dir
+}
+
+func keyMsg(key string) tea.KeyMsg {
+	if key == "esc" {
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+}
+
+func TestValidateRepoPath(t *testing.T) {
+	m := testModel(t)
+	repo := initGitRepo(t)
+	plain := t.TempDir()
+
+	if _, err := m.validateRepoPath("  "); err == nil {
+		t.Error("empty path should be rejected")
+	}
+	if _, err := m.validateRepoPath(filepath.Join(plain, "missing")); err == nil {
+		t.Error("missing directory should be rejected")
+	}
+	if _, err := m.validateRepoPath(plain); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("plain directory err = %v", err)
+	}
+	path, err := m.validateRepoPath(repo + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != repo {
+		t.Errorf("path = %q, want %q", path, repo)
+	}
+
+	m.handles = []RepoHandle{{Path: repo, Name: "repo"}}
+	m.reindexHandles()
+	if _, err := m.validateRepoPath(repo); err == nil {
+		t.Error("tracked repo should be rejected")
+	}
+}
+
+func TestRepoManagerAdd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := testModel(t)
+	repo := initGitRepo(t)
+
+	m.screen = ScreenRepos
+	result, _ := m.updateRepoKeys(keyMsg("a"))
+	rm := result.(Model)
+	if rm.screen != ScreenRepoAdd {
+		t.Fatalf("screen = %d, want ScreenRepoAdd", rm.screen)
+	}
+
+	rm.repoInput.SetValue(repo)
+	result, cmd := rm.updateRepoAdd(tea.KeyMsg{Type: tea.KeyEnter})
+	rm = result.(Model)
+	if rm.screen != ScreenRepos || cmd == nil {
+		t.Fatalf("screen = %d, cmd = %v", rm.screen, cmd)
+	}
+
+	msg, ok := cmd().(ReposAddedMsg)
+	if !ok || len(msg.Handles) != 1 || msg.Handles[0].RepoID == 0 {
+		t.Fatalf("msg = %+v", msg)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.RepoPaths) != 1 || cfg.RepoPaths[0] != repo {
+		t.Errorf("saved RepoPaths = %v", cfg.RepoPaths)
+	}
+}
+
+func TestRepoManagerPauseAndDeactivate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := testModel(t)
+	seedTestCommits(t, &m, 2)
+	path := m.handles[0].Path
+	m.screen = ScreenRepos
+
+	result, cmd := m.updateRepoKeys(keyMsg("p"))
+	rm := result.(Model)
+	if !rm.handles[0].Paused || !rm.cfg.IsPaused(path) {
+		t.Fatal("p should pause the selected repo")
+	}
+	cmd()
+	if cfg, _ := config.Load(); !cfg.IsPaused(path) {
+		t.Error("pause should be saved to config")
+	}
+
+	result, _ = rm.updateRepoKeys(keyMsg("p"))
+	rm = result.(Model)
+	if rm.handles[0].Paused || rm.cfg.IsPaused(path) {
+		t.Error("second p should resume the repo")
+	}
+
+	result, cmd = rm.updateRepoKeys(keyMsg("d"))
+	rm = result.(Model)
+	if !rm.handles[0].Inactive {
+		t.Fatal("d should deactivate the selected repo")
+	}
+	if _, ok := cmd().(RepoUpdatedMsg); !ok {
+		t.Fatal("deactivate should report RepoUpdatedMsg")
+	}
+	if r, _ := rm.store.GetRepoByPath(path); r == nil || r.Active {
+		t.Error("repo should be inactive in the database")
+	}
+	if ids := rm.repoIDs(); len(ids) != 0 {
+		t.Errorf("repoIDs = %v, inactive repos should be hidden from the board", ids)
+	}
+}
+
+func TestPausedRepoDropsQueuedEvents(t *testing.T) {
+	m := testModel(t)
+	path := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-b", "main", path},
+		{"-C", path, "-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "--allow-empty", "-m", "root"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	repo, err := git.OpenRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoID, _ := m.store.UpsertRepo("test", path)
+	m.handles = []RepoHandle{{Path: path, Name: "test", RepoID: repoID, Repo: repo, Mode: watcher.ModeHook}}
+	m.reindexHandles()
+	ev := watcher.Event{RepoPath: path, Type: watcher.EventChange, Rescan: true}
+
+	for _, tc := range []struct {
+		name             string
+		paused, inactive bool
+		want             int
+	}{
+		{"paused", true, false, 0},
+		{"inactive", false, true, 0},
+		{"watched", false, false, 1},
+	} {
+		m.handles[0].Paused, m.handles[0].Inactive = tc.paused, tc.inactive
+		msg, ok := m.readNewCommitsForRepo(ev)().(NewCommitsMsg)
+		if !ok || len(msg.Commits) != tc.want {
+			t.Errorf("%s: msg = %#v, want %d commits", tc.name, msg, tc.want)
+		}
+	}
+}
+
+func TestRepoManagerRemove(t *testing.T) {
+	for _, tt := range []struct {
+		key   string
+		purge bool
+	}{{"k", false}, {"p", true}} {
+		t.Run(tt.key, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			m := testModel(t)
+			seedTestCommits(t, &m, 2)
+			path := m.handles[0].Path
+			repoID := m.handles[0].RepoID
+			if err := config.Save(config.Config{RepoPaths: []string{path}, PausedPaths: []string{path}}); err != nil {
+				t.Fatal(err)
+			}
+
+			m.screen = ScreenRepos
+			result, _ := m.updateRepoKeys(keyMsg("x"))
+			rm := result.(Model)
+			if rm.screen != ScreenRepoRemove {
+				t.Fatalf("screen = %d, want ScreenRepoRemove", rm.screen)
+			}
+
+			result, cmd := rm.updateRepoRemove(keyMsg(tt.key))
+			rm = result.(Model)
+			if len(rm.handles) != 0 || rm.screen != ScreenRepos {
+				t.Fatalf("handles = %d, screen = %d", len(rm.handles), rm.screen)
+			}
+			if _, ok := cmd().(RepoUpdatedMsg); !ok {
+				t.Fatal("remove should report RepoUpdatedMsg")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.RepoPaths) != 0 || cfg.IsPaused(path) {
+				t.Errorf("config still references repo: %+v", cfg)
+			}
+
+			commits, err := rm.store.QueryCommits(db.CommitQuery{RepoIDs: []int64{repoID}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, _ := rm.store.GetRepoByPath(path)
+			if tt.purge && (r != nil || len(commits) != 0) {
+				t.Errorf("purge left repo=%v commits=%d", r, len(commits))
+			}
+			if !tt.purge && (r == nil || r.Active || len(commits) != 2) {
+				t.Errorf("keep: repo=%+v commits=%d", r, len(commits))
+			}
+		})
+	}
+}
+
+func TestRepoManagerRemoveDiscovered(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := testModel(t)
+	root := t.TempDir()
+	path := filepath.Join(root, "a")
+	if out, err := exec.Command("git", "init", path).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	m.cfg.ScanRoots = []config.ScanRoot{{Path: root, MaxDepth: 1}}
+	if err := config.Save(config.Config{ScanRoots: m.cfg.ScanRoots}); err != nil {
+		t.Fatal(err)
+	}
+	h := m.openHandle(path, true)
+	h.Discovered = true
+	m.handles = []RepoHandle{h}
+	m.reindexHandles()
+
+	m.screen = ScreenRepoRemove
+	result, cmd := m.updateRepoRemove(keyMsg("k"))
+	m = result.(Model)
+	if _, ok := cmd().(RepoUpdatedMsg); !ok {
+		t.Fatal("remove should report RepoUpdatedMsg")
+	}
+	if cfg, _ := config.Load(); !cfg.IsExcluded(path) {
+		t.Errorf("excluded = %v, want the removed repo", cfg.ExcludedPaths)
+	}
+	if added, _ := m.diffDiscovered([]string{path}); len(added) != 0 {
+		t.Errorf("discovery added %v back", added)
+	}
+	start, ok := m.initRepos()().(ReposInitializedMsg)
+	if !ok {
+		t.Fatal("initRepos failed")
+	}
+	for _, h := range start.Handles {
+		if h.Path == path {
+			t.Error("the removed repo came back on restart")
+		}
+	}
+
+	if _, ok := m.addConfiguredRepo(path)().(ReposAddedMsg); !ok {
+		t.Fatal("adding the repo back by hand should work")
+	}
+	if cfg, _ := config.Load(); cfg.IsExcluded(path) {
+		t.Error("adding the repo back should lift the exclusion")
+	}
+}
+
+func TestRepoManagerRemoveCancel(t *testing.T) {
+	m := testModel(t)
+	seedTestCommits(t, &m, 1)
+	m.screen = ScreenRepoRemove
+
+	result, cmd := m.updateRepoRemove(keyMsg("esc"))
+	rm := result.(Model)
+	if cmd != nil || rm.screen != ScreenRepos || len(rm.handles) != 1 {
+		t.Error("esc should cancel removal")
+	}
+}
+
+func TestRelocatedRepoRebind(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := testModel(t)
+	m.screen = ScreenBoard
+	parent := t.TempDir()
+	oldPath := filepath.Join(parent, "before")
+	newPath := filepath.Join(parent, "after")
+	for _, args := range [][]string{
+		{"init", "-b", "main", oldPath},
+		{"-C", oldPath, "-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "--allow-empty", "-m", "root"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	before := m.openHandle(oldPath, true)
+	if before.Err != nil || before.Relocated != nil {
+		t.Fatalf("first open = %+v", before)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	after := m.openHandle(newPath, true)
+	if after.Relocated == nil || after.Relocated.ID != before.RepoID {
+		t.Fatalf("moved checkout not matched: %+v", after.Relocated)
+	}
+
+	m.handles = []RepoHandle{{Path: oldPath, Name: "before", Err: os.ErrNotExist}}
+	m.reindexHandles()
+	result, _ := m.Update(ReposAddedMsg{Handles: []RepoHandle{after}})
+	m = result.(Model)
+	if m.screen != ScreenRebind {
+		t.Fatalf("screen = %v, want rebind prompt", m.screen)
+	}
+	result, cmd := m.Update(keyMsg("y"))
+	m = result.(Model)
+	if m.screen != ScreenBoard || cmd == nil {
+		t.Fatal("y should rebind and close the prompt")
+	}
+	msg, ok := cmd().(RepoReboundMsg)
+	if !ok {
+		t.Fatalf("rebind = %#v", msg)
+	}
+	result, _ = m.Update(msg)
+	m = result.(Model)
+
+	if len(m.handles) != 1 || m.handles[0].Path != newPath || m.handles[0].RepoID != before.RepoID {
+		t.Errorf("handles = %+v", m.handles)
+	}
+	if r, _ := m.store.GetRepoByPath(newPath); r == nil || r.ID != before.RepoID {
+		t.Errorf("repo at new path = %+v", r)
+	}
+}
+
+func TestOpenExistingReposOnSQLite(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m, _ := sqliteTestModel(t)
+	var paths []string
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(t.TempDir(), name)
+		for _, args := range [][]string{
+			{"init", "-b", "main", path},
+			{"-C", path, "-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "--allow-empty", "-m", "root " + name},
+		} {
+			if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	// Both repos were tracked before identities were recorded, so opening
+	// each one inserts identity rows between the upserts.
+	var ids []int64
+	for _, path := range paths {
+		id, err := m.store.UpsertRepo(filepath.Base(path), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i, path := range paths {
+		h := m.openHandle(path, true)
+		if h.Err != nil || h.RepoID != ids[i] {
+			t.Fatalf("open %s = id %d, %v; want id %d", path, h.RepoID, h.Err, ids[i])
+		}
+		if has, _ := m.store.HasRepoIdentity(ids[i]); !has {
+			t.Errorf("no identity recorded for %s", path)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/walter/apollo/internal/db"
+	"github.com/walter/apollo/internal/style"
+)
+
+// searchLimit caps how many matches the board shows for a query.
+const searchLimit = 1000
+
+type commitKey struct {
+	repoID int64
+	hash   string
+}
+
+func (m Model) runSearch(query string) tea.Cmd {
+	ids := m.repoIDs()
+	return func() tea.Msg {
+		results, err := m.store.SearchCommits(ids, query, searchLimit)
+		if err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return SearchResultsMsg{Query: query, Results: results}
+	}
+}
+
+// updateSearch filters the board as the query is typed. Enter keeps the
+// filter and returns to the board; esc drops it.
+func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.searchInput.Blur()
+		m.screen = ScreenBoard
+		return m, nil
+	case "esc":
+		m.searchInput.Blur()
+		m.clearSearch()
+		m.screen = ScreenBoard
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.searchInput, cmd = m.searchInput.Update(msg)
+	query := strings.TrimSpace(m.searchInput.Value())
+	if query == m.search {
+		return m, cmd
+	}
+	m.search = query
+	for i := range m.columns {
+		m.columns[i].Cursor, m.columns[i].Scroll = 0, 0
+	}
+	if query == "" {
+		m.clearSearch()
+		return m, cmd
+	}
+	return m, tea.Batch(cmd, m.runSearch(query))
+}
+
+func (m *Model) setSearchResults(results []db.SearchResult) {
+	m.searchResults = results
+	m.searchIdx = make(map[commitKey]int, len(results))
+	for i, r := range results {
+		m.searchIdx[commitKey{r.RepoID, r.Hash}] = i
+	}
+	m.refreshColumns()
+}
+
+func (m *Model) clearSearch() {
+	m.search = ""
+	m.searchResults, m.searchIdx = nil, nil
+	m.searchInput.SetValue("")
+	m.refreshColumns()
+}
+
+// searchMatch returns how c matched the active search, if it did.
+func (m Model) searchMatch(c db.CommitRow) *db.SearchResult {
+	if i, ok := m.searchIdx[commitKey{c.RepoID, c.Hash}]; ok {
+		return &m.searchResults[i]
+	}
+	return nil
+}
+
+func (m Model) searchStatus() string {
+	if m.screen == ScreenSearch {
+		return " " + m.searchInput.View()
+	}
+	return " " + style.HelpKey.Render("/") + " " + m.search
+}
+
+// highlightMatches renders text carrying db.MatchStart/MatchEnd markers,
+// styling matched runs and truncating to width like truncate does.
+func highlightMatches(marked string, width int, base lipgloss.Style) string {
+	if width <= 0 {
+		return ""
+	}
+	plain := strings.NewReplacer(db.MatchStart, "", db.MatchEnd, "").Replace(marked)
+	limit := len(plain)
+	cut := limit > width
+	if cut {
+		limit = width
+		if width > 3 {
+			limit--
+		}
+	}
+
+	var b, seg strings.Builder
+	matched := false
+	flush := func() {
+		if seg.Len() == 0 {
+			return
+		}
+		if matched {
+			b.WriteString(style.Match.Render(seg.String()))
+		} else {
+			b.WriteString(base.Render(seg.String()))
+		}
+		seg.Reset()
+	}
+	n := 0
+	for i := 0; i < len(marked) && n < limit; i++ {
+		switch marked[i] {
+		case db.MatchStart[0]:
+			flush()
+			matched = true
+		case db.MatchEnd[0]:
+			flush()
+			matched = false
+		default:
+			seg.WriteByte(marked[i])
+			n++
+		}
+	}
+	flush()
+	if cut && width > 3 {
+		b.WriteString(base.Render("…"))
+	}
+	return b.String()
+}
@@ -6,16 +6,23 @@ import (
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/walter/apollo/internal/style"
+	"github.com/walter/apollo/internal/watcher"
 )
 
 func (m Model) statusBar() string {
 	var left string
-	if m.copiedHash != "" {
+	switch {
+	case m.screen == ScreenSearch || m.search != "":
+		left = m.searchStatus() + fmt.Sprintf("  %d matches", len(m.searchResults))
+	case m.copiedHash != "":
 		left = fmt.Sprintf(" Copied %s", m.copiedHash)
-	} else {
+	default:
 		left = fmt.Sprintf(" %d needs review · %d reviewed · %d ignored",
 			m.stats.Unreviewed, m.stats.Reviewed, m.stats.Ignored)
 	}
+	if m.labelFilter != 0 {
+		left += " · label: " + m.labelFilterName()
+	}
 
 	watcherStatus := m.watcherStatusText()
 	left = left + "  " + watcherStatus
@@ -30,26 +37,50 @@ func (m Model) watcherStatusText() string {
 	total := 0
 	active := 0
 	errored := 0
+	var polling, hooked []string
 	for _, h := range m.handles {
 		total++
-		if h.Err != nil {
+		if h.Err != nil || h.Health.Down {
 			errored++
-		} else if h.WatchCh != nil {
+			continue
+		}
+		switch {
+		case h.Mode == watcher.ModeHook:
 			active++
+			hooked = append(hooked, h.Name)
+		case h.Watching:
+			active++
+			if h.Mode == watcher.ModePoll {
+				polling = append(polling, h.Name)
+			}
 		}
 	}
 
 	if total == 1 {
 		if active == 1 {
+			switch {
+			case len(polling) == 1:
+				return style.Muted.Render("polling")
+			case len(hooked) == 1:
+				return style.Muted.Render("hooks")
+			}
 			return style.Muted.Render("watching")
 		}
 		return style.Error.Render("not watching")
 	}
 
+	note := ""
+	if len(polling) > 0 {
+		note += " · polling " + strings.Join(polling, ", ")
+	}
+	if len(hooked) > 0 {
+		note += " · hooks " + strings.Join(hooked, ", ")
+	}
+
 	if errored > 0 {
-		return style.Error.Render(fmt.Sprintf("watching %d/%d repos (%d errors)", active, total, errored))
+		return style.Error.Render(fmt.Sprintf("watching %d/%d repos (%d errors)%s", active, total, errored, note))
 	}
-	return style.Muted.Render(fmt.Sprintf("watching %d repos", active))
+	return style.Muted.Render(fmt.Sprintf("watching %d repos%s", active, note))
 }
 
 func (m Model) helpBar() string {
@@ -62,8 +93,69 @@ func (m Model) helpBar() string {
 		{"u", "unreviewed"},
 		{"i", "ignored"},
 		{"n", "note"},
+		{"/", "search"},
+		{"t", "labels"},
+		{"m", "repos"},
+		{"P", "profiles"},
 		{"q", "quit"},
 	}
+	if m.expandedHash != "" && m.screen == ScreenBoard {
+		keys = append(keys[:len(keys)-1],
+			struct{ key, desc string }{"[/]", "history"},
+			struct{ key, desc string }{"z", "undo"},
+			keys[len(keys)-1])
+	}
+	if m.search != "" && m.expandedHash == "" && m.screen == ScreenBoard {
+		keys = append(keys[:len(keys)-1],
+			struct{ key, desc string }{"esc", "clear search"},
+			keys[len(keys)-1])
+	} else if m.labelFilter != 0 && m.expandedHash == "" && m.screen == ScreenBoard {
+		keys = append(keys[:len(keys)-1],
+			struct{ key, desc string }{"esc", "clear label filter"},
+			keys[len(keys)-1])
+	}
+	if m.screen == ScreenLabels {
+		keys = []struct{ key, desc string }{
+			{"j/k", "labels"},
+			{"space", "toggle on card"},
+			{"a", "new label"},
+			{"f", "filter board"},
+			{"esc", "board"},
+			{"q", "quit"},
+		}
+	}
+	if m.screen == ScreenRebind {
+		keys = []struct{ key, desc string }{
+			{"y", "rebind"},
+			{"n", "track as new"},
+		}
+	}
+	if m.screen == ScreenProfiles {
+		keys = []struct{ key, desc string }{
+			{"j/k", "profiles"},
+			{"enter", "switch"},
+			{"a", "new profile"},
+			{"esc", "board"},
+			{"q", "quit"},
+		}
+	}
+	if m.screen == ScreenSearch {
+		keys = []struct{ key, desc string }{
+			{"enter", "keep filter"},
+			{"esc", "clear"},
+		}
+	}
+	if m.screen == ScreenRepos {
+		keys = []struct{ key, desc string }{
+			{"j/k", "repos"},
+			{"a", "add"},
+			{"p", "pause/resume"},
+			{"d", "deactivate/activate"},
+			{"x", "remove"},
+			{"esc", "board"},
+			{"q", "quit"},
+		}
+	}
 
 	var parts []string
 	for _, k := range keys {
@@ -87,8 +179,26 @@ func (m Model) noteInputView() string {
 }
 
 func (m Model) errorView() string {
-	if m.err == nil {
+	if m.err != nil {
+		return style.Error.Render(" Error: " + m.err.Error())
+	}
+	return m.healthView()
+}
+
+func (m Model) healthView() string {
+	var parts []string
+	for _, h := range m.handles {
+		if h.Health.LastErr == nil {
+			continue
+		}
+		part := h.Name + ": " + h.Health.LastErr.Error()
+		if h.Health.Restarts > 0 {
+			part += fmt.Sprintf(" (%d restarts)", h.Health.Restarts)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
 		return ""
 	}
-	return style.Error.Render(" Error: " + m.err.Error())
+	return style.Error.Render(" " + truncate(strings.Join(parts, " · "), max(m.width-2, 10)))
 }
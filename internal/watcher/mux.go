@@ -2,17 +2,29 @@ package watcher
 
 import "sync"
 
+// Mux fans in events from many sources. Change events are coalesced into a
+// per-repo dirty set so a busy consumer never causes a change to be lost;
+// everything else (errors, restarts) is delivered in order.
 type Mux struct {
+	q *queue
+
 	out  chan Event
 	done chan struct{}
 	wg   sync.WaitGroup
 }
 
 func NewMux() *Mux {
-	return &Mux{
-		out:  make(chan Event, 4),
+	m := &Mux{
+		q:    newQueue(),
+		out:  make(chan Event),
 		done: make(chan struct{}),
 	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.q.drain(m.out, m.done)
+	}()
+	return m
 }
 
 func (m *Mux) Add(ch <-chan Event) {
@@ -27,11 +39,7 @@ func (m *Mux) Add(ch <-chan Event) {
 				if !ok {
 					return
 				}
-				select {
-				case m.out <- ev:
-				case <-m.done:
-					return
-				}
+				m.q.push(ev)
 			}
 		}
 	}()
@@ -46,3 +54,139 @@ func (m *Mux) Close() {
 	m.wg.Wait()
 	close(m.out)
 }
+
+// Pending reports how many events are waiting for the consumer.
+func (m *Mux) Pending() int {
+	return m.q.len()
+}
+
+// queue holds events until the consumer takes them: non-change events in
+// FIFO order ahead of one merged change event per dirty repo.
+type queue struct {
+	mu     sync.Mutex
+	events []Event
+	dirty  map[string]*Event
+	order  []string
+	notify chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		dirty:  make(map[string]*Event),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events) + len(q.order)
+}
+
+func (q *queue) push(ev Event) {
+	q.mu.Lock()
+	if ev.Type != EventChange {
+		q.events = append(q.events, ev)
+	} else if cur, ok := q.dirty[ev.RepoPath]; ok {
+		cur.Changes = mergeChanges(cur.Changes, ev.Changes)
+		cur.Rewrites = append(cur.Rewrites, ev.Rewrites...)
+		cur.Rescan = cur.Rescan || ev.Rescan
+	} else {
+		q.dirty[ev.RepoPath] = &ev
+		q.order = append(q.order, ev.RepoPath)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) pop() (Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) > 0 {
+		ev := q.events[0]
+		q.events = q.events[1:]
+		return ev, true
+	}
+	if len(q.order) > 0 {
+		path := q.order[0]
+		q.order = q.order[1:]
+		ev := q.dirty[path]
+		delete(q.dirty, path)
+		return *ev, true
+	}
+	return Event{}, false
+}
+
+// drain delivers queued events to out until done is closed.
+func (q *queue) drain(out chan<- Event, done <-chan struct{}) {
+	for {
+		ev, ok := q.pop()
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-done:
+				return
+			}
+		}
+		select {
+		case out <- ev:
+		case <-done:
+			return
+		}
+	}
+}
+
+// mergeChanges folds later ref changes into earlier ones so the result
+// describes the net movement of each ref across both batches.
+func mergeChanges(prev, next []RefChange) []RefChange {
+	if len(next) == 0 {
+		return prev
+	}
+	byRef := make(map[string]int, len(prev))
+	merged := append([]RefChange(nil), prev...)
+	for i, c := range merged {
+		byRef[c.Ref] = i
+	}
+
+	for _, c := range next {
+		i, ok := byRef[c.Ref]
+		if !ok {
+			byRef[c.Ref] = len(merged)
+			merged = append(merged, c)
+			continue
+		}
+		merged[i] = combineChange(merged[i], c)
+	}
+
+	result := merged[:0]
+	for _, c := range merged {
+		if c.Kind == RefCreated && c.New == "" {
+			continue
+		}
+		if c.Kind != RefCreated && c.Kind != RefDeleted && c.Old == c.New {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+func combineChange(first, second RefChange) RefChange {
+	c := RefChange{Ref: first.Ref, Old: first.Old, New: second.New}
+	switch {
+	case first.Kind == RefCreated:
+		c.Kind = RefCreated
+	case second.Kind == RefDeleted:
+		c.Kind = RefDeleted
+	case first.Kind == RefDeleted || first.Kind == RefForceUpdate || second.Kind == RefForceUpdate || second.Kind == RefCreated:
+		c.Kind = RefForceUpdate
+	default:
+		c.Kind = RefFastForward
+	}
+	return c
+}
@@ -61,3 +61,122 @@ func TestMuxClosedSource(t *testing.T) {
 		t.Error("events channel should be closed")
 	}
 }
+
+func TestMuxCoalescesPerRepo(t *testing.T) {
+	m := NewMux()
+	defer m.Close()
+
+	ch := make(chan Event)
+	m.Add(ch)
+
+	ch <- Event{RepoPath: "/a", Changes: []RefChange{{Ref: "refs/heads/main", Old: "1", New: "2", Kind: RefFastForward}}}
+	ch <- Event{RepoPath: "/b"}
+	ch <- Event{RepoPath: "/a", Changes: []RefChange{{Ref: "refs/heads/main", Old: "2", New: "3", Kind: RefFastForward}}}
+	ch <- Event{RepoPath: "/a", Changes: []RefChange{{Ref: "refs/heads/x", New: "9", Kind: RefCreated}}}
+	ch <- Event{RepoPath: "/c"}
+
+	deadline := time.After(time.Second)
+	var aEvents []Event
+	var net []RefChange
+	for seen := map[string]bool{}; !seen["/b"] || !seen["/c"]; {
+		select {
+		case ev := <-m.Events():
+			seen[ev.RepoPath] = true
+			if ev.RepoPath == "/a" {
+				aEvents = append(aEvents, ev)
+				net = mergeChanges(net, ev.Changes)
+			}
+		case <-deadline:
+			t.Fatal("timeout")
+		}
+	}
+
+	// At most one /a event can be in flight before the rest collapse.
+	if len(aEvents) > 2 {
+		t.Errorf("got %d events for /a, want at most 2", len(aEvents))
+	}
+	want := []RefChange{
+		{Ref: "refs/heads/main", Old: "1", New: "3", Kind: RefFastForward},
+		{Ref: "refs/heads/x", New: "9", Kind: RefCreated},
+	}
+	if len(net) != len(want) || net[0] != want[0] || net[1] != want[1] {
+		t.Errorf("net changes = %+v, want %+v", net, want)
+	}
+	if m.Pending() != 0 {
+		t.Errorf("pending = %d, want 0", m.Pending())
+	}
+}
+
+func TestMuxKeepsNonChangeOrder(t *testing.T) {
+	m := NewMux()
+	defer m.Close()
+
+	ch := make(chan Event)
+	m.Add(ch)
+	ch <- Event{RepoPath: "/a", Type: EventStopped}
+	ch <- Event{RepoPath: "/a", Type: EventError}
+	ch <- Event{RepoPath: "/a", Type: EventRestarted}
+
+	for _, want := range []EventType{EventStopped, EventError, EventRestarted} {
+		select {
+		case ev := <-m.Events():
+			if ev.Type != want {
+				t.Fatalf("type = %d, want %d", ev.Type, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestMergeChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		prev []RefChange
+		next []RefChange
+		want []RefChange
+	}{
+		{
+			name: "created then deleted vanishes",
+			prev: []RefChange{{Ref: "r", New: "1", Kind: RefCreated}},
+			next: []RefChange{{Ref: "r", Old: "1", Kind: RefDeleted}},
+			want: nil,
+		},
+		{
+			name: "created then advanced stays created",
+			prev: []RefChange{{Ref: "r", New: "1", Kind: RefCreated}},
+			next: []RefChange{{Ref: "r", Old: "1", New: "2", Kind: RefFastForward}},
+			want: []RefChange{{Ref: "r", New: "2", Kind: RefCreated}},
+		},
+		{
+			name: "force anywhere is force",
+			prev: []RefChange{{Ref: "r", Old: "1", New: "2", Kind: RefForceUpdate}},
+			next: []RefChange{{Ref: "r", Old: "2", New: "3", Kind: RefFastForward}},
+			want: []RefChange{{Ref: "r", Old: "1", New: "3", Kind: RefForceUpdate}},
+		},
+		{
+			name: "deleted and recreated at same tip vanishes",
+			prev: []RefChange{{Ref: "r", Old: "1", Kind: RefDeleted}},
+			next: []RefChange{{Ref: "r", New: "1", Kind: RefCreated}},
+			want: nil,
+		},
+		{
+			name: "advanced then deleted is deleted",
+			prev: []RefChange{{Ref: "r", Old: "1", New: "2", Kind: RefFastForward}},
+			next: []RefChange{{Ref: "r", Old: "2", Kind: RefDeleted}},
+			want: []RefChange{{Ref: "r", Old: "1", Kind: RefDeleted}},
+		},
+	}
+	for _, tt := range tests {
+		got := mergeChanges(tt.prev, tt.next)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %+v, want %+v", tt.name, got[i], tt.want[i])
+			}
+		}
+	}
+}
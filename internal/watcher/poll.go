@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Poll is the fallback for filesystems where fsnotify is unavailable or the
+// inotify limits are exhausted. It compares ref tips every interval and
+// emits on the same Event contract as Watch, including holding a pending
+// change until the consumer takes it.
+func Poll(repoPath string, interval time.Duration) (<-chan Event, func(), error) {
+	gitDir := filepath.Join(repoPath, ".git")
+	last, err := readRefTips(gitDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan Event)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastErr error
+		var out chan<- Event
+		var pending Event
+		var pendingTips map[string]string
+
+		for {
+			select {
+			case <-done:
+				return
+			case out <- pending:
+				last = pendingTips
+				out = nil
+			case <-ticker.C:
+				tips, err := readRefTips(gitDir)
+				if err != nil {
+					if lastErr == nil || lastErr.Error() != err.Error() {
+						lastErr = err
+						select {
+						case ch <- Event{RepoPath: repoPath, Type: EventError, Err: err}:
+						case <-done:
+							return
+						}
+					}
+					continue
+				}
+				lastErr = nil
+				if sameTips(last, tips) {
+					continue
+				}
+				changes := diffTips(repoPath, last, tips)
+				pending = Event{RepoPath: repoPath, Changes: changes, Rescan: len(changes) == 0}
+				pendingTips = tips
+				out = ch
+			}
+		}
+	}()
+
+	cleanup := func() {
+		close(done)
+	}
+
+	return ch, cleanup, nil
+}
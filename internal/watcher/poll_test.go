@@ -0,0 +1,99 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollDetectsRefChange(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Poll(dir, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	nested := filepath.Join(dir, ".git", "refs", "heads", "feature")
+	os.MkdirAll(nested, 0755)
+	os.WriteFile(filepath.Join(nested, "foo"), []byte(strings.Repeat("a", 40)+"\n"), 0644)
+
+	ev := waitEvent(t, ch)
+	if ev.RepoPath != dir {
+		t.Errorf("path = %q, want %q", ev.RepoPath, dir)
+	}
+}
+
+func TestPollDetectsPackedRefs(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Poll(dir, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(dir, ".git", "packed-refs"), []byte("# pack-refs with: peeled\nabc123 refs/heads/main\n"), 0644)
+	waitEvent(t, ch)
+}
+
+func TestPollQuietWithoutChanges(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Poll(dir, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected event without ref changes")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestPollNotARepo(t *testing.T) {
+	if _, _, err := Poll(t.TempDir(), time.Second); err == nil {
+		t.Fatal("expected error for non-repo dir")
+	}
+}
+
+func TestReadRefTipsLoosePrecedence(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	gitDir := filepath.Join(dir, ".git")
+	aaa, bbb, ccc, ddd := strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40), strings.Repeat("d", 40)
+	os.WriteFile(filepath.Join(gitDir, "packed-refs"), []byte(aaa+" refs/heads/main\n"+bbb+" refs/tags/v1\n^"+ccc+"\n"), 0644)
+	os.WriteFile(filepath.Join(gitDir, "refs", "heads", "main"), []byte(ddd+"\n"), 0644)
+
+	tips, err := readRefTips(gitDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tips["refs/heads/main"] != ddd {
+		t.Errorf("main = %q, want %s", tips["refs/heads/main"], ddd)
+	}
+	if tips["refs/tags/v1"] != bbb {
+		t.Errorf("v1 = %q, want %s", tips["refs/tags/v1"], bbb)
+	}
+}
+
+func TestReadRefTipsSkipsSymbolicRefs(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	gitDir := filepath.Join(dir, ".git")
+	remote := filepath.Join(gitDir, "refs", "remotes", "origin")
+	os.MkdirAll(remote, 0755)
+	os.WriteFile(filepath.Join(remote, "main"), []byte(strings.Repeat("a", 40)+"\n"), 0644)
+	os.WriteFile(filepath.Join(remote, "HEAD"), []byte("ref: refs/remotes/origin/main\n"), 0644)
+
+	tips, err := readRefTips(gitDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tips["refs/remotes/origin/HEAD"]; ok {
+		t.Errorf("symbolic ref listed as %q", tips["refs/remotes/origin/HEAD"])
+	}
+	if tips["refs/remotes/origin/main"] == "" {
+		t.Error("the ref it points at is missing")
+	}
+}
@@ -0,0 +1,216 @@
+package watcher
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/walter/apollo/internal/git"
+)
+
+type ChangeKind int
+
+const (
+	RefCreated ChangeKind = iota
+	RefDeleted
+	RefFastForward
+	RefForceUpdate
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case RefCreated:
+		return "created"
+	case RefDeleted:
+		return "deleted"
+	case RefFastForward:
+		return "fast-forward"
+	case RefForceUpdate:
+		return "force-update"
+	default:
+		return "unknown"
+	}
+}
+
+type RefChange struct {
+	Ref  string
+	Old  string
+	New  string
+	Kind ChangeKind
+}
+
+// Rewrite maps a commit to its replacement after an amend or rebase.
+type Rewrite struct {
+	Old string
+	New string
+}
+
+// readRefTips returns every ref name in gitDir mapped to the hash it points
+// at. Loose refs take precedence over packed-refs, matching git's own
+// lookup order. Symbolic refs such as refs/remotes/origin/HEAD are skipped:
+// the ref they point at is listed in its own right. HEAD is included
+// verbatim so a checkout registers as a change.
+func readRefTips(gitDir string) (map[string]string, error) {
+	tips := make(map[string]string)
+
+	if err := readPackedRefs(filepath.Join(gitDir, "packed-refs"), tips); err != nil {
+		return nil, err
+	}
+
+	refsPath := filepath.Join(gitDir, "refs")
+	err := filepath.WalkDir(refsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(gitDir, path)
+		if err != nil {
+			return err
+		}
+		if tip := strings.TrimSpace(string(data)); isHash(tip) {
+			tips[filepath.ToSlash(rel)] = tip
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	tips["HEAD"] = strings.TrimSpace(string(head))
+
+	return tips, nil
+}
+
+func readPackedRefs(path string, tips map[string]string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		tips[name] = hash
+	}
+	return sc.Err()
+}
+
+// isHash reports whether s is a full SHA-1 or SHA-256 object name.
+func isHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTips(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// diffTips compares two ref snapshots. HEAD is skipped because it is
+// symbolic; the branch it points at shows up as its own change.
+func diffTips(repoPath string, prev, cur map[string]string) []RefChange {
+	var changes []RefChange
+	c := newClassifier(repoPath)
+
+	for ref, newHash := range cur {
+		if ref == "HEAD" {
+			continue
+		}
+		if oldHash := prev[ref]; oldHash != newHash {
+			changes = append(changes, c.classify(ref, oldHash, newHash))
+		}
+	}
+	for ref, oldHash := range prev {
+		if ref == "HEAD" {
+			continue
+		}
+		if _, ok := cur[ref]; !ok {
+			changes = append(changes, RefChange{Ref: ref, Old: oldHash, Kind: RefDeleted})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Ref < changes[j].Ref })
+	return changes
+}
+
+// Classify describes a single ref update. An empty old or new hash means the
+// ref was created or deleted.
+func Classify(repoPath, ref, oldHash, newHash string) RefChange {
+	return newClassifier(repoPath).classify(ref, oldHash, newHash)
+}
+
+type classifier struct {
+	path string
+	repo *git.Repo
+}
+
+func newClassifier(repoPath string) *classifier {
+	return &classifier{path: repoPath}
+}
+
+func (c *classifier) classify(ref, oldHash, newHash string) RefChange {
+	change := RefChange{Ref: ref, Old: oldHash, New: newHash}
+	switch {
+	case oldHash == "":
+		change.Kind = RefCreated
+		return change
+	case newHash == "":
+		change.Kind = RefDeleted
+		return change
+	}
+
+	if c.repo == nil {
+		c.repo, _ = git.OpenRepo(c.path)
+	}
+	change.Kind = RefForceUpdate
+	if c.repo != nil {
+		if ff, err := c.repo.IsAncestor(oldHash, newHash); err == nil && ff {
+			change.Kind = RefFastForward
+		}
+	}
+	return change
+}
@@ -0,0 +1,297 @@
+package watcher
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Shared watches any number of repos through one fsnotify instance. Events
+// are routed to the repo whose git dir prefixes the event path, and every
+// repo keeps its own debounce burst. Two goroutines serve all repos, so file
+// descriptors and inotify instances stay flat as repos are added.
+//
+// A repo whose git dir disappears is reported as stopped and re-armed with
+// exponential backoff; the restart diffs against the tips last reported, so
+// nothing that moved while it was down is lost.
+type Shared struct {
+	opts    Options
+	backoff Backoff
+	w       *fsnotify.Watcher
+	q       *queue
+
+	mu    sync.Mutex
+	repos map[string]*sharedRepo // keyed by git dir
+	timed map[*sharedRepo]struct{}
+
+	out  chan Event
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type sharedRepo struct {
+	*repoState
+	dirs     map[string]bool
+	deadline time.Time
+	down     bool
+	delay    time.Duration
+	restarts int
+}
+
+func NewShared(opts Options, b Backoff) (*Shared, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	s := &Shared{
+		opts:    opts,
+		backoff: b,
+		w:       w,
+		q:       newQueue(),
+		repos:   make(map[string]*sharedRepo),
+		timed:   make(map[*sharedRepo]struct{}),
+		out:     make(chan Event),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(2)
+	go s.run()
+	go func() {
+		defer s.wg.Done()
+		s.q.drain(s.out, s.done)
+	}()
+	return s, nil
+}
+
+// Add starts watching repoPath. Adding a repo twice is a no-op.
+func (s *Shared) Add(repoPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &sharedRepo{repoState: newRepoState(repoPath), dirs: make(map[string]bool)}
+	if _, ok := s.repos[r.gitDir]; ok {
+		return nil
+	}
+	if err := r.start(s.adder(r)); err != nil {
+		s.unwatch(r)
+		return err
+	}
+	s.repos[r.gitDir] = r
+	return nil
+}
+
+// Remove stops watching repoPath. Events already queued are still delivered.
+func (s *Shared) Remove(repoPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gitDir := filepath.Join(repoPath, ".git")
+	r, ok := s.repos[gitDir]
+	if !ok {
+		return
+	}
+	s.unwatch(r)
+	delete(s.repos, gitDir)
+	delete(s.timed, r)
+}
+
+// Len reports how many repos are being watched.
+func (s *Shared) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.repos)
+}
+
+func (s *Shared) Events() <-chan Event {
+	return s.out
+}
+
+func (s *Shared) Close() {
+	close(s.done)
+	s.w.Close()
+	s.wg.Wait()
+	close(s.out)
+}
+
+func (s *Shared) run() {
+	defer s.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		next := s.fireDue(time.Now())
+		s.mu.Unlock()
+
+		timer.Stop()
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-timer.C:
+		case ev, ok := <-s.w.Events:
+			if !ok {
+				s.stopAll()
+				return
+			}
+			s.mu.Lock()
+			s.handle(ev, time.Now())
+			s.mu.Unlock()
+		case err, ok := <-s.w.Errors:
+			if !ok {
+				s.stopAll()
+				return
+			}
+			s.mu.Lock()
+			s.handleError(err, time.Now())
+			s.mu.Unlock()
+		}
+	}
+}
+
+// route finds the repo owning name by walking up to the nearest git dir.
+func (s *Shared) route(name string) *sharedRepo {
+	for dir := name; ; {
+		if r, ok := s.repos[dir]; ok {
+			return r
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+func (s *Shared) handle(ev fsnotify.Event, now time.Time) {
+	r := s.route(ev.Name)
+	if r == nil || r.down {
+		return
+	}
+	changed, err := r.handle(ev, s.adder(r))
+	if err != nil {
+		s.fail(r, err, now)
+		return
+	}
+	if changed {
+		s.schedule(r, now, r.arm(now, s.opts))
+	}
+}
+
+// handleError treats a queue overflow as "anything may have moved" and diffs
+// every repo; other errors can't be attributed to one repo, so all hear them.
+func (s *Shared) handleError(err error, now time.Time) {
+	if errors.Is(err, fsnotify.ErrEventOverflow) {
+		for _, r := range s.repos {
+			if !r.down {
+				s.schedule(r, now, 0)
+			}
+		}
+		return
+	}
+	for _, r := range s.repos {
+		s.q.push(Event{RepoPath: r.path, Type: EventError, Err: err})
+	}
+}
+
+// fireDue fires every repo whose deadline has passed and returns the next
+// deadline, or zero if nothing is scheduled.
+func (s *Shared) fireDue(now time.Time) time.Time {
+	var due []*sharedRepo
+	for r := range s.timed {
+		if !r.deadline.After(now) {
+			due = append(due, r)
+		}
+	}
+	for _, r := range due {
+		delete(s.timed, r)
+		if r.down {
+			s.retry(r, now)
+			continue
+		}
+		ev, tips := r.fire()
+		s.q.push(ev)
+		if tips != nil {
+			r.last = tips
+		}
+	}
+
+	var next time.Time
+	for r := range s.timed {
+		if next.IsZero() || r.deadline.Before(next) {
+			next = r.deadline
+		}
+	}
+	return next
+}
+
+func (s *Shared) schedule(r *sharedRepo, now time.Time, wait time.Duration) {
+	r.deadline = now.Add(wait)
+	s.timed[r] = struct{}{}
+}
+
+func (s *Shared) fail(r *sharedRepo, err error, now time.Time) {
+	s.unwatch(r)
+	r.down = true
+	r.burstStart = time.Time{}
+	if r.delay == 0 {
+		r.delay = s.backoff.Min
+	}
+	s.q.push(Event{RepoPath: r.path, Type: EventStopped, Err: err})
+	s.schedule(r, now, r.delay)
+}
+
+func (s *Shared) retry(r *sharedRepo, now time.Time) {
+	last := r.last
+	if err := r.start(s.adder(r)); err != nil {
+		s.unwatch(r)
+		s.q.push(Event{RepoPath: r.path, Type: EventError, Err: err})
+		r.delay = min(r.delay*2, s.backoff.Max)
+		s.schedule(r, now, r.delay)
+		return
+	}
+	r.last = last
+	r.down = false
+	r.delay = 0
+	r.restarts++
+	s.q.push(Event{RepoPath: r.path, Type: EventRestarted, Mode: ModeNotify, Restarts: r.restarts})
+	s.schedule(r, now, 0)
+}
+
+// stopAll reports every repo stopped when fsnotify itself goes away, unless
+// that is because Close was called.
+func (s *Shared) stopAll() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.repos {
+		s.q.push(Event{RepoPath: r.path, Type: EventStopped, Err: errWatcherStopped})
+	}
+}
+
+func (s *Shared) adder(r *sharedRepo) func(string) error {
+	return func(path string) error {
+		if err := s.w.Add(path); err != nil {
+			return err
+		}
+		r.dirs[path] = true
+		return nil
+	}
+}
+
+func (s *Shared) unwatch(r *sharedRepo) {
+	for dir := range r.dirs {
+		_ = s.w.Remove(dir)
+	}
+	r.dirs = make(map[string]bool)
+}
@@ -0,0 +1,290 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRepo lays out just enough of a git dir for ref watching, which is much
+// cheaper than git init when hundreds of repos are needed.
+func fakeRepo(tb testing.TB, root string, i int) string {
+	tb.Helper()
+	dir := filepath.Join(root, fmt.Sprintf("repo%03d", i))
+	gitDir := filepath.Join(dir, ".git")
+	for _, d := range []string{"refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, d), 0755); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+func writeRef(tb testing.TB, repo, name, hash string) {
+	tb.Helper()
+	path := filepath.Join(repo, ".git", "refs", "heads", name)
+	if err := os.WriteFile(path, []byte(hash+"\n"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func newTestShared(t *testing.T) *Shared {
+	t.Helper()
+	s, err := NewShared(Options{Debounce: 30 * time.Millisecond}, fastBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// openFDs counts this process's open file descriptors, or -1 where /proc
+// isn't available.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func TestSharedRoutesByRepo(t *testing.T) {
+	root := t.TempDir()
+	s := newTestShared(t)
+	var repos []string
+	for i := range 3 {
+		repos = append(repos, fakeRepo(t, root, i))
+		if err := s.Add(repos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeRef(t, repos[1], "feature", strings.Repeat("a", 40))
+	ev := waitEvent(t, s.Events())
+	if ev.RepoPath != repos[1] {
+		t.Fatalf("event routed to %q, want %q", ev.RepoPath, repos[1])
+	}
+	if len(ev.Changes) != 1 || ev.Changes[0].Ref != "refs/heads/feature" || ev.Changes[0].Kind != RefCreated {
+		t.Errorf("changes = %+v", ev.Changes)
+	}
+}
+
+func TestSharedDebouncesPerRepo(t *testing.T) {
+	root := t.TempDir()
+	s := newTestShared(t)
+	a, b := fakeRepo(t, root, 0), fakeRepo(t, root, 1)
+	s.Add(a)
+	s.Add(b)
+
+	writeRef(t, a, "one", strings.Repeat("a", 40))
+	writeRef(t, b, "two", strings.Repeat("b", 40))
+	writeRef(t, a, "three", strings.Repeat("c", 40))
+
+	got := map[string][]string{}
+	for range 2 {
+		ev := waitEvent(t, s.Events())
+		for _, c := range ev.Changes {
+			got[ev.RepoPath] = append(got[ev.RepoPath], c.Ref)
+		}
+	}
+	if len(got[a]) != 2 || len(got[b]) != 1 || got[b][0] != "refs/heads/two" {
+		t.Errorf("changes by repo = %v", got)
+	}
+}
+
+func TestSharedRemove(t *testing.T) {
+	root := t.TempDir()
+	s := newTestShared(t)
+	a, b := fakeRepo(t, root, 0), fakeRepo(t, root, 1)
+	s.Add(a)
+	s.Add(b)
+	s.Remove(a)
+	if s.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", s.Len())
+	}
+
+	writeRef(t, a, "ignored", strings.Repeat("a", 40))
+	writeRef(t, b, "seen", strings.Repeat("b", 40))
+	ev := waitEvent(t, s.Events())
+	if ev.RepoPath != b {
+		t.Errorf("event for removed repo %q", ev.RepoPath)
+	}
+	select {
+	case ev := <-s.Events():
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestSharedRestartsRemovedGitDir(t *testing.T) {
+	root := t.TempDir()
+	s := newTestShared(t)
+	repo := fakeRepo(t, root, 0)
+	if err := s.Add(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	gitDir := filepath.Join(repo, ".git")
+	moved := filepath.Join(root, "moved.git")
+	if err := os.Rename(gitDir, moved); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitEvent(t, s.Events()); ev.Type != EventStopped {
+		t.Fatalf("got %+v, want stopped", ev)
+	}
+
+	os.WriteFile(filepath.Join(moved, "refs", "heads", "offline"), []byte(strings.Repeat("d", 40)+"\n"), 0644)
+	if err := os.Rename(moved, gitDir); err != nil {
+		t.Fatal(err)
+	}
+
+	var restarted bool
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-s.Events():
+			switch ev.Type {
+			case EventRestarted:
+				restarted = true
+			case EventChange:
+				if !restarted {
+					t.Fatal("change delivered before restart")
+				}
+				for _, c := range ev.Changes {
+					if c.Ref == "refs/heads/offline" {
+						return
+					}
+				}
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for the ref written while stopped")
+		}
+	}
+}
+
+func TestSharedResourceUsageIsFlat(t *testing.T) {
+	if openFDs() < 0 {
+		t.Skip("no /proc/self/fd")
+	}
+	root := t.TempDir()
+	repos := make([]string, 200)
+	for i := range repos {
+		repos[i] = fakeRepo(t, root, i)
+	}
+
+	fds, goroutines := openFDs(), runtime.NumGoroutine()
+	s := newTestShared(t)
+	for _, r := range repos {
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := openFDs() - fds; d > 4 {
+		t.Errorf("%d repos opened %d file descriptors", len(repos), d)
+	}
+	if d := runtime.NumGoroutine() - goroutines; d > 4 {
+		t.Errorf("%d repos started %d goroutines", len(repos), d)
+	}
+}
+
+func benchRepos(b *testing.B, n int) []string {
+	b.Helper()
+	root := b.TempDir()
+	repos := make([]string, n)
+	for i := range repos {
+		repos[i] = fakeRepo(b, root, i)
+	}
+	return repos
+}
+
+// BenchmarkSharedAdd500 measures arming 500 repos and reports the resources
+// held afterwards.
+func BenchmarkSharedAdd500(b *testing.B) {
+	repos := benchRepos(b, 500)
+	fds, goroutines := openFDs(), runtime.NumGoroutine()
+
+	for b.Loop() {
+		s, err := NewShared(Options{Debounce: time.Millisecond}, DefaultBackoff)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, r := range repos {
+			if err := s.Add(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(openFDs()-fds), "fds")
+		b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+		s.Close()
+		b.StartTimer()
+	}
+}
+
+// BenchmarkSharedEvent500 measures the latency from a ref write to its event
+// with 500 repos watched, rotating through all of them.
+func BenchmarkSharedEvent500(b *testing.B) {
+	repos := benchRepos(b, 500)
+	fds, goroutines := openFDs(), runtime.NumGoroutine()
+
+	s, err := NewShared(Options{Debounce: time.Millisecond}, DefaultBackoff)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	for _, r := range repos {
+		if err := s.Add(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	i := 0
+	for b.Loop() {
+		repo := repos[i%len(repos)]
+		writeRef(b, repo, fmt.Sprintf("b%d", i), fmt.Sprintf("%040x", i+1))
+		for ev := range s.Events() {
+			if ev.RepoPath == repo && ev.Type == EventChange {
+				break
+			}
+		}
+		i++
+	}
+	b.ReportMetric(float64(openFDs()-fds), "fds")
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+}
+
+// BenchmarkWatchPerRepo500 is the baseline: one fsnotify instance per repo.
+// It usually stops early at the inotify instance limit, which is the point.
+func BenchmarkWatchPerRepo500(b *testing.B) {
+	repos := benchRepos(b, 500)
+	fds, goroutines := openFDs(), runtime.NumGoroutine()
+
+	for b.Loop() {
+		var stops []func()
+		for _, r := range repos {
+			_, stop, err := Watch(r, Options{Debounce: time.Millisecond})
+			if err != nil {
+				for _, stop := range stops {
+					stop()
+				}
+				b.Skipf("per-repo watchers failed after %d repos: %v", len(stops), err)
+			}
+			stops = append(stops, stop)
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(openFDs()-fds), "fds")
+		b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+		for _, stop := range stops {
+			stop()
+		}
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"errors"
+	"time"
+)
+
+type Mode int
+
+const (
+	ModeNotify Mode = iota
+	ModePoll
+	ModeHook
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModePoll:
+		return "poll"
+	case ModeHook:
+		return "hook"
+	default:
+		return "notify"
+	}
+}
+
+type Options struct {
+	Debounce     time.Duration
+	MaxLatency   time.Duration
+	PollInterval time.Duration
+	ForcePoll    bool
+}
+
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+var DefaultBackoff = Backoff{Min: 500 * time.Millisecond, Max: 30 * time.Second}
+
+var errWatcherStopped = errors.New("watcher stopped")
+
+type startFunc func() (<-chan Event, func(), Mode, error)
+
+// Start prefers fsnotify and falls back to polling when the watcher can't be
+// set up, e.g. inotify limits or a network filesystem.
+func Start(repoPath string, opts Options) (<-chan Event, func(), Mode, error) {
+	if !opts.ForcePoll {
+		ch, stop, err := Watch(repoPath, opts)
+		if err == nil {
+			return ch, stop, ModeNotify, nil
+		}
+	}
+	ch, stop, err := Poll(repoPath, opts.PollInterval)
+	if err != nil {
+		return nil, nil, ModePoll, err
+	}
+	return ch, stop, ModePoll, nil
+}
+
+// Supervise starts a watcher for repoPath and restarts it with exponential
+// backoff whenever its event channel closes. Failures are reported as
+// EventStopped and EventError, recoveries as EventRestarted.
+func Supervise(repoPath string, opts Options, b Backoff) (<-chan Event, func(), Mode, error) {
+	return supervise(repoPath, func() (<-chan Event, func(), Mode, error) {
+		return Start(repoPath, opts)
+	}, b)
+}
+
+func supervise(repoPath string, start startFunc, b Backoff) (<-chan Event, func(), Mode, error) {
+	in, stop, mode, err := start()
+	if err != nil {
+		return nil, nil, mode, err
+	}
+
+	out := make(chan Event, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(out)
+
+		emit := func(ev Event) bool {
+			ev.RepoPath = repoPath
+			select {
+			case out <- ev:
+				return true
+			case <-done:
+				return false
+			}
+		}
+
+		delay := b.Min
+		restarts := 0
+		for {
+			started := time.Now()
+			if !forward(in, emit, done) {
+				stop()
+				return
+			}
+			stop()
+			if time.Since(started) > b.Max {
+				delay = b.Min
+			}
+			if !emit(Event{Type: EventStopped, Err: errWatcherStopped}) {
+				return
+			}
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(delay):
+				}
+				delay = min(delay*2, b.Max)
+
+				ch, st, md, err := start()
+				if err != nil {
+					if !emit(Event{Type: EventError, Err: err}) {
+						return
+					}
+					continue
+				}
+				restarts++
+				in, stop = ch, st
+				if !emit(Event{Type: EventRestarted, Mode: md, Restarts: restarts}) {
+					stop()
+					return
+				}
+				break
+			}
+		}
+	}()
+
+	cleanup := func() {
+		close(done)
+	}
+
+	return out, cleanup, mode, nil
+}
+
+// forward copies events until in closes. It returns false if the consumer
+// went away first.
+func forward(in <-chan Event, emit func(Event) bool, done <-chan struct{}) bool {
+	for {
+		select {
+		case <-done:
+			return false
+		case ev, ok := <-in:
+			if !ok {
+				return true
+			}
+			if !emit(ev) {
+				return false
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	mu    sync.Mutex
+	chans []chan Event
+	fails int
+}
+
+func (f *fakeSource) start() (<-chan Event, func(), Mode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails > 0 {
+		f.fails--
+		return nil, nil, ModeNotify, errors.New("boom")
+	}
+	ch := make(chan Event, 1)
+	f.chans = append(f.chans, ch)
+	return ch, func() {}, ModeNotify, nil
+}
+
+func (f *fakeSource) current() chan Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.chans[len(f.chans)-1]
+}
+
+var fastBackoff = Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond}
+
+func TestSuperviseForwardsEvents(t *testing.T) {
+	src := &fakeSource{}
+	out, stop, _, err := supervise("/repo", src.start, fastBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	src.current() <- Event{}
+	ev := waitEvent(t, out)
+	if ev.Type != EventChange || ev.RepoPath != "/repo" {
+		t.Errorf("got %+v", ev)
+	}
+}
+
+func TestSuperviseRestartsClosedWatcher(t *testing.T) {
+	src := &fakeSource{}
+	out, stop, _, err := supervise("/repo", src.start, fastBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	src.mu.Lock()
+	src.fails = 2
+	src.mu.Unlock()
+	close(src.current())
+
+	want := []EventType{EventStopped, EventError, EventError, EventRestarted}
+	for i, typ := range want {
+		ev := waitEvent(t, out)
+		if ev.Type != typ {
+			t.Fatalf("event %d type = %d, want %d", i, ev.Type, typ)
+		}
+		if typ == EventRestarted && ev.Restarts != 1 {
+			t.Errorf("restarts = %d, want 1", ev.Restarts)
+		}
+	}
+
+	src.current() <- Event{}
+	if ev := waitEvent(t, out); ev.Type != EventChange {
+		t.Errorf("after restart type = %d, want EventChange", ev.Type)
+	}
+}
+
+func TestSuperviseInitialFailure(t *testing.T) {
+	src := &fakeSource{fails: 1}
+	if _, _, _, err := supervise("/repo", src.start, fastBackoff); err == nil {
+		t.Fatal("expected initial start error")
+	}
+}
+
+func TestSuperviseStopClosesOutput(t *testing.T) {
+	src := &fakeSource{}
+	out, stop, _, err := supervise("/repo", src.start, fastBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Error("expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output not closed after stop")
+	}
+}
+
+func TestStartForcePoll(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	_, stop, mode, err := Start(dir, Options{Debounce: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond, ForcePoll: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if mode != ModePoll {
+		t.Errorf("mode = %v, want poll", mode)
+	}
+}
+
+func TestWatchReportsGitDirRemoval(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	os.RemoveAll(filepath.Join(dir, ".git"))
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatal("channel closed without error event")
+			}
+			if ev.Type == EventError {
+				return
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for error event")
+		}
+	}
+}
@@ -1,67 +1,107 @@
 package watcher
 
 import (
+	"errors"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+type EventType int
+
+const (
+	EventChange EventType = iota
+	EventError
+	EventStopped
+	EventRestarted
+)
+
 type Event struct {
 	RepoPath string
+	Type     EventType
+	Err      error
+	Mode     Mode
+	Restarts int
+	Changes  []RefChange
+	Rewrites []Rewrite
+	Rescan   bool
 }
 
-func Watch(repoPath string, debounce time.Duration) (<-chan Event, func(), error) {
+var errGitDirRemoved = errors.New("git dir removed")
+
+// Watch debounces ref activity and reports the net ref changes since the last
+// delivered event. A change is never dropped: while the consumer is busy the
+// pending event keeps absorbing new activity. MaxLatency caps how long a
+// continuous stream of writes can postpone delivery.
+func Watch(repoPath string, opts Options) (<-chan Event, func(), error) {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	refsPath := filepath.Join(repoPath, ".git", "refs")
-	headPath := filepath.Join(repoPath, ".git")
-
-	if err := w.Add(refsPath); err != nil {
+	rs := newRepoState(repoPath)
+	if err := rs.start(w.Add); err != nil {
 		w.Close()
 		return nil, nil, err
 	}
-	headsPath := filepath.Join(refsPath, "heads")
-	_ = w.Add(headsPath)
-	_ = w.Add(headPath)
 
-	ch := make(chan Event, 1)
+	ch := make(chan Event)
 	done := make(chan struct{})
 
 	go func() {
 		defer close(ch)
-		var timer *time.Timer
+		timer := time.NewTimer(opts.Debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		var out chan<- Event
+		var pending Event
+		var pendingTips map[string]string
+
+		send := func(ev Event) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-done:
+				return false
+			}
+		}
 
 		for {
 			select {
 			case <-done:
-				if timer != nil {
-					timer.Stop()
-				}
 				return
+			case <-timer.C:
+				pending, pendingTips = rs.fire()
+				out = ch
+			case out <- pending:
+				if pendingTips != nil {
+					rs.last = pendingTips
+				}
+				out = nil
 			case ev, ok := <-w.Events:
 				if !ok {
 					return
 				}
-				if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
-					continue
+				changed, err := rs.handle(ev, w.Add)
+				if err != nil {
+					send(Event{RepoPath: repoPath, Type: EventError, Err: err})
+					return
 				}
-				if timer != nil {
-					timer.Stop()
+				if changed {
+					timer.Reset(rs.arm(time.Now(), opts))
 				}
-				timer = time.AfterFunc(debounce, func() {
-					select {
-					case ch <- Event{RepoPath: repoPath}:
-					default:
-					}
-				})
-			case _, ok := <-w.Errors:
+			case err, ok := <-w.Errors:
 				if !ok {
 					return
 				}
+				if !send(Event{RepoPath: repoPath, Type: EventError, Err: err}) {
+					return
+				}
 			}
 		}
 	}()
@@ -73,3 +113,131 @@ func Watch(repoPath string, debounce time.Duration) (<-chan Event, func(), error
 
 	return ch, cleanup, nil
 }
+
+// repoState is the per-repo half of a watcher: which directories to watch,
+// the ref tips last reported and the current debounce burst.
+type repoState struct {
+	path       string
+	gitDir     string
+	refsPath   string
+	last       map[string]string
+	burstStart time.Time
+}
+
+func newRepoState(repoPath string) *repoState {
+	gitDir := filepath.Join(repoPath, ".git")
+	return &repoState{path: repoPath, gitDir: gitDir, refsPath: filepath.Join(gitDir, "refs")}
+}
+
+// start watches the git dir and refs tree, then records the current tips as
+// the baseline for the first diff.
+func (s *repoState) start(add func(string) error) error {
+	if err := add(s.gitDir); err != nil {
+		return err
+	}
+	if err := addTree(add, s.refsPath); err != nil {
+		return err
+	}
+	s.last, _ = readRefTips(s.gitDir)
+	return nil
+}
+
+// handle reports whether ev touches a ref. Newly created ref directories are
+// watched as they appear; losing the git dir itself is an error.
+func (s *repoState) handle(ev fsnotify.Event, add func(string) error) (bool, error) {
+	if ev.Name == s.gitDir && ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		return false, errGitDirRemoved
+	}
+	if ev.Op&fsnotify.Create != 0 && isRefsDir(s.refsPath, ev.Name) {
+		_ = addTree(add, ev.Name)
+	}
+	return isRefChange(s.gitDir, ev), nil
+}
+
+// arm extends the debounce burst and returns how long to wait before firing.
+func (s *repoState) arm(now time.Time, opts Options) time.Duration {
+	if s.burstStart.IsZero() {
+		s.burstStart = now
+	}
+	return debounceWait(now, s.burstStart, opts.Debounce, opts.MaxLatency)
+}
+
+// fire ends the burst and snapshots the refs. The returned tips become the
+// new baseline once the event has been handed off.
+func (s *repoState) fire() (Event, map[string]string) {
+	s.burstStart = time.Time{}
+	return snapshotEvent(s.path, s.gitDir, s.last)
+}
+
+// debounceWait returns how long to wait before firing, never pushing the
+// deadline past burstStart+maxLatency. A zero maxLatency disables the cap.
+func debounceWait(now, burstStart time.Time, debounce, maxLatency time.Duration) time.Duration {
+	if maxLatency <= 0 {
+		return debounce
+	}
+	remaining := burstStart.Add(maxLatency).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return min(debounce, remaining)
+}
+
+// snapshotEvent diffs the current ref tips against last. When the diff isn't
+// available, or only HEAD moved, the event asks for a rescan from HEAD.
+func snapshotEvent(repoPath, gitDir string, last map[string]string) (Event, map[string]string) {
+	ev := Event{RepoPath: repoPath}
+	tips, err := readRefTips(gitDir)
+	if err != nil {
+		ev.Rescan = true
+		return ev, nil
+	}
+	if last != nil {
+		ev.Changes = diffTips(repoPath, last, tips)
+	}
+	ev.Rescan = len(ev.Changes) == 0
+	return ev, tips
+}
+
+// addTree watches root and every directory below it. Directories created
+// between the walk and the watch being armed are picked up by the Create
+// event on their parent.
+func addTree(add func(string) error, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return add(path)
+	})
+}
+
+func isRefsDir(refsPath, name string) bool {
+	if name != refsPath && !strings.HasPrefix(name, refsPath+string(filepath.Separator)) {
+		return false
+	}
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+func isRefChange(gitDir string, ev fsnotify.Event) bool {
+	if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(gitDir, ev.Name)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasSuffix(rel, ".lock") {
+		return false
+	}
+	switch {
+	case rel == "HEAD", rel == "packed-refs":
+		return true
+	case rel == "refs", strings.HasPrefix(rel, "refs/"):
+		return true
+	}
+	return false
+}
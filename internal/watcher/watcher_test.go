@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -21,7 +22,7 @@ func setupWatcherRepo(t *testing.T) string {
 
 func TestWatchDetectsRefChange(t *testing.T) {
 	dir := setupWatcherRepo(t)
-	ch, cleanup, err := Watch(dir, 50*time.Millisecond)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,9 +44,243 @@ func TestWatchDetectsRefChange(t *testing.T) {
 
 func TestWatchCleanup(t *testing.T) {
 	dir := setupWatcherRepo(t)
-	_, cleanup, err := Watch(dir, 50*time.Millisecond)
+	_, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
 	if err != nil {
 		t.Fatal(err)
 	}
 	cleanup()
 }
+
+func waitEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return Event{}
+}
+
+func TestWatchNestedBranch(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	nested := filepath.Join(dir, ".git", "refs", "heads", "feature", "deep")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, ch)
+
+	os.WriteFile(filepath.Join(nested, "foo"), []byte("abc123\n"), 0644)
+	waitEvent(t, ch)
+}
+
+func TestWatchPackedRefs(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(dir, ".git", "packed-refs"), []byte("abc123 refs/heads/main\n"), 0644)
+	waitEvent(t, ch)
+}
+
+func TestWatchIgnoresUnrelatedFiles(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(dir, ".git", "index"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, ".git", "refs", "heads", "main.lock"), []byte("x"), 0644)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected event for non-ref file")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchRearmsRecreatedDir(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	feature := filepath.Join(dir, ".git", "refs", "heads", "feature")
+	os.MkdirAll(feature, 0755)
+	waitEvent(t, ch)
+
+	os.RemoveAll(feature)
+	waitEvent(t, ch)
+
+	os.MkdirAll(feature, 0755)
+	waitEvent(t, ch)
+
+	os.WriteFile(filepath.Join(feature, "bar"), []byte("abc123\n"), 0644)
+	waitEvent(t, ch)
+}
+
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@test.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s %v", args, out, err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestDiffTipsKinds(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	gitRun(t, dir, "checkout", "-b", "main")
+	gitRun(t, dir, "commit", "--allow-empty", "-m", "one")
+	one := gitRun(t, dir, "rev-parse", "HEAD")
+	gitRun(t, dir, "commit", "--allow-empty", "-m", "two")
+	two := gitRun(t, dir, "rev-parse", "HEAD")
+
+	prev := map[string]string{
+		"HEAD":               "ref: refs/heads/main",
+		"refs/heads/main":    one,
+		"refs/heads/rewrite": two,
+		"refs/heads/gone":    one,
+	}
+	cur := map[string]string{
+		"HEAD":               "ref: refs/heads/main",
+		"refs/heads/main":    two,
+		"refs/heads/rewrite": one,
+		"refs/heads/new":     two,
+	}
+
+	changes := diffTips(dir, prev, cur)
+	got := map[string]ChangeKind{}
+	for _, c := range changes {
+		got[c.Ref] = c.Kind
+	}
+	want := map[string]ChangeKind{
+		"refs/heads/main":    RefFastForward,
+		"refs/heads/rewrite": RefForceUpdate,
+		"refs/heads/gone":    RefDeleted,
+		"refs/heads/new":     RefCreated,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for ref, kind := range want {
+		if got[ref] != kind {
+			t.Errorf("%s kind = %v, want %v", ref, got[ref], kind)
+		}
+	}
+}
+
+func TestWatchReportsRefChanges(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	gitRun(t, dir, "checkout", "-b", "main")
+	gitRun(t, dir, "commit", "--allow-empty", "-m", "one")
+
+	ch, cleanup, err := Watch(dir, Options{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	gitRun(t, dir, "branch", "feature/x")
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			for _, c := range ev.Changes {
+				if c.Ref == "refs/heads/feature/x" && c.Kind == RefCreated {
+					return
+				}
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for branch creation")
+		}
+	}
+}
+
+func TestDebounceWait(t *testing.T) {
+	start := time.Now()
+	if got := debounceWait(start, start, 100*time.Millisecond, 0); got != 100*time.Millisecond {
+		t.Errorf("uncapped wait = %v", got)
+	}
+	if got := debounceWait(start.Add(950*time.Millisecond), start, 100*time.Millisecond, time.Second); got != 50*time.Millisecond {
+		t.Errorf("capped wait = %v, want 50ms", got)
+	}
+	if got := debounceWait(start.Add(2*time.Second), start, 100*time.Millisecond, time.Second); got != 0 {
+		t.Errorf("overdue wait = %v, want 0", got)
+	}
+}
+
+func TestWatchMaxLatency(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 200 * time.Millisecond, MaxLatency: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ref := filepath.Join(dir, ".git", "refs", "heads", "busy")
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				os.WriteFile(ref, []byte(strings.Repeat("a", 40)+"\n"), 0644)
+			}
+		}
+	}()
+
+	select {
+	case <-ch:
+	case <-time.After(1500 * time.Millisecond):
+		t.Fatal("continuous writes postponed the event past max latency")
+	}
+}
+
+func TestWatchHoldsChangesForBusyConsumer(t *testing.T) {
+	dir := setupWatcherRepo(t)
+	ch, cleanup, err := Watch(dir, Options{Debounce: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	heads := filepath.Join(dir, ".git", "refs", "heads")
+	os.WriteFile(filepath.Join(heads, "one"), []byte(strings.Repeat("a", 40)+"\n"), 0644)
+	time.Sleep(100 * time.Millisecond)
+	os.WriteFile(filepath.Join(heads, "two"), []byte(strings.Repeat("b", 40)+"\n"), 0644)
+	time.Sleep(100 * time.Millisecond)
+
+	ev := waitEvent(t, ch)
+	refs := map[string]bool{}
+	for _, c := range ev.Changes {
+		refs[c.Ref] = true
+	}
+	if !refs["refs/heads/one"] || !refs["refs/heads/two"] {
+		t.Errorf("changes = %+v, want both refs in one event", ev.Changes)
+	}
+}
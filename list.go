@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/walter/apollo/internal/db"
+)
+
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var repos repoFlags
+	fs.Var(&repos, "repo", "only list commits from this repo path (repeatable)")
+	status := fs.String("status", "", "only list commits with this status: unreviewed, reviewed or ignored")
+	author := fs.String("author", "", "only list commits whose author contains this")
+	branch := fs.String("branch", "", "only list commits detected on this branch")
+	since := fs.String("since", "", "only list commits made on or after this date or span (2024-01-01, 30d)")
+	until := fs.String("until", "", "only list commits made before this date")
+	label := fs.String("label", "", "only list commits with this label")
+	path := fs.String("path", "", "only list commits touching this file or directory")
+	sortKey := fs.String("sort", "committed", "order by committed, detected, reviewed or author")
+	asc := fs.Bool("asc", false, "oldest (or A to Z) first")
+	limit := fs.Int("n", 50, "list at most this many commits")
+	after := fs.String("after", "", "continue from the cursor printed by the previous page")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apollo list [flags] [text]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	q := db.CommitQuery{
+		Status: db.ReviewFilter(*status), Author: *author, Branch: *branch, Path: *path,
+		Text: strings.Join(fs.Args(), " "), Sort: db.SortKey(*sortKey), Asc: *asc,
+		Limit: *limit, After: *after,
+	}
+	switch q.Status {
+	case "", db.FilterUnreviewed, db.FilterReviewed, db.FilterIgnored:
+	default:
+		fmt.Fprintf(os.Stderr, "list: unknown status %q\n", *status)
+		return 2
+	}
+	var err error
+	if q.Since, err = parseWhen(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "list: -since: %v\n", err)
+		return 2
+	}
+	if q.Until, err = parseWhen(*until); err != nil {
+		fmt.Fprintf(os.Stderr, "list: -until: %v\n", err)
+		return 2
+	}
+
+	_, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	for _, p := range repos {
+		r, err := db.GetRepoByPath(database, p)
+		if err != nil || r == nil {
+			fmt.Fprintf(os.Stderr, "list: %s is not tracked\n", p)
+			return 1
+		}
+		q.RepoIDs = append(q.RepoIDs, r.ID)
+	}
+	if *label != "" {
+		labels, err := db.ListLabels(database)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list: %v\n", err)
+			return 1
+		}
+		for _, l := range labels {
+			if strings.EqualFold(l.Name, *label) {
+				q.Label = l.ID
+			}
+		}
+		if q.Label == 0 {
+			fmt.Fprintf(os.Stderr, "list: no label %q\n", *label)
+			return 1
+		}
+	}
+
+	commits, err := db.QueryCommits(database, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list: %v\n", err)
+		return 1
+	}
+	for _, c := range commits {
+		fmt.Printf("%s  %-10s  %-10s  %s  %-16s  %s\n", c.Hash[:min(7, len(c.Hash))], c.Status,
+			c.RepoName, c.CommittedAt.Format("2006-01-02"), c.Author, c.Subject)
+	}
+	if *limit > 0 && len(commits) == *limit {
+		fmt.Fprintf(os.Stderr, "more: -after %s\n", commits[len(commits)-1].Cursor)
+	}
+	return 0
+}
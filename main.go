@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/walter/apollo/internal/config"
@@ -12,43 +13,130 @@ import (
 )
 
 func main() {
+	profile, args, err := splitProfile(os.Args[1:])
+	if err == nil {
+		err = config.SetProfile(profile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "apollo: %v\n", err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "hooks":
+			os.Exit(runHooks(args[1:]))
+		case "gc":
+			os.Exit(runGC(args[1:]))
+		case "archive":
+			os.Exit(runArchive(args[1:]))
+		case "backup":
+			os.Exit(runBackup(args[1:]))
+		case "restore":
+			os.Exit(runRestore(args[1:]))
+		case "export":
+			os.Exit(runExport(args[1:]))
+		case "import":
+			os.Exit(runImport(args[1:]))
+		case "list":
+			os.Exit(runList(args[1:]))
+		case "stats":
+			os.Exit(runStats(args[1:]))
+		}
+	}
+
+	// Switching profiles from the TUI ends the session; the next one starts
+	// from scratch under the new profile. Repos given on the command line
+	// belong to the profile they were given for.
+	for {
+		next, code := runTUI(args)
+		if code != 0 {
+			os.Exit(code)
+		}
+		if next == "" {
+			return
+		}
+		if err := config.SetProfile(next); err != nil {
+			fmt.Fprintf(os.Stderr, "apollo: %v\n", err)
+			os.Exit(2)
+		}
+		args = nil
+	}
+}
+
+// splitProfile takes a leading --profile flag off args, in any of the forms
+// the flag package accepts. Without one the profile comes from
+// APOLLO_PROFILE.
+func splitProfile(args []string) (string, []string, error) {
+	profile := os.Getenv("APOLLO_PROFILE")
+	if len(args) == 0 {
+		return profile, args, nil
+	}
+	name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+	if !strings.HasPrefix(args[0], "-") || name != "profile" {
+		return profile, args, nil
+	}
+	if hasValue {
+		return value, args[1:], nil
+	}
+	if len(args) < 2 {
+		return "", nil, fmt.Errorf("--profile needs a name")
+	}
+	return args[1], args[2:], nil
+}
+
+// runTUI runs one session of the board under the active profile. It returns
+// the profile the user switched to, if any, and the exit code.
+func runTUI(repoArgs []string) (string, int) {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "config: %v\n", err)
-		os.Exit(1)
+		return "", 1
 	}
 
-	for _, arg := range os.Args[1:] {
+	for _, arg := range repoArgs {
 		cfg.RepoPaths = append(cfg.RepoPaths, arg)
 	}
 
-	if len(cfg.ResolvedPaths()) == 0 {
+	if len(cfg.ResolvedPaths()) == 0 && len(cfg.ResolvedScanRoots()) == 0 {
 		cwd, err := os.Getwd()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "getwd: %v\n", err)
-			os.Exit(1)
+			return "", 1
 		}
 		cfg.RepoPaths = append(cfg.RepoPaths, cwd)
 	}
 
 	if err := os.MkdirAll(config.ApolloDir(), 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "mkdir: %v\n", err)
-		os.Exit(1)
+		return "", 1
 	}
 
 	database, err := db.Open(config.DBPath())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "db: %v\n", err)
-		os.Exit(1)
+		return "", 1
 	}
 	defer database.Close()
 
+	if r, err := db.Repair(database); err != nil {
+		fmt.Fprintf(os.Stderr, "db: consistency check: %v\n", err)
+		return "", 1
+	} else if r.Total() > 0 {
+		fmt.Fprintf(os.Stderr, "db: repaired %s\n", r)
+	}
+
 	n := notifier.New()
-	model := tui.NewModel(cfg, database, n)
+	model := tui.NewModel(cfg, db.NewSQLStore(database), n)
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "apollo: %v\n", err)
-		os.Exit(1)
+		return "", 1
+	}
+	if m, ok := final.(tui.Model); ok {
+		return m.SwitchProfile(), 0
 	}
+	return "", 0
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/walter/apollo/internal/db"
+)
+
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	var repos repoFlags
+	fs.Var(&repos, "repo", "only report on this repo path (repeatable)")
+	since := fs.String("since", "30d", "report reviews from this date or span on (2024-01-01, 30d)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apollo stats [-since 30d] [-repo path]...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	from, err := parseWhen(*since)
+	if err == nil && from.IsZero() {
+		err = fmt.Errorf("a start is required")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats: -since: %v\n", err)
+		return 2
+	}
+
+	_, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	var repoIDs []int64
+	for _, p := range repos {
+		r, err := db.GetRepoByPath(database, p)
+		if err != nil || r == nil {
+			fmt.Fprintf(os.Stderr, "stats: %s is not tracked\n", p)
+			return 1
+		}
+		repoIDs = append(repoIDs, r.ID)
+	}
+
+	now := time.Now()
+	// Today's counts go into the trend even if the TUI hasn't run today.
+	if err := db.SnapshotStats(database, now); err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	m, err := db.GetMetrics(database, repoIDs, from, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	reviewers, err := db.GetReviewerStats(database, repoIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("since %s\n\n", from.Format("2006-01-02"))
+	fmt.Printf("reviews         %d (%.1f/day)\n", m.TimeToReview.Count, m.ReviewsPerDayAvg(now))
+	if m.TimeToReview.Count > 0 {
+		t := m.TimeToReview
+		fmt.Printf("time to review  p50 %s  p90 %s  p99 %s\n", formatAge(t.P50), formatAge(t.P90), formatAge(t.P99))
+	}
+	if n := len(m.Snapshots); n > 0 {
+		first, last := m.Snapshots[0], m.Snapshots[n-1]
+		fmt.Printf("backlog trend   %d on %s -> %d on %s (%+d)\n",
+			first.Unreviewed, first.Day, last.Unreviewed, last.Day, last.Unreviewed-first.Unreviewed)
+	}
+
+	fmt.Println("\nbacklog age")
+	for _, b := range m.Backlog {
+		fmt.Printf("  %-10s %d\n", b.Label, b.Count)
+	}
+
+	if len(m.Oldest) > 0 {
+		fmt.Println("\noldest unreviewed")
+		for _, o := range m.Oldest {
+			fmt.Printf("  %-16s %s  %-8s %s  (%d waiting)\n", o.RepoName, o.Hash[:min(7, len(o.Hash))],
+				formatAge(now.Sub(o.DetectedAt)), o.Subject, o.Unreviewed)
+		}
+	}
+
+	if len(reviewers) > 0 {
+		fmt.Println("\nreviewers")
+		for _, r := range reviewers {
+			name := r.Reviewer
+			if name == "" {
+				name = "(unknown)"
+			}
+			fmt.Printf("  %-32s %d reviewed, %d ignored\n", name, r.Reviewed, r.Ignored)
+		}
+	}
+	return 0
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%.1fh", d.Hours())
+	default:
+		return fmt.Sprintf("%.1fd", d.Hours()/24)
+	}
+}
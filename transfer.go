@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walter/apollo/internal/config"
+	"github.com/walter/apollo/internal/db"
+)
+
+// repoFlags collects repeated -repo flags as absolute paths.
+type repoFlags []string
+
+func (r *repoFlags) String() string { return strings.Join(*r, ",") }
+
+func (r *repoFlags) Set(v string) error {
+	abs, err := filepath.Abs(config.ExpandHome(v))
+	if err != nil {
+		return err
+	}
+	*r = append(*r, abs)
+	return nil
+}
+
+// parseWhen reads a date (2006-01-02), an RFC 3339 time, or a span back
+// from now such as 30d or 12h.
+func parseWhen(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") {
+		return time.Now().AddDate(0, 0, -n), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q, want 2006-01-02, RFC 3339 or a span like 30d", s)
+}
+
+// formatFor picks the format from an explicit flag, else from the file
+// extension, else JSON.
+func formatFor(flagValue, path string) (string, error) {
+	format := flagValue
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("unknown format %q, want json or csv", format)
+	}
+	return format, nil
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var repos repoFlags
+	fs.Var(&repos, "repo", "only export this repo path (repeatable)")
+	status := fs.String("status", "", "only export commits with this status: unreviewed, reviewed or ignored")
+	since := fs.String("since", "", "only export commits made on or after this date or span (2024-01-01, 90d)")
+	until := fs.String("until", "", "only export commits made before this date")
+	format := fs.String("format", "", "json or csv (default: from -o, else json)")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := db.ExportFilter{RepoPaths: repos, Status: db.ReviewFilter(*status)}
+	switch filter.Status {
+	case "", db.FilterUnreviewed, db.FilterReviewed, db.FilterIgnored:
+	default:
+		fmt.Fprintf(os.Stderr, "export: unknown status %q\n", *status)
+		return 2
+	}
+	var err error
+	if filter.Since, err = parseWhen(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "export: -since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseWhen(*until); err != nil {
+		fmt.Fprintf(os.Stderr, "export: -until: %v\n", err)
+		return 2
+	}
+	f, err := formatFor(*format, *out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 2
+	}
+
+	_, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	data, err := db.ExportData(database, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if f == "csv" {
+		err = db.WriteCSV(&buf, data)
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(data)
+	}
+	if err == nil {
+		if *out == "" {
+			_, err = os.Stdout.Write(buf.Bytes())
+		} else {
+			err = os.WriteFile(config.ExpandHome(*out), buf.Bytes(), 0600)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv (default: from the file name, else json)")
+	merge := fs.String("merge", string(db.MergeFill), "for commits already here: fill (only untouched ones), ours (keep local) or theirs (take imported)")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apollo import [-format json|csv] [-merge fill|ours|theirs] [-dry-run] <file|->")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	src := fs.Arg(0)
+	f, err := formatFor(*format, src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 2
+	}
+	var in io.Reader = os.Stdin
+	if src != "-" {
+		file, err := os.Open(config.ExpandHome(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "import: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var data db.Export
+	if f == "csv" {
+		data, err = db.ReadCSV(in)
+	} else {
+		err = json.NewDecoder(in).Decode(&data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: read %s: %v\n", src, err)
+		return 1
+	}
+
+	_, database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	res, err := db.ImportData(database, data, db.ImportOptions{
+		Policy: db.MergePolicy(*merge), Source: filepath.Base(src), DryRun: *dryRun,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	prefix := ""
+	if *dryRun {
+		prefix = "dry run: "
+	}
+	fmt.Printf("%s%d commits added, %d updated, %d unchanged, %d archived here; %d new repos\n",
+		prefix, res.Added, res.Updated, res.Unchanged, res.Archived, res.Repos)
+	return 0
+}